@@ -3,46 +3,214 @@ package main
 import (
 	"context"
 	"errors"
+	"flag"
+	"fmt"
 	"github.com/Ki4EH/stunning-octo-waddle/internal/api"
 	"github.com/Ki4EH/stunning-octo-waddle/internal/config"
 	"github.com/Ki4EH/stunning-octo-waddle/internal/db"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/memory"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/models"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/repository"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/events"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/health"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/idempotency"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/jobs"
 	"github.com/Ki4EH/stunning-octo-waddle/internal/logger"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/metrics"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/migrate"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/ratelimit"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/tracing"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/utils"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/webhooks"
+	"github.com/Ki4EH/stunning-octo-waddle/migrations"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
 	"go.uber.org/zap"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 )
 
 func main() {
-	cfg, err := config.LoadConfig()
+	sources := config.Sources{Overrides: make(map[string]string)}
+	flag.StringVar(&sources.File, "config", os.Getenv("CONFIG_FILE"), "YAML-файл конфигурации, по умолчанию из CONFIG_FILE")
+	flag.Func("storage", "хранилище: postgres или memory, по умолчанию из STORAGE", override(sources.Overrides, "STORAGE"))
+	flag.Func("log-level", "уровень логов, по умолчанию из LOG_LEVEL", override(sources.Overrides, "LOG_LEVEL"))
+	flag.Func("set", "любая настройка в виде NAME=value, например -set SERVER_PORT=9090", func(s string) error {
+		name, value, ok := strings.Cut(s, "=")
+		if !ok {
+			return fmt.Errorf("expected NAME=value, got %q", s)
+		}
+		sources.Overrides[name] = value
+		return nil
+	})
+	flag.Parse()
+
+	// Подкоманда migrate выполняется вместо запуска сервера, ей нужны только
+	// настройки базы
+	runMigrations := flag.NArg() > 0 && flag.Arg(0) == "migrate"
+	sources.Migrate = runMigrations
+
+	cfg, err := config.Load(sources)
 	if err != nil {
-		panic("failed to load config: " + err.Error())
+		fmt.Fprintf(os.Stderr, "invalid config:\n%v\n", err)
+		os.Exit(1)
 	}
+	settings := config.NewStore(cfg, func() (*config.Config, error) { return config.Load(sources) })
 
-	log, err := logger.NewZapLogger(cfg.Environment)
+	level := zap.NewAtomicLevelAt(cfg.Level())
+	log, err := logger.NewZapLogger(cfg.Environment, level)
 	if err != nil {
 		panic("failed to create logger: " + err.Error())
 	}
+	logger.SetDefault(log)
+	settings.OnReload(func(cfg *config.Config) { level.SetLevel(cfg.Level()) })
 
-	database, err := db.NewPostgresDB(cfg)
+	utils.ConfigureTokens([]byte(cfg.JWTSecret), cfg.TokenTTL)
+
+	shutdownTracing, err := tracing.Init(context.Background(), cfg)
 	if err != nil {
-		panic("failed to create database connection: " + err.Error())
+		panic("failed to init tracing: " + err.Error())
+	}
+
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+
+	broker := events.NewBroker()
+	checker := health.NewChecker()
+
+	var database *pgxpool.Pool
+	var repos api.Repositories
+	if cfg.Storage == config.StorageMemory {
+		// События доставляются подписчикам напрямую, без LISTEN/NOTIFY
+		log.Warn("using in-memory storage, data will be lost on shutdown")
+		repos = api.NewMemoryRepositories(memory.NewStore(broker.Publish), cfg)
+	} else {
+		database, err = db.NewPostgresDB(cfg)
+		if err != nil {
+			log.Error("failed to connect to database", zap.Error(err))
+			os.Exit(1)
+		}
+
+		migrator, err := migrate.New(database, migrations.FS)
+		if err != nil {
+			panic("failed to load migrations: " + err.Error())
+		}
+
+		if runMigrations {
+			if err = runMigrate(context.Background(), migrator, flag.Args()[1:]); err != nil {
+				log.Error("migration failed", zap.Error(err))
+				os.Exit(1)
+			}
+			return
+		}
+
+		if cfg.AutoMigrate {
+			if err = migrator.Up(context.Background()); err != nil {
+				panic("failed to apply migrations: " + err.Error())
+			}
+		}
+
+		prometheus.MustRegister(metrics.NewPoolCollector(database))
+
+		var replicas *db.ReplicaSet
+		if len(cfg.DatabaseReplicaDSNs) > 0 {
+			pools, err := db.NewReplicaPools(cfg)
+			if err != nil {
+				panic("failed to connect to replicas: " + err.Error())
+			}
+			replicas = db.NewReplicaSet(pools, cfg.DatabaseReplicaMaxLag, cfg.ReadYourWritesWindow)
+			go replicas.Run(jobsCtx, cfg.DatabaseReplicaCheckInterval, log)
+			// Событие с другого экземпляра — запись в primary, которой на
+			// реплике может еще не быть
+			broker.Observe(events.Observer{
+				Event: func(event models.UserEvent) { replicas.Wrote(event.UserID) },
+				Reset: func() {},
+			})
+			defer replicas.Close()
+		}
+
+		catalog := repository.NewCatalog(database)
+		if err = catalog.Refresh(context.Background()); err != nil {
+			panic("failed to load catalog: " + err.Error())
+		}
+		// После переподключения каталог перечитывается: уведомление могло
+		// потеряться
+		refreshCatalog := func() {
+			if err := catalog.Refresh(jobsCtx); err != nil {
+				log.Error("failed to refresh catalog", zap.Error(err))
+			}
+		}
+		go events.Watch(jobsCtx, database, repository.CatalogChannel, log.With(zap.String("component", "catalog")),
+			refreshCatalog, func(string) { refreshCatalog() })
+
+		repos = api.NewRepositories(database, replicas, catalog, cfg)
+		if cfg.RateLimitShared {
+			rateLimits := ratelimit.NewPostgres(database)
+			repos.RateLimits = rateLimits
+			go jobs.RunRateLimitCleanup(jobsCtx, rateLimits, cfg.RateLimitCleanupInterval, log)
+		}
+		idempotencyKeys := idempotency.NewPostgres(database, cfg.IdempotencyTTL)
+		repos.Idempotency = idempotencyKeys
+		go jobs.RunIdempotencyCleanup(jobsCtx, idempotencyKeys, cfg.IdempotencyCleanupInterval, log)
+		go events.Listen(jobsCtx, database, broker, log)
+
+		checker.AddCheck("database", health.DatabaseCheck(database))
+		checker.AddCheck("pool", health.PoolCheck(database))
+		checker.AddCheck("migrations", health.MigrationsCheck(migrator))
 	}
 
+	go jobs.RunCoinExpiry(jobsCtx, repos.Coins, cfg.CoinExpiryInterval, log)
+	go jobs.RunHoldRelease(jobsCtx, repos.Coins, cfg.HoldReleaseInterval, log)
+	go jobs.RunEventCleanup(jobsCtx, repos.Events, cfg.EventsCleanupInterval, cfg.EventsRetention, log)
+	go jobs.RunOutboxCleanup(jobsCtx, repos.Webhooks, cfg.EventsCleanupInterval, cfg.WebhookRetention, log)
+
+	dispatcher := webhooks.NewDispatcher(repos.Webhooks, &http.Client{}, webhooks.Options{
+		Interval:    cfg.WebhookDispatchInterval,
+		Workers:     cfg.WebhookWorkers,
+		Timeout:     cfg.WebhookTimeout,
+		MaxAttempts: cfg.WebhookMaxAttempts,
+		BaseDelay:   cfg.WebhookRetryBaseDelay,
+		MaxDelay:    cfg.WebhookRetryMaxDelay,
+	}, log)
+	go dispatcher.Run(jobsCtx)
+
 	e := echo.New()
 
 	// Инициализируем пути для API
-	api.InitRoutes(e, database, &log)
+	if err = api.InitRoutes(e, repos, broker, &log, settings, checker); err != nil {
+		panic("failed to init routes: " + err.Error())
+	}
 
 	graceCh := make(chan os.Signal, 1)
 	signal.Notify(graceCh, syscall.SIGINT, syscall.SIGTERM)
 
+	// SIGHUP перечитывает конфигурацию без перезапуска
+	reloadCh := make(chan os.Signal, 1)
+	signal.Notify(reloadCh, syscall.SIGHUP)
+	go func() {
+		for range reloadCh {
+			applied, restart, err := settings.Reload()
+			if err != nil {
+				log.Error("config reload failed, keeping current config", zap.Error(err))
+				continue
+			}
+			if len(restart) > 0 {
+				log.Warn("changed settings require restart", zap.Strings("settings", restart))
+			}
+			log.Info("config reloaded", zap.Strings("applied", applied))
+		}
+	}()
+
 	go func() {
 		if err = e.Start(":" + cfg.ServerPort); err != nil && !errors.Is(err, http.ErrServerClosed) {
-			defer database.Close()
+			if database != nil {
+				defer database.Close()
+			}
 			log.Error("shutting down the server", zap.Error(err))
 			syscall.Exit(1)
 		}
@@ -50,6 +218,15 @@ func main() {
 
 	<-graceCh
 
+	// Сначала перестаем быть готовыми и ждем, пока балансировщик снимет трафик
+	checker.SetShuttingDown()
+	log.Info("draining before shutdown", zap.Duration("delay", cfg.ShutdownDrainDelay))
+	time.Sleep(cfg.ShutdownDrainDelay)
+
+	stopJobs()
+	// Открытые потоки событий иначе не дадут серверу остановиться
+	broker.Close()
+
 	// Graceful shutdown сервера
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -58,5 +235,17 @@ func main() {
 		log.Error("server forced to shutdown", zap.Error(err))
 	}
 
+	if err = shutdownTracing(ctx); err != nil {
+		log.Error("failed to flush traces", zap.Error(err))
+	}
+
 	log.Info("server exiting")
 }
+
+// override возвращает обработчик флага, который задаёт настройку name.
+func override(overrides map[string]string, name string) func(string) error {
+	return func(value string) error {
+		overrides[name] = value
+		return nil
+	}
+}
@@ -2,10 +2,14 @@ package e2e_test
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"github.com/Ki4EH/stunning-octo-waddle/internal/api/handler"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/api/problem"
 	"github.com/Ki4EH/stunning-octo-waddle/internal/db/repository"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/migrate"
 	"github.com/Ki4EH/stunning-octo-waddle/internal/utils"
+	"github.com/Ki4EH/stunning-octo-waddle/migrations"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -114,49 +118,13 @@ func setupPostgresContainer(ctx context.Context) (testcontainers.Container, *pgx
 	return container, dbPool, nil
 }
 
+// initTestDB накатывает на тестовую базу те же миграции, что и в проде
 func initTestDB(ctx context.Context) error {
-	_, err := testDB.Exec(ctx, `
-		CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
-        CREATE TABLE IF NOT EXISTS credentials (
-            id UUID PRIMARY KEY DEFAULT public.uuid_generate_v4() NOT NULL,
-            username TEXT UNIQUE NOT NULL,
-            password TEXT NOT NULL,
-            coin BIGINT DEFAULT 0
-        );
-        CREATE TABLE IF NOT EXISTS shops (
-            item TEXT PRIMARY KEY,
-            price BIGINT NOT NULL
-        );
-        CREATE TABLE IF NOT EXISTS user_items (
-            user_id UUID REFERENCES credentials(id),
-            type TEXT,
-            quantity INT,
-            PRIMARY KEY (user_id, type)
-        );
-		CREATE TABLE IF NOT EXISTS credentials (
-			id UUID PRIMARY KEY,
-			username TEXT UNIQUE NOT NULL,
-			password TEXT NOT NULL,
-			coin BIGINT DEFAULT 0
-		);
-		CREATE TABLE IF NOT EXISTS transactions (
-			id UUID PRIMARY KEY DEFAULT public.uuid_generate_v4() NOT NULL,
-			from_user UUID,
-			to_user UUID,
-			amount BIGINT NOT NULL
-		);
-		CREATE TABLE IF NOT EXISTS shops (
-			item TEXT PRIMARY KEY,
-			price BIGINT NOT NULL
-		);
-		CREATE TABLE IF NOT EXISTS user_items (
-			user_id UUID REFERENCES credentials(id),
-		type TEXT,
-		quantity INT,
-			PRIMARY KEY (user_id, type)
-	);
-`)
-	return err
+	migrator, err := migrate.New(testDB, migrations.FS)
+	if err != nil {
+		return err
+	}
+	return migrator.Up(ctx)
 }
 
 func setupCoinTest(t *testing.T) (context.Context, *handler.CoinHandler) {
@@ -175,7 +143,7 @@ func setupCoinTest(t *testing.T) (context.Context, *handler.CoinHandler) {
     `)
 	require.NoError(t, err)
 
-	repo := repository.NewCoinRepository(testDB)
+	repo := repository.NewCoinRepository(testDB, repository.CoinOptions{})
 	handlerCoin := handler.NewCoinHandler(repo)
 
 	return ctx, handlerCoin
@@ -203,6 +171,22 @@ func createTestUser(t *testing.T, coin int64) (uuid.UUID, *jwt.Token) {
 	return userID, token
 }
 
+// serve вызывает обработчик и, как Echo, передаёт его ошибку в HTTPErrorHandler.
+func serve(c echo.Context, h echo.HandlerFunc) {
+	if err := h(c); err != nil {
+		problem.HTTPErrorHandler(err, c)
+	}
+}
+
+func requireProblem(t *testing.T, rec *httptest.ResponseRecorder, code string) {
+	t.Helper()
+
+	require.Equal(t, problem.ContentType, rec.Header().Get(echo.HeaderContentType))
+	var p problem.Problem
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &p))
+	require.Equal(t, code, p.Code)
+}
+
 func TestBuyItemHandler(t *testing.T) {
 	t.Run("successful purchase", func(t *testing.T) {
 		ctx, handlerCoin := setupCoinTest(t)
@@ -223,13 +207,12 @@ func TestBuyItemHandler(t *testing.T) {
 		c.SetParamValues("cup")
 
 		c.Set("user", token)
-		err := handlerCoin.BuyItem(c)
+		serve(c, handlerCoin.BuyItem)
 
-		require.NoError(t, err)
 		require.Equal(t, http.StatusOK, rec.Code)
 
 		var balance int64
-		err = testDB.QueryRow(ctx,
+		err := testDB.QueryRow(ctx,
 			"SELECT coin FROM credentials WHERE id = $1", userID).
 			Scan(&balance)
 		require.NoError(t, err)
@@ -259,11 +242,10 @@ func TestBuyItemHandler(t *testing.T) {
 		c.SetParamValues("cup")
 		c.Set("user", token)
 
-		err := handlerCoin.BuyItem(c)
+		serve(c, handlerCoin.BuyItem)
 
-		require.NoError(t, err)
-		require.Equal(t, http.StatusBadRequest, rec.Code)
-		require.Contains(t, rec.Body.String(), "insufficient balance")
+		require.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+		requireProblem(t, rec, "insufficient_balance")
 	})
 
 	t.Run("invalid item", func(t *testing.T) {
@@ -281,11 +263,10 @@ func TestBuyItemHandler(t *testing.T) {
 		c.SetParamValues("invalid")
 		c.Set("user", token)
 
-		err := handlerCoin.BuyItem(c)
+		serve(c, handlerCoin.BuyItem)
 
-		require.NoError(t, err)
-		require.Equal(t, http.StatusBadRequest, rec.Code)
-		require.Contains(t, rec.Body.String(), "item not found")
+		require.Equal(t, http.StatusNotFound, rec.Code)
+		requireProblem(t, rec, "item_not_found")
 	})
 
 	t.Run("invalid token", func(t *testing.T) {
@@ -299,10 +280,9 @@ func TestBuyItemHandler(t *testing.T) {
 		c.SetParamNames("item")
 		c.SetParamValues("cup")
 
-		err := handlerCoin.BuyItem(c)
+		serve(c, handlerCoin.BuyItem)
 
-		require.NoError(t, err)
 		require.Equal(t, http.StatusInternalServerError, rec.Code)
-		require.Contains(t, rec.Body.String(), "failed to get jwt token")
+		requireProblem(t, rec, "internal_error")
 	})
 }
@@ -0,0 +1,78 @@
+package e2e_test
+
+import (
+	"context"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/repository"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/events"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/logger"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestCatalog проверяет, что покупка с копией каталога не пропускает смену
+// цены, даже если копия ещё не обновлена.
+func TestCatalog(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_, err := testDB.Exec(ctx, `TRUNCATE credentials, shops, user_items, transactions CASCADE`)
+	require.NoError(t, err)
+	_, err = testDB.Exec(ctx, `INSERT INTO shops (item, price) VALUES ('cup', 20)`)
+	require.NoError(t, err)
+
+	catalog := repository.NewCatalog(testDB)
+	require.NoError(t, catalog.Refresh(ctx))
+	snapshot := catalog.Snapshot()
+	require.Equal(t, int64(20), snapshot.Items["cup"].Price)
+
+	repo := repository.NewCoinRepository(testDB, repository.CoinOptions{Catalog: catalog})
+	balance := func(userID uuid.UUID) int64 {
+		var coin int64
+		require.NoError(t, testDB.QueryRow(ctx, "SELECT coin FROM credentials WHERE id = $1", userID).Scan(&coin))
+		return coin
+	}
+
+	t.Run("price from catalog", func(t *testing.T) {
+		userID, _ := createTestUser(t, 100)
+		require.NoError(t, repo.BuyItemFromShop(ctx, userID, "cup"))
+		require.Equal(t, int64(80), balance(userID))
+
+		require.ErrorIs(t, repo.BuyItemFromShop(ctx, userID, "pen"), repository.ErrItemNotFound)
+	})
+
+	t.Run("stale catalog falls back to database", func(t *testing.T) {
+		_, err := testDB.Exec(ctx, `UPDATE shops SET price = 30 WHERE item = 'cup'`)
+		require.NoError(t, err)
+		require.Equal(t, snapshot, catalog.Snapshot())
+
+		userID, _ := createTestUser(t, 100)
+		require.NoError(t, repo.BuyItemFromShop(ctx, userID, "cup"))
+		require.Equal(t, int64(70), balance(userID))
+		require.Equal(t, int64(30), catalog.Snapshot().Items["cup"].Price, "catalog is refreshed after a stale purchase")
+	})
+
+	t.Run("refreshed on notification", func(t *testing.T) {
+		watchCtx, stop := context.WithCancel(ctx)
+		defer stop()
+
+		// Ошибка обновления проявится как таймаут ожидания новой цены
+		connected := make(chan struct{})
+		refresh := func() { _ = catalog.Refresh(watchCtx) }
+		var once sync.Once
+		go events.Watch(watchCtx, testDB, repository.CatalogChannel, logger.Nop(), func() {
+			refresh()
+			once.Do(func() { close(connected) })
+		}, func(string) { refresh() })
+		<-connected
+
+		_, err := testDB.Exec(ctx, `UPDATE shops SET price = 40 WHERE item = 'cup'`)
+		require.NoError(t, err)
+		require.Eventually(t, func() bool {
+			return catalog.Snapshot().Items["cup"].Price == 40
+		}, 5*time.Second, 10*time.Millisecond)
+		require.Greater(t, catalog.Snapshot().Version, snapshot.Version)
+	})
+}
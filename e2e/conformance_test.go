@@ -0,0 +1,38 @@
+package e2e_test
+
+import (
+	"context"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/memory"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/repository"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/repository/repotest"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+// TestPostgresConformance прогоняет на Postgres тот же набор, что и на
+// хранилище в памяти.
+func TestPostgresConformance(t *testing.T) {
+	repotest.Run(t, func(t *testing.T, opts repository.CoinOptions) repotest.Backend {
+		ctx := context.Background()
+
+		_, err := testDB.Exec(ctx, `
+			TRUNCATE credentials, shops, user_items, transactions, transfer_reversals, transfer_limit_overrides,
+				coin_lots, coin_holds, user_events, webhooks, outbox, webhook_deliveries CASCADE
+		`)
+		require.NoError(t, err)
+		for _, item := range memory.DefaultShop {
+			_, err = testDB.Exec(ctx, `INSERT INTO shops (item, price) VALUES ($1, $2)`, item.Item, item.Price)
+			require.NoError(t, err)
+		}
+		// Покупки идут через копию каталога, как в сервере
+		opts.Catalog = repository.NewCatalog(testDB)
+		require.NoError(t, opts.Catalog.Refresh(ctx))
+
+		return repotest.Backend{
+			Users:    repository.NewUserRepository(testDB, opts.CoinLifetime),
+			Coins:    repository.NewCoinRepository(testDB, opts),
+			Events:   repository.NewEventRepository(testDB),
+			Webhooks: repository.NewWebhookRepository(testDB),
+		}
+	})
+}
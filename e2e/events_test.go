@@ -0,0 +1,115 @@
+package e2e_test
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/api/handler"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/models"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/repository"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/events"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/logger"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUserEvents(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_, err := testDB.Exec(ctx, `TRUNCATE credentials, transactions, user_events CASCADE`)
+	require.NoError(t, err)
+
+	coinRepo := repository.NewCoinRepository(testDB, repository.CoinOptions{})
+	eventRepo := repository.NewEventRepository(testDB)
+	senderID, _ := createTestUser(t, 1000)
+	receiverID, receiverToken := createTestUser(t, 0)
+
+	broker := events.NewBroker()
+	go events.Listen(ctx, testDB, broker, logger.Nop())
+	sub := broker.Subscribe(receiverID)
+	defer sub.Close()
+
+	// LISTEN выполняется асинхронно: начисляем монеты, пока событие не дойдёт
+	var granted models.UserEvent
+	require.Eventually(t, func() bool {
+		require.NoError(t, coinRepo.GrantCoins(ctx, receiverID, 1))
+		select {
+		case granted = <-sub.Events:
+			return true
+		case <-time.After(100 * time.Millisecond):
+			return false
+		}
+	}, 10*time.Second, time.Millisecond)
+	require.Equal(t, models.EventCoinsGranted, granted.Type)
+	require.Equal(t, receiverID, granted.UserID)
+
+	// Начисления, отправленные до готовности LISTEN, тоже могли дойти
+	for len(sub.Events) > 0 {
+		<-sub.Events
+	}
+
+	require.NoError(t, coinRepo.SendCoins(ctx, senderID, receiverID, 300))
+
+	var received models.UserEvent
+	select {
+	case received = <-sub.Events:
+	case <-time.After(5 * time.Second):
+		t.Fatal("coins_received was not delivered")
+	}
+	require.Equal(t, models.EventCoinsReceived, received.Type)
+	var payload models.CoinsReceivedEvent
+	require.NoError(t, json.Unmarshal(received.Payload, &payload))
+	require.Equal(t, senderID.String(), payload.FromUser)
+	require.Equal(t, int64(300), payload.Amount)
+
+	sent, err := eventRepo.GetEventsAfter(ctx, senderID, 0, 100)
+	require.NoError(t, err)
+	require.Len(t, sent, 1)
+	require.Equal(t, models.EventCoinsSent, sent[0].Type)
+	var sentPayload models.CoinsSentEvent
+	require.NoError(t, json.Unmarshal(sent[0].Payload, &sentPayload))
+	require.Equal(t, receiverID.String(), sentPayload.ToUser)
+
+	t.Run("replay after Last-Event-ID", func(t *testing.T) {
+		stored, err := eventRepo.GetEventsAfter(ctx, receiverID, 0, 100)
+		require.NoError(t, err)
+		require.Equal(t, received.ID, stored[len(stored)-1].ID)
+
+		replayBroker := events.NewBroker()
+		h := handler.NewEventsHandler(eventRepo, replayBroker, time.Hour)
+		req := httptest.NewRequest(http.MethodGet, "/api/v2/events", nil)
+		req.Header.Set(handler.HeaderLastEventID, "0")
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		c.Set("user", receiverToken)
+
+		// Поток завершится, как только брокер будет закрыт после выдачи истории
+		go func() {
+			for replayBroker.Subscribers() == 0 {
+				time.Sleep(time.Millisecond)
+			}
+			time.Sleep(100 * time.Millisecond)
+			replayBroker.Close()
+		}()
+		require.NoError(t, h.Stream(c))
+
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.Contains(t, rec.Body.String(), "event: coins_received\n")
+		require.Equal(t, len(stored), strings.Count(rec.Body.String(), "id: "))
+	})
+
+	t.Run("cleanup", func(t *testing.T) {
+		deleted, err := eventRepo.DeleteEventsBefore(ctx, time.Now().Add(time.Minute))
+		require.NoError(t, err)
+		require.Positive(t, deleted)
+
+		left, err := eventRepo.GetEventsAfter(ctx, receiverID, 0, 100)
+		require.NoError(t, err)
+		require.Empty(t, left)
+	})
+}
@@ -47,9 +47,8 @@ func TestGetInfoHandler(t *testing.T) {
 
 		c := e.NewContext(req, rec)
 		c.Set("user", token)
-		err = handler.GetInfo(c)
+		serve(c, handler.GetInfo)
 
-		require.NoError(t, err)
 		require.Equal(t, http.StatusOK, rec.Code)
 
 		var response models.User
@@ -84,11 +83,10 @@ func TestGetInfoHandler(t *testing.T) {
 		rec := httptest.NewRecorder()
 
 		c := e.NewContext(req, rec)
-		err := handler.GetInfo(c)
+		serve(c, handler.GetInfo)
 
-		require.NoError(t, err)
 		require.Equal(t, http.StatusInternalServerError, rec.Code)
-		require.Contains(t, rec.Body.String(), "failed to get jwt token")
+		requireProblem(t, rec, "internal_error")
 	})
 
 	t.Run("missing user data", func(t *testing.T) {
@@ -107,11 +105,10 @@ func TestGetInfoHandler(t *testing.T) {
 
 		c := e.NewContext(req, rec)
 		c.Set("user", token)
-		err = handler.GetInfo(c)
+		serve(c, handler.GetInfo)
 
-		require.NoError(t, err)
 		require.Equal(t, http.StatusInternalServerError, rec.Code)
-		require.Contains(t, rec.Body.String(), "failed to get jwt token")
+		requireProblem(t, rec, "internal_error")
 	})
 
 	t.Run("empty transaction history", func(t *testing.T) {
@@ -127,9 +124,8 @@ func TestGetInfoHandler(t *testing.T) {
 
 		c := e.NewContext(req, rec)
 		c.Set("user", token)
-		err := handler.GetInfo(c)
+		serve(c, handler.GetInfo)
 
-		require.NoError(t, err)
 		require.Equal(t, http.StatusOK, rec.Code)
 
 		var response models.User
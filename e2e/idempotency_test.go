@@ -0,0 +1,68 @@
+package e2e_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/idempotency"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// TestIdempotencyShared проверяет, что повтор с тем же ключом получает
+// сохранённый ответ на другом экземпляре.
+func TestIdempotencyShared(t *testing.T) {
+	ctx := context.Background()
+	_, err := testDB.Exec(ctx, `TRUNCATE idempotency_keys`)
+	require.NoError(t, err)
+
+	first, second := idempotency.NewPostgres(testDB, time.Hour), idempotency.NewPostgres(testDB, time.Hour)
+	body := sha256.Sum256([]byte(`{"amount":1}`))
+
+	lease, err := first.Begin(ctx, "alice POST /api/sendCoin key-1", body)
+	require.NoError(t, err)
+	require.Equal(t, idempotency.New, lease.State)
+
+	t.Run("in flight on another instance", func(t *testing.T) {
+		other, err := second.Begin(ctx, "alice POST /api/sendCoin key-1", body)
+		require.NoError(t, err)
+		assert.Equal(t, idempotency.InFlight, other.State)
+	})
+
+	t.Run("replayed on another instance", func(t *testing.T) {
+		response := idempotency.Response{Status: http.StatusOK, ContentType: "application/json", Body: []byte(`{}`)}
+		require.NoError(t, first.Complete(ctx, "alice POST /api/sendCoin key-1", lease.Token, response))
+
+		replay, err := second.Begin(ctx, "alice POST /api/sendCoin key-1", body)
+		require.NoError(t, err)
+		assert.Equal(t, idempotency.Replay, replay.State)
+		assert.Equal(t, response, replay.Response)
+	})
+
+	t.Run("key reused with another body", func(t *testing.T) {
+		reused, err := second.Begin(ctx, "alice POST /api/sendCoin key-1", sha256.Sum256([]byte(`{"amount":2}`)))
+		require.NoError(t, err)
+		assert.Equal(t, idempotency.KeyReused, reused.State)
+	})
+
+	t.Run("forgotten key can be taken again", func(t *testing.T) {
+		lease, err := first.Begin(ctx, "alice POST /api/sendCoin key-2", body)
+		require.NoError(t, err)
+		require.NoError(t, first.Forget(ctx, "alice POST /api/sendCoin key-2", lease.Token))
+
+		again, err := second.Begin(ctx, "alice POST /api/sendCoin key-2", body)
+		require.NoError(t, err)
+		assert.Equal(t, idempotency.New, again.State)
+	})
+
+	t.Run("expired keys are deleted", func(t *testing.T) {
+		_, err := testDB.Exec(ctx, `UPDATE idempotency_keys SET expires_at = now() - interval '1 second'`)
+		require.NoError(t, err)
+
+		deleted, err := first.DeleteExpired(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), deleted)
+	})
+}
@@ -23,7 +23,7 @@ func setupUserTest(t *testing.T) (context.Context, *handler.AuthorizationHandler
     `)
 	require.NoError(t, err)
 
-	userRepo := repository.NewUserRepository(testDB)
+	userRepo := repository.NewUserRepository(testDB, 0)
 	authorization := handler.NewAuthorizationHandler(userRepo)
 
 	return ctx, authorization
@@ -46,9 +46,8 @@ func TestLoginHandler(t *testing.T) {
 		rec := httptest.NewRecorder()
 
 		c := e.NewContext(req, rec)
-		err := handlerAuth.Login(c)
+		serve(c, handlerAuth.Login)
 
-		require.NoError(t, err)
 		require.Equal(t, http.StatusOK, rec.Code)
 
 		var token struct{ Token string }
@@ -56,7 +55,7 @@ func TestLoginHandler(t *testing.T) {
 		require.NotEmpty(t, token)
 
 		var count int
-		err = testDB.QueryRow(context.Background(),
+		err := testDB.QueryRow(context.Background(),
 			"SELECT COUNT(*) FROM credentials WHERE username = $1", "newuser").Scan(&count)
 		require.NoError(t, err)
 		require.Equal(t, 1, count)
@@ -84,9 +83,8 @@ func TestLoginHandler(t *testing.T) {
 		rec := httptest.NewRecorder()
 
 		c := echo.New().NewContext(req, rec)
-		err = handlerAuth.Login(c)
+		serve(c, handlerAuth.Login)
 
-		require.NoError(t, err)
 		require.Equal(t, http.StatusOK, rec.Code)
 
 		var token struct{ Token string }
@@ -116,11 +114,10 @@ func TestLoginHandler(t *testing.T) {
 		rec := httptest.NewRecorder()
 
 		c := echo.New().NewContext(req, rec)
-		err = handlerAuth.Login(c)
+		serve(c, handlerAuth.Login)
 
-		require.NoError(t, err)
 		require.Equal(t, http.StatusUnauthorized, rec.Code)
-		require.Contains(t, rec.Body.String(), "invalid password")
+		requireProblem(t, rec, "invalid_credentials")
 	})
 
 	t.Run("invalid request", func(t *testing.T) {
@@ -133,11 +130,10 @@ func TestLoginHandler(t *testing.T) {
 		rec := httptest.NewRecorder()
 
 		c := echo.New().NewContext(req, rec)
-		err := handlerAuth.Login(c)
+		serve(c, handlerAuth.Login)
 
-		require.NoError(t, err)
 		require.Equal(t, http.StatusBadRequest, rec.Code)
-		require.Contains(t, rec.Body.String(), "invalid request")
+		requireProblem(t, rec, "invalid_request")
 	})
 
 	t.Run("duplicate username registration", func(t *testing.T) {
@@ -160,10 +156,9 @@ func TestLoginHandler(t *testing.T) {
 		rec := httptest.NewRecorder()
 
 		c := echo.New().NewContext(req, rec)
-		err = handlerAuth.Login(c)
+		serve(c, handlerAuth.Login)
 
-		require.NoError(t, err)
 		require.Equal(t, http.StatusUnauthorized, rec.Code)
-		require.Contains(t, rec.Body.String(), "invalid password")
+		requireProblem(t, rec, "invalid_credentials")
 	})
 }
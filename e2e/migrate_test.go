@@ -0,0 +1,82 @@
+package e2e_test
+
+import (
+	"context"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/migrate"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"testing/fstest"
+)
+
+// TestMigrateStatementTimeout проверяет, что statement_timeout пула не
+// обрывает долгую миграцию и остаётся в силе для остальных запросов.
+func TestMigrateStatementTimeout(t *testing.T) {
+	ctx := context.Background()
+	pool := scratchDB(t, "migrate_timeout", map[string]string{"statement_timeout": "100"})
+
+	migrator, err := migrate.New(pool, fstest.MapFS{
+		"001_slow.up.sql": {Data: []byte("SELECT pg_sleep(0.3)")},
+	})
+	require.NoError(t, err)
+	require.NoError(t, migrator.Up(ctx))
+
+	var timeout string
+	require.NoError(t, pool.QueryRow(ctx, "SHOW statement_timeout").Scan(&timeout))
+	assert.Equal(t, "100ms", timeout)
+	_, err = pool.Exec(ctx, "SELECT pg_sleep(0.3)")
+	assert.ErrorContains(t, err, "statement timeout")
+}
+
+// TestMigrateLegacySchema проверяет, что база со схемой от старого
+// entrypoint-скрипта получает первую миграцию как применённую и не теряет
+// данные.
+func TestMigrateLegacySchema(t *testing.T) {
+	ctx := context.Background()
+	pool := scratchDB(t, "migrate_legacy", nil)
+
+	_, err := pool.Exec(ctx, `
+		CREATE TABLE public.credentials (username text NOT NULL);
+		INSERT INTO public.credentials (username) VALUES ('alice')`)
+	require.NoError(t, err)
+
+	migrator, err := migrate.New(pool, fstest.MapFS{
+		"001_init.up.sql":  {Data: []byte("CREATE TABLE public.credentials (username text NOT NULL)")},
+		"002_shops.up.sql": {Data: []byte("CREATE TABLE public.shops (item text NOT NULL)")},
+	})
+	require.NoError(t, err)
+	require.NoError(t, migrator.Up(ctx))
+
+	pending, err := migrator.Pending(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, pending)
+
+	var username string
+	require.NoError(t, pool.QueryRow(ctx, "SELECT username FROM credentials").Scan(&username))
+	assert.Equal(t, "alice", username)
+}
+
+// scratchDB создаёт отдельную базу name с параметрами сессии params и
+// удаляет её после теста.
+func scratchDB(t *testing.T, name string, params map[string]string) *pgxpool.Pool {
+	t.Helper()
+	ctx := context.Background()
+	_, err := testDB.Exec(ctx, "CREATE DATABASE "+name)
+	require.NoError(t, err)
+
+	poolConfig := testDB.Config().Copy()
+	poolConfig.ConnConfig.Database = name
+	for k, v := range params {
+		poolConfig.ConnConfig.RuntimeParams[k] = v
+	}
+	poolConfig.MaxConns = 1
+	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		pool.Close()
+		_, _ = testDB.Exec(ctx, "DROP DATABASE "+name)
+	})
+	return pool
+}
@@ -0,0 +1,64 @@
+package e2e_test
+
+import (
+	"context"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/ratelimit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestRateLimitShared проверяет, что корзины в PostgreSQL не выдают больше
+// лимита при одновременных запросах с разных экземпляров.
+func TestRateLimitShared(t *testing.T) {
+	ctx := context.Background()
+	_, err := testDB.Exec(ctx, `TRUNCATE rate_limit_buckets`)
+	require.NoError(t, err)
+
+	limit := ratelimit.Limit{Requests: 5, Period: time.Hour}
+	instances := []*ratelimit.Postgres{ratelimit.NewPostgres(testDB), ratelimit.NewPostgres(testDB)}
+
+	t.Run("limit holds across instances", func(t *testing.T) {
+		var allowed atomic.Int64
+		var wg sync.WaitGroup
+		for i := range 20 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				res, err := instances[i%2].Take(ctx, "user:alice *", limit)
+				assert.NoError(t, err)
+				if res.Allowed {
+					allowed.Add(1)
+				}
+			}()
+		}
+		wg.Wait()
+		assert.Equal(t, int64(5), allowed.Load())
+
+		res, err := instances[0].Take(ctx, "user:alice *", limit)
+		require.NoError(t, err)
+		assert.False(t, res.Allowed)
+		assert.Equal(t, 0, res.Remaining)
+		assert.InDelta(t, (12 * time.Minute).Seconds(), res.RetryAfter.Seconds(), 1)
+	})
+
+	t.Run("buckets are independent", func(t *testing.T) {
+		res, err := instances[1].Take(ctx, "user:bob *", limit)
+		require.NoError(t, err)
+		assert.True(t, res.Allowed)
+		assert.Equal(t, 4, res.Remaining)
+	})
+
+	t.Run("full buckets are deleted", func(t *testing.T) {
+		_, err := instances[0].Take(ctx, "ip:10.0.0.1 POST /api/auth", ratelimit.Limit{Requests: 1, Period: time.Millisecond})
+		require.NoError(t, err)
+		time.Sleep(10 * time.Millisecond)
+
+		deleted, err := instances[0].DeleteFull(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), deleted)
+	})
+}
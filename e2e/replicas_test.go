@@ -0,0 +1,27 @@
+package e2e_test
+
+import (
+	"context"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/logger"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// TestReplicaLagCheck проверяет запрос отставания на сервере без репликации:
+// такой сервер считается репликой без отставания.
+func TestReplicaLagCheck(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	replicas := db.NewReplicaSet([]*pgxpool.Pool{testDB}, time.Second, time.Minute)
+	require.Equal(t, -1, replicas.Replica(uuid.New()))
+
+	go replicas.Run(ctx, 10*time.Millisecond, logger.Nop())
+	require.Eventually(t, func() bool {
+		return replicas.Replica(uuid.New()) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
@@ -24,9 +24,9 @@ func setupCombinedTest(t *testing.T) (context.Context, *handler.CombinedReposito
     `)
 	require.NoError(t, err)
 
-	userRepo := repository.NewUserRepository(testDB)
-	coinRepo := repository.NewCoinRepository(testDB)
-	combinedRepo := handler.NewCombinedRepository(userRepo, coinRepo)
+	userRepo := repository.NewUserRepository(testDB, 0)
+	coinRepo := repository.NewCoinRepository(testDB, repository.CoinOptions{})
+	combinedRepo := handler.NewCombinedRepository(userRepo, coinRepo, nil)
 
 	return ctx, combinedRepo
 }
@@ -53,13 +53,12 @@ func TestSendCoinHandler(t *testing.T) {
 
 		c := e.NewContext(req, rec)
 		c.Set("user", senderToken)
-		err := handlerCombined.SendCoinHandler(c)
+		serve(c, handlerCombined.SendCoinHandler)
 
-		require.NoError(t, err)
 		require.Equal(t, http.StatusOK, rec.Code)
 
 		var senderBalance, receiverBalance int64
-		err = testDB.QueryRow(ctx, "SELECT coin FROM credentials WHERE id = $1", senderID).Scan(&senderBalance)
+		err := testDB.QueryRow(ctx, "SELECT coin FROM credentials WHERE id = $1", senderID).Scan(&senderBalance)
 		require.NoError(t, err)
 		require.Equal(t, int64(500), senderBalance)
 
@@ -95,11 +94,10 @@ func TestSendCoinHandler(t *testing.T) {
 
 		c := e.NewContext(req, rec)
 		c.Set("user", senderToken)
-		err := handlerCombined.SendCoinHandler(c)
+		serve(c, handlerCombined.SendCoinHandler)
 
-		require.NoError(t, err)
-		require.Equal(t, http.StatusBadRequest, rec.Code)
-		require.Contains(t, rec.Body.String(), "insufficient balance")
+		require.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+		requireProblem(t, rec, "insufficient_balance")
 	})
 
 	t.Run("send to self", func(t *testing.T) {
@@ -119,11 +117,10 @@ func TestSendCoinHandler(t *testing.T) {
 
 		c := e.NewContext(req, rec)
 		c.Set("user", senderToken)
-		err := handlerCombined.SendCoinHandler(c)
+		serve(c, handlerCombined.SendCoinHandler)
 
-		require.NoError(t, err)
-		require.Equal(t, http.StatusBadRequest, rec.Code)
-		require.Contains(t, rec.Body.String(), "cannot send coins to yourself")
+		require.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+		requireProblem(t, rec, "self_transfer")
 	})
 
 	t.Run("receiver not found", func(t *testing.T) {
@@ -142,11 +139,10 @@ func TestSendCoinHandler(t *testing.T) {
 
 		c := e.NewContext(req, rec)
 		c.Set("user", senderToken)
-		err := handlerCombined.SendCoinHandler(c)
+		serve(c, handlerCombined.SendCoinHandler)
 
-		require.NoError(t, err)
-		require.Equal(t, http.StatusBadRequest, rec.Code)
-		require.Contains(t, rec.Body.String(), "receiver not found")
+		require.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+		requireProblem(t, rec, "receiver_not_found")
 	})
 
 	t.Run("invalid request", func(t *testing.T) {
@@ -160,10 +156,9 @@ func TestSendCoinHandler(t *testing.T) {
 
 		c := e.NewContext(req, rec)
 		c.Set("user", senderToken)
-		err := handlerCombined.SendCoinHandler(c)
+		serve(c, handlerCombined.SendCoinHandler)
 
-		require.NoError(t, err)
 		require.Equal(t, http.StatusBadRequest, rec.Code)
-		require.Contains(t, rec.Body.String(), "invalid request")
+		requireProblem(t, rec, "invalid_request")
 	})
 }
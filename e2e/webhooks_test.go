@@ -0,0 +1,133 @@
+package e2e_test
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/models"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/repository"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/logger"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/webhooks"
+	"github.com/Ki4EH/stunning-octo-waddle/pkg/client"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// webhookReceiver запоминает проверенные события.
+type webhookReceiver struct {
+	secret string
+	status int
+
+	mu     sync.Mutex
+	events []client.WebhookEvent
+}
+
+func (rcv *webhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	if err := client.VerifyWebhook(rcv.secret, r.Header.Get(client.HeaderWebhookSignature), body, time.Minute); err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	var event client.WebhookEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+	rcv.events = append(rcv.events, event)
+	w.WriteHeader(rcv.status)
+}
+
+func (rcv *webhookReceiver) received() []client.WebhookEvent {
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+	return append([]client.WebhookEvent(nil), rcv.events...)
+}
+
+func TestWebhookDelivery(t *testing.T) {
+	ctx := context.Background()
+
+	_, err := testDB.Exec(ctx, `TRUNCATE credentials, shops, transactions, webhooks, outbox CASCADE`)
+	require.NoError(t, err)
+	_, err = testDB.Exec(ctx, `INSERT INTO shops (item, price) VALUES ('cup', 20)`)
+	require.NoError(t, err)
+
+	coinRepo := repository.NewCoinRepository(testDB, repository.CoinOptions{})
+	webhookRepo := repository.NewWebhookRepository(testDB)
+	senderID, _ := createTestUser(t, 1000)
+	receiverID, _ := createTestUser(t, 0)
+
+	transfers := &webhookReceiver{secret: "transfers", status: http.StatusOK}
+	transfersServer := httptest.NewServer(transfers)
+	defer transfersServer.Close()
+	broken := &webhookReceiver{secret: "broken", status: http.StatusServiceUnavailable}
+	brokenServer := httptest.NewServer(broken)
+	defer brokenServer.Close()
+
+	_, err = webhookRepo.CreateWebhook(ctx, models.WebhookRequest{
+		URL: transfersServer.URL, Secret: transfers.secret, EventTypes: []string{models.OutboxTransferCompleted},
+	})
+	require.NoError(t, err)
+	brokenHook, err := webhookRepo.CreateWebhook(ctx, models.WebhookRequest{URL: brokenServer.URL, Secret: broken.secret})
+	require.NoError(t, err)
+
+	require.NoError(t, coinRepo.SendCoins(ctx, senderID, receiverID, 300))
+	require.NoError(t, coinRepo.BuyItemFromShop(ctx, senderID, "cup"))
+
+	// Одна попытка: неудачная доставка сразу уходит в dead letter
+	dispatcher := webhooks.NewDispatcher(webhookRepo, http.DefaultClient, webhooks.Options{
+		Workers: 4, Timeout: time.Second, MaxAttempts: 1,
+	}, logger.Nop())
+	require.Equal(t, 3, dispatcher.Dispatch(ctx))
+
+	got := transfers.received()
+	require.Len(t, got, 1)
+	require.Equal(t, client.EventTransferCompleted, got[0].Type)
+	var transfer client.TransferEvent
+	require.NoError(t, json.Unmarshal(got[0].Data, &transfer))
+	require.Equal(t, senderID.String(), transfer.FromUser)
+	require.Equal(t, receiverID.String(), transfer.ToUser)
+	require.Equal(t, int64(300), transfer.Amount)
+
+	require.Len(t, broken.received(), 2)
+	dead, err := webhookRepo.GetDeliveries(ctx, brokenHook.ID, models.DeliveryStatusDead, 10)
+	require.NoError(t, err)
+	require.Len(t, dead, 2)
+	require.Equal(t, http.StatusServiceUnavailable, *dead[0].LastStatus)
+
+	t.Run("replay dead letter", func(t *testing.T) {
+		broken.mu.Lock()
+		broken.status = http.StatusOK
+		broken.mu.Unlock()
+
+		replayed, err := webhookRepo.ReplayDeliveries(ctx, brokenHook.ID, models.ReplayRequest{})
+		require.NoError(t, err)
+		require.Equal(t, int64(2), replayed)
+		require.Equal(t, 2, dispatcher.Dispatch(ctx))
+
+		delivered, err := webhookRepo.GetDeliveries(ctx, brokenHook.ID, models.DeliveryStatusDelivered, 10)
+		require.NoError(t, err)
+		require.Len(t, delivered, 2)
+
+		// Получатель видит те же id событий, что и в первый раз
+		events := broken.received()
+		require.Len(t, events, 4)
+		require.ElementsMatch(t, []int64{events[0].ID, events[1].ID}, []int64{events[2].ID, events[3].ID})
+	})
+
+	t.Run("cleanup keeps undelivered events", func(t *testing.T) {
+		_, err := testDB.Exec(ctx, `UPDATE webhook_deliveries SET status = 'dead' WHERE webhook_id = $1`, brokenHook.ID)
+		require.NoError(t, err)
+
+		deleted, err := webhookRepo.DeleteOutboxBefore(ctx, time.Now().Add(time.Minute))
+		require.NoError(t, err)
+		// Оба события не доставлены сломанному получателю
+		require.Zero(t, deleted)
+	})
+}
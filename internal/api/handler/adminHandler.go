@@ -0,0 +1,144 @@
+package handler
+
+import (
+	"fmt"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/api/problem"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/models"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/repository"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/utils"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"net/http"
+)
+
+type AdminHandler struct {
+	userRepo repository.UserRepository
+	coinRepo repository.CoinRepository
+}
+
+func NewAdminHandler(userRepo repository.UserRepository, coinRepo repository.CoinRepository) *AdminHandler {
+	return &AdminHandler{
+		userRepo: userRepo,
+		coinRepo: coinRepo,
+	}
+}
+
+func (r *AdminHandler) GetTransferLimits(c echo.Context) error {
+	user, err := r.findUser(c)
+	if err != nil {
+		return err
+	}
+
+	limits, err := r.coinRepo.GetTransferLimits(c.Request().Context(), user.ID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch transfer limits: %w", err)
+	}
+
+	return c.JSON(http.StatusOK, limits)
+}
+
+func (r *AdminHandler) SetTransferLimits(c echo.Context) error {
+	adminID, ok := utils.UserIDFromContext(c)
+	if !ok {
+		return problem.MissingToken()
+	}
+
+	var override models.TransferLimitsOverride
+	if err := c.Bind(&override); err != nil {
+		return problem.InvalidRequest("invalid request")
+	}
+
+	user, err := r.findUser(c)
+	if err != nil {
+		return err
+	}
+
+	limits, err := r.coinRepo.SetTransferLimits(c.Request().Context(), user.ID, adminID, override)
+	if err != nil {
+		return fmt.Errorf("failed to update transfer limits: %w", err)
+	}
+
+	return c.JSON(http.StatusOK, limits)
+}
+
+func (r *AdminHandler) GrantCoins(c echo.Context) error {
+	var request models.GrantCoins
+	if err := c.Bind(&request); err != nil || request.Amount <= 0 {
+		return problem.InvalidRequest("invalid request")
+	}
+
+	user, err := r.findUser(c)
+	if err != nil {
+		return err
+	}
+
+	if err = r.coinRepo.GrantCoins(c.Request().Context(), user.ID, request.Amount); err != nil {
+		return fmt.Errorf("failed to grant coins: %w", err)
+	}
+
+	return c.NoContent(http.StatusOK)
+}
+
+func (r *AdminHandler) HoldCoins(c echo.Context) error {
+	adminID, ok := utils.UserIDFromContext(c)
+	if !ok {
+		return problem.MissingToken()
+	}
+
+	var request models.HoldRequest
+	if err := c.Bind(&request); err != nil || request.Amount <= 0 || request.TTLSeconds < 0 {
+		return problem.InvalidRequest("invalid request")
+	}
+
+	user, err := r.findUser(c)
+	if err != nil {
+		return err
+	}
+
+	hold, err := r.coinRepo.HoldCoins(c.Request().Context(), user.ID, adminID, request)
+	if err != nil {
+		return fmt.Errorf("failed to hold coins: %w", err)
+	}
+
+	return c.JSON(http.StatusCreated, hold)
+}
+
+func (r *AdminHandler) CaptureHold(c echo.Context) error {
+	holdID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return problem.InvalidRequest("invalid hold id")
+	}
+
+	hold, err := r.coinRepo.CaptureHold(c.Request().Context(), holdID)
+	if err != nil {
+		return fmt.Errorf("failed to capture hold: %w", err)
+	}
+
+	return c.JSON(http.StatusOK, hold)
+}
+
+func (r *AdminHandler) ReleaseHold(c echo.Context) error {
+	holdID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return problem.InvalidRequest("invalid hold id")
+	}
+
+	hold, err := r.coinRepo.ReleaseHold(c.Request().Context(), holdID)
+	if err != nil {
+		return fmt.Errorf("failed to release hold: %w", err)
+	}
+
+	return c.JSON(http.StatusOK, hold)
+}
+
+// findUser ищет пользователя из параметра пути.
+func (r *AdminHandler) findUser(c echo.Context) (*models.Credential, error) {
+	user, err := r.userRepo.GetUserCredentialByName(c.Request().Context(), c.Param("username"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch user info: %w", err)
+	}
+	if user.ID == uuid.Nil {
+		return nil, repository.ErrUserNotFound
+	}
+	return user, nil
+}
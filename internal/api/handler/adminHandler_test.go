@@ -0,0 +1,108 @@
+package handler
+
+import (
+	"bytes"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/models"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/repository"
+	mock_repository "github.com/Ki4EH/stunning-octo-waddle/internal/mocks/repository"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/utils"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAdminHandler_SetTransferLimits(t *testing.T) {
+	e := echo.New()
+	adminID := uuid.New()
+	userID := uuid.New()
+	maxPerTransfer := int64(100)
+
+	tests := []struct {
+		name           string
+		setupMocks     func(*mock_repository.MockUserRepository, *mock_repository.MockCoinRepository)
+		requestBody    string
+		expectedStatus int
+		expectedBody   string
+		expectedCode   string
+	}{
+		{
+			name: "successful update",
+			setupMocks: func(userRepo *mock_repository.MockUserRepository, coinRepo *mock_repository.MockCoinRepository) {
+				userRepo.EXPECT().
+					GetUserCredentialByName(gomock.Any(), "bob").
+					Return(&models.Credential{ID: userID, Username: "bob"}, nil)
+				coinRepo.EXPECT().
+					SetTransferLimits(gomock.Any(), userID, adminID, models.TransferLimitsOverride{MaxPerTransfer: &maxPerTransfer}).
+					Return(&models.UserTransferLimits{
+						Effective: models.TransferLimits{MaxPerTransfer: 100},
+						Override:  models.TransferLimitsOverride{MaxPerTransfer: &maxPerTransfer},
+					}, nil)
+			},
+			requestBody:    `{"maxPerTransfer":100}`,
+			expectedStatus: http.StatusOK,
+			expectedBody: `{"effective":{"maxPerTransfer":100,"maxDailyTotal":0,"maxDailyRecipients":0},
+				"override":{"maxPerTransfer":100,"maxDailyTotal":null,"maxDailyRecipients":null}}`,
+		},
+		{
+			name: "user not found",
+			setupMocks: func(userRepo *mock_repository.MockUserRepository, coinRepo *mock_repository.MockCoinRepository) {
+				userRepo.EXPECT().
+					GetUserCredentialByName(gomock.Any(), "bob").
+					Return(&models.Credential{}, nil)
+			},
+			requestBody:    `{"maxPerTransfer":100}`,
+			expectedStatus: http.StatusNotFound,
+			expectedCode:   "user_not_found",
+		},
+		{
+			name: "negative limit",
+			setupMocks: func(userRepo *mock_repository.MockUserRepository, coinRepo *mock_repository.MockCoinRepository) {
+				userRepo.EXPECT().
+					GetUserCredentialByName(gomock.Any(), "bob").
+					Return(&models.Credential{ID: userID, Username: "bob"}, nil)
+				coinRepo.EXPECT().
+					SetTransferLimits(gomock.Any(), userID, adminID, gomock.Any()).
+					Return(nil, repository.ErrNegativeLimits)
+			},
+			requestBody:    `{"maxPerTransfer":-1}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   "invalid_limits",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			userRepo := mock_repository.NewMockUserRepository(ctrl)
+			coinRepo := mock_repository.NewMockCoinRepository(ctrl)
+
+			tt.setupMocks(userRepo, coinRepo)
+
+			handler := NewAdminHandler(userRepo, coinRepo)
+
+			req := httptest.NewRequest(http.MethodPut, "/api/admin/users/bob/limits", bytes.NewReader([]byte(tt.requestBody)))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("username")
+			c.SetParamValues("bob")
+			c.Set("user", &jwt.Token{Claims: &utils.Claims{UserID: adminID}})
+
+			serve(c, handler.SetTransferLimits)
+
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+			if tt.expectedCode != "" {
+				assertProblem(t, rec, tt.expectedCode)
+			} else {
+				assert.JSONEq(t, tt.expectedBody, rec.Body.String())
+			}
+		})
+	}
+}
@@ -2,8 +2,10 @@ package handler
 
 import (
 	"fmt"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/api/problem"
 	"github.com/Ki4EH/stunning-octo-waddle/internal/db/models"
 	"github.com/Ki4EH/stunning-octo-waddle/internal/db/repository"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/metrics"
 	"github.com/Ki4EH/stunning-octo-waddle/internal/utils"
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
@@ -23,17 +25,15 @@ func NewAuthorizationHandler(repo repository.UserRepository) *AuthorizationHandl
 func (r *AuthorizationHandler) Login(c echo.Context) error {
 	var loginRequest models.Credential
 	if err := c.Bind(&loginRequest); err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"errors": fmt.Sprintf("invalid request %v", err)})
+		return problem.InvalidRequest("invalid request")
 	}
 	if loginRequest.Username == "" || loginRequest.Password == "" {
-		return c.JSON(http.StatusBadRequest, map[string]string{"errors": "username and password are required"})
+		return problem.InvalidRequest("username and password are required")
 	}
 
 	credential, err := r.repo.GetUserCredentialByName(c.Request().Context(), loginRequest.Username)
 	if err != nil {
-		c.Logger().Error("failed to fetch user info", err)
-		c.Response().Status = http.StatusInternalServerError
-		return c.JSON(http.StatusUnauthorized, map[string]string{"errors": fmt.Sprintf("failed to fetch user info %v", err)})
+		return fmt.Errorf("failed to fetch user info: %w", err)
 	}
 
 	if credential.ID == uuid.Nil {
@@ -41,22 +41,19 @@ func (r *AuthorizationHandler) Login(c echo.Context) error {
 		credential.Password = loginRequest.Password
 		err = r.repo.CreateUserCredential(c.Request().Context(), credential)
 		if err != nil {
-			c.Response().Status = http.StatusInternalServerError
-			c.Logger().Error("failed to create user", err)
-			return c.JSON(http.StatusInternalServerError, map[string]string{"errors": fmt.Sprintf("failed to create user %v", err)})
+			return fmt.Errorf("failed to create user: %w", err)
 		}
+		metrics.Registrations.Inc()
 	} else {
 		if credential.Password != loginRequest.Password {
-			c.Response().Status = http.StatusUnauthorized
-			return c.JSON(http.StatusUnauthorized, map[string]string{"errors": "invalid password"})
+			return problem.New(http.StatusUnauthorized, "invalid_credentials", "invalid password")
 		}
+		metrics.Logins.Inc()
 	}
 
 	token, err := utils.GenerateToken(credential.ID)
 	if err != nil {
-		c.Response().Status = http.StatusInternalServerError
-		c.Logger().Error("failed to generate token", err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"errors": fmt.Sprintf("failed to generate token %v", err)})
+		return fmt.Errorf("failed to generate token: %w", err)
 	}
 
 	return c.JSON(http.StatusOK, map[string]string{"token": token})
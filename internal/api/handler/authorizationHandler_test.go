@@ -22,7 +22,7 @@ func TestAuthorizationHandler_Login(t *testing.T) {
 		setupMocks     func(*mock_repository.MockUserRepository)
 		requestBody    string
 		expectedStatus int
-		expectedBody   string
+		expectedCode   string
 	}{
 		{
 			name: "invalid request body",
@@ -30,7 +30,7 @@ func TestAuthorizationHandler_Login(t *testing.T) {
 			},
 			requestBody:    `{"username":"testuser"`, // Ошибка в JSON
 			expectedStatus: http.StatusBadRequest,
-			expectedBody:   `{"errors":"invalid request code=400, message=unexpected EOF, internal=unexpected EOF"}`,
+			expectedCode:   "invalid_request",
 		},
 		{
 			name: "failed to fetch user info",
@@ -40,8 +40,8 @@ func TestAuthorizationHandler_Login(t *testing.T) {
 					Return(nil, errors.New("database error"))
 			},
 			requestBody:    `{"username":"testuser","password":"testpass"}`,
-			expectedStatus: http.StatusUnauthorized,
-			expectedBody:   `{"errors":"failed to fetch user info database error"}`,
+			expectedStatus: http.StatusInternalServerError,
+			expectedCode:   "internal_error",
 		},
 		{
 			name: "invalid password",
@@ -56,7 +56,7 @@ func TestAuthorizationHandler_Login(t *testing.T) {
 			},
 			requestBody:    `{"username":"testuser","password":"wrongpass"}`,
 			expectedStatus: http.StatusUnauthorized,
-			expectedBody:   `{"errors": "invalid password"}`,
+			expectedCode:   "invalid_credentials",
 		},
 	}
 
@@ -79,11 +79,11 @@ func TestAuthorizationHandler_Login(t *testing.T) {
 			rec := httptest.NewRecorder()
 			c := e.NewContext(req, rec)
 
-			err := handler.Login(c)
+			serve(c, handler.Login)
 
-			assert.NoError(t, err)
 			assert.Equal(t, tt.expectedStatus, rec.Code)
-			assert.JSONEq(t, tt.expectedBody, rec.Body.String())
+			assertProblem(t, rec, tt.expectedCode)
+			assert.NotContains(t, rec.Body.String(), "database error")
 		})
 	}
 }
@@ -2,9 +2,12 @@ package handler
 
 import (
 	"fmt"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/api/problem"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/models"
 	"github.com/Ki4EH/stunning-octo-waddle/internal/db/repository"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/metrics"
 	"github.com/Ki4EH/stunning-octo-waddle/internal/utils"
-	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 	"net/http"
 )
@@ -20,26 +23,42 @@ func NewCoinHandler(repo repository.CoinRepository) *CoinHandler {
 }
 
 func (r *CoinHandler) BuyItem(c echo.Context) error {
-	user, ok := c.Get("user").(*jwt.Token)
+	userID, ok := utils.UserIDFromContext(c)
 	if !ok {
-		c.Response().Status = http.StatusInternalServerError
-		return c.JSON(http.StatusInternalServerError, map[string]string{"errors": "failed to get jwt token"})
+		return problem.MissingToken()
 	}
-	claims, ok := user.Claims.(*utils.Claims)
+
+	if err := r.buy(c, userID, c.Param("item")); err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusOK)
+}
+
+// Purchase — /api/v2/purchases: покупка через POST с товаром в теле запроса.
+func (r *CoinHandler) Purchase(c echo.Context) error {
+	userID, ok := utils.UserIDFromContext(c)
 	if !ok {
-		c.Response().Status = http.StatusInternalServerError
-		return c.JSON(http.StatusInternalServerError, map[string]string{"errors": "failed to get jwt token"})
+		return problem.MissingToken()
 	}
-	userID := claims.UserID
-	item := c.Param("item")
 
-	err := r.repo.BuyItemFromShop(c.Request().Context(), userID, item)
+	var purchase models.Purchase
+	if err := c.Bind(&purchase); err != nil {
+		return problem.InvalidRequest("invalid request body")
+	}
+	if purchase.Item == "" {
+		return problem.InvalidField("item", "is required")
+	}
 
-	if err != nil {
-		c.Response().Status = http.StatusBadRequest
-		c.Logger().Error("failed to buy item ", err)
-		return c.JSON(http.StatusBadRequest, map[string]string{"errors": fmt.Sprintf("failed to buy item %v", err)})
+	if err := r.buy(c, userID, purchase.Item); err != nil {
+		return err
 	}
+	return c.NoContent(http.StatusNoContent)
+}
 
-	return c.NoContent(http.StatusOK)
+func (r *CoinHandler) buy(c echo.Context, userID uuid.UUID, item string) error {
+	if err := r.repo.BuyItemFromShop(c.Request().Context(), userID, item); err != nil {
+		return fmt.Errorf("failed to buy item: %w", err)
+	}
+	metrics.ItemsSold.WithLabelValues(item).Inc()
+	return nil
 }
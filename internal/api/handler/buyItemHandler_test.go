@@ -2,6 +2,7 @@ package handler
 
 import (
 	"errors"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/repository"
 	mock_repository "github.com/Ki4EH/stunning-octo-waddle/internal/mocks/repository"
 	"github.com/Ki4EH/stunning-octo-waddle/internal/utils"
 	"github.com/golang-jwt/jwt/v5"
@@ -23,7 +24,7 @@ func TestCoinHandler_BuyItem(t *testing.T) {
 		token          *jwt.Token
 		item           string
 		expectedStatus int
-		expectedBody   string
+		expectedCode   string
 	}{
 		{
 			name: "successful purchase",
@@ -39,7 +40,6 @@ func TestCoinHandler_BuyItem(t *testing.T) {
 			},
 			item:           "item1",
 			expectedStatus: http.StatusOK,
-			expectedBody:   "",
 		},
 		{
 			name: "failed to get JWT token",
@@ -48,14 +48,14 @@ func TestCoinHandler_BuyItem(t *testing.T) {
 			token:          nil, // симулируем отсутствие токена
 			item:           "item1",
 			expectedStatus: http.StatusInternalServerError,
-			expectedBody:   `{"errors":"failed to get jwt token"}`,
+			expectedCode:   "internal_error",
 		},
 		{
-			name: "failed to buy item - insufficient funds",
+			name: "failed to buy item - insufficient balance",
 			setupMocks: func(mockRepo *mock_repository.MockCoinRepository) {
 				mockRepo.EXPECT().
 					BuyItemFromShop(gomock.Any(), gomock.Any(), "item1").
-					Return(errors.New("insufficient funds"))
+					Return(repository.ErrInsufficientBalance)
 			},
 			token: &jwt.Token{
 				Claims: &utils.Claims{
@@ -63,8 +63,8 @@ func TestCoinHandler_BuyItem(t *testing.T) {
 				},
 			},
 			item:           "item1",
-			expectedStatus: http.StatusBadRequest,
-			expectedBody:   `{"errors":"failed to buy item insufficient funds"}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedCode:   "insufficient_balance",
 		},
 		{
 			name: "failed to buy item - repository error",
@@ -79,8 +79,8 @@ func TestCoinHandler_BuyItem(t *testing.T) {
 				},
 			},
 			item:           "item1",
-			expectedStatus: http.StatusBadRequest,
-			expectedBody:   `{"errors":"failed to buy item database error"}`,
+			expectedStatus: http.StatusInternalServerError,
+			expectedCode:   "internal_error",
 		},
 	}
 
@@ -107,14 +107,13 @@ func TestCoinHandler_BuyItem(t *testing.T) {
 				c.Set("user", tt.token)
 			}
 
-			err := handler.BuyItem(c)
+			serve(c, handler.BuyItem)
 
-			assert.NoError(t, err)
 			assert.Equal(t, tt.expectedStatus, rec.Code)
-			if tt.name == "successful purchase" {
-				assert.Empty(t, rec.Body.String())
+			if tt.expectedCode != "" {
+				assertProblem(t, rec, tt.expectedCode)
 			} else {
-				assert.JSONEq(t, tt.expectedBody, rec.Body.String())
+				assert.Empty(t, rec.Body.String())
 			}
 		})
 	}
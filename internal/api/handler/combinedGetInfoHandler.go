@@ -1,93 +1,123 @@
 package handler
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/api/problem"
 	"github.com/Ki4EH/stunning-octo-waddle/internal/db/models"
 	"github.com/Ki4EH/stunning-octo-waddle/internal/db/repository"
 	"github.com/Ki4EH/stunning-octo-waddle/internal/utils"
-	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 	"net/http"
 	"sync"
-	"time"
 )
 
 type CombinedRepository struct {
 	userRepo repository.UserRepository
 	coinRepo repository.CoinRepository
+	info     *InfoCache
 }
 
-func NewCombinedRepository(userRepo repository.UserRepository, coinRepo repository.CoinRepository) *CombinedRepository {
+// NewCombinedRepository создаёт обработчик. info может быть nil, тогда ответы
+// /api/info не кешируются.
+func NewCombinedRepository(userRepo repository.UserRepository, coinRepo repository.CoinRepository, info *InfoCache) *CombinedRepository {
 	return &CombinedRepository{
 		userRepo: userRepo,
 		coinRepo: coinRepo,
+		info:     info,
 	}
 }
 
 func (r *CombinedRepository) GetInfo(c echo.Context) error {
-
-	user, ok := c.Get("user").(*jwt.Token)
+	userID, ok := utils.UserIDFromContext(c)
 	if !ok {
-		c.Response().Status = http.StatusInternalServerError
-		return c.JSON(http.StatusInternalServerError, map[string]string{"errors": "failed to get jwt token"})
+		return problem.MissingToken()
 	}
-	claims, ok := user.Claims.(*utils.Claims)
+
+	return r.serveInfo(c, userID, true)
+}
+
+// GetWallet — /api/v2/info: баланс и инвентарь, история отдаётся
+// постранично через GetHistory.
+func (r *CombinedRepository) GetWallet(c echo.Context) error {
+	userID, ok := utils.UserIDFromContext(c)
 	if !ok {
-		c.Response().Status = http.StatusInternalServerError
-		return c.JSON(http.StatusInternalServerError, map[string]string{"errors": "failed to get jwt token"})
+		return problem.MissingToken()
 	}
-	userID := claims.UserID
 
+	return r.serveInfo(c, userID, false)
+}
+
+// serveInfo отдаёт ответ с ETag, а на совпавший If-None-Match — 304 без тела.
+func (r *CombinedRepository) serveInfo(c echo.Context, userID uuid.UUID, withHistory bool) error {
+	ctx := c.Request().Context()
+	info, err := r.info.load(infoKey{userID: userID, withHistory: withHistory}, func() (any, error) {
+		response, err := r.loadInfo(ctx, userID, withHistory)
+		if err != nil {
+			return nil, err
+		}
+		if !withHistory {
+			return response.Wallet, nil
+		}
+		return response, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	header := c.Response().Header()
+	header.Set("ETag", info.etag)
+	// Ответ личный, а перед повторным использованием его нужно сверить
+	header.Set(echo.HeaderCacheControl, "private, no-cache")
+	if etagMatches(c.Request().Header.Get("If-None-Match"), info.etag) {
+		return c.NoContent(http.StatusNotModified)
+	}
+	return c.JSONBlob(http.StatusOK, info.body)
+}
+
+// loadInfo параллельно загружает данные пользователя. История переводов
+// читается целиком, только если withHistory.
+func (r *CombinedRepository) loadInfo(ctx context.Context, userID uuid.UUID, withHistory bool) (*models.User, error) {
 	var wg sync.WaitGroup
 	var userCredential *models.Credential
+	var expiring *models.ExpiringCoins
 	userItems := make([]models.UserItem, 0)
 	allTx := make([]models.Transaction, 0)
-	var userErr, itemsErr, receivedErr, sentErr error
+	var userErr, itemsErr, receivedErr, expiringErr error
 
 	wg.Add(3)
 	go func() {
 		defer wg.Done()
 
-		start := time.Now()
-		userCredential, userErr = r.userRepo.GetUserByID(c.Request().Context(), userID)
-
-		elapsed := time.Since(start)
-		if elapsed > 50*time.Millisecond {
-			c.Logger().Error("Slow SQL", fmt.Sprintf("GetUserByID DB REQUEST took %s\n", elapsed))
-		}
+		userCredential, userErr = r.userRepo.GetUserByID(ctx, userID)
 	}()
 
 	go func() {
 		defer wg.Done()
 
-		start := time.Now()
+		itemsErr = r.userRepo.GetUserItems(ctx, userID, &userItems)
+	}()
 
-		itemsErr = r.userRepo.GetUserItems(c.Request().Context(), userID, &userItems)
+	if withHistory {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
 
-		elapsed := time.Since(start)
-		if elapsed > 50*time.Millisecond {
-			c.Logger().Error("Slow SQL", fmt.Sprintf("GetUserItems DB REQUEST took %s\n", elapsed))
-		}
-	}()
+			receivedErr = r.coinRepo.GetTransactions(ctx, userID, &allTx)
+		}()
+	}
 
 	go func() {
 		defer wg.Done()
 
-		start := time.Now()
-
-		receivedErr = r.coinRepo.GetTransactions(c.Request().Context(), userID, &allTx)
-
-		elapsed := time.Since(start)
-		if elapsed > 50*time.Millisecond {
-			c.Logger().Error("Slow SQL ", fmt.Sprintf("GetTransactions DB REQUEST took %s\n", elapsed))
-		}
-
+		expiring, expiringErr = r.coinRepo.GetExpiringCoins(ctx, userID)
 	}()
 	wg.Wait()
 
-	if userErr != nil || itemsErr != nil || receivedErr != nil || sentErr != nil {
-		c.Logger().Error("failed to fetch data", userErr, itemsErr, receivedErr, sentErr)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"errors": "failed to fetch data"})
+	if userErr != nil || itemsErr != nil || receivedErr != nil || expiringErr != nil {
+		return nil, fmt.Errorf("failed to fetch data: %w", errors.Join(userErr, itemsErr, receivedErr, expiringErr))
 	}
 
 	tx := models.CoinHistory{
@@ -97,20 +127,23 @@ func (r *CombinedRepository) GetInfo(c echo.Context) error {
 
 	for _, t := range allTx {
 		if t.ToUser == userCredential.Username {
-			tx.Received = append(tx.Received, models.ReceivedTransaction{FromUser: t.FromUser, Amount: t.Amount})
+			tx.Received = append(tx.Received, models.ReceivedTransaction{
+				ID: t.ID, FromUser: t.FromUser, Amount: t.Amount, Reversed: t.Reversed, ReversalOf: t.ReversalOf,
+			})
 		} else {
-			tx.Sent = append(tx.Sent, models.SentTransaction{ToUser: t.ToUser, Amount: t.Amount})
+			tx.Sent = append(tx.Sent, models.SentTransaction{
+				ID: t.ID, ToUser: t.ToUser, Amount: t.Amount, Reversed: t.Reversed, ReversalOf: t.ReversalOf,
+			})
 		}
 	}
 
-	response := models.User{
-		Coin:      userCredential.Coin,
-		Inventory: userItems,
-		CoinHistory: models.CoinHistory{
-			Received: tx.Received,
-			Sent:     tx.Sent,
+	return &models.User{
+		Wallet: models.Wallet{
+			Coin:         userCredential.Coin - userCredential.Held,
+			HeldCoins:    userCredential.Held,
+			ExpiringSoon: *expiring,
+			Inventory:    userItems,
 		},
-	}
-
-	return c.JSON(http.StatusOK, response)
+		CoinHistory: tx,
+	}, nil
 }
@@ -0,0 +1,140 @@
+package handler
+
+import (
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/models"
+	mock_repository "github.com/Ki4EH/stunning-octo-waddle/internal/mocks/repository"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/utils"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCombinedRepository_GetWallet(t *testing.T) {
+	e := echo.New()
+	userID := uuid.New()
+
+	// expectLoad ожидает одну загрузку кошелька с балансом coin.
+	expectLoad := func(users *mock_repository.MockUserRepository, coins *mock_repository.MockCoinRepository, coin int64) {
+		users.EXPECT().GetUserByID(gomock.Any(), userID).Return(&models.Credential{ID: userID, Username: "alice", Coin: coin}, nil)
+		users.EXPECT().GetUserItems(gomock.Any(), userID, gomock.Any()).Return(nil)
+		coins.EXPECT().GetExpiringCoins(gomock.Any(), userID).Return(&models.ExpiringCoins{}, nil)
+	}
+
+	get := func(handler *CombinedRepository, ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/v2/info", nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.Set("user", &jwt.Token{Claims: &utils.Claims{UserID: userID}})
+		serve(c, handler.GetWallet)
+		return rec
+	}
+
+	tests := []struct {
+		name string
+		run  func(t *testing.T, users *mock_repository.MockUserRepository, coins *mock_repository.MockCoinRepository, cache *InfoCache)
+	}{
+		{
+			name: "repeated request is served from cache",
+			run: func(t *testing.T, users *mock_repository.MockUserRepository, coins *mock_repository.MockCoinRepository, cache *InfoCache) {
+				expectLoad(users, coins, 100)
+				handler := NewCombinedRepository(users, coins, cache)
+
+				first := get(handler, "")
+				second := get(handler, "")
+				require.Equal(t, http.StatusOK, second.Code)
+				assert.Equal(t, first.Body.String(), second.Body.String())
+				assert.Equal(t, first.Header().Get("ETag"), second.Header().Get("ETag"))
+			},
+		},
+		{
+			name: "invalidate reloads changed wallet",
+			run: func(t *testing.T, users *mock_repository.MockUserRepository, coins *mock_repository.MockCoinRepository, cache *InfoCache) {
+				expectLoad(users, coins, 100)
+				expectLoad(users, coins, 90)
+				handler := NewCombinedRepository(users, coins, cache)
+
+				first := get(handler, "")
+				cache.Invalidate(userID)
+				second := get(handler, "")
+				assert.Contains(t, second.Body.String(), `"coins":90`)
+				assert.NotEqual(t, first.Header().Get("ETag"), second.Header().Get("ETag"))
+			},
+		},
+		{
+			name: "event from broker invalidates",
+			run: func(t *testing.T, users *mock_repository.MockUserRepository, coins *mock_repository.MockCoinRepository, cache *InfoCache) {
+				expectLoad(users, coins, 100)
+				expectLoad(users, coins, 110)
+				handler := NewCombinedRepository(users, coins, cache)
+
+				get(handler, "")
+				cache.Observer().Event(models.UserEvent{UserID: userID, Type: models.EventCoinsReceived})
+				assert.Contains(t, get(handler, "").Body.String(), `"coins":110`)
+			},
+		},
+		{
+			name: "matching If-None-Match gets 304",
+			run: func(t *testing.T, users *mock_repository.MockUserRepository, coins *mock_repository.MockCoinRepository, cache *InfoCache) {
+				expectLoad(users, coins, 100)
+				handler := NewCombinedRepository(users, coins, cache)
+
+				etag := get(handler, "").Header().Get("ETag")
+				require.NotEmpty(t, etag)
+
+				rec := get(handler, `"other", W/`+etag)
+				assert.Equal(t, http.StatusNotModified, rec.Code)
+				assert.Empty(t, rec.Body.String())
+				assert.Equal(t, etag, rec.Header().Get("ETag"))
+			},
+		},
+		{
+			name: "without cache every request loads",
+			run: func(t *testing.T, users *mock_repository.MockUserRepository, coins *mock_repository.MockCoinRepository, cache *InfoCache) {
+				expectLoad(users, coins, 100)
+				expectLoad(users, coins, 100)
+				handler := NewCombinedRepository(users, coins, nil)
+
+				etag := get(handler, "").Header().Get("ETag")
+				assert.Equal(t, http.StatusNotModified, get(handler, etag).Code)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			users := mock_repository.NewMockUserRepository(ctrl)
+			coins := mock_repository.NewMockCoinRepository(ctrl)
+
+			tt.run(t, users, coins, NewInfoCache(10, time.Minute))
+		})
+	}
+}
+
+func TestEtagMatches(t *testing.T) {
+	tests := []struct {
+		ifNoneMatch string
+		expected    bool
+	}{
+		{ifNoneMatch: "", expected: false},
+		{ifNoneMatch: `"abc"`, expected: true},
+		{ifNoneMatch: `W/"abc"`, expected: true},
+		{ifNoneMatch: `"x", "abc"`, expected: true},
+		{ifNoneMatch: "*", expected: true},
+		{ifNoneMatch: `"abcd"`, expected: false},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, etagMatches(tt.ifNoneMatch, `"abc"`), tt.ifNoneMatch)
+	}
+}
@@ -0,0 +1,138 @@
+package handler
+
+import (
+	"fmt"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/api/problem"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/models"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/repository"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/events"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/logger"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/metrics"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/utils"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	HeaderLastEventID = "Last-Event-ID"
+	MIMEEventStream   = "text/event-stream"
+
+	defaultHeartbeat = 15 * time.Second
+	replayBatchSize  = 100
+	// Через сколько миллисекунд EventSource переподключается после обрыва
+	eventsRetryMillis = 3000
+)
+
+type EventsHandler struct {
+	repo      repository.EventRepository
+	broker    *events.Broker
+	heartbeat time.Duration
+}
+
+// NewEventsHandler создаёт обработчик потока событий. Раз в heartbeat в поток
+// пишется комментарий, чтобы прокси не закрывали простаивающее соединение.
+func NewEventsHandler(repo repository.EventRepository, broker *events.Broker, heartbeat time.Duration) *EventsHandler {
+	if heartbeat <= 0 {
+		heartbeat = defaultHeartbeat
+	}
+	return &EventsHandler{
+		repo:      repo,
+		broker:    broker,
+		heartbeat: heartbeat,
+	}
+}
+
+// Stream — /api/v2/events: события пользователя в формате Server-Sent Events.
+// С заголовком Last-Event-ID сначала отдаются сохранённые события после него.
+func (h *EventsHandler) Stream(c echo.Context) error {
+	userID, ok := utils.UserIDFromContext(c)
+	if !ok {
+		return problem.MissingToken()
+	}
+
+	var lastID int64
+	replay := false
+	if raw := c.Request().Header.Get(HeaderLastEventID); raw != "" {
+		var err error
+		if lastID, err = strconv.ParseInt(raw, 10, 64); err != nil || lastID < 0 {
+			return problem.InvalidField(HeaderLastEventID, "must be a non-negative integer")
+		}
+		replay = true
+	}
+
+	// Подписка создаётся до чтения истории, чтобы не потерять события между
+	// ними. Повторы отсеиваются по id: события одного пользователя пишутся
+	// под блокировкой его строки, поэтому id растут в порядке коммитов.
+	sub := h.broker.Subscribe(userID)
+	defer sub.Close()
+
+	metrics.EventStreams.Inc()
+	defer metrics.EventStreams.Dec()
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, MIMEEventStream)
+	res.Header().Set(echo.HeaderCacheControl, "no-cache")
+	// Отключает буферизацию ответа в nginx
+	res.Header().Set("X-Accel-Buffering", "no")
+	res.WriteHeader(http.StatusOK)
+	if _, err := fmt.Fprintf(res, "retry: %d\n\n", eventsRetryMillis); err != nil {
+		return nil
+	}
+	res.Flush()
+
+	ctx := c.Request().Context()
+	log := logger.FromContext(ctx)
+
+	for replay {
+		batch, err := h.repo.GetEventsAfter(ctx, userID, lastID, replayBatchSize)
+		if err != nil {
+			// Заголовки уже отправлены, клиент переподключится и повторит
+			log.Error("failed to replay events", zap.Error(err))
+			return nil
+		}
+		for _, event := range batch {
+			if err = writeEvent(res, event); err != nil {
+				return nil
+			}
+			lastID = event.ID
+		}
+		res.Flush()
+		replay = len(batch) == replayBatchSize
+	}
+
+	heartbeat := time.NewTicker(h.heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-sub.Events:
+			if !ok {
+				return nil
+			}
+			if event.ID <= lastID {
+				continue
+			}
+			if err := writeEvent(res, event); err != nil {
+				return nil
+			}
+			lastID = event.ID
+			res.Flush()
+		case <-heartbeat.C:
+			if _, err := io.WriteString(res, ": ping\n\n"); err != nil {
+				return nil
+			}
+			res.Flush()
+		}
+	}
+}
+
+func writeEvent(w io.Writer, event models.UserEvent) error {
+	_, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, event.Payload)
+	return err
+}
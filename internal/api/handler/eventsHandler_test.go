@@ -0,0 +1,155 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/models"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/events"
+	mock_repository "github.com/Ki4EH/stunning-octo-waddle/internal/mocks/repository"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/utils"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestEventsHandler_Stream(t *testing.T) {
+	e := echo.New()
+	userID := uuid.New()
+
+	event := func(id int64) models.UserEvent {
+		return models.UserEvent{
+			ID:      id,
+			UserID:  userID,
+			Type:    models.EventCoinsGranted,
+			Payload: json.RawMessage(`{"amount":10}`),
+		}
+	}
+
+	tests := []struct {
+		name        string
+		lastEventID string
+		setupMock   func(repo *mock_repository.MockEventRepository)
+		live        []models.UserEvent
+		wantBody    string
+	}{
+		{
+			name: "live events only",
+			live: []models.UserEvent{event(1), event(2)},
+			wantBody: "retry: 3000\n\n" +
+				"id: 1\nevent: coins_granted\ndata: {\"amount\":10}\n\n" +
+				"id: 2\nevent: coins_granted\ndata: {\"amount\":10}\n\n",
+		},
+		{
+			name:        "replay skips live duplicates",
+			lastEventID: "5",
+			setupMock: func(repo *mock_repository.MockEventRepository) {
+				repo.EXPECT().GetEventsAfter(gomock.Any(), userID, int64(5), replayBatchSize).
+					Return([]models.UserEvent{event(6), event(7)}, nil)
+			},
+			live: []models.UserEvent{event(7), event(8)},
+			wantBody: "retry: 3000\n\n" +
+				"id: 6\nevent: coins_granted\ndata: {\"amount\":10}\n\n" +
+				"id: 7\nevent: coins_granted\ndata: {\"amount\":10}\n\n" +
+				"id: 8\nevent: coins_granted\ndata: {\"amount\":10}\n\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mockRepo := mock_repository.NewMockEventRepository(ctrl)
+			if tt.setupMock != nil {
+				tt.setupMock(mockRepo)
+			}
+			broker := events.NewBroker()
+			handler := NewEventsHandler(mockRepo, broker, time.Hour)
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v2/events", nil)
+			if tt.lastEventID != "" {
+				req.Header.Set(HeaderLastEventID, tt.lastEventID)
+			}
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.Set("user", &jwt.Token{Claims: &utils.Claims{UserID: userID}})
+
+			done := make(chan error, 1)
+			go func() { done <- handler.Stream(c) }()
+
+			require.Eventually(t, func() bool { return broker.Subscribers() == 1 }, time.Second, time.Millisecond)
+			for _, ev := range tt.live {
+				broker.Publish(ev)
+			}
+			// Закрытие брокера завершает поток, как при остановке сервера
+			broker.Close()
+
+			select {
+			case err := <-done:
+				require.NoError(t, err)
+			case <-time.After(time.Second):
+				t.Fatal("stream did not stop")
+			}
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Equal(t, MIMEEventStream, rec.Header().Get(echo.HeaderContentType))
+			assert.Equal(t, tt.wantBody, rec.Body.String())
+		})
+	}
+
+	t.Run("replay error ends the stream", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mockRepo := mock_repository.NewMockEventRepository(ctrl)
+		mockRepo.EXPECT().GetEventsAfter(gomock.Any(), userID, int64(0), replayBatchSize).
+			Return(nil, errors.New("db down"))
+		broker := events.NewBroker()
+		handler := NewEventsHandler(mockRepo, broker, time.Hour)
+
+		req := httptest.NewRequest(http.MethodGet, "/api/v2/events", nil)
+		req.Header.Set(HeaderLastEventID, "0")
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.Set("user", &jwt.Token{Claims: &utils.Claims{UserID: userID}})
+
+		require.NoError(t, handler.Stream(c))
+		assert.Equal(t, "retry: 3000\n\n", rec.Body.String())
+		assert.Equal(t, 0, broker.Subscribers())
+	})
+
+	t.Run("invalid Last-Event-ID", func(t *testing.T) {
+		handler := NewEventsHandler(nil, events.NewBroker(), 0)
+		for _, value := range []string{"abc", "-1"} {
+			req := httptest.NewRequest(http.MethodGet, "/api/v2/events", nil)
+			req.Header.Set(HeaderLastEventID, value)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.Set("user", &jwt.Token{Claims: &utils.Claims{UserID: userID}})
+
+			serve(c, handler.Stream)
+			assert.Equal(t, http.StatusBadRequest, rec.Code, value)
+			assertProblem(t, rec, "invalid_request")
+		}
+	})
+
+	t.Run("heartbeat", func(t *testing.T) {
+		broker := events.NewBroker()
+		handler := NewEventsHandler(nil, broker, time.Millisecond)
+
+		req := httptest.NewRequest(http.MethodGet, "/api/v2/events", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.Set("user", &jwt.Token{Claims: &utils.Claims{UserID: userID}})
+
+		done := make(chan error, 1)
+		go func() { done <- handler.Stream(c) }()
+		require.Eventually(t, func() bool { return broker.Subscribers() == 1 }, time.Second, time.Millisecond)
+		time.Sleep(20 * time.Millisecond)
+		broker.Close()
+		require.NoError(t, <-done)
+		assert.Contains(t, rec.Body.String(), ": ping\n\n")
+	})
+}
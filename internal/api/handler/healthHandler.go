@@ -0,0 +1,30 @@
+package handler
+
+import (
+	"github.com/Ki4EH/stunning-octo-waddle/internal/health"
+	"github.com/labstack/echo/v4"
+	"net/http"
+)
+
+type HealthHandler struct {
+	checker *health.Checker
+}
+
+func NewHealthHandler(checker *health.Checker) *HealthHandler {
+	return &HealthHandler{
+		checker: checker,
+	}
+}
+
+// Live отвечает, пока процесс жив и обрабатывает запросы
+func (h *HealthHandler) Live(c echo.Context) error {
+	return c.JSON(http.StatusOK, health.Report{Status: health.StatusOK})
+}
+
+func (h *HealthHandler) Ready(c echo.Context) error {
+	report := h.checker.Ready(c.Request().Context())
+	if report.Status != health.StatusOK {
+		return c.JSON(http.StatusServiceUnavailable, report)
+	}
+	return c.JSON(http.StatusOK, report)
+}
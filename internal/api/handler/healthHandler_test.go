@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/health"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHealthHandler_Live(t *testing.T) {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	checker := health.NewChecker()
+	checker.SetShuttingDown()
+	h := NewHealthHandler(checker)
+
+	if assert.NoError(t, h.Live(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"status":"ok"}`, rec.Body.String())
+	}
+}
+
+func TestHealthHandler_Ready(t *testing.T) {
+	e := echo.New()
+
+	ok := func(context.Context) error { return nil }
+	failing := func(context.Context) error { return errors.New("connection refused") }
+
+	tests := []struct {
+		name           string
+		checks         map[string]health.Check
+		shuttingDown   bool
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "all checks pass",
+			checks:         map[string]health.Check{"database": ok, "pool": ok},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"status":"ok","checks":{"database":{"status":"ok"},"pool":{"status":"ok"}}}`,
+		},
+		{
+			name:           "database unavailable",
+			checks:         map[string]health.Check{"database": failing, "pool": ok},
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedBody: `{"status":"unavailable","checks":{` +
+				`"database":{"status":"unavailable","error":"connection refused"},"pool":{"status":"ok"}}}`,
+		},
+		{
+			name:           "shutting down",
+			checks:         map[string]health.Check{"database": ok},
+			shuttingDown:   true,
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedBody:   `{"status":"unavailable","checks":{"shutdown":{"status":"unavailable","error":"server is shutting down"}}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker := health.NewChecker()
+			for name, check := range tt.checks {
+				checker.AddCheck(name, check)
+			}
+			if tt.shuttingDown {
+				checker.SetShuttingDown()
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/readyz", nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			h := NewHealthHandler(checker)
+			if assert.NoError(t, h.Ready(c)) {
+				assert.Equal(t, tt.expectedStatus, rec.Code)
+				assert.JSONEq(t, tt.expectedBody, rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package handler
+
+import (
+	"encoding/json"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/api/problem"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http/httptest"
+	"testing"
+)
+
+// serve вызывает обработчик и, как Echo, передаёт его ошибку в HTTPErrorHandler.
+func serve(c echo.Context, h echo.HandlerFunc) {
+	if err := h(c); err != nil {
+		problem.HTTPErrorHandler(err, c)
+	}
+}
+
+// assertProblem проверяет, что ответ — problem+json с ожидаемым кодом.
+func assertProblem(t *testing.T, rec *httptest.ResponseRecorder, code string) {
+	t.Helper()
+
+	assert.Equal(t, problem.ContentType, rec.Header().Get(echo.HeaderContentType))
+	var p problem.Problem
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &p))
+	assert.Equal(t, code, p.Code)
+	assert.Equal(t, rec.Code, p.Status)
+}
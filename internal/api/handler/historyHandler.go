@@ -0,0 +1,88 @@
+package handler
+
+import (
+	"encoding/base64"
+	"fmt"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/api/problem"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/models"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/utils"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultHistoryLimit = 20
+	maxHistoryLimit     = 100
+)
+
+// GetHistory — /api/v2/history: переводы пользователя от новых к старым.
+// Следующая страница запрашивается с cursor из nextCursor предыдущей.
+func (r *CoinHandler) GetHistory(c echo.Context) error {
+	userID, ok := utils.UserIDFromContext(c)
+	if !ok {
+		return problem.MissingToken()
+	}
+
+	limit := defaultHistoryLimit
+	if raw := c.QueryParam("limit"); raw != "" {
+		var err error
+		if limit, err = strconv.Atoi(raw); err != nil || limit < 1 || limit > maxHistoryLimit {
+			return problem.InvalidField("limit", fmt.Sprintf("must be between 1 and %d", maxHistoryLimit))
+		}
+	}
+
+	var after *models.HistoryCursor
+	if raw := c.QueryParam("cursor"); raw != "" {
+		cursor, err := decodeCursor(raw)
+		if err != nil {
+			return problem.InvalidField("cursor", "is malformed")
+		}
+		after = &cursor
+	}
+
+	// Лишняя запись показывает, что есть следующая страница
+	entries, err := r.repo.GetHistory(c.Request().Context(), userID, limit+1, after)
+	if err != nil {
+		return fmt.Errorf("failed to get history: %w", err)
+	}
+
+	var page models.HistoryPage
+	if len(entries) > limit {
+		entries = entries[:limit]
+		last := entries[limit-1]
+		page.NextCursor = encodeCursor(models.HistoryCursor{CreatedAt: last.CreatedAt, ID: last.ID})
+	}
+	// Пустая история — пустой массив, а не null
+	page.Items = append(make([]models.HistoryEntry, 0, len(entries)), entries...)
+
+	return c.JSON(http.StatusOK, page)
+}
+
+func encodeCursor(cursor models.HistoryCursor) string {
+	raw := cursor.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + cursor.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(s string) (models.HistoryCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return models.HistoryCursor{}, err
+	}
+	createdAt, id, found := strings.Cut(string(raw), "|")
+	if !found {
+		return models.HistoryCursor{}, fmt.Errorf("cursor without separator")
+	}
+
+	var cursor models.HistoryCursor
+	if cursor.CreatedAt, err = time.Parse(time.RFC3339Nano, createdAt); err != nil {
+		return models.HistoryCursor{}, err
+	}
+	if cursor.ID, err = uuid.Parse(id); err != nil {
+		return models.HistoryCursor{}, err
+	}
+	return cursor, nil
+}
@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"encoding/json"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/models"
+	mock_repository "github.com/Ki4EH/stunning-octo-waddle/internal/mocks/repository"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/utils"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCoinHandler_GetHistory(t *testing.T) {
+	e := echo.New()
+	userID := uuid.New()
+	now := time.Now().UTC()
+	entries := []models.HistoryEntry{
+		{ID: uuid.New(), Direction: models.HistorySent, Counterparty: "bob", Amount: 3, CreatedAt: now},
+		{ID: uuid.New(), Direction: models.HistoryReceived, Counterparty: "bob", Amount: 2, CreatedAt: now.Add(-time.Minute)},
+		{ID: uuid.New(), Direction: models.HistorySent, Counterparty: "carol", Amount: 1, CreatedAt: now.Add(-time.Hour)},
+	}
+
+	ctrl := gomock.NewController(t)
+	mockRepo := mock_repository.NewMockCoinRepository(ctrl)
+	handler := &CoinHandler{repo: mockRepo}
+
+	get := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/v2/history?"+query, nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.Set("user", &jwt.Token{Claims: &utils.Claims{UserID: userID}})
+		serve(c, handler.GetHistory)
+		return rec
+	}
+
+	t.Run("pages follow each other", func(t *testing.T) {
+		mockRepo.EXPECT().GetHistory(gomock.Any(), userID, 3, nil).Return(entries, nil)
+		mockRepo.EXPECT().
+			GetHistory(gomock.Any(), userID, 3, &models.HistoryCursor{CreatedAt: entries[1].CreatedAt, ID: entries[1].ID}).
+			Return(entries[2:], nil)
+
+		rec := get("limit=2")
+		require.Equal(t, http.StatusOK, rec.Code)
+		var first models.HistoryPage
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &first))
+		assert.Len(t, first.Items, 2)
+		require.NotEmpty(t, first.NextCursor)
+
+		rec = get("limit=2&cursor=" + first.NextCursor)
+		require.Equal(t, http.StatusOK, rec.Code)
+		var second models.HistoryPage
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &second))
+		assert.Len(t, second.Items, 1)
+		assert.Empty(t, second.NextCursor)
+	})
+
+	t.Run("default limit", func(t *testing.T) {
+		mockRepo.EXPECT().GetHistory(gomock.Any(), userID, defaultHistoryLimit+1, nil).Return(nil, nil)
+
+		rec := get("")
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"items":[]}`, rec.Body.String())
+	})
+
+	t.Run("invalid parameters", func(t *testing.T) {
+		for _, query := range []string{"limit=0", "limit=abc", "cursor=%21%21", "cursor=" + encodeCursor(models.HistoryCursor{})[:4]} {
+			rec := get(query)
+			assert.Equal(t, http.StatusBadRequest, rec.Code, query)
+			assertProblem(t, rec, "invalid_request")
+		}
+	})
+}
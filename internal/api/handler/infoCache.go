@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/cache"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/models"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/events"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/metrics"
+	"github.com/google/uuid"
+	"strings"
+	"time"
+)
+
+// InfoCache хранит готовые ответы /api/info и /api/v2/info. Ответ
+// пользователя сбрасывается, когда его данные меняются на этом экземпляре
+// (Invalidate как repository.WriteObserver) или на другом (события брокера,
+// пришедшие через LISTEN/NOTIFY). ttl ограничивает устаревание, если
+// событие потерялось.
+type InfoCache struct {
+	lru *cache.LRU[infoKey, cachedInfo]
+}
+
+type infoKey struct {
+	userID      uuid.UUID
+	withHistory bool
+}
+
+// cachedInfo — тело ответа и его ETag.
+type cachedInfo struct {
+	body []byte
+	etag string
+}
+
+// NewInfoCache создаёт кеш не больше чем на size ответов, каждый живёт ttl.
+func NewInfoCache(size int, ttl time.Duration) *InfoCache {
+	return &InfoCache{lru: cache.NewLRU[infoKey, cachedInfo](size, ttl)}
+}
+
+// Invalidate сбрасывает ответы пользователей.
+func (c *InfoCache) Invalidate(userIDs ...uuid.UUID) {
+	for _, id := range userIDs {
+		c.lru.Delete(infoKey{userID: id, withHistory: true})
+		c.lru.Delete(infoKey{userID: id, withHistory: false})
+	}
+}
+
+// Observer сбрасывает ответ получателя каждого события и весь кеш, если
+// события могли быть потеряны.
+func (c *InfoCache) Observer() events.Observer {
+	return events.Observer{
+		Event: func(event models.UserEvent) { c.Invalidate(event.UserID) },
+		Reset: c.lru.Purge,
+	}
+}
+
+// load возвращает ответ из кеша или строит его через build. Без кеша ответ
+// строится каждый раз, ETag при этом всё равно считается.
+func (c *InfoCache) load(key infoKey, build func() (any, error)) (cachedInfo, error) {
+	render := func() (cachedInfo, error) {
+		response, err := build()
+		if err != nil {
+			return cachedInfo{}, err
+		}
+		return newCachedInfo(response)
+	}
+	if c == nil {
+		return render()
+	}
+
+	info, hit, err := c.lru.Load(key, render)
+	if hit {
+		metrics.InfoCacheLookups.WithLabelValues("hit").Inc()
+	} else {
+		metrics.InfoCacheLookups.WithLabelValues("miss").Inc()
+	}
+	return info, err
+}
+
+func newCachedInfo(response any) (cachedInfo, error) {
+	body, err := json.Marshal(response)
+	if err != nil {
+		return cachedInfo{}, err
+	}
+	sum := sha256.Sum256(body)
+	return cachedInfo{body: body, etag: `"` + hex.EncodeToString(sum[:16]) + `"`}, nil
+}
+
+// etagMatches проверяет If-None-Match: список ETag через запятую или *.
+// Сравнение слабое, как требует RFC 9110 для If-None-Match.
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"fmt"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/api/problem"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/models"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/repository"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/utils"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"net/http"
+)
+
+type ReversalHandler struct {
+	repo repository.CoinRepository
+}
+
+func NewReversalHandler(repo repository.CoinRepository) *ReversalHandler {
+	return &ReversalHandler{
+		repo: repo,
+	}
+}
+
+// RequestReversal создаёт запрос на отмену перевода. Запросить отмену может
+// только отправитель, исполнить её — получатель или администратор.
+func (r *ReversalHandler) RequestReversal(c echo.Context) error {
+	userID, ok := utils.UserIDFromContext(c)
+	if !ok {
+		return problem.MissingToken()
+	}
+	transactionID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return problem.InvalidRequest("invalid transaction id")
+	}
+
+	var request models.ReversalRequest
+	if err = c.Bind(&request); err != nil {
+		return problem.InvalidRequest("invalid request")
+	}
+
+	reversal, err := r.repo.RequestReversal(c.Request().Context(), transactionID, userID, request.Reason)
+	if err != nil {
+		return fmt.Errorf("failed to request reversal: %w", err)
+	}
+
+	return c.JSON(http.StatusCreated, reversal)
+}
+
+func (r *ReversalHandler) ApproveReversal(c echo.Context) error {
+	userID, ok := utils.UserIDFromContext(c)
+	if !ok {
+		return problem.MissingToken()
+	}
+	reversalID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return problem.InvalidRequest("invalid reversal id")
+	}
+
+	reversal, err := r.repo.ApproveReversal(c.Request().Context(), reversalID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to approve reversal: %w", err)
+	}
+
+	return c.JSON(http.StatusOK, reversal)
+}
+
+func (r *ReversalHandler) RejectReversal(c echo.Context) error {
+	userID, ok := utils.UserIDFromContext(c)
+	if !ok {
+		return problem.MissingToken()
+	}
+	reversalID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return problem.InvalidRequest("invalid reversal id")
+	}
+
+	reversal, err := r.repo.RejectReversal(c.Request().Context(), reversalID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to reject reversal: %w", err)
+	}
+
+	return c.JSON(http.StatusOK, reversal)
+}
+
+func (r *ReversalHandler) ForceReversal(c echo.Context) error {
+	adminID, ok := utils.UserIDFromContext(c)
+	if !ok {
+		return problem.MissingToken()
+	}
+	transactionID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return problem.InvalidRequest("invalid transaction id")
+	}
+
+	var request models.ReversalRequest
+	if err = c.Bind(&request); err != nil {
+		return problem.InvalidRequest("invalid request")
+	}
+
+	reversal, err := r.repo.ForceReversal(c.Request().Context(), transactionID, adminID, request.Reason)
+	if err != nil {
+		return fmt.Errorf("failed to force reversal: %w", err)
+	}
+
+	return c.JSON(http.StatusOK, reversal)
+}
+
+func (r *ReversalHandler) GetReversals(c echo.Context) error {
+	userID, ok := utils.UserIDFromContext(c)
+	if !ok {
+		return problem.MissingToken()
+	}
+
+	reversals := make([]models.TransferReversal, 0)
+	if err := r.repo.GetReversals(c.Request().Context(), userID, &reversals); err != nil {
+		return fmt.Errorf("failed to fetch reversals: %w", err)
+	}
+
+	return c.JSON(http.StatusOK, map[string][]models.TransferReversal{"reversals": reversals})
+}
@@ -0,0 +1,172 @@
+package handler
+
+import (
+	"bytes"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/models"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/repository"
+	mock_repository "github.com/Ki4EH/stunning-octo-waddle/internal/mocks/repository"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/utils"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestReversalHandler_RequestReversal(t *testing.T) {
+	e := echo.New()
+	userID := uuid.New()
+	transactionID := uuid.New()
+
+	tests := []struct {
+		name           string
+		setupMocks     func(*mock_repository.MockCoinRepository)
+		token          *jwt.Token
+		transactionID  string
+		expectedStatus int
+		expectedCode   string
+	}{
+		{
+			name: "successful request",
+			setupMocks: func(mockRepo *mock_repository.MockCoinRepository) {
+				mockRepo.EXPECT().
+					RequestReversal(gomock.Any(), transactionID, userID, "wrong user").
+					Return(&models.TransferReversal{
+						ID:            transactionID,
+						TransactionID: transactionID,
+						FromUser:      "alice",
+						ToUser:        "bob",
+						Amount:        10,
+						Reason:        "wrong user",
+						Status:        models.ReversalStatusPending,
+					}, nil)
+			},
+			token:          &jwt.Token{Claims: &utils.Claims{UserID: userID}},
+			transactionID:  transactionID.String(),
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "failed to get JWT token",
+			setupMocks:     func(mockRepo *mock_repository.MockCoinRepository) {},
+			token:          nil,
+			transactionID:  transactionID.String(),
+			expectedStatus: http.StatusInternalServerError,
+			expectedCode:   "internal_error",
+		},
+		{
+			name:           "invalid transaction id",
+			setupMocks:     func(mockRepo *mock_repository.MockCoinRepository) {},
+			token:          &jwt.Token{Claims: &utils.Claims{UserID: userID}},
+			transactionID:  "not-a-uuid",
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   "invalid_request",
+		},
+		{
+			name: "repository error",
+			setupMocks: func(mockRepo *mock_repository.MockCoinRepository) {
+				mockRepo.EXPECT().
+					RequestReversal(gomock.Any(), transactionID, userID, "wrong user").
+					Return(nil, repository.ErrNotTransactionSender)
+			},
+			token:          &jwt.Token{Claims: &utils.Claims{UserID: userID}},
+			transactionID:  transactionID.String(),
+			expectedStatus: http.StatusForbidden,
+			expectedCode:   "not_transaction_sender",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockRepo := mock_repository.NewMockCoinRepository(ctrl)
+
+			tt.setupMocks(mockRepo)
+
+			handler := NewReversalHandler(mockRepo)
+
+			req := httptest.NewRequest(http.MethodPost, "/api/transactions/"+tt.transactionID+"/reversal",
+				bytes.NewReader([]byte(`{"reason":"wrong user"}`)))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("id")
+			c.SetParamValues(tt.transactionID)
+
+			if tt.token != nil {
+				c.Set("user", tt.token)
+			}
+
+			serve(c, handler.RequestReversal)
+
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+			if tt.expectedCode != "" {
+				assertProblem(t, rec, tt.expectedCode)
+			}
+		})
+	}
+}
+
+func TestReversalHandler_ApproveReversal(t *testing.T) {
+	e := echo.New()
+	userID := uuid.New()
+	reversalID := uuid.New()
+
+	tests := []struct {
+		name           string
+		setupMocks     func(*mock_repository.MockCoinRepository)
+		expectedStatus int
+		expectedCode   string
+	}{
+		{
+			name: "successful approval",
+			setupMocks: func(mockRepo *mock_repository.MockCoinRepository) {
+				mockRepo.EXPECT().
+					ApproveReversal(gomock.Any(), reversalID, userID).
+					Return(&models.TransferReversal{ID: reversalID, Status: models.ReversalStatusApproved}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name: "insufficient balance",
+			setupMocks: func(mockRepo *mock_repository.MockCoinRepository) {
+				mockRepo.EXPECT().
+					ApproveReversal(gomock.Any(), reversalID, userID).
+					Return(nil, repository.ErrInsufficientBalance)
+			},
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedCode:   "insufficient_balance",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockRepo := mock_repository.NewMockCoinRepository(ctrl)
+
+			tt.setupMocks(mockRepo)
+
+			handler := NewReversalHandler(mockRepo)
+
+			req := httptest.NewRequest(http.MethodPost, "/api/reversals/"+reversalID.String()+"/approve", nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("id")
+			c.SetParamValues(reversalID.String())
+			c.Set("user", &jwt.Token{Claims: &utils.Claims{UserID: userID}})
+
+			serve(c, handler.ApproveReversal)
+
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+			if tt.expectedCode != "" {
+				assertProblem(t, rec, tt.expectedCode)
+			}
+		})
+	}
+}
@@ -3,9 +3,12 @@ package handler
 import (
 	"errors"
 	"fmt"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/api/problem"
 	"github.com/Ki4EH/stunning-octo-waddle/internal/db/models"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/repository"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/logger"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/metrics"
 	"github.com/Ki4EH/stunning-octo-waddle/internal/utils"
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 	"github.com/labstack/echo/v4"
@@ -13,29 +16,54 @@ import (
 )
 
 func (r *CombinedRepository) SendCoinHandler(c echo.Context) error {
-	user, ok := c.Get("user").(*jwt.Token)
+	senderUserID, ok := utils.UserIDFromContext(c)
 	if !ok {
-		c.Response().Status = http.StatusInternalServerError
-		return c.JSON(http.StatusInternalServerError, map[string]string{"errors": "failed to get jwt token"})
+		return problem.MissingToken()
 	}
-	claims, ok := user.Claims.(*utils.Claims)
+
+	var sendCoinRequest models.SendCoin
+	if err := c.Bind(&sendCoinRequest); err != nil || sendCoinRequest.Amount <= 0 {
+		return problem.InvalidRequest("invalid request")
+	}
+
+	if err := r.sendCoins(c, senderUserID, sendCoinRequest); err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusOK)
+}
+
+// Transfer — /api/v2/transfers. В отличие от v1 отвечает 204 и сообщает,
+// какое поле запроса неверно.
+func (r *CombinedRepository) Transfer(c echo.Context) error {
+	senderUserID, ok := utils.UserIDFromContext(c)
 	if !ok {
-		c.Response().Status = http.StatusInternalServerError
-		return c.JSON(http.StatusInternalServerError, map[string]string{"errors": "failed to get jwt token"})
+		return problem.MissingToken()
 	}
-	senderUserID := claims.UserID
 
 	var sendCoinRequest models.SendCoin
-	if err := c.Bind(&sendCoinRequest); err != nil || sendCoinRequest.Amount <= 0 {
-		return c.JSON(http.StatusBadRequest, map[string]string{"errors": "invalid request"})
+	if err := c.Bind(&sendCoinRequest); err != nil {
+		return problem.InvalidRequest("invalid request body")
+	}
+	if sendCoinRequest.ToUser == "" {
+		return problem.InvalidField("toUser", "is required")
+	}
+	if sendCoinRequest.Amount <= 0 {
+		return problem.InvalidField("amount", "must be positive")
 	}
 
+	if err := r.sendCoins(c, senderUserID, sendCoinRequest); err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (r *CombinedRepository) sendCoins(c echo.Context, senderUserID uuid.UUID, sendCoinRequest models.SendCoin) error {
 	receiverChan := make(chan *models.Credential, 1)
 	errChan := make(chan error, 1)
 	go func() {
 		receiver, err := r.userRepo.GetUserCredentialByName(c.Request().Context(), sendCoinRequest.ToUser)
-		if receiver.ID == uuid.Nil {
-			err = errors.New("receiver not found")
+		if errors.Is(err, pgx.ErrNoRows) || err == nil && receiver.ID == uuid.Nil {
+			err = repository.ErrReceiverNotFound
 		}
 		if err != nil {
 			errChan <- err
@@ -47,25 +75,21 @@ func (r *CombinedRepository) SendCoinHandler(c echo.Context) error {
 	select {
 	case receiver := <-receiverChan:
 		if receiver.ID == senderUserID {
-			return c.JSON(http.StatusBadRequest, map[string]string{"errors": "cannot send coins to yourself"})
+			return repository.ErrSelfTransfer
 		}
 
 		if err := r.coinRepo.SendCoins(c.Request().Context(), senderUserID, receiver.ID, sendCoinRequest.Amount); err != nil {
-			c.Logger().Error("failed to send coins", err)
-			return c.JSON(http.StatusBadRequest, map[string]string{"errors": fmt.Sprintf("failed to send coins %v", err)})
+			return fmt.Errorf("failed to send coins: %w", err)
 		}
+		metrics.CoinsTransferred.Add(float64(sendCoinRequest.Amount))
 
-		return c.NoContent(http.StatusOK)
+		return nil
 
 	case err := <-errChan:
-		if errors.Is(err, pgx.ErrNoRows) {
-			return c.JSON(http.StatusBadRequest, map[string]string{"errors": "receiver not found"})
-		}
-		c.Logger().Error("failed to fetch receiver info", err)
-		return c.JSON(http.StatusBadRequest, map[string]string{"errors": fmt.Sprintf("failed to fetch receiver info %v", err)})
+		return fmt.Errorf("failed to fetch receiver info: %w", err)
 
 	case <-c.Request().Context().Done():
-		c.Logger().Error("request canceled or timed out")
-		return c.JSON(http.StatusInternalServerError, map[string]string{"errors": "request canceled or timed out"})
+		logger.FromContext(c.Request().Context()).Warn("request canceled or timed out")
+		return c.Request().Context().Err()
 	}
 }
@@ -0,0 +1,297 @@
+package handler
+
+import (
+	"errors"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/api/problem"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/models"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/events"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/logger"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/metrics"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/utils"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+	"net"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	defaultPingInterval = 30 * time.Second
+	defaultWriteTimeout = 10 * time.Second
+	// Клиенту нечего присылать, кроме управляющих кадров
+	walletSocketReadLimit = 512
+)
+
+var errTooManySockets = problem.New(http.StatusTooManyRequests, "too_many_connections", "too many open websocket connections")
+
+type WalletSocketOptions struct {
+	// Как часто слать ping. Соединение закрывается, если pong не пришёл
+	// за PingInterval+WriteTimeout
+	PingInterval time.Duration
+	// Сколько ждать, пока клиент примет сообщение
+	WriteTimeout time.Duration
+	// Сколько соединений пользователь может открыть на этом экземпляре,
+	// 0 — без ограничения
+	MaxConnectionsPerUser int
+}
+
+type WalletSocketHandler struct {
+	wallets  *CombinedRepository
+	broker   *events.Broker
+	opts     WalletSocketOptions
+	upgrader websocket.Upgrader
+
+	mu    sync.Mutex
+	conns map[uuid.UUID]int
+}
+
+func NewWalletSocketHandler(wallets *CombinedRepository, broker *events.Broker, opts WalletSocketOptions) *WalletSocketHandler {
+	if opts.PingInterval <= 0 {
+		opts.PingInterval = defaultPingInterval
+	}
+	if opts.WriteTimeout <= 0 {
+		opts.WriteTimeout = defaultWriteTimeout
+	}
+	return &WalletSocketHandler{
+		wallets: wallets,
+		broker:  broker,
+		opts:    opts,
+		upgrader: websocket.Upgrader{
+			// Авторизация по токену, а не по cookie, поэтому чужой сайт
+			// не может открыть соединение от имени пользователя
+			CheckOrigin: func(*http.Request) bool { return true },
+		},
+		conns: make(map[uuid.UUID]int),
+	}
+}
+
+// Connect — /api/v2/ws: WebSocket с изменениями кошелька. После подключения
+// приходит снимок кошелька, затем сообщения balance и inventory при каждом
+// изменении. События, пришедшие пачкой, дают одно перечитывание кошелька.
+func (h *WalletSocketHandler) Connect(c echo.Context) error {
+	userID, ok := utils.UserIDFromContext(c)
+	if !ok {
+		return problem.MissingToken()
+	}
+	if !c.IsWebSocket() {
+		return problem.InvalidRequest("websocket upgrade required")
+	}
+	if !h.acquire(userID) {
+		return errTooManySockets
+	}
+	defer h.release(userID)
+
+	// Как и в потоке событий, подписка создаётся до чтения кошелька
+	sub := h.broker.Subscribe(userID)
+	defer func() { sub.Close() }()
+
+	ctx := c.Request().Context()
+	log := logger.FromContext(ctx)
+
+	wallet, err := h.wallets.loadInfo(ctx, userID, false)
+	if err != nil {
+		return err
+	}
+
+	conn, err := h.upgrader.Upgrade(c.Response(), c.Request(), nil)
+	if err != nil {
+		// Upgrader уже ответил клиенту ошибкой
+		return nil
+	}
+	defer conn.Close()
+	// Ответ отправлен в обход echo.Response, логам и метрикам нужен статус
+	c.Response().Status = http.StatusSwitchingProtocols
+	c.Response().Committed = true
+
+	metrics.WalletSockets.Inc()
+	defer metrics.WalletSockets.Dec()
+
+	s := &walletSocket{conn: conn, opts: h.opts}
+	if err = s.write(models.WalletSnapshotMessage{Type: models.WalletMessageSnapshot, Wallet: wallet.Wallet}); err != nil {
+		s.closeOnError(err)
+		return nil
+	}
+
+	readDone := s.readLoop()
+
+	ping := time.NewTicker(h.opts.PingInterval)
+	defer ping.Stop()
+
+	var expired <-chan time.Time
+	if exp := tokenExpiry(c); !exp.IsZero() {
+		timer := time.NewTimer(time.Until(exp))
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	for {
+		select {
+		case <-readDone:
+			return nil
+		case <-expired:
+			s.close(websocket.ClosePolicyViolation, "token expired", "token_expired")
+			return nil
+		case <-ping.C:
+			if err = s.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(h.opts.WriteTimeout)); err != nil {
+				s.closeOnError(err)
+				return nil
+			}
+		case event, ok := <-sub.Events:
+			reason := event.Type
+			if !ok {
+				if h.broker.Closed() {
+					s.close(websocket.CloseGoingAway, "server shutting down", "shutdown")
+					return nil
+				}
+				// Подписку сбросили или она отстала: события могли
+				// потеряться, поэтому кошелёк сверяется целиком
+				sub = h.broker.Subscribe(userID)
+				reason = ""
+			}
+			reason = drain(sub, reason)
+
+			next, err := h.wallets.loadInfo(ctx, userID, false)
+			if err != nil {
+				log.Error("failed to reload wallet", zap.Error(err))
+				s.close(websocket.CloseInternalServerErr, "failed to load wallet", "error")
+				return nil
+			}
+			if err = s.sendChanges(wallet.Wallet, next.Wallet, reason); err != nil {
+				s.closeOnError(err)
+				return nil
+			}
+			wallet = next
+		}
+	}
+}
+
+// drain забирает уже пришедшие события, чтобы перечитать кошелёк один раз.
+// Возвращает тип последнего из них.
+func drain(sub *events.Subscription, reason string) string {
+	for {
+		select {
+		case event, ok := <-sub.Events:
+			if !ok {
+				return reason
+			}
+			reason = event.Type
+		default:
+			return reason
+		}
+	}
+}
+
+func (h *WalletSocketHandler) acquire(userID uuid.UUID) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.opts.MaxConnectionsPerUser > 0 && h.conns[userID] >= h.opts.MaxConnectionsPerUser {
+		return false
+	}
+	h.conns[userID]++
+	return true
+}
+
+func (h *WalletSocketHandler) release(userID uuid.UUID) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.conns[userID]--; h.conns[userID] <= 0 {
+		delete(h.conns, userID)
+	}
+}
+
+// tokenExpiry возвращает срок действия токена: соединение не должно
+// пережить токен, с которым открыто.
+func tokenExpiry(c echo.Context) time.Time {
+	token, ok := c.Get("user").(*jwt.Token)
+	if !ok {
+		return time.Time{}
+	}
+	exp, err := token.Claims.GetExpirationTime()
+	if err != nil || exp == nil {
+		return time.Time{}
+	}
+	return exp.Time
+}
+
+// walletSocket пишет в соединение. Все записи идут из одной горутины.
+type walletSocket struct {
+	conn *websocket.Conn
+	opts WalletSocketOptions
+}
+
+// readLoop читает соединение, чтобы обрабатывать pong и close от клиента.
+// Канал закрывается, когда клиент ушёл или перестал отвечать на ping.
+func (s *walletSocket) readLoop() <-chan struct{} {
+	done := make(chan struct{})
+	pongWait := s.opts.PingInterval + s.opts.WriteTimeout
+
+	s.conn.SetReadLimit(walletSocketReadLimit)
+	_ = s.conn.SetReadDeadline(time.Now().Add(pongWait))
+	s.conn.SetPongHandler(func(string) error {
+		return s.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	go func() {
+		defer close(done)
+		for {
+			if _, _, err := s.conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+	return done
+}
+
+func (s *walletSocket) write(msg any) error {
+	if err := s.conn.SetWriteDeadline(time.Now().Add(s.opts.WriteTimeout)); err != nil {
+		return err
+	}
+	return s.conn.WriteJSON(msg)
+}
+
+// sendChanges отправляет сообщения только о том, что действительно
+// изменилось. ExpiringSoon.Before сдвигается при каждом чтении, поэтому
+// сравнивается только сумма.
+func (s *walletSocket) sendChanges(prev, next models.Wallet, reason string) error {
+	if prev.Coin != next.Coin || prev.HeldCoins != next.HeldCoins || prev.ExpiringSoon.Amount != next.ExpiringSoon.Amount {
+		err := s.write(models.BalanceMessage{
+			Type:         models.WalletMessageBalance,
+			Reason:       reason,
+			Coins:        next.Coin,
+			HeldCoins:    next.HeldCoins,
+			ExpiringSoon: next.ExpiringSoon,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if !slices.Equal(prev.Inventory, next.Inventory) {
+		return s.write(models.InventoryMessage{
+			Type:      models.WalletMessageInventory,
+			Reason:    reason,
+			Inventory: next.Inventory,
+		})
+	}
+	return nil
+}
+
+func (s *walletSocket) close(code int, text, reason string) {
+	metrics.WalletSocketsClosed.WithLabelValues(reason).Inc()
+	_ = s.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, text), time.Now().Add(s.opts.WriteTimeout))
+}
+
+// closeOnError учитывает клиента, который не успел принять сообщение.
+// Остальные ошибки записи значат, что соединение уже разорвано.
+func (s *walletSocket) closeOnError(err error) {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		metrics.WalletSocketsClosed.WithLabelValues("slow_client").Inc()
+	}
+}
@@ -0,0 +1,196 @@
+package handler
+
+import (
+	"context"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/models"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/events"
+	mock_repository "github.com/Ki4EH/stunning-octo-waddle/internal/mocks/repository"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/utils"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// walletState подменяет кошелёк пользователя в моках репозиториев.
+type walletState struct {
+	coins atomic.Int64
+	items atomic.Value
+}
+
+func newWalletSocketServer(t *testing.T, opts WalletSocketOptions, userID uuid.UUID, expiresAt time.Time) (*events.Broker, *walletState, string) {
+	ctrl := gomock.NewController(t)
+	users := mock_repository.NewMockUserRepository(ctrl)
+	coins := mock_repository.NewMockCoinRepository(ctrl)
+
+	state := &walletState{}
+	state.items.Store([]models.UserItem{})
+	users.EXPECT().GetUserByID(gomock.Any(), userID).DoAndReturn(func(context.Context, uuid.UUID) (*models.Credential, error) {
+		return &models.Credential{ID: userID, Username: "alice", Coin: state.coins.Load()}, nil
+	}).AnyTimes()
+	users.EXPECT().GetUserItems(gomock.Any(), userID, gomock.Any()).DoAndReturn(func(_ context.Context, _ uuid.UUID, items *[]models.UserItem) error {
+		*items = state.items.Load().([]models.UserItem)
+		return nil
+	}).AnyTimes()
+	coins.EXPECT().GetExpiringCoins(gomock.Any(), userID).Return(&models.ExpiringCoins{}, nil).AnyTimes()
+
+	broker := events.NewBroker()
+	handler := NewWalletSocketHandler(NewCombinedRepository(users, coins, nil), broker, opts)
+
+	e := echo.New()
+	e.GET("/api/v2/ws", func(c echo.Context) error {
+		claims := &utils.Claims{UserID: userID}
+		if !expiresAt.IsZero() {
+			claims.ExpiresAt = jwt.NewNumericDate(expiresAt)
+		}
+		c.Set("user", &jwt.Token{Claims: claims})
+		serve(c, handler.Connect)
+		return nil
+	})
+	srv := httptest.NewServer(e)
+	t.Cleanup(srv.Close)
+
+	return broker, state, "ws" + strings.TrimPrefix(srv.URL, "http") + "/api/v2/ws"
+}
+
+func readMessage(t *testing.T, conn *websocket.Conn, v any) {
+	t.Helper()
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	require.NoError(t, conn.ReadJSON(v))
+}
+
+func TestWalletSocketHandler_Connect(t *testing.T) {
+	userID := uuid.New()
+
+	t.Run("snapshot and changes", func(t *testing.T) {
+		broker, state, url := newWalletSocketServer(t, WalletSocketOptions{}, userID, time.Time{})
+		state.coins.Store(100)
+
+		conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+		require.NoError(t, err)
+		defer conn.Close()
+
+		var snapshot models.WalletSnapshotMessage
+		readMessage(t, conn, &snapshot)
+		assert.Equal(t, models.WalletMessageSnapshot, snapshot.Type)
+		assert.Equal(t, int64(100), snapshot.Wallet.Coin)
+
+		state.coins.Store(80)
+		state.items.Store([]models.UserItem{{Type: "cup", Quantity: 1}})
+		broker.Publish(models.UserEvent{ID: 1, UserID: userID, Type: models.EventPurchaseCompleted})
+
+		var balance models.BalanceMessage
+		readMessage(t, conn, &balance)
+		assert.Equal(t, models.BalanceMessage{Type: models.WalletMessageBalance, Reason: models.EventPurchaseCompleted, Coins: 80}, balance)
+
+		var inventory models.InventoryMessage
+		readMessage(t, conn, &inventory)
+		assert.Equal(t, models.WalletMessageInventory, inventory.Type)
+		assert.Equal(t, []models.UserItem{{Type: "cup", Quantity: 1}}, inventory.Inventory)
+
+		// Событие без изменений кошелька не даёт сообщений
+		broker.Publish(models.UserEvent{ID: 2, UserID: userID, Type: models.EventCoinsGranted})
+		state.coins.Store(90)
+		broker.Publish(models.UserEvent{ID: 3, UserID: userID, Type: models.EventCoinsReceived})
+
+		readMessage(t, conn, &balance)
+		assert.Equal(t, int64(90), balance.Coins)
+	})
+
+	t.Run("connection limit", func(t *testing.T) {
+		_, _, url := newWalletSocketServer(t, WalletSocketOptions{MaxConnectionsPerUser: 1}, userID, time.Time{})
+
+		first, _, err := websocket.DefaultDialer.Dial(url, nil)
+		require.NoError(t, err)
+		var snapshot models.WalletSnapshotMessage
+		readMessage(t, first, &snapshot)
+
+		_, res, err := websocket.DefaultDialer.Dial(url, nil)
+		require.ErrorIs(t, err, websocket.ErrBadHandshake)
+		assert.Equal(t, http.StatusTooManyRequests, res.StatusCode)
+
+		// После закрытия первого соединения место освобождается
+		first.Close()
+		require.Eventually(t, func() bool {
+			conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+			if err != nil {
+				return false
+			}
+			conn.Close()
+			return true
+		}, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("plain http request", func(t *testing.T) {
+		_, _, url := newWalletSocketServer(t, WalletSocketOptions{}, userID, time.Time{})
+
+		res, err := http.Get("http" + strings.TrimPrefix(url, "ws"))
+		require.NoError(t, err)
+		defer res.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	})
+
+	closeTests := []struct {
+		name      string
+		expiresAt time.Time
+		trigger   func(broker *events.Broker)
+		wantCode  int
+	}{
+		{
+			name:     "server shutdown",
+			trigger:  func(broker *events.Broker) { broker.Close() },
+			wantCode: websocket.CloseGoingAway,
+		},
+		{
+			name:      "token expiry",
+			expiresAt: time.Now().Add(1500 * time.Millisecond),
+			trigger:   func(*events.Broker) {},
+			wantCode:  websocket.ClosePolicyViolation,
+		},
+	}
+
+	for _, tt := range closeTests {
+		t.Run(tt.name, func(t *testing.T) {
+			broker, _, url := newWalletSocketServer(t, WalletSocketOptions{}, userID, tt.expiresAt)
+
+			conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+			require.NoError(t, err)
+			defer conn.Close()
+			var snapshot models.WalletSnapshotMessage
+			readMessage(t, conn, &snapshot)
+
+			tt.trigger(broker)
+
+			require.NoError(t, conn.SetReadDeadline(time.Now().Add(3*time.Second)))
+			_, _, err = conn.ReadMessage()
+			assert.True(t, websocket.IsCloseError(err, tt.wantCode), err)
+		})
+	}
+
+	t.Run("reset subscription resyncs wallet", func(t *testing.T) {
+		broker, state, url := newWalletSocketServer(t, WalletSocketOptions{}, userID, time.Time{})
+
+		conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+		require.NoError(t, err)
+		defer conn.Close()
+		var snapshot models.WalletSnapshotMessage
+		readMessage(t, conn, &snapshot)
+
+		state.coins.Store(5)
+		broker.Reset()
+
+		var balance models.BalanceMessage
+		readMessage(t, conn, &balance)
+		assert.Equal(t, int64(5), balance.Coins)
+		assert.Empty(t, balance.Reason)
+	})
+}
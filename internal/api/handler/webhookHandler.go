@@ -0,0 +1,139 @@
+package handler
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/api/problem"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/models"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/repository"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+)
+
+const (
+	defaultDeliveriesLimit = 50
+	maxDeliveriesLimit     = 500
+	// Длина сгенерированного секрета в байтах
+	webhookSecretBytes = 32
+)
+
+var webhookEventTypes = []string{models.OutboxTransferCompleted, models.OutboxPurchaseCompleted}
+
+type WebhookHandler struct {
+	repo repository.WebhookRepository
+}
+
+func NewWebhookHandler(repo repository.WebhookRepository) *WebhookHandler {
+	return &WebhookHandler{repo: repo}
+}
+
+func (h *WebhookHandler) GetWebhooks(c echo.Context) error {
+	webhooks, err := h.repo.GetWebhooks(c.Request().Context())
+	if err != nil {
+		return fmt.Errorf("failed to fetch webhooks: %w", err)
+	}
+
+	return c.JSON(http.StatusOK, map[string][]models.Webhook{"webhooks": webhooks})
+}
+
+// CreateWebhook регистрирует получателя. Если секрет не передан, он
+// генерируется; в ответе секрет отдаётся один раз.
+func (h *WebhookHandler) CreateWebhook(c echo.Context) error {
+	var request models.WebhookRequest
+	if err := c.Bind(&request); err != nil {
+		return problem.InvalidRequest("invalid request")
+	}
+
+	target, err := url.Parse(request.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return problem.InvalidField("url", "must be an absolute http or https URL")
+	}
+	for _, eventType := range request.EventTypes {
+		if !slices.Contains(webhookEventTypes, eventType) {
+			return problem.InvalidField("eventTypes", "unknown event type "+strconv.Quote(eventType))
+		}
+	}
+	if request.Secret == "" {
+		secret := make([]byte, webhookSecretBytes)
+		if _, err = rand.Read(secret); err != nil {
+			return fmt.Errorf("failed to generate webhook secret: %w", err)
+		}
+		request.Secret = hex.EncodeToString(secret)
+	}
+
+	webhook, err := h.repo.CreateWebhook(c.Request().Context(), request)
+	if err != nil {
+		return fmt.Errorf("failed to create webhook: %w", err)
+	}
+
+	return c.JSON(http.StatusCreated, webhook)
+}
+
+func (h *WebhookHandler) DeleteWebhook(c echo.Context) error {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return problem.InvalidRequest("invalid webhook id")
+	}
+
+	if err = h.repo.DeleteWebhook(c.Request().Context(), id); err != nil {
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// GetDeliveries — последние доставки webhook, новые первыми. Параметр
+// status=dead показывает dead letter.
+func (h *WebhookHandler) GetDeliveries(c echo.Context) error {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return problem.InvalidRequest("invalid webhook id")
+	}
+
+	status := c.QueryParam("status")
+	switch status {
+	case "", models.DeliveryStatusPending, models.DeliveryStatusDelivered, models.DeliveryStatusDead:
+	default:
+		return problem.InvalidField("status", "must be one of pending, delivered, dead")
+	}
+
+	limit := defaultDeliveriesLimit
+	if raw := c.QueryParam("limit"); raw != "" {
+		if limit, err = strconv.Atoi(raw); err != nil || limit < 1 || limit > maxDeliveriesLimit {
+			return problem.InvalidField("limit", fmt.Sprintf("must be between 1 and %d", maxDeliveriesLimit))
+		}
+	}
+
+	deliveries, err := h.repo.GetDeliveries(c.Request().Context(), id, status, limit)
+	if err != nil {
+		return fmt.Errorf("failed to fetch webhook deliveries: %w", err)
+	}
+
+	return c.JSON(http.StatusOK, map[string][]models.WebhookDelivery{"deliveries": deliveries})
+}
+
+// Replay ставит доставки из dead letter (и, по запросу, уже доставленные)
+// обратно в очередь. Получатель должен отбрасывать повторы по X-Webhook-Id.
+func (h *WebhookHandler) Replay(c echo.Context) error {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return problem.InvalidRequest("invalid webhook id")
+	}
+
+	var request models.ReplayRequest
+	if err = c.Bind(&request); err != nil {
+		return problem.InvalidRequest("invalid request")
+	}
+
+	replayed, err := h.repo.ReplayDeliveries(c.Request().Context(), id, request)
+	if err != nil {
+		return fmt.Errorf("failed to replay webhook deliveries: %w", err)
+	}
+
+	return c.JSON(http.StatusOK, models.ReplayResult{Replayed: replayed})
+}
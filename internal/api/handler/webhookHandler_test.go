@@ -0,0 +1,274 @@
+package handler
+
+import (
+	"encoding/json"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/models"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/repository"
+	mock_repository "github.com/Ki4EH/stunning-octo-waddle/internal/mocks/repository"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWebhookHandler_CreateWebhook(t *testing.T) {
+	e := echo.New()
+	createdAt := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	webhookID := uuid.New()
+
+	tests := []struct {
+		name           string
+		setupMocks     func(*mock_repository.MockWebhookRepository)
+		requestBody    string
+		expectedStatus int
+		expectedCode   string
+	}{
+		{
+			name: "with secret",
+			setupMocks: func(repo *mock_repository.MockWebhookRepository) {
+				repo.EXPECT().
+					CreateWebhook(gomock.Any(), models.WebhookRequest{
+						URL:        "https://example.com/hook",
+						Secret:     "s3cret",
+						EventTypes: []string{models.OutboxTransferCompleted},
+					}).
+					Return(&models.Webhook{ID: webhookID, URL: "https://example.com/hook", Secret: "s3cret",
+						EventTypes: []string{models.OutboxTransferCompleted}, CreatedAt: createdAt}, nil)
+			},
+			requestBody:    `{"url":"https://example.com/hook","secret":"s3cret","eventTypes":["transfer.completed"]}`,
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name: "generated secret",
+			setupMocks: func(repo *mock_repository.MockWebhookRepository) {
+				repo.EXPECT().
+					CreateWebhook(gomock.Any(), gomock.Any()).
+					DoAndReturn(func(_ any, request models.WebhookRequest) (*models.Webhook, error) {
+						assert.Len(t, request.Secret, 2*webhookSecretBytes)
+						return &models.Webhook{ID: webhookID, URL: request.URL, Secret: request.Secret, CreatedAt: createdAt}, nil
+					})
+			},
+			requestBody:    `{"url":"http://example.com/hook"}`,
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "relative url",
+			setupMocks:     func(*mock_repository.MockWebhookRepository) {},
+			requestBody:    `{"url":"/hook"}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   "invalid_request",
+		},
+		{
+			name:           "unsupported scheme",
+			setupMocks:     func(*mock_repository.MockWebhookRepository) {},
+			requestBody:    `{"url":"ftp://example.com/hook"}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   "invalid_request",
+		},
+		{
+			name:           "unknown event type",
+			setupMocks:     func(*mock_repository.MockWebhookRepository) {},
+			requestBody:    `{"url":"https://example.com/hook","eventTypes":["user.deleted"]}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   "invalid_request",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			repo := mock_repository.NewMockWebhookRepository(ctrl)
+			tt.setupMocks(repo)
+
+			handler := NewWebhookHandler(repo)
+
+			req := httptest.NewRequest(http.MethodPost, "/api/admin/webhooks", strings.NewReader(tt.requestBody))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+
+			serve(e.NewContext(req, rec), handler.CreateWebhook)
+
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+			if tt.expectedCode != "" {
+				assertProblem(t, rec, tt.expectedCode)
+				return
+			}
+			var webhook models.Webhook
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &webhook))
+			assert.Equal(t, webhookID, webhook.ID)
+			assert.NotEmpty(t, webhook.Secret)
+		})
+	}
+}
+
+func TestWebhookHandler_DeleteWebhook(t *testing.T) {
+	e := echo.New()
+	webhookID := uuid.New()
+
+	tests := []struct {
+		name           string
+		setupMocks     func(*mock_repository.MockWebhookRepository)
+		id             string
+		expectedStatus int
+		expectedCode   string
+	}{
+		{
+			name: "deleted",
+			setupMocks: func(repo *mock_repository.MockWebhookRepository) {
+				repo.EXPECT().DeleteWebhook(gomock.Any(), webhookID).Return(nil)
+			},
+			id:             webhookID.String(),
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name: "not found",
+			setupMocks: func(repo *mock_repository.MockWebhookRepository) {
+				repo.EXPECT().DeleteWebhook(gomock.Any(), webhookID).Return(repository.ErrWebhookNotFound)
+			},
+			id:             webhookID.String(),
+			expectedStatus: http.StatusNotFound,
+			expectedCode:   "webhook_not_found",
+		},
+		{
+			name:           "invalid id",
+			setupMocks:     func(*mock_repository.MockWebhookRepository) {},
+			id:             "42",
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   "invalid_request",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			repo := mock_repository.NewMockWebhookRepository(ctrl)
+			tt.setupMocks(repo)
+
+			handler := NewWebhookHandler(repo)
+
+			req := httptest.NewRequest(http.MethodDelete, "/api/admin/webhooks/"+tt.id, nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("id")
+			c.SetParamValues(tt.id)
+
+			serve(c, handler.DeleteWebhook)
+
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+			if tt.expectedCode != "" {
+				assertProblem(t, rec, tt.expectedCode)
+			}
+		})
+	}
+}
+
+func TestWebhookHandler_GetDeliveries(t *testing.T) {
+	e := echo.New()
+	webhookID := uuid.New()
+
+	tests := []struct {
+		name           string
+		setupMocks     func(*mock_repository.MockWebhookRepository)
+		query          string
+		expectedStatus int
+		expectedCode   string
+	}{
+		{
+			name: "default limit",
+			setupMocks: func(repo *mock_repository.MockWebhookRepository) {
+				repo.EXPECT().
+					GetDeliveries(gomock.Any(), webhookID, "", defaultDeliveriesLimit).
+					Return([]models.WebhookDelivery{{ID: 1, WebhookID: webhookID, Status: models.DeliveryStatusPending}}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name: "dead letter",
+			setupMocks: func(repo *mock_repository.MockWebhookRepository) {
+				repo.EXPECT().
+					GetDeliveries(gomock.Any(), webhookID, models.DeliveryStatusDead, 10).
+					Return(nil, nil)
+			},
+			query:          "?status=dead&limit=10",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "unknown status",
+			setupMocks:     func(*mock_repository.MockWebhookRepository) {},
+			query:          "?status=lost",
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   "invalid_request",
+		},
+		{
+			name:           "limit too large",
+			setupMocks:     func(*mock_repository.MockWebhookRepository) {},
+			query:          "?limit=501",
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   "invalid_request",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			repo := mock_repository.NewMockWebhookRepository(ctrl)
+			tt.setupMocks(repo)
+
+			handler := NewWebhookHandler(repo)
+
+			req := httptest.NewRequest(http.MethodGet, "/api/admin/webhooks/"+webhookID.String()+"/deliveries"+tt.query, nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("id")
+			c.SetParamValues(webhookID.String())
+
+			serve(c, handler.GetDeliveries)
+
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+			if tt.expectedCode != "" {
+				assertProblem(t, rec, tt.expectedCode)
+			}
+		})
+	}
+}
+
+func TestWebhookHandler_Replay(t *testing.T) {
+	e := echo.New()
+	webhookID := uuid.New()
+	since := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repo := mock_repository.NewMockWebhookRepository(ctrl)
+	repo.EXPECT().
+		ReplayDeliveries(gomock.Any(), webhookID, models.ReplayRequest{Since: &since, IncludeDelivered: true}).
+		Return(int64(3), nil)
+
+	handler := NewWebhookHandler(repo)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/admin/webhooks/"+webhookID.String()+"/replay",
+		strings.NewReader(`{"since":"2025-01-01T00:00:00Z","includeDelivered":true}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetParamNames("id")
+	c.SetParamValues(webhookID.String())
+
+	serve(c, handler.Replay)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"replayed":3}`, rec.Body.String())
+}
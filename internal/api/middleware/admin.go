@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"fmt"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/api/problem"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/repository"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/utils"
+	"github.com/labstack/echo/v4"
+)
+
+// RequireAdmin пропускает запрос дальше, только если у пользователя из токена
+// есть права администратора. Должен стоять после echojwt.
+func RequireAdmin(repo repository.UserRepository) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			userID, ok := utils.UserIDFromContext(c)
+			if !ok {
+				return problem.MissingToken()
+			}
+
+			user, err := repo.GetUserByID(c.Request().Context(), userID)
+			if err != nil {
+				return fmt.Errorf("failed to fetch user info: %w", err)
+			}
+			if !user.IsAdmin {
+				return problem.Forbidden("admin privileges required")
+			}
+
+			return next(c)
+		}
+	}
+}
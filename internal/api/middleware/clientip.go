@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"net"
+)
+
+// IPExtractor определяет IP клиента для c.RealIP. Без доверенных прокси
+// берётся адрес соединения: X-Forwarded-For и X-Real-IP задаёт сам клиент,
+// и по ним он мог бы обходить лимиты по IP. С прокси адрес читается из
+// X-Forwarded-For, но только пока цепочка идёт через сети trustedProxies.
+func IPExtractor(trustedProxies []string) (echo.IPExtractor, error) {
+	if len(trustedProxies) == 0 {
+		return echo.ExtractIPDirect(), nil
+	}
+	options := []echo.TrustOption{
+		echo.TrustLoopback(false),
+		echo.TrustLinkLocal(false),
+		echo.TrustPrivateNet(false),
+	}
+	for _, cidr := range trustedProxies {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", cidr, err)
+		}
+		options = append(options, echo.TrustIPRange(network))
+	}
+	return echo.ExtractIPFromXFFHeader(options...), nil
+}
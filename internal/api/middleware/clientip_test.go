@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIPExtractor(t *testing.T) {
+	tests := []struct {
+		name           string
+		trustedProxies []string
+		remoteAddr     string
+		forwardedFor   string
+		expected       string
+	}{
+		{name: "forwarded for is ignored without proxies", remoteAddr: "192.0.2.1:1234", forwardedFor: "203.0.113.7", expected: "192.0.2.1"},
+		{name: "private network is not trusted by default", trustedProxies: []string{"10.1.0.0/16"}, remoteAddr: "192.168.0.1:1234", forwardedFor: "203.0.113.7", expected: "192.168.0.1"},
+		{name: "trusted proxy passes client address", trustedProxies: []string{"10.1.0.0/16"}, remoteAddr: "10.1.0.5:1234", forwardedFor: "203.0.113.7", expected: "203.0.113.7"},
+		{name: "spoofed hop before proxy is skipped", trustedProxies: []string{"10.1.0.0/16"}, remoteAddr: "10.1.0.5:1234", forwardedFor: "198.51.100.9, 203.0.113.7", expected: "203.0.113.7"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			extract, err := IPExtractor(tt.trustedProxies)
+			require.NoError(t, err)
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			req.Header.Set(echo.HeaderXForwardedFor, tt.forwardedFor)
+			assert.Equal(t, tt.expected, extract(req))
+		})
+	}
+
+	_, err := IPExtractor([]string{"10.1.0.0"})
+	assert.Error(t, err)
+}
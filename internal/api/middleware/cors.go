@@ -5,10 +5,11 @@ import (
 	"github.com/labstack/echo/v4/middleware"
 )
 
-func CORSConfig() echo.MiddlewareFunc {
+func CORSConfig(origins []string) echo.MiddlewareFunc {
 	return middleware.CORSWithConfig(middleware.CORSConfig{
-		AllowOrigins: []string{"http://localhost:8080"},
-		AllowMethods: []string{echo.GET, echo.POST, echo.PUT, echo.PATCH, echo.DELETE},
-		AllowHeaders: []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept},
+		AllowOrigins:  origins,
+		AllowMethods:  []string{echo.GET, echo.POST, echo.PUT, echo.PATCH, echo.DELETE},
+		AllowHeaders:  []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept, echo.HeaderXRequestID, HeaderIdempotencyKey, "Last-Event-ID"},
+		ExposeHeaders: []string{echo.HeaderXRequestID, HeaderIdempotentReplayed, HeaderDeprecation, HeaderSunset, HeaderLink},
 	})
 }
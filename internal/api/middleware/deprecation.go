@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"fmt"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/metrics"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"time"
+)
+
+const (
+	HeaderDeprecation = "Deprecation"
+	HeaderSunset      = "Sunset"
+	HeaderLink        = "Link"
+)
+
+// Deprecation описывает устаревший маршрут. Sunset — дата отключения,
+// нулевая не отдаётся. Successor — путь маршрута-замены.
+type Deprecation struct {
+	Since     time.Time
+	Sunset    time.Time
+	Successor string
+}
+
+// Deprecated добавляет к ответам заголовки Deprecation (RFC 9745), Sunset
+// (RFC 8594) и ссылку на замену.
+func Deprecated(d Deprecation) echo.MiddlewareFunc {
+	deprecation := fmt.Sprintf("@%d", d.Since.Unix())
+	var sunset string
+	if !d.Sunset.IsZero() {
+		sunset = d.Sunset.UTC().Format(http.TimeFormat)
+	}
+	var link string
+	if d.Successor != "" {
+		link = fmt.Sprintf(`<%s>; rel="successor-version"`, d.Successor)
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			header := c.Response().Header()
+			header.Set(HeaderDeprecation, deprecation)
+			if sunset != "" {
+				header.Set(HeaderSunset, sunset)
+			}
+			if link != "" {
+				header.Add(HeaderLink, link)
+			}
+			metrics.DeprecatedRequests.WithLabelValues(c.Request().Method, c.Path()).Inc()
+			return next(c)
+		}
+	}
+}
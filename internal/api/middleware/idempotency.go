@@ -0,0 +1,163 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/api/problem"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/idempotency"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/logger"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/utils"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+const (
+	HeaderIdempotencyKey     = "Idempotency-Key"
+	HeaderIdempotentReplayed = "Idempotent-Replayed"
+
+	maxIdempotencyKeyLength = 255
+	// Тело запроса с ключом читается в память целиком, чтобы посчитать хеш
+	maxIdempotentBodySize = 1 << 20
+)
+
+var (
+	errRequestInProgress = problem.New(http.StatusConflict, "request_in_progress",
+		"request with this idempotency key is still in progress")
+	errIdempotencyKeyReused = problem.New(http.StatusUnprocessableEntity, "idempotency_key_reused",
+		"idempotency key was already used with a different request")
+	errRequestTooLarge = problem.New(http.StatusRequestEntityTooLarge, "request_too_large",
+		"request body is too large")
+)
+
+// Idempotency повторяет сохранённый ответ, если запрос с тем же
+// Idempotency-Key уже выполнялся. Ключ действует в пределах пользователя,
+// метода и пути. Ответы 5xx не сохраняются, такой запрос можно повторить.
+// Запросы GET, HEAD и OPTIONS выполняются как обычно. Должен стоять после
+// echojwt.
+func Idempotency(store idempotency.Store) echo.MiddlewareFunc {
+	return idempotent(store, false)
+}
+
+// IdempotentRoute — Idempotency для маршрута, который меняет данные, хотя
+// вызывается безопасным методом, как устаревшая покупка GET /api/buy/:item.
+func IdempotentRoute(store idempotency.Store) echo.MiddlewareFunc {
+	return idempotent(store, true)
+}
+
+func idempotent(store idempotency.Store, anyMethod bool) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			header := c.Request().Header.Get(HeaderIdempotencyKey)
+			if header == "" || !anyMethod && isSafeMethod(c.Request().Method) {
+				return next(c)
+			}
+			if len(header) > maxIdempotencyKeyLength {
+				return problem.InvalidRequest("idempotency key is too long")
+			}
+
+			body, err := io.ReadAll(http.MaxBytesReader(c.Response(), c.Request().Body, maxIdempotentBodySize))
+			if err != nil {
+				var tooLarge *http.MaxBytesError
+				if errors.As(err, &tooLarge) {
+					return errRequestTooLarge
+				}
+				return problem.InvalidRequest("failed to read request body")
+			}
+			c.Request().Body = io.NopCloser(bytes.NewReader(body))
+
+			ctx := c.Request().Context()
+			userID, _ := utils.UserIDFromContext(c)
+			key := userID.String() + " " + c.Request().Method + " " + c.Request().URL.Path + " " + header
+
+			lease, err := store.Begin(ctx, key, sha256.Sum256(body))
+			if err != nil {
+				return err
+			}
+			switch lease.State {
+			case idempotency.InFlight:
+				return errRequestInProgress
+			case idempotency.KeyReused:
+				return errIdempotencyKeyReused
+			case idempotency.Replay:
+				c.Response().Header().Set(HeaderIdempotentReplayed, strconv.FormatBool(true))
+				if lease.Response.ContentType == "" {
+					return c.NoContent(lease.Response.Status)
+				}
+				return c.Blob(lease.Response.Status, lease.Response.ContentType, lease.Response.Body)
+			}
+
+			log := logger.FromContext(ctx)
+			res := c.Response()
+			recorder := &recordingWriter{ResponseWriter: res.Writer}
+			res.Writer = recorder
+			stored := false
+			defer func() {
+				// При панике ключ освобождается, иначе повтор получит 409
+				if !stored {
+					if err := store.Forget(context.WithoutCancel(ctx), key, lease.Token); err != nil {
+						log.Error("failed to release idempotency key", zap.Error(err))
+					}
+				}
+			}()
+
+			err = next(c)
+			if err != nil {
+				// Ответ с ошибкой тоже сохраняется, поэтому он пишется здесь.
+				// Внешние middleware получают ту же ошибку, а HTTPErrorHandler
+				// второй раз ответ не пишет
+				c.Error(err)
+			}
+			res.Writer = recorder.ResponseWriter
+
+			if res.Status < http.StatusInternalServerError {
+				response := idempotency.Response{
+					Status:      res.Status,
+					ContentType: res.Header().Get(echo.HeaderContentType),
+					Body:        recorder.body.Bytes(),
+				}
+				if serr := store.Complete(context.WithoutCancel(ctx), key, lease.Token, response); serr != nil {
+					log.Error("failed to store idempotent response", zap.Error(serr))
+				} else {
+					stored = true
+				}
+			}
+			return err
+		}
+	}
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// recordingWriter пишет ответ клиенту и сохраняет копию тела.
+type recordingWriter struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *recordingWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush отправляет клиенту уже записанную часть ответа.
+func (w *recordingWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap даёт http.ResponseController доступ к исходному writer.
+func (w *recordingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
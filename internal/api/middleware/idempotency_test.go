@@ -0,0 +1,141 @@
+package middleware
+
+import (
+	"errors"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/api/problem"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/idempotency"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestIdempotency(t *testing.T) {
+	calls := 0
+	failures := 0
+	outerErrors := 0
+	store := idempotency.NewMemory(0, 2)
+	e := echo.New()
+	e.HTTPErrorHandler = problem.HTTPErrorHandler
+	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			err := next(c)
+			if err != nil {
+				outerErrors++
+			}
+			return err
+		}
+	})
+	e.Use(Idempotency(store))
+	count := func(c echo.Context) error {
+		calls++
+		return c.JSON(http.StatusOK, map[string]int{"call": calls})
+	}
+	e.POST("/api/sendCoin", count)
+	e.GET("/api/info", count)
+	e.GET("/api/buy/:item", count, IdempotentRoute(store))
+	e.POST("/api/fail", func(c echo.Context) error {
+		failures++
+		return errors.New("database is down")
+	})
+	e.POST("/api/stream", func(c echo.Context) error {
+		c.Response().WriteHeader(http.StatusOK)
+		c.Response().Flush()
+		return nil
+	})
+
+	serveMethod := func(method, path, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		if key != "" {
+			req.Header.Set(HeaderIdempotencyKey, key)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+	serve := func(path, key, body string) *httptest.ResponseRecorder {
+		return serveMethod(http.MethodPost, path, key, body)
+	}
+
+	t.Run("repeated request gets the stored response", func(t *testing.T) {
+		first := serve("/api/sendCoin", "key-1", `{"amount":1}`)
+		second := serve("/api/sendCoin", "key-1", `{"amount":1}`)
+
+		assert.Equal(t, 1, calls)
+		assert.Equal(t, http.StatusOK, second.Code)
+		assert.JSONEq(t, first.Body.String(), second.Body.String())
+		assert.Empty(t, first.Header().Get(HeaderIdempotentReplayed))
+		assert.Equal(t, "true", second.Header().Get(HeaderIdempotentReplayed))
+	})
+
+	t.Run("key reused with another body", func(t *testing.T) {
+		rec := serve("/api/sendCoin", "key-1", `{"amount":2}`)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+		assert.Contains(t, rec.Body.String(), "idempotency_key_reused")
+	})
+
+	t.Run("requests without key are not deduplicated", func(t *testing.T) {
+		before := calls
+		serve("/api/sendCoin", "", `{"amount":1}`)
+		serve("/api/sendCoin", "", `{"amount":1}`)
+
+		assert.Equal(t, before+2, calls)
+	})
+
+	t.Run("server errors are not stored", func(t *testing.T) {
+		outerErrors = 0
+		assert.Equal(t, http.StatusInternalServerError, serve("/api/fail", "key-2", "").Code)
+		assert.Equal(t, http.StatusInternalServerError, serve("/api/fail", "key-2", "").Code)
+
+		assert.Equal(t, 2, failures)
+		assert.Equal(t, 2, outerErrors, "outer middleware sees the handler error")
+	})
+
+	t.Run("safe methods are not deduplicated", func(t *testing.T) {
+		before := calls
+		serveMethod(http.MethodGet, "/api/info", "key-3", "")
+		second := serveMethod(http.MethodGet, "/api/info", "key-3", "")
+
+		assert.Equal(t, before+2, calls)
+		assert.Empty(t, second.Header().Get(HeaderIdempotentReplayed))
+	})
+
+	t.Run("idempotent route accepts get", func(t *testing.T) {
+		before := calls
+		serveMethod(http.MethodGet, "/api/buy/pen", "key-4", "")
+		second := serveMethod(http.MethodGet, "/api/buy/pen", "key-4", "")
+
+		assert.Equal(t, before+1, calls)
+		assert.Equal(t, "true", second.Header().Get(HeaderIdempotentReplayed))
+	})
+
+	t.Run("least recently used keys are evicted", func(t *testing.T) {
+		before := calls
+		serve("/api/sendCoin", "key-5", "")
+		serve("/api/sendCoin", "key-6", "")
+		serve("/api/sendCoin", "key-7", "")
+		assert.Equal(t, 2, store.Len())
+
+		serve("/api/sendCoin", "key-5", "")
+		assert.Equal(t, before+4, calls)
+	})
+
+	t.Run("large body is rejected", func(t *testing.T) {
+		before := calls
+		rec := serve("/api/sendCoin", "key-9", strings.Repeat("x", maxIdempotentBodySize+1))
+
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+		assert.Equal(t, before, calls)
+	})
+
+	t.Run("flush reaches the client", func(t *testing.T) {
+		rec := serve("/api/stream", "key-8", "")
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.True(t, rec.Flushed)
+	})
+}
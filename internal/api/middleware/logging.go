@@ -2,12 +2,52 @@ package middleware
 
 import (
 	"github.com/Ki4EH/stunning-octo-waddle/internal/logger"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/utils"
 	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 	"time"
 )
 
-func LoggingMiddleware(log logger.Logger) echo.MiddlewareFunc {
+// RequestLogger кладёт в контекст запроса логгер с request ID, маршрутом и
+// trace ID. Должен стоять после middleware.RequestID и трейсинга.
+func RequestLogger(log logger.Logger) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			fields := []zap.Field{
+				zap.String("request_id", c.Response().Header().Get(echo.HeaderXRequestID)),
+				zap.String("method", req.Method),
+				zap.String("route", c.Path()),
+			}
+			if span := trace.SpanContextFromContext(req.Context()); span.IsValid() {
+				fields = append(fields, zap.String("trace_id", span.TraceID().String()))
+			}
+
+			c.SetRequest(req.WithContext(logger.WithContext(req.Context(), log.With(fields...))))
+			return next(c)
+		}
+	}
+}
+
+// UserLogger добавляет в логгер запроса ID пользователя из токена.
+// Должен стоять после echojwt.
+func UserLogger() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if userID, ok := utils.UserIDFromContext(c); ok {
+				ctx := c.Request().Context()
+				log := logger.FromContext(ctx).With(zap.String("user_id", userID.String()))
+				c.SetRequest(c.Request().WithContext(logger.WithContext(ctx, log)))
+			}
+			return next(c)
+		}
+	}
+}
+
+// LoggingMiddleware пишет в лог запросы дольше порога. Порог читается при
+// каждом запросе, поэтому его можно менять на ходу.
+func LoggingMiddleware(threshold func() time.Duration) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
 			start := time.Now()
@@ -15,9 +55,8 @@ func LoggingMiddleware(log logger.Logger) echo.MiddlewareFunc {
 
 			eclipse := time.Since(start)
 
-			if eclipse > 50*time.Millisecond {
-				log.Info("request",
-					zap.String("method", c.Request().Method),
+			if eclipse > threshold() {
+				logger.FromContext(c.Request().Context()).Info("request",
 					zap.String("path", c.Request().URL.Path),
 					zap.Int("status", c.Response().Status),
 					zap.Duration("duration", eclipse),
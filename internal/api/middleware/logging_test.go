@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"github.com/Ki4EH/stunning-octo-waddle/internal/logger"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/utils"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	middlewareEcho "github.com/labstack/echo/v4/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequestLogger(t *testing.T) {
+	core, logs := observer.New(zap.DebugLevel)
+	userID := uuid.New()
+
+	e := echo.New()
+	e.Use(middlewareEcho.RequestID())
+	e.Use(RequestLogger(logger.NewFromZap(zap.New(core))))
+	e.GET("/api/buy/:item", func(c echo.Context) error {
+		logger.FromContext(c.Request().Context()).Info("bought")
+		return c.NoContent(http.StatusOK)
+	}, func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set("user", &jwt.Token{Claims: &utils.Claims{UserID: userID}})
+			return next(c)
+		}
+	}, UserLogger())
+
+	req := httptest.NewRequest(http.MethodGet, "/api/buy/cup", nil)
+	req.Header.Set(echo.HeaderXRequestID, "req-1")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "req-1", rec.Header().Get(echo.HeaderXRequestID))
+
+	require.Equal(t, 1, logs.Len())
+	fields := logs.All()[0].ContextMap()
+	assert.Equal(t, "req-1", fields["request_id"])
+	assert.Equal(t, "/api/buy/:item", fields["route"])
+	assert.Equal(t, http.MethodGet, fields["method"])
+	assert.Equal(t, userID.String(), fields["user_id"])
+}
@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"github.com/Ki4EH/stunning-octo-waddle/internal/metrics"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MetricsMiddleware пишет латентность каждого запроса в гистограмму. Маршрут
+// берётся из шаблона (/api/buy/:item), чтобы не плодить метки на каждый item.
+// Потоки событий и WebSocket живут минутами и в латентность не попадают.
+func MetricsMiddleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			err := next(c)
+			if err != nil {
+				// Статус ответа известен только после обработки ошибки
+				c.Error(err)
+			}
+
+			if c.Response().Status == http.StatusSwitchingProtocols ||
+				strings.HasPrefix(c.Response().Header().Get(echo.HeaderContentType), "text/event-stream") {
+				return err
+			}
+
+			route := c.Path()
+			if route == "" {
+				route = "unmatched"
+			}
+			status := c.Response().Status
+
+			metrics.RequestDuration.
+				WithLabelValues(c.Request().Method, route, strconv.Itoa(status)).
+				Observe(time.Since(start).Seconds())
+
+			return err
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"github.com/Ki4EH/stunning-octo-waddle/internal/metrics"
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMetricsMiddleware(t *testing.T) {
+	e := echo.New()
+	e.Use(MetricsMiddleware())
+	e.GET("/api/buy/:item", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	serve := func(path string) int {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec.Code
+	}
+
+	t.Run("route template is used as label", func(t *testing.T) {
+		before := testutil.CollectAndCount(metrics.RequestDuration)
+
+		assert.Equal(t, http.StatusOK, serve("/api/buy/cup"))
+		assert.Equal(t, http.StatusOK, serve("/api/buy/pen"))
+
+		assert.Equal(t, before+1, testutil.CollectAndCount(metrics.RequestDuration))
+	})
+}
@@ -0,0 +1,219 @@
+package middleware
+
+import (
+	"bytes"
+	"errors"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/api/problem"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/logger"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// ErrInvalidResponse возвращается вместо ответа, который не совпал со схемой.
+var ErrInvalidResponse = problem.New(http.StatusInternalServerError, "invalid_response", "response does not match api spec")
+
+type OpenAPIOptions struct {
+	// Проверять запросы, неподходящие отклоняются с 400
+	ValidateRequests bool
+	// Проверять ответы. Ответ буферизуется целиком, поэтому включается
+	// только при разработке и в тестах
+	ValidateResponses bool
+}
+
+var pathParam = regexp.MustCompile(`:(\w+)`)
+
+// OpenAPIValidator проверяет запросы и ответы по описанию API. Операция
+// ищется по шаблону маршрута Echo, маршруты вне схемы (/metrics) не проверяются.
+func OpenAPIValidator(doc *openapi3.T, opts OpenAPIOptions) echo.MiddlewareFunc {
+	filterOpts := &openapi3filter.Options{
+		AuthenticationFunc:    openapi3filter.NoopAuthenticationFunc,
+		IncludeResponseStatus: true,
+	}
+	// Полный текст SchemaError содержит всю схему, клиенту хватит пути и причины
+	filterOpts.WithCustomSchemaErrorFunc(func(err *openapi3.SchemaError) string {
+		if pointer := err.JSONPointer(); len(pointer) > 0 {
+			return "/" + strings.Join(pointer, "/") + ": " + err.Reason
+		}
+		return err.Reason
+	})
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			route := findRoute(doc, c)
+			if route == nil {
+				return next(c)
+			}
+
+			input := &openapi3filter.RequestValidationInput{
+				Request:    c.Request(),
+				PathParams: pathParams(c),
+				Route:      route,
+				Options:    filterOpts,
+			}
+			if opts.ValidateRequests {
+				if err := openapi3filter.ValidateRequest(c.Request().Context(), input); err != nil {
+					return requestProblem(err)
+				}
+			}
+			if !opts.ValidateResponses || streaming(route) {
+				return next(c)
+			}
+
+			res := c.Response()
+			original := res.Writer
+			buffer := &bufferedWriter{ResponseWriter: original}
+			res.Writer = buffer
+
+			err := next(c)
+			if err != nil {
+				// Ответ с ошибкой тоже должен попасть в буфер
+				c.Error(err)
+			}
+			res.Writer = original
+
+			validationErr := openapi3filter.ValidateResponse(c.Request().Context(), &openapi3filter.ResponseValidationInput{
+				RequestValidationInput: input,
+				Status:                 buffer.statusCode(),
+				Header:                 res.Header(),
+				Body:                   io.NopCloser(bytes.NewReader(buffer.body.Bytes())),
+				Options:                filterOpts,
+			})
+			if validationErr != nil {
+				logger.FromContext(c.Request().Context()).Error("response does not match api spec",
+					zap.Int("status", buffer.statusCode()), zap.Error(validationErr))
+				res.Committed = false
+				res.Size = 0
+				res.Header().Del(echo.HeaderContentLength)
+				c.Error(ErrInvalidResponse)
+				return nil
+			}
+
+			buffer.flush()
+			return err
+		}
+	}
+}
+
+// requestProblem превращает ошибку проверки запроса в 400 с перечнем
+// неверных полей.
+func requestProblem(err error) *problem.Problem {
+	p := problem.InvalidRequest(err.Error())
+
+	var requestErr *openapi3filter.RequestError
+	if !errors.As(err, &requestErr) {
+		return p
+	}
+	var field string
+	if requestErr.Parameter != nil {
+		field = requestErr.Parameter.Name
+	}
+
+	var schemaErrs []*openapi3.SchemaError
+	var multiErr openapi3.MultiError
+	var schemaErr *openapi3.SchemaError
+	switch {
+	case errors.As(requestErr.Err, &multiErr):
+		for _, e := range multiErr {
+			if errors.As(e, &schemaErr) {
+				schemaErrs = append(schemaErrs, schemaErr)
+			}
+		}
+	case errors.As(requestErr.Err, &schemaErr):
+		schemaErrs = append(schemaErrs, schemaErr)
+	}
+
+	for _, e := range schemaErrs {
+		name := field
+		if pointer := e.JSONPointer(); len(pointer) > 0 {
+			name = strings.Join(append([]string{field}, pointer...), ".")
+			name = strings.TrimPrefix(name, ".")
+		}
+		if name != "" {
+			p.Errors = append(p.Errors, problem.FieldError{Field: name, Reason: e.Reason})
+		}
+	}
+	if len(schemaErrs) == 0 && field != "" {
+		reason := requestErr.Reason
+		if reason == "" && requestErr.Err != nil {
+			reason = requestErr.Err.Error()
+		}
+		p.Errors = append(p.Errors, problem.FieldError{Field: field, Reason: reason})
+	}
+	return p
+}
+
+// streaming сообщает, что операция отвечает потоком событий или
+// переключается на WebSocket: такой ответ нельзя буферизовать до конца.
+func streaming(route *routers.Route) bool {
+	if route.Operation.Responses.Status(http.StatusSwitchingProtocols) != nil {
+		return true
+	}
+	ok := route.Operation.Responses.Status(http.StatusOK)
+	return ok != nil && ok.Value != nil && ok.Value.Content.Get("text/event-stream") != nil
+}
+
+func findRoute(doc *openapi3.T, c echo.Context) *routers.Route {
+	path := pathParam.ReplaceAllString(c.Path(), "{$1}")
+	pathItem := doc.Paths.Value(path)
+	if pathItem == nil {
+		return nil
+	}
+	operation := pathItem.GetOperation(c.Request().Method)
+	if operation == nil {
+		return nil
+	}
+	return &routers.Route{
+		Spec:      doc,
+		Path:      path,
+		PathItem:  pathItem,
+		Method:    c.Request().Method,
+		Operation: operation,
+	}
+}
+
+func pathParams(c echo.Context) map[string]string {
+	params := make(map[string]string, len(c.ParamNames()))
+	for i, name := range c.ParamNames() {
+		params[name] = c.ParamValues()[i]
+	}
+	return params
+}
+
+// bufferedWriter копит ответ, пока он не проверен по схеме.
+type bufferedWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *bufferedWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *bufferedWriter) Write(b []byte) (int, error) {
+	return w.body.Write(b)
+}
+
+func (w *bufferedWriter) statusCode() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+func (w *bufferedWriter) flush() {
+	if w.status == 0 && w.body.Len() == 0 {
+		return
+	}
+	w.ResponseWriter.WriteHeader(w.statusCode())
+	w.ResponseWriter.Write(w.body.Bytes())
+}
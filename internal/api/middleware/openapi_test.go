@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"encoding/json"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/api/problem"
+	"github.com/Ki4EH/stunning-octo-waddle/openapi"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestOpenAPIValidator(t *testing.T) {
+	doc, err := openapi.Load()
+	require.NoError(t, err)
+
+	e := echo.New()
+	e.HTTPErrorHandler = problem.HTTPErrorHandler
+	e.Use(OpenAPIValidator(doc, OpenAPIOptions{ValidateRequests: true, ValidateResponses: true}))
+	e.GET("/healthz", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, map[string]int{"status": 1})
+	})
+	e.GET("/readyz", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, map[string]string{"status": "ok"})
+	})
+	e.POST("/api/sendCoin", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+	e.GET("/metrics", func(c echo.Context) error {
+		return c.String(http.StatusOK, "# not in spec")
+	})
+
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+	code := func(rec *httptest.ResponseRecorder) string {
+		var p problem.Problem
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &p))
+		return p.Code
+	}
+
+	t.Run("valid response is passed through", func(t *testing.T) {
+		rec := serve(http.MethodGet, "/readyz", "")
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"status":"ok"}`, rec.Body.String())
+	})
+
+	t.Run("response drifted from spec", func(t *testing.T) {
+		rec := serve(http.MethodGet, "/healthz", "")
+
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+		assert.Equal(t, "invalid_response", code(rec))
+	})
+
+	t.Run("invalid request body", func(t *testing.T) {
+		rec := serve(http.MethodPost, "/api/sendCoin", `{"toUser":"bob","amount":"ten"}`)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Equal(t, "invalid_request", code(rec))
+		assert.Contains(t, rec.Body.String(), "/amount")
+
+		var p problem.Problem
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &p))
+		require.Len(t, p.Errors, 1)
+		assert.Equal(t, "amount", p.Errors[0].Field)
+	})
+
+	t.Run("missing required field", func(t *testing.T) {
+		rec := serve(http.MethodPost, "/api/sendCoin", `{"amount":10}`)
+
+		var p problem.Problem
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &p))
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		require.Len(t, p.Errors, 1)
+		assert.Equal(t, "toUser", p.Errors[0].Field)
+	})
+
+	t.Run("route outside spec is not validated", func(t *testing.T) {
+		rec := serve(http.MethodGet, "/metrics", "")
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "# not in spec", rec.Body.String())
+	})
+}
@@ -0,0 +1,122 @@
+package middleware
+
+import (
+	"github.com/Ki4EH/stunning-octo-waddle/internal/api/problem"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/logger"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/metrics"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/ratelimit"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/utils"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	HeaderRateLimitLimit     = "RateLimit-Limit"
+	HeaderRateLimitRemaining = "RateLimit-Remaining"
+	HeaderRateLimitReset     = "RateLimit-Reset"
+	HeaderRateLimitPolicy    = "RateLimit-Policy"
+	HeaderRetryAfter         = "Retry-After"
+
+	// Ключ общей корзины RATE_LIMIT_GLOBAL
+	globalBucket = "global"
+)
+
+var errRateLimited = problem.New(http.StatusTooManyRequests, "rate_limited", "too many requests, retry later")
+
+// RateLimits — действующие лимиты. Routes — по ключу "METHOD /path",
+// остальные маршруты делят корзину Default.
+type RateLimits struct {
+	Default ratelimit.Limit
+	Routes  ratelimit.Routes
+	Global  ratelimit.Limit
+}
+
+// RateLimit ограничивает частоту запросов пользователя из токена, а без
+// токена — IP клиента. Лимиты читаются при каждом запросе, поэтому их можно
+// менять на ходу. Ответ содержит заголовки RateLimit-* по лимиту клиента,
+// отклонённый запрос получает 429 с Retry-After. Запрос, отклонённый общим
+// лимитом, возвращается в корзину клиента. Если хранилище корзин
+// недоступно, запрос пропускается. Должен стоять после echojwt, если
+// маршрут его использует.
+func RateLimit(store ratelimit.Store, limits func() RateLimits) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			current := limits()
+			route := c.Request().Method + " " + c.Path()
+			limit, ok := current.Routes[route]
+			if !ok {
+				limit, route = current.Default, "*"
+			}
+
+			subject := "ip:" + c.RealIP()
+			if userID, ok := utils.UserIDFromContext(c); ok {
+				subject = "user:" + userID.String()
+			}
+
+			key := subject + " " + route
+			taken := false
+			if limit.Enabled() {
+				res, ok := take(c, store, key, limit)
+				if ok {
+					setRateLimitHeaders(c, limit, res)
+					if !res.Allowed {
+						return rejectRateLimited(c, res, "client")
+					}
+					taken = true
+				}
+			}
+			if current.Global.Enabled() {
+				res, ok := take(c, store, globalBucket, current.Global)
+				if ok && !res.Allowed {
+					if taken {
+						refund(c, store, key, limit)
+					}
+					setRateLimitHeaders(c, current.Global, res)
+					return rejectRateLimited(c, res, "global")
+				}
+			}
+			return next(c)
+		}
+	}
+}
+
+func take(c echo.Context, store ratelimit.Store, key string, limit ratelimit.Limit) (ratelimit.Result, bool) {
+	ctx := c.Request().Context()
+	res, err := store.Take(ctx, key, limit)
+	if err != nil {
+		logger.FromContext(ctx).Error("rate limiter is unavailable, request is not limited", zap.Error(err))
+		return ratelimit.Result{}, false
+	}
+	return res, true
+}
+
+func refund(c echo.Context, store ratelimit.Store, key string, limit ratelimit.Limit) {
+	ctx := c.Request().Context()
+	if err := store.Refund(ctx, key, limit); err != nil {
+		logger.FromContext(ctx).Error("failed to refund rate limit token", zap.Error(err))
+	}
+}
+
+func setRateLimitHeaders(c echo.Context, limit ratelimit.Limit, res ratelimit.Result) {
+	header := c.Response().Header()
+	header.Set(HeaderRateLimitLimit, strconv.Itoa(res.Limit))
+	header.Set(HeaderRateLimitRemaining, strconv.Itoa(res.Remaining))
+	header.Set(HeaderRateLimitReset, ceilSeconds(res.Reset))
+	header.Set(HeaderRateLimitPolicy, strconv.Itoa(limit.Requests)+";w="+ceilSeconds(limit.Period))
+}
+
+func rejectRateLimited(c echo.Context, res ratelimit.Result, scope string) error {
+	c.Response().Header().Set(HeaderRetryAfter, ceilSeconds(res.RetryAfter))
+	metrics.RateLimited.WithLabelValues(c.Request().Method, c.Path(), scope).Inc()
+	return errRateLimited
+}
+
+// ceilSeconds округляет вверх: клиент, подождавший столько секунд, уже
+// получит запрос.
+func ceilSeconds(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10)
+}
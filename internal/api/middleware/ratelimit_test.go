@@ -0,0 +1,162 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/api/problem"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/ratelimit"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/utils"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type failingStore struct{}
+
+func (failingStore) Take(context.Context, string, ratelimit.Limit) (ratelimit.Result, error) {
+	return ratelimit.Result{}, errors.New("database is down")
+}
+
+func (failingStore) Refund(context.Context, string, ratelimit.Limit) error {
+	return errors.New("database is down")
+}
+
+func TestRateLimit(t *testing.T) {
+	alice, bob := uuid.New(), uuid.New()
+	limits := RateLimits{
+		Default: ratelimit.Limit{Requests: 3, Period: time.Minute},
+		Routes: ratelimit.Routes{
+			"POST /api/sendCoin": {Requests: 2, Period: time.Minute},
+			"POST /api/auth":     {Requests: 1, Period: time.Minute},
+		},
+	}
+
+	newServer := func(store ratelimit.Store, limits *RateLimits) *echo.Echo {
+		e := echo.New()
+		e.HTTPErrorHandler = problem.HTTPErrorHandler
+		// Вместо echojwt: пользователь из заголовка X-User
+		e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+			return func(c echo.Context) error {
+				if id, err := uuid.Parse(c.Request().Header.Get("X-User")); err == nil {
+					c.Set("user", &jwt.Token{Claims: &utils.Claims{UserID: id}})
+				}
+				return next(c)
+			}
+		})
+		e.Use(RateLimit(store, func() RateLimits { return *limits }))
+		ok := func(c echo.Context) error { return c.NoContent(http.StatusOK) }
+		e.POST("/api/sendCoin", ok)
+		e.POST("/api/auth", ok)
+		e.GET("/api/info", ok)
+		e.GET("/api/history", ok)
+		return e
+	}
+
+	serve := func(e *echo.Echo, method, path string, user uuid.UUID, ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if user != uuid.Nil {
+			req.Header.Set("X-User", user.String())
+		}
+		req.RemoteAddr = ip + ":1234"
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("route limit is per user", func(t *testing.T) {
+		e := newServer(ratelimit.NewMemory(), &limits)
+
+		first := serve(e, http.MethodPost, "/api/sendCoin", alice, "10.0.0.1")
+		assert.Equal(t, http.StatusOK, first.Code)
+		assert.Equal(t, "2", first.Header().Get(HeaderRateLimitLimit))
+		assert.Equal(t, "1", first.Header().Get(HeaderRateLimitRemaining))
+		assert.Equal(t, "2;w=60", first.Header().Get(HeaderRateLimitPolicy))
+
+		assert.Equal(t, http.StatusOK, serve(e, http.MethodPost, "/api/sendCoin", alice, "10.0.0.1").Code)
+		rejected := serve(e, http.MethodPost, "/api/sendCoin", alice, "10.0.0.2")
+		assert.Equal(t, http.StatusTooManyRequests, rejected.Code)
+		assert.Contains(t, rejected.Body.String(), "rate_limited")
+		assert.Equal(t, "0", rejected.Header().Get(HeaderRateLimitRemaining))
+		assert.Equal(t, "30", rejected.Header().Get(HeaderRetryAfter))
+
+		assert.Equal(t, http.StatusOK, serve(e, http.MethodPost, "/api/sendCoin", bob, "10.0.0.1").Code)
+	})
+
+	t.Run("requests without token are limited by ip", func(t *testing.T) {
+		e := newServer(ratelimit.NewMemory(), &limits)
+
+		assert.Equal(t, http.StatusOK, serve(e, http.MethodPost, "/api/auth", uuid.Nil, "10.0.0.1").Code)
+		assert.Equal(t, http.StatusTooManyRequests, serve(e, http.MethodPost, "/api/auth", uuid.Nil, "10.0.0.1").Code)
+		assert.Equal(t, http.StatusOK, serve(e, http.MethodPost, "/api/auth", uuid.Nil, "10.0.0.2").Code)
+	})
+
+	t.Run("routes without own limit share default", func(t *testing.T) {
+		e := newServer(ratelimit.NewMemory(), &limits)
+
+		assert.Equal(t, http.StatusOK, serve(e, http.MethodGet, "/api/info", alice, "10.0.0.1").Code)
+		assert.Equal(t, http.StatusOK, serve(e, http.MethodGet, "/api/history", alice, "10.0.0.1").Code)
+		assert.Equal(t, http.StatusOK, serve(e, http.MethodGet, "/api/info", alice, "10.0.0.1").Code)
+		assert.Equal(t, http.StatusTooManyRequests, serve(e, http.MethodGet, "/api/history", alice, "10.0.0.1").Code)
+		// Свой лимит маршрута считается отдельно
+		assert.Equal(t, http.StatusOK, serve(e, http.MethodPost, "/api/sendCoin", alice, "10.0.0.1").Code)
+	})
+
+	t.Run("global limit covers all clients", func(t *testing.T) {
+		global := RateLimits{Global: ratelimit.Limit{Requests: 2, Period: time.Second}}
+		e := newServer(ratelimit.NewMemory(), &global)
+
+		assert.Equal(t, http.StatusOK, serve(e, http.MethodGet, "/api/info", alice, "10.0.0.1").Code)
+		assert.Equal(t, http.StatusOK, serve(e, http.MethodGet, "/api/info", bob, "10.0.0.2").Code)
+		rejected := serve(e, http.MethodGet, "/api/info", uuid.Nil, "10.0.0.3")
+		assert.Equal(t, http.StatusTooManyRequests, rejected.Code)
+		assert.Equal(t, "1", rejected.Header().Get(HeaderRetryAfter))
+	})
+
+	t.Run("global reject does not drain client bucket", func(t *testing.T) {
+		both := RateLimits{
+			Default: ratelimit.Limit{Requests: 2, Period: time.Hour},
+			Global:  ratelimit.Limit{Requests: 1, Period: time.Hour},
+		}
+		e := newServer(ratelimit.NewMemory(), &both)
+
+		assert.Equal(t, http.StatusOK, serve(e, http.MethodGet, "/api/info", bob, "10.0.0.1").Code)
+		for range 3 {
+			assert.Equal(t, http.StatusTooManyRequests, serve(e, http.MethodGet, "/api/info", alice, "10.0.0.1").Code)
+		}
+
+		// Общий лимит снят: у alice весь запас на месте
+		both.Global = ratelimit.Limit{}
+		assert.Equal(t, http.StatusOK, serve(e, http.MethodGet, "/api/info", alice, "10.0.0.1").Code)
+		rec := serve(e, http.MethodGet, "/api/info", alice, "10.0.0.1")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "0", rec.Header().Get(HeaderRateLimitRemaining))
+	})
+
+	t.Run("limits are read on every request", func(t *testing.T) {
+		current := RateLimits{}
+		e := newServer(ratelimit.NewMemory(), &current)
+
+		rec := serve(e, http.MethodGet, "/api/info", alice, "10.0.0.1")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Empty(t, rec.Header().Get(HeaderRateLimitLimit))
+
+		current.Default = ratelimit.Limit{Requests: 1, Period: time.Minute}
+		assert.Equal(t, http.StatusOK, serve(e, http.MethodGet, "/api/info", alice, "10.0.0.1").Code)
+		assert.Equal(t, http.StatusTooManyRequests, serve(e, http.MethodGet, "/api/info", alice, "10.0.0.1").Code)
+	})
+
+	t.Run("unavailable store does not block requests", func(t *testing.T) {
+		e := newServer(failingStore{}, &limits)
+
+		for range 3 {
+			rec := serve(e, http.MethodPost, "/api/auth", uuid.Nil, "10.0.0.1")
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Empty(t, rec.Header().Get(HeaderRateLimitLimit))
+		}
+	})
+}
@@ -0,0 +1,632 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/config"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/models"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/repository"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/events"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/health"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/logger"
+	mock_repository "github.com/Ki4EH/stunning-octo-waddle/internal/mocks/repository"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/ratelimit"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/utils"
+	"github.com/Ki4EH/stunning-octo-waddle/openapi"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	userID  = uuid.New()
+	adminID = uuid.New()
+	otherID = uuid.New()
+	itemID  = uuid.New()
+)
+
+// newTestServer собирает сервер через InitRoutes поверх моков и включает
+// проверку ответов: ответ, расходящийся со схемой, превращается в 500.
+func newTestServer(t *testing.T, setup func(users *mock_repository.MockUserRepository, coins *mock_repository.MockCoinRepository)) *echo.Echo {
+	return newTestServerWithBroker(t, events.NewBroker(), setup)
+}
+
+func newTestServerWithBroker(t *testing.T, broker *events.Broker, setup func(users *mock_repository.MockUserRepository, coins *mock_repository.MockCoinRepository)) *echo.Echo {
+	ctrl := gomock.NewController(t)
+	users := mock_repository.NewMockUserRepository(ctrl)
+	coins := mock_repository.NewMockCoinRepository(ctrl)
+
+	users.EXPECT().GetUserByID(gomock.Any(), adminID).
+		Return(&models.Credential{ID: adminID, Username: "admin", IsAdmin: true}, nil).AnyTimes()
+	if setup != nil {
+		setup(users, coins)
+	}
+
+	e := echo.New()
+	log := logger.Nop()
+	cfg := &config.Config{OpenAPIValidateRequests: true, OpenAPIValidateResponses: true}
+	require.NoError(t, InitRoutes(e, Repositories{Users: users, Coins: coins}, broker, &log, config.NewStore(cfg, nil), health.NewChecker()))
+	return e
+}
+
+func bearer(t *testing.T, id uuid.UUID) string {
+	token, err := utils.GenerateToken(id)
+	require.NoError(t, err)
+	return "Bearer " + token
+}
+
+func TestRoutesMatchSpec(t *testing.T) {
+	doc, err := openapi.Load()
+	require.NoError(t, err)
+
+	documented := make(map[string]bool)
+	for path, item := range doc.Paths.Map() {
+		for method := range item.Operations() {
+			documented[method+" "+path] = true
+		}
+	}
+
+	param := regexp.MustCompile(`:(\w+)`)
+	registered := make(map[string]bool)
+	for _, route := range newTestServer(t, nil).Routes() {
+		if route.Path == "/metrics" || route.Method == echo.RouteNotFound {
+			continue
+		}
+		registered[route.Method+" "+param.ReplaceAllString(route.Path, "{$1}")] = true
+	}
+
+	for route := range registered {
+		assert.True(t, documented[route], "route %s is not described in schema.yaml", route)
+	}
+	for operation := range documented {
+		assert.True(t, registered[operation], "operation %s from schema.yaml has no handler", operation)
+	}
+}
+
+func TestResponsesMatchSpec(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	reversal := &models.TransferReversal{
+		ID: uuid.New(), TransactionID: uuid.New(), FromUser: "alice", ToUser: "bob",
+		Amount: 10, Reason: "wrong user", Status: models.ReversalStatusPending, CreatedAt: now,
+	}
+	hold := &models.CoinHold{
+		ID: uuid.New(), Amount: 10, Reason: "order", Status: models.HoldStatusHeld, CreatedAt: now, ExpiresAt: now.Add(time.Hour),
+	}
+	maxPerTransfer := int64(100)
+	limits := &models.UserTransferLimits{
+		Effective: models.TransferLimits{MaxPerTransfer: maxPerTransfer},
+		Override:  models.TransferLimitsOverride{MaxPerTransfer: &maxPerTransfer},
+	}
+	bob := &models.Credential{ID: otherID, Username: "bob"}
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		body           string
+		as             uuid.UUID
+		setup          func(users *mock_repository.MockUserRepository, coins *mock_repository.MockCoinRepository)
+		expectedStatus int
+	}{
+		{
+			name:   "login",
+			method: http.MethodPost,
+			path:   "/api/auth",
+			body:   `{"username":"alice","password":"secret"}`,
+			setup: func(users *mock_repository.MockUserRepository, coins *mock_repository.MockCoinRepository) {
+				users.EXPECT().GetUserCredentialByName(gomock.Any(), "alice").
+					Return(&models.Credential{ID: userID, Username: "alice", Password: "secret"}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "login without password",
+			method:         http.MethodPost,
+			path:           "/api/auth",
+			body:           `{"username":"alice"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:   "login with wrong password",
+			method: http.MethodPost,
+			path:   "/api/auth",
+			body:   `{"username":"alice","password":"wrong"}`,
+			setup: func(users *mock_repository.MockUserRepository, coins *mock_repository.MockCoinRepository) {
+				users.EXPECT().GetUserCredentialByName(gomock.Any(), "alice").
+					Return(&models.Credential{ID: userID, Username: "alice", Password: "secret"}, nil)
+			},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:   "info",
+			method: http.MethodGet,
+			path:   "/api/info",
+			as:     userID,
+			setup: func(users *mock_repository.MockUserRepository, coins *mock_repository.MockCoinRepository) {
+				users.EXPECT().GetUserByID(gomock.Any(), userID).
+					Return(&models.Credential{ID: userID, Username: "alice", Coin: 900, Held: 10}, nil)
+				users.EXPECT().GetUserItems(gomock.Any(), userID, gomock.Any()).
+					DoAndReturn(func(_ any, _ uuid.UUID, items *[]models.UserItem) error {
+						*items = append(*items, models.UserItem{Type: "cup", Quantity: 2})
+						return nil
+					})
+				coins.EXPECT().GetTransactions(gomock.Any(), userID, gomock.Any()).
+					DoAndReturn(func(_ any, _ uuid.UUID, txs *[]models.Transaction) error {
+						*txs = append(*txs,
+							models.Transaction{ID: uuid.New(), FromUser: "bob", ToUser: "alice", Amount: 5},
+							models.Transaction{ID: uuid.New(), FromUser: "alice", ToUser: "bob", Amount: 7, Reversed: true})
+						return nil
+					})
+				coins.EXPECT().GetExpiringCoins(gomock.Any(), userID).
+					Return(&models.ExpiringCoins{Amount: 100, Before: now}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "info without token",
+			method:         http.MethodGet,
+			path:           "/api/info",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:   "send coins",
+			method: http.MethodPost,
+			path:   "/api/sendCoin",
+			body:   `{"toUser":"bob","amount":10}`,
+			as:     userID,
+			setup: func(users *mock_repository.MockUserRepository, coins *mock_repository.MockCoinRepository) {
+				users.EXPECT().GetUserCredentialByName(gomock.Any(), "bob").Return(bob, nil)
+				coins.EXPECT().SendCoins(gomock.Any(), userID, otherID, int64(10)).Return(nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:   "send coins with insufficient balance",
+			method: http.MethodPost,
+			path:   "/api/sendCoin",
+			body:   `{"toUser":"bob","amount":10}`,
+			as:     userID,
+			setup: func(users *mock_repository.MockUserRepository, coins *mock_repository.MockCoinRepository) {
+				users.EXPECT().GetUserCredentialByName(gomock.Any(), "bob").Return(bob, nil)
+				coins.EXPECT().SendCoins(gomock.Any(), userID, otherID, int64(10)).Return(repository.ErrInsufficientBalance)
+			},
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "send coins with wrong amount type",
+			method:         http.MethodPost,
+			path:           "/api/sendCoin",
+			body:           `{"toUser":"bob","amount":"ten"}`,
+			as:             userID,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:   "buy item",
+			method: http.MethodGet,
+			path:   "/api/buy/cup",
+			as:     userID,
+			setup: func(users *mock_repository.MockUserRepository, coins *mock_repository.MockCoinRepository) {
+				coins.EXPECT().BuyItemFromShop(gomock.Any(), userID, "cup").Return(nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:   "buy unknown item",
+			method: http.MethodGet,
+			path:   "/api/buy/car",
+			as:     userID,
+			setup: func(users *mock_repository.MockUserRepository, coins *mock_repository.MockCoinRepository) {
+				coins.EXPECT().BuyItemFromShop(gomock.Any(), userID, "car").Return(repository.ErrItemNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:   "list reversals",
+			method: http.MethodGet,
+			path:   "/api/reversals",
+			as:     userID,
+			setup: func(users *mock_repository.MockUserRepository, coins *mock_repository.MockCoinRepository) {
+				coins.EXPECT().GetReversals(gomock.Any(), userID, gomock.Any()).
+					DoAndReturn(func(_ any, _ uuid.UUID, reversals *[]models.TransferReversal) error {
+						*reversals = append(*reversals, *reversal)
+						return nil
+					})
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:   "request reversal",
+			method: http.MethodPost,
+			path:   "/api/transactions/" + itemID.String() + "/reversal",
+			body:   `{"reason":"wrong user"}`,
+			as:     userID,
+			setup: func(users *mock_repository.MockUserRepository, coins *mock_repository.MockCoinRepository) {
+				coins.EXPECT().RequestReversal(gomock.Any(), itemID, userID, "wrong user").Return(reversal, nil)
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:   "approve reversal",
+			method: http.MethodPost,
+			path:   "/api/reversals/" + itemID.String() + "/approve",
+			as:     userID,
+			setup: func(users *mock_repository.MockUserRepository, coins *mock_repository.MockCoinRepository) {
+				coins.EXPECT().ApproveReversal(gomock.Any(), itemID, userID).Return(reversal, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:   "reject reversal",
+			method: http.MethodPost,
+			path:   "/api/reversals/" + itemID.String() + "/reject",
+			as:     userID,
+			setup: func(users *mock_repository.MockUserRepository, coins *mock_repository.MockCoinRepository) {
+				coins.EXPECT().RejectReversal(gomock.Any(), itemID, userID).Return(nil, repository.ErrReversalNotPending)
+			},
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name:   "force reversal",
+			method: http.MethodPost,
+			path:   "/api/admin/transactions/" + itemID.String() + "/reverse",
+			body:   `{"reason":"fraud"}`,
+			as:     adminID,
+			setup: func(users *mock_repository.MockUserRepository, coins *mock_repository.MockCoinRepository) {
+				coins.EXPECT().ForceReversal(gomock.Any(), itemID, adminID, "fraud").Return(reversal, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:   "admin route for regular user",
+			method: http.MethodPost,
+			path:   "/api/admin/transactions/" + itemID.String() + "/reverse",
+			body:   `{"reason":"fraud"}`,
+			as:     userID,
+			setup: func(users *mock_repository.MockUserRepository, coins *mock_repository.MockCoinRepository) {
+				users.EXPECT().GetUserByID(gomock.Any(), userID).Return(&models.Credential{ID: userID}, nil)
+			},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:   "get limits",
+			method: http.MethodGet,
+			path:   "/api/admin/users/bob/limits",
+			as:     adminID,
+			setup: func(users *mock_repository.MockUserRepository, coins *mock_repository.MockCoinRepository) {
+				users.EXPECT().GetUserCredentialByName(gomock.Any(), "bob").Return(bob, nil)
+				coins.EXPECT().GetTransferLimits(gomock.Any(), otherID).Return(limits, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:   "set limits",
+			method: http.MethodPut,
+			path:   "/api/admin/users/bob/limits",
+			body:   `{"maxPerTransfer":100}`,
+			as:     adminID,
+			setup: func(users *mock_repository.MockUserRepository, coins *mock_repository.MockCoinRepository) {
+				users.EXPECT().GetUserCredentialByName(gomock.Any(), "bob").Return(bob, nil)
+				coins.EXPECT().SetTransferLimits(gomock.Any(), otherID, adminID, gomock.Any()).Return(limits, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:   "limits of unknown user",
+			method: http.MethodGet,
+			path:   "/api/admin/users/carol/limits",
+			as:     adminID,
+			setup: func(users *mock_repository.MockUserRepository, coins *mock_repository.MockCoinRepository) {
+				users.EXPECT().GetUserCredentialByName(gomock.Any(), "carol").Return(&models.Credential{}, nil)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:   "grant coins",
+			method: http.MethodPost,
+			path:   "/api/admin/users/bob/grant",
+			body:   `{"amount":100}`,
+			as:     adminID,
+			setup: func(users *mock_repository.MockUserRepository, coins *mock_repository.MockCoinRepository) {
+				users.EXPECT().GetUserCredentialByName(gomock.Any(), "bob").Return(bob, nil)
+				coins.EXPECT().GrantCoins(gomock.Any(), otherID, int64(100)).Return(nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:   "hold coins",
+			method: http.MethodPost,
+			path:   "/api/admin/users/bob/holds",
+			body:   `{"amount":10,"reason":"order","ttlSeconds":60}`,
+			as:     adminID,
+			setup: func(users *mock_repository.MockUserRepository, coins *mock_repository.MockCoinRepository) {
+				users.EXPECT().GetUserCredentialByName(gomock.Any(), "bob").Return(bob, nil)
+				coins.EXPECT().HoldCoins(gomock.Any(), otherID, adminID, gomock.Any()).Return(hold, nil)
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:   "capture hold",
+			method: http.MethodPost,
+			path:   "/api/admin/holds/" + hold.ID.String() + "/capture",
+			as:     adminID,
+			setup: func(users *mock_repository.MockUserRepository, coins *mock_repository.MockCoinRepository) {
+				captured := *hold
+				captured.Status = models.HoldStatusCaptured
+				captured.ResolvedAt = &now
+				coins.EXPECT().CaptureHold(gomock.Any(), hold.ID).Return(&captured, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:   "release inactive hold",
+			method: http.MethodPost,
+			path:   "/api/admin/holds/" + hold.ID.String() + "/release",
+			as:     adminID,
+			setup: func(users *mock_repository.MockUserRepository, coins *mock_repository.MockCoinRepository) {
+				coins.EXPECT().ReleaseHold(gomock.Any(), hold.ID).Return(nil, repository.ErrHoldNotActive)
+			},
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name:   "v2 login",
+			method: http.MethodPost,
+			path:   "/api/v2/auth",
+			body:   `{"username":"alice","password":"secret"}`,
+			setup: func(users *mock_repository.MockUserRepository, coins *mock_repository.MockCoinRepository) {
+				users.EXPECT().GetUserCredentialByName(gomock.Any(), "alice").
+					Return(&models.Credential{ID: userID, Username: "alice", Password: "secret"}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:   "v2 info",
+			method: http.MethodGet,
+			path:   "/api/v2/info",
+			as:     userID,
+			setup: func(users *mock_repository.MockUserRepository, coins *mock_repository.MockCoinRepository) {
+				users.EXPECT().GetUserByID(gomock.Any(), userID).
+					Return(&models.Credential{ID: userID, Username: "alice", Coin: 900}, nil)
+				users.EXPECT().GetUserItems(gomock.Any(), userID, gomock.Any()).Return(nil)
+				coins.EXPECT().GetExpiringCoins(gomock.Any(), userID).Return(&models.ExpiringCoins{}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:   "v2 history",
+			method: http.MethodGet,
+			path:   "/api/v2/history?limit=1",
+			as:     userID,
+			setup: func(users *mock_repository.MockUserRepository, coins *mock_repository.MockCoinRepository) {
+				reversalOf := uuid.New()
+				coins.EXPECT().GetHistory(gomock.Any(), userID, 2, nil).Return([]models.HistoryEntry{
+					{ID: uuid.New(), Direction: models.HistorySent, Counterparty: "bob", Amount: 5, CreatedAt: now},
+					{ID: uuid.New(), Direction: models.HistoryReceived, Counterparty: "bob", Amount: 5, ReversalOf: &reversalOf, CreatedAt: now},
+				}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "v2 history with limit out of range",
+			method:         http.MethodGet,
+			path:           "/api/v2/history?limit=1000",
+			as:             userID,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "v2 history with malformed cursor",
+			method:         http.MethodGet,
+			path:           "/api/v2/history?cursor=bad",
+			as:             userID,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:   "v2 purchase",
+			method: http.MethodPost,
+			path:   "/api/v2/purchases",
+			body:   `{"item":"cup"}`,
+			as:     userID,
+			setup: func(users *mock_repository.MockUserRepository, coins *mock_repository.MockCoinRepository) {
+				coins.EXPECT().BuyItemFromShop(gomock.Any(), userID, "cup").Return(nil)
+			},
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:           "v2 purchase without item",
+			method:         http.MethodPost,
+			path:           "/api/v2/purchases",
+			body:           `{}`,
+			as:             userID,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:   "v2 transfer",
+			method: http.MethodPost,
+			path:   "/api/v2/transfers",
+			body:   `{"toUser":"bob","amount":10}`,
+			as:     userID,
+			setup: func(users *mock_repository.MockUserRepository, coins *mock_repository.MockCoinRepository) {
+				users.EXPECT().GetUserCredentialByName(gomock.Any(), "bob").Return(bob, nil)
+				coins.EXPECT().SendCoins(gomock.Any(), userID, otherID, int64(10)).Return(nil)
+			},
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:           "v2 transfer with negative amount",
+			method:         http.MethodPost,
+			path:           "/api/v2/transfers",
+			body:           `{"toUser":"bob","amount":-1}`,
+			as:             userID,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:   "v2 transfer with insufficient balance",
+			method: http.MethodPost,
+			path:   "/api/v2/transfers",
+			body:   `{"toUser":"bob","amount":10}`,
+			as:     userID,
+			setup: func(users *mock_repository.MockUserRepository, coins *mock_repository.MockCoinRepository) {
+				users.EXPECT().GetUserCredentialByName(gomock.Any(), "bob").Return(bob, nil)
+				coins.EXPECT().SendCoins(gomock.Any(), userID, otherID, int64(10)).Return(repository.ErrInsufficientBalance)
+			},
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "liveness",
+			method:         http.MethodGet,
+			path:           "/healthz",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "readiness",
+			method:         http.MethodGet,
+			path:           "/readyz",
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newTestServer(t, tt.setup)
+
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if tt.body != "" {
+				req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			}
+			if tt.as != uuid.Nil {
+				req.Header.Set(echo.HeaderAuthorization, bearer(t, tt.as))
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			if rec.Code == http.StatusInternalServerError {
+				var p map[string]any
+				_ = json.Unmarshal(rec.Body.Bytes(), &p)
+				require.NotEqual(t, "invalid_response", p["code"], "response drifted from schema.yaml")
+			}
+			assert.Equal(t, tt.expectedStatus, rec.Code, rec.Body.String())
+		})
+	}
+}
+
+func TestV1Deprecation(t *testing.T) {
+	e := newTestServer(t, func(users *mock_repository.MockUserRepository, coins *mock_repository.MockCoinRepository) {
+		coins.EXPECT().BuyItemFromShop(gomock.Any(), userID, "cup").Return(nil).Times(2)
+	})
+
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set(echo.HeaderAuthorization, bearer(t, userID))
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	v1 := serve(http.MethodGet, "/api/buy/cup", "")
+	require.Equal(t, http.StatusOK, v1.Code)
+	assert.Equal(t, fmt.Sprintf("@%d", apiV1DeprecatedAt.Unix()), v1.Header().Get("Deprecation"))
+	assert.Equal(t, `</api/v2/purchases>; rel="successor-version"`, v1.Header().Get("Link"))
+	assert.Empty(t, v1.Header().Get("Sunset"))
+
+	v2 := serve(http.MethodPost, "/api/v2/purchases", `{"item":"cup"}`)
+	require.Equal(t, http.StatusNoContent, v2.Code)
+	assert.Empty(t, v2.Header().Get("Deprecation"))
+}
+
+// Поток событий должен доходить до клиента сразу, несмотря на проверку
+// ответов и метрики, которые буферизуют обычные ответы.
+func TestEventsStream(t *testing.T) {
+	broker := events.NewBroker()
+	srv := httptest.NewServer(newTestServerWithBroker(t, broker, nil))
+	defer srv.Close()
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL+"/api/v2/events", nil)
+	require.NoError(t, err)
+	req.Header.Set(echo.HeaderAuthorization, bearer(t, userID))
+	res, err := srv.Client().Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "text/event-stream", res.Header.Get(echo.HeaderContentType))
+
+	require.Eventually(t, func() bool { return broker.Subscribers() == 1 }, time.Second, time.Millisecond)
+	broker.Publish(models.UserEvent{ID: 1, UserID: userID, Type: models.EventCoinsGranted, Payload: json.RawMessage(`{"amount":5}`)})
+
+	reader := bufio.NewReader(res.Body)
+	var lines []string
+	for len(lines) < 5 {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		lines = append(lines, strings.TrimSuffix(line, "\n"))
+	}
+	assert.Equal(t, []string{"retry: 3000", "", "id: 1", "event: coins_granted", `data: {"amount":5}`}, lines)
+
+	broker.Close()
+	_, err = io.ReadAll(reader)
+	assert.NoError(t, err)
+}
+
+// WebSocket проходит через те же middleware, что и остальные маршруты, а
+// браузерный клиент передаёт токен в access_token.
+func TestWalletSocket(t *testing.T) {
+	srv := httptest.NewServer(newTestServer(t, func(users *mock_repository.MockUserRepository, coins *mock_repository.MockCoinRepository) {
+		users.EXPECT().GetUserByID(gomock.Any(), userID).Return(&models.Credential{ID: userID, Username: "alice", Coin: 42}, nil)
+		users.EXPECT().GetUserItems(gomock.Any(), userID, gomock.Any()).Return(nil)
+		coins.EXPECT().GetExpiringCoins(gomock.Any(), userID).Return(&models.ExpiringCoins{}, nil)
+	}))
+	defer srv.Close()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/api/v2/ws"
+
+	_, res, err := websocket.DefaultDialer.Dial(url, nil)
+	require.ErrorIs(t, err, websocket.ErrBadHandshake)
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+
+	token := strings.TrimPrefix(bearer(t, userID), "Bearer ")
+	conn, res, err := websocket.DefaultDialer.Dial(url+"?access_token="+token, nil)
+	require.NoError(t, err)
+	defer conn.Close()
+	assert.Equal(t, http.StatusSwitchingProtocols, res.StatusCode)
+
+	var snapshot models.WalletSnapshotMessage
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	require.NoError(t, conn.ReadJSON(&snapshot))
+	assert.Equal(t, int64(42), snapshot.Wallet.Coin)
+}
+
+// Лимит входа считается по адресу соединения: подставляя новый
+// X-Forwarded-For, клиент не получает новую корзину.
+func TestRateLimitIgnoresForwardedFor(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	users := mock_repository.NewMockUserRepository(ctrl)
+	users.EXPECT().GetUserCredentialByName(gomock.Any(), "alice").
+		Return(&models.Credential{ID: userID, Username: "alice", Password: "secret"}, nil).AnyTimes()
+
+	e := echo.New()
+	log := logger.Nop()
+	cfg := &config.Config{RateLimitRoutes: ratelimit.Routes{"POST /api/v2/auth": {Requests: 2, Period: time.Minute}}}
+	require.NoError(t, InitRoutes(e, Repositories{Users: users}, events.NewBroker(), &log, config.NewStore(cfg, nil), health.NewChecker()))
+
+	var statuses []int
+	for i := range 4 {
+		req := httptest.NewRequest(http.MethodPost, "/api/v2/auth", strings.NewReader(`{"username":"alice","password":"wrong"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set(echo.HeaderXForwardedFor, fmt.Sprintf("203.0.113.%d", i))
+		req.Header.Set(echo.HeaderXRealIP, fmt.Sprintf("198.51.100.%d", i))
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		statuses = append(statuses, rec.Code)
+	}
+	assert.Equal(t, []int{http.StatusUnauthorized, http.StatusUnauthorized, http.StatusTooManyRequests, http.StatusTooManyRequests}, statuses)
+}
@@ -0,0 +1,207 @@
+package problem
+
+import (
+	"context"
+	"errors"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/repository"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/logger"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/metrics"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ContentType — тип ответа с ошибкой по RFC 7807.
+const ContentType = "application/problem+json"
+
+// typePrefix — префикс поля type; полный адрес задачи — typePrefix + code.
+const typePrefix = "/problems/"
+
+// Problem — тело ответа с ошибкой по RFC 7807. Code — машиночитаемый код,
+// по нему клиенты различают ошибки вместо разбора detail.
+type Problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	Code      string `json:"code"`
+	RequestID string `json:"requestId,omitempty"`
+	// Errors перечисляет неверные поля запроса, если их удалось определить
+	Errors []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError — неверное поле запроса. Field — имя параметра или путь
+// к полю тела через точку.
+type FieldError struct {
+	Field  string `json:"field"`
+	Reason string `json:"reason"`
+}
+
+func (p *Problem) Error() string {
+	if p.Detail != "" {
+		return p.Detail
+	}
+	return p.Title
+}
+
+func New(status int, code, detail string) *Problem {
+	return &Problem{
+		Type:   typePrefix + code,
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+func InvalidRequest(detail string) *Problem {
+	return New(http.StatusBadRequest, "invalid_request", detail)
+}
+
+// InvalidField — 400 для одного неверного поля запроса.
+func InvalidField(field, reason string) *Problem {
+	p := InvalidRequest(field + ": " + reason)
+	p.Errors = []FieldError{{Field: field, Reason: reason}}
+	return p
+}
+
+func Unauthorized(detail string) *Problem {
+	return New(http.StatusUnauthorized, "unauthorized", detail)
+}
+
+func Forbidden(detail string) *Problem {
+	return New(http.StatusForbidden, "forbidden", detail)
+}
+
+func NotFound(code, detail string) *Problem {
+	return New(http.StatusNotFound, code, detail)
+}
+
+// MissingToken возвращается, когда echojwt не положил токен в контекст.
+// Это ошибка конфигурации маршрутов, а не клиента.
+func MissingToken() *Problem {
+	return New(http.StatusInternalServerError, "internal_error", "failed to get jwt token")
+}
+
+type mapping struct {
+	err    error
+	status int
+	code   string
+}
+
+// domainErrors сопоставляет ошибки репозиториев статусам и кодам ответа.
+// Текст доменной ошибки безопасен и уходит клиенту в detail.
+var domainErrors = []mapping{
+	{repository.ErrInvalidAmount, http.StatusBadRequest, "invalid_amount"},
+	{repository.ErrNegativeLimits, http.StatusBadRequest, "invalid_limits"},
+
+	{repository.ErrNotTransactionSender, http.StatusForbidden, "not_transaction_sender"},
+	{repository.ErrNotTransactionRecipient, http.StatusForbidden, "not_transaction_recipient"},
+
+	{repository.ErrUserNotFound, http.StatusNotFound, "user_not_found"},
+	{repository.ErrSenderNotFound, http.StatusNotFound, "user_not_found"},
+	{repository.ErrItemNotFound, http.StatusNotFound, "item_not_found"},
+	{repository.ErrTransactionNotFound, http.StatusNotFound, "transaction_not_found"},
+	{repository.ErrReversalNotFound, http.StatusNotFound, "reversal_not_found"},
+	{repository.ErrHoldNotFound, http.StatusNotFound, "hold_not_found"},
+	{repository.ErrWebhookNotFound, http.StatusNotFound, "webhook_not_found"},
+
+	{repository.ErrAlreadyReversed, http.StatusConflict, "already_reversed"},
+	{repository.ErrReversalAlreadyExists, http.StatusConflict, "reversal_already_requested"},
+	{repository.ErrReversalNotPending, http.StatusConflict, "reversal_not_pending"},
+	{repository.ErrHoldNotActive, http.StatusConflict, "hold_not_active"},
+
+	{repository.ErrInsufficientBalance, http.StatusUnprocessableEntity, "insufficient_balance"},
+	{repository.ErrReceiverNotFound, http.StatusUnprocessableEntity, "receiver_not_found"},
+	{repository.ErrSelfTransfer, http.StatusUnprocessableEntity, "self_transfer"},
+	{repository.ErrCompensatingReversal, http.StatusUnprocessableEntity, "compensating_reversal"},
+	{repository.ErrTransferLimitExceeded, http.StatusUnprocessableEntity, "transfer_limit_exceeded"},
+	{repository.ErrDailyLimitExceeded, http.StatusUnprocessableEntity, "daily_limit_exceeded"},
+	{repository.ErrDailyRecipientsExceeded, http.StatusUnprocessableEntity, "daily_recipients_exceeded"},
+}
+
+// From превращает произвольную ошибку в Problem. Неизвестные ошибки
+// становятся 500 без текста: он может содержать детали SQL и окружения.
+func From(err error) *Problem {
+	var p *Problem
+	if errors.As(err, &p) {
+		return p
+	}
+
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) {
+		return fromHTTPError(httpErr)
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return New(http.StatusGatewayTimeout, "timeout", "request timed out")
+	}
+
+	for _, m := range domainErrors {
+		if errors.Is(err, m.err) {
+			return New(m.status, m.code, m.err.Error())
+		}
+	}
+
+	return New(http.StatusInternalServerError, "internal_error", "internal server error")
+}
+
+func fromHTTPError(err *echo.HTTPError) *Problem {
+	detail := ""
+	if msg, ok := err.Message.(string); ok {
+		detail = msg
+	}
+
+	switch err.Code {
+	case http.StatusBadRequest:
+		return InvalidRequest(detail)
+	case http.StatusUnauthorized:
+		return Unauthorized(detail)
+	case http.StatusForbidden:
+		return Forbidden(detail)
+	case http.StatusNotFound:
+		return NotFound("not_found", detail)
+	}
+
+	if err.Code >= http.StatusInternalServerError {
+		return New(err.Code, "internal_error", "internal server error")
+	}
+	return New(err.Code, codeFromStatus(err.Code), detail)
+}
+
+func codeFromStatus(status int) string {
+	text := http.StatusText(status)
+	if text == "" {
+		return strconv.Itoa(status)
+	}
+	return strings.ReplaceAll(strings.ToLower(text), " ", "_")
+}
+
+// HTTPErrorHandler — обработчик ошибок Echo. Все ответы с ошибкой проходят
+// через него, поэтому формат и метрика errors_total везде одинаковые.
+func HTTPErrorHandler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+
+	p := *From(err)
+	if p.Status >= http.StatusInternalServerError {
+		logger.FromContext(c.Request().Context()).Error("request failed", zap.Error(err))
+	}
+	p.Instance = c.Request().URL.Path
+	p.RequestID = c.Response().Header().Get(echo.HeaderXRequestID)
+	metrics.Errors.WithLabelValues(p.Code).Inc()
+
+	if c.Request().Method == http.MethodHead {
+		err = c.NoContent(p.Status)
+	} else {
+		c.Response().Header().Set(echo.HeaderContentType, ContentType)
+		err = c.JSON(p.Status, p)
+	}
+	if err != nil {
+		logger.FromContext(c.Request().Context()).Error("failed to write error response", zap.Error(err))
+	}
+}
@@ -0,0 +1,112 @@
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/repository"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/metrics"
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFrom(t *testing.T) {
+	tests := []struct {
+		name           string
+		err            error
+		expectedStatus int
+		expectedCode   string
+		expectedDetail string
+	}{
+		{
+			name:           "wrapped domain error",
+			err:            fmt.Errorf("failed to buy item: %w", repository.ErrInsufficientBalance),
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedCode:   "insufficient_balance",
+			expectedDetail: "insufficient balance",
+		},
+		{
+			name:           "not found",
+			err:            repository.ErrItemNotFound,
+			expectedStatus: http.StatusNotFound,
+			expectedCode:   "item_not_found",
+			expectedDetail: "item not found",
+		},
+		{
+			name:           "problem is returned as is",
+			err:            InvalidRequest("invalid request"),
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   "invalid_request",
+			expectedDetail: "invalid request",
+		},
+		{
+			name:           "echo error",
+			err:            echo.NewHTTPError(http.StatusUnauthorized, "invalid or expired jwt"),
+			expectedStatus: http.StatusUnauthorized,
+			expectedCode:   "unauthorized",
+			expectedDetail: "invalid or expired jwt",
+		},
+		{
+			name:           "echo error without own code",
+			err:            echo.ErrMethodNotAllowed,
+			expectedStatus: http.StatusMethodNotAllowed,
+			expectedCode:   "method_not_allowed",
+			expectedDetail: "Method Not Allowed",
+		},
+		{
+			name:           "unknown error hides its text",
+			err:            errors.New(`pq: relation "credentials" does not exist`),
+			expectedStatus: http.StatusInternalServerError,
+			expectedCode:   "internal_error",
+			expectedDetail: "internal server error",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := From(tt.err)
+
+			assert.Equal(t, tt.expectedStatus, p.Status)
+			assert.Equal(t, tt.expectedCode, p.Code)
+			assert.Equal(t, tt.expectedDetail, p.Detail)
+			assert.Equal(t, "/problems/"+tt.expectedCode, p.Type)
+			assert.Equal(t, http.StatusText(tt.expectedStatus), p.Title)
+		})
+	}
+}
+
+func TestHTTPErrorHandler(t *testing.T) {
+	e := echo.New()
+	e.HTTPErrorHandler = HTTPErrorHandler
+	e.GET("/api/buy/:item", func(c echo.Context) error {
+		c.Response().Header().Set(echo.HeaderXRequestID, "req-1")
+		return fmt.Errorf("failed to buy item: %w", repository.ErrItemNotFound)
+	})
+
+	counter := metrics.Errors.WithLabelValues("item_not_found")
+	before := testutil.ToFloat64(counter)
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/buy/car", nil))
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Equal(t, ContentType, rec.Header().Get(echo.HeaderContentType))
+
+	var p Problem
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &p))
+	assert.Equal(t, Problem{
+		Type:      "/problems/item_not_found",
+		Title:     "Not Found",
+		Status:    http.StatusNotFound,
+		Detail:    "item not found",
+		Instance:  "/api/buy/car",
+		Code:      "item_not_found",
+		RequestID: "req-1",
+	}, p)
+	assert.Equal(t, before+1, testutil.ToFloat64(counter))
+}
@@ -3,38 +3,253 @@ package api
 import (
 	"github.com/Ki4EH/stunning-octo-waddle/internal/api/handler"
 	"github.com/Ki4EH/stunning-octo-waddle/internal/api/middleware"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/api/problem"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/config"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/memory"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/models"
 	"github.com/Ki4EH/stunning-octo-waddle/internal/db/repository"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/events"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/health"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/idempotency"
 	"github.com/Ki4EH/stunning-octo-waddle/internal/logger"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/ratelimit"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/tracing"
 	"github.com/Ki4EH/stunning-octo-waddle/internal/utils"
+	"github.com/Ki4EH/stunning-octo-waddle/openapi"
 	"github.com/jackc/pgx/v5/pgxpool"
 	echojwt "github.com/labstack/echo-jwt/v4"
 	"github.com/labstack/echo/v4"
 	middlewareEcho "github.com/labstack/echo/v4/middleware"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/labstack/echo/otelecho"
+	"time"
 )
 
-func InitRoutes(e *echo.Echo, db *pgxpool.Pool, log *logger.Logger) {
-	e.Use(middleware.LoggingMiddleware(*log))
+// apiV1DeprecatedAt — дата выхода /api/v2, с неё маршруты v1, у которых
+// есть замена, считаются устаревшими.
+var apiV1DeprecatedAt = time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)
+
+// Repositories — хранилища, с которыми работают обработчики.
+type Repositories struct {
+	Users    repository.UserRepository
+	Coins    repository.CoinRepository
+	Events   repository.EventRepository
+	Webhooks repository.WebhookRepository
+	// Корзины ограничения частоты запросов, nil — в памяти экземпляра
+	RateLimits ratelimit.Store
+	// Ответы на запросы с Idempotency-Key, nil — в памяти экземпляра
+	Idempotency idempotency.Store
+}
+
+// NewRepositories создаёт репозитории поверх Postgres с трейсингом вызовов.
+// Чтения, упавшие из-за соединения, повторяются до DATABASE_READ_ATTEMPTS раз.
+// Если replicas не nil, данные пользователя читаются с реплик. Покупки берут
+// цены из catalog, если он не nil.
+func NewRepositories(primary *pgxpool.Pool, replicas *db.ReplicaSet, catalog *repository.Catalog, cfg *config.Config) Repositories {
+	opts := CoinOptions(cfg)
+	opts.Catalog = catalog
+
+	users := repository.NewUserRepository(primary, cfg.CoinLifetime)
+	coins := repository.NewCoinRepository(primary, opts)
+	if replicas != nil {
+		var replicaUsers []repository.UserRepository
+		var replicaCoins []repository.CoinRepository
+		for _, pool := range replicas.Pools() {
+			replicaUsers = append(replicaUsers, repository.NewUserRepository(pool, cfg.CoinLifetime))
+			replicaCoins = append(replicaCoins, repository.NewCoinRepository(pool, CoinOptions(cfg)))
+		}
+		users = repository.NewObservedUserRepository(
+			repository.NewReplicatedUserRepository(users, replicaUsers, replicas), replicas.Wrote)
+		coins = repository.NewObservedCoinRepository(
+			repository.NewReplicatedCoinRepository(coins, replicaCoins, replicas), replicas.Wrote)
+	}
+
+	retry := repository.ReadRetry{Attempts: cfg.DatabaseReadAttempts, BaseDelay: cfg.DatabaseReadRetryDelay}
+	userEvents := repository.NewRetryingEventRepository(repository.NewEventRepository(primary), retry)
+	webhooks := repository.NewRetryingWebhookRepository(repository.NewWebhookRepository(primary), retry)
+
+	return Repositories{
+		Users:    repository.NewTracedUserRepository(repository.NewRetryingUserRepository(users, retry)),
+		Coins:    repository.NewTracedCoinRepository(repository.NewRetryingCoinRepository(coins, retry)),
+		Events:   repository.NewTracedEventRepository(userEvents),
+		Webhooks: repository.NewTracedWebhookRepository(webhooks),
+	}
+}
+
+// NewMemoryRepositories создаёт репозитории поверх хранилища в памяти.
+func NewMemoryRepositories(store *memory.Store, cfg *config.Config) Repositories {
+	return Repositories{
+		Users:    repository.NewTracedUserRepository(memory.NewUserRepository(store, cfg.CoinLifetime)),
+		Coins:    repository.NewTracedCoinRepository(memory.NewCoinRepository(store, CoinOptions(cfg))),
+		Events:   repository.NewTracedEventRepository(memory.NewEventRepository(store)),
+		Webhooks: repository.NewTracedWebhookRepository(memory.NewWebhookRepository(store)),
+	}
+}
+
+// InitRoutes регистрирует маршруты. Настройки читаются из settings при
+// старте, а перезагружаемые — при каждом запросе.
+func InitRoutes(e *echo.Echo, repos Repositories, broker *events.Broker, log *logger.Logger, settings *config.Store, checker *health.Checker) error {
+	cfg := settings.Current()
+	e.HTTPErrorHandler = problem.HTTPErrorHandler
+	ipExtractor, err := middleware.IPExtractor(cfg.TrustedProxies)
+	if err != nil {
+		return err
+	}
+	e.IPExtractor = ipExtractor
+
+	e.Use(middlewareEcho.RequestID())
+	e.Use(otelecho.Middleware(tracing.ServiceName))
+	e.Use(middleware.MetricsMiddleware())
+	e.Use(middleware.RequestLogger(*log))
+	e.Use(middleware.LoggingMiddleware(func() time.Duration { return settings.Current().SlowRequestThreshold }))
 	e.Use(middlewareEcho.Recover())
-	e.Use(middleware.CORSConfig())
+	e.Use(middleware.CORSConfig(cfg.CORSAllowOrigins))
+
+	if cfg.OpenAPIValidateRequests || cfg.OpenAPIValidateResponses {
+		doc, err := openapi.Load()
+		if err != nil {
+			return err
+		}
+		e.Use(middleware.OpenAPIValidator(doc, middleware.OpenAPIOptions{
+			ValidateRequests:  cfg.OpenAPIValidateRequests,
+			ValidateResponses: cfg.OpenAPIValidateResponses,
+		}))
+	}
+
+	// Ответы /api/info сбрасываются при изменениях на этом экземпляре через
+	// обёртки репозиториев, а на других — по событиям брокера
+	var infoCache *handler.InfoCache
+	userRepo, coinRepo := repos.Users, repos.Coins
+	if cfg.InfoCacheSize > 0 {
+		infoCache = handler.NewInfoCache(cfg.InfoCacheSize, cfg.InfoCacheTTL)
+		broker.Observe(infoCache.Observer())
+		userRepo = repository.NewObservedUserRepository(userRepo, infoCache.Invalidate)
+		coinRepo = repository.NewObservedCoinRepository(coinRepo, infoCache.Invalidate)
+	}
 
-	userRepo := repository.NewUserRepository(db)
 	authHandler := handler.NewAuthorizationHandler(userRepo)
 
+	healthHandler := handler.NewHealthHandler(checker)
+
+	// Проверки для балансировщика и оркестратора
+	e.GET("/healthz", healthHandler.Live)
+	e.GET("/readyz", healthHandler.Ready)
+
+	// Метрики для Prometheus
+	e.GET("/metrics", echo.WrapHandler(promhttp.Handler()))
+
+	deprecated := func(successor string) echo.MiddlewareFunc {
+		return middleware.Deprecated(middleware.Deprecation{
+			Since:     apiV1DeprecatedAt,
+			Sunset:    cfg.APIV1Sunset,
+			Successor: successor,
+		})
+	}
+
+	// Лимиты перечитываются при каждом запросе. Вход ограничивается по IP,
+	// остальные маршруты — по пользователю из токена
+	rateLimits := repos.RateLimits
+	if rateLimits == nil {
+		rateLimits = ratelimit.NewMemory()
+	}
+	rateLimit := middleware.RateLimit(rateLimits, func() middleware.RateLimits {
+		cfg := settings.Current()
+		return middleware.RateLimits{Default: cfg.RateLimitDefault, Routes: cfg.RateLimitRoutes, Global: cfg.RateLimitGlobal}
+	})
+
 	// Путь для авторизации
-	e.POST("/api/auth", authHandler.Login)
+	e.POST("/api/auth", authHandler.Login, deprecated("/api/v2/auth"), rateLimit)
+	e.POST("/api/v2/auth", authHandler.Login, rateLimit)
 
 	apiGroup := e.Group("/api")
 
-	apiGroup.Use(echojwt.WithConfig(utils.JwtConfig))
+	jwtConfig := utils.JwtConfig
+	jwtConfig.ErrorHandler = func(c echo.Context, err error) error {
+		return problem.Unauthorized("missing or invalid token")
+	}
+	apiGroup.Use(echojwt.WithConfig(jwtConfig))
+	apiGroup.Use(middleware.UserLogger())
+	apiGroup.Use(rateLimit)
+	idempotencyStore := repos.Idempotency
+	if idempotencyStore == nil {
+		idempotencyStore = idempotency.NewMemory(cfg.IdempotencyTTL, cfg.IdempotencyMaxKeys)
+	}
+	apiGroup.Use(middleware.Idempotency(idempotencyStore))
 
-	coinRepo := repository.NewCoinRepository(db)
 	coinHandler := handler.NewCoinHandler(coinRepo)
 
-	combinedRepository := handler.NewCombinedRepository(userRepo, coinRepo)
+	combinedRepository := handler.NewCombinedRepository(userRepo, coinRepo, infoCache)
+
+	apiGroup.GET("/info", combinedRepository.GetInfo, deprecated("/api/v2/info"))
+
+	apiGroup.GET("/buy/:item", coinHandler.BuyItem, deprecated("/api/v2/purchases"), middleware.IdempotentRoute(idempotencyStore))
+	apiGroup.POST("/sendCoin", combinedRepository.SendCoinHandler, deprecated("/api/v2/transfers"))
+
+	// v2: покупка через POST, постраничная история, ошибки с перечнем полей
+	v2Group := apiGroup.Group("/v2")
+
+	v2Group.GET("/info", combinedRepository.GetWallet)
+	v2Group.GET("/history", coinHandler.GetHistory)
+	v2Group.POST("/purchases", coinHandler.Purchase)
+	v2Group.POST("/transfers", combinedRepository.Transfer)
+
+	eventsHandler := handler.NewEventsHandler(repos.Events, broker, cfg.EventsHeartbeat)
+
+	v2Group.GET("/events", eventsHandler.Stream)
+
+	// Браузер не может передать заголовок Authorization при открытии
+	// WebSocket, поэтому тот же токен принимается и в access_token
+	wsJwtConfig := jwtConfig
+	wsJwtConfig.TokenLookup = "header:Authorization:Bearer ,query:access_token"
+	walletSocketHandler := handler.NewWalletSocketHandler(combinedRepository, broker, handler.WalletSocketOptions{
+		PingInterval:          cfg.WSPingInterval,
+		WriteTimeout:          cfg.WSWriteTimeout,
+		MaxConnectionsPerUser: cfg.WSMaxConnectionsPerUser,
+	})
+
+	e.GET("/api/v2/ws", walletSocketHandler.Connect, echojwt.WithConfig(wsJwtConfig), middleware.UserLogger(), rateLimit)
 
-	apiGroup.GET("/info", combinedRepository.GetInfo)
+	reversalHandler := handler.NewReversalHandler(coinRepo)
 
-	apiGroup.GET("/buy/:item", coinHandler.BuyItem)
-	apiGroup.POST("/sendCoin", combinedRepository.SendCoinHandler)
+	apiGroup.GET("/reversals", reversalHandler.GetReversals)
+	apiGroup.POST("/transactions/:id/reversal", reversalHandler.RequestReversal)
+	apiGroup.POST("/reversals/:id/approve", reversalHandler.ApproveReversal)
+	apiGroup.POST("/reversals/:id/reject", reversalHandler.RejectReversal)
+
+	adminGroup := apiGroup.Group("/admin", middleware.RequireAdmin(userRepo))
+
+	adminGroup.POST("/transactions/:id/reverse", reversalHandler.ForceReversal)
+
+	adminHandler := handler.NewAdminHandler(userRepo, coinRepo)
+
+	adminGroup.GET("/users/:username/limits", adminHandler.GetTransferLimits)
+	adminGroup.PUT("/users/:username/limits", adminHandler.SetTransferLimits)
+	adminGroup.POST("/users/:username/grant", adminHandler.GrantCoins)
+	adminGroup.POST("/users/:username/holds", adminHandler.HoldCoins)
+	adminGroup.POST("/holds/:id/capture", adminHandler.CaptureHold)
+	adminGroup.POST("/holds/:id/release", adminHandler.ReleaseHold)
+
+	webhookHandler := handler.NewWebhookHandler(repos.Webhooks)
+
+	adminGroup.GET("/webhooks", webhookHandler.GetWebhooks)
+	adminGroup.POST("/webhooks", webhookHandler.CreateWebhook)
+	adminGroup.DELETE("/webhooks/:id", webhookHandler.DeleteWebhook)
+	adminGroup.GET("/webhooks/:id/deliveries", webhookHandler.GetDeliveries)
+	adminGroup.POST("/webhooks/:id/replay", webhookHandler.Replay)
+
+	return nil
+}
 
+func CoinOptions(cfg *config.Config) repository.CoinOptions {
+	return repository.CoinOptions{
+		Limits: models.TransferLimits{
+			MaxPerTransfer:     cfg.TransferMaxAmount,
+			MaxDailyTotal:      cfg.TransferDailyLimit,
+			MaxDailyRecipients: cfg.TransferDailyRecipients,
+		},
+		CoinLifetime:  cfg.CoinLifetime,
+		ExpiryWarning: cfg.CoinExpiryWarning,
+		HoldTTL:       cfg.HoldTTL,
+	}
 }
@@ -0,0 +1,142 @@
+// Package cache — кеши в памяти процесса.
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// LRU хранит не больше size значений, вытесняя давно не читанные. Значение
+// старше ttl считается отсутствующим.
+//
+// Load защищает от гонки с Delete: если ключ сбросили, пока значение
+// загружалось, загруженное значение не сохраняется, потому что могло быть
+// прочитано до изменения.
+type LRU[K comparable, V any] struct {
+	mu    sync.Mutex
+	size  int
+	ttl   time.Duration
+	items map[K]*list.Element
+	order *list.List
+	// Номер загрузки по ключу: Delete снимает его, и результат загрузки
+	// отбрасывается
+	loads    map[K]uint64
+	lastLoad uint64
+	now      func() time.Time
+}
+
+type entry[K comparable, V any] struct {
+	key       K
+	value     V
+	expiresAt time.Time
+}
+
+func NewLRU[K comparable, V any](size int, ttl time.Duration) *LRU[K, V] {
+	return &LRU[K, V]{
+		size:  size,
+		ttl:   ttl,
+		items: make(map[K]*list.Element),
+		order: list.New(),
+		loads: make(map[K]uint64),
+		now:   time.Now,
+	}
+}
+
+func (c *LRU[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	e := el.Value.(*entry[K, V])
+	if !c.now().Before(e.expiresAt) {
+		c.remove(el)
+		var zero V
+		return zero, false
+	}
+	c.order.MoveToFront(el)
+	return e.value, true
+}
+
+// Load возвращает значение из кеша или загружает его через load и сохраняет.
+// hit сообщает, что значение взято из кеша. Ошибки не кешируются.
+func (c *LRU[K, V]) Load(key K, load func() (V, error)) (value V, hit bool, err error) {
+	if value, ok := c.Get(key); ok {
+		return value, true, nil
+	}
+
+	c.mu.Lock()
+	c.lastLoad++
+	id := c.lastLoad
+	c.loads[key] = id
+	c.mu.Unlock()
+
+	value, err = load()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.loads[key] == id {
+		delete(c.loads, key)
+		if err == nil {
+			c.set(key, value)
+		}
+	}
+	return value, false, err
+}
+
+func (c *LRU[K, V]) Set(key K, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.set(key, value)
+}
+
+// Delete удаляет значение и отменяет сохранение идущей загрузки ключа.
+func (c *LRU[K, V]) Delete(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.loads, key)
+	if el, ok := c.items[key]; ok {
+		c.remove(el)
+	}
+}
+
+// Purge удаляет все значения и отменяет идущие загрузки.
+func (c *LRU[K, V]) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	clear(c.loads)
+	clear(c.items)
+	c.order.Init()
+}
+
+func (c *LRU[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+func (c *LRU[K, V]) set(key K, value V) {
+	expiresAt := c.now().Add(c.ttl)
+	if el, ok := c.items[key]; ok {
+		e := el.Value.(*entry[K, V])
+		e.value, e.expiresAt = value, expiresAt
+		c.order.MoveToFront(el)
+		return
+	}
+
+	c.items[key] = c.order.PushFront(&entry[K, V]{key: key, value: value, expiresAt: expiresAt})
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+}
+
+func (c *LRU[K, V]) remove(el *list.Element) {
+	c.order.Remove(el)
+	delete(c.items, el.Value.(*entry[K, V]).key)
+}
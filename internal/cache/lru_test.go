@@ -0,0 +1,98 @@
+package cache
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestLRU(t *testing.T) {
+	now := time.Now()
+	newCache := func(size int) *LRU[string, int] {
+		c := NewLRU[string, int](size, time.Minute)
+		c.now = func() time.Time { return now }
+		return c
+	}
+
+	t.Run("evicts least recently used", func(t *testing.T) {
+		c := newCache(2)
+		c.Set("a", 1)
+		c.Set("b", 2)
+		_, _ = c.Get("a")
+		c.Set("c", 3)
+
+		_, ok := c.Get("b")
+		assert.False(t, ok)
+		v, ok := c.Get("a")
+		assert.True(t, ok)
+		assert.Equal(t, 1, v)
+		assert.Equal(t, 2, c.Len())
+	})
+
+	t.Run("expires after ttl", func(t *testing.T) {
+		c := newCache(2)
+		c.Set("a", 1)
+
+		c.now = func() time.Time { return now.Add(59 * time.Second) }
+		_, ok := c.Get("a")
+		assert.True(t, ok)
+
+		c.now = func() time.Time { return now.Add(time.Minute) }
+		_, ok = c.Get("a")
+		assert.False(t, ok)
+		assert.Zero(t, c.Len())
+	})
+
+	t.Run("load caches value", func(t *testing.T) {
+		c := newCache(2)
+		calls := 0
+		load := func() (int, error) {
+			calls++
+			return 7, nil
+		}
+
+		v, hit, err := c.Load("a", load)
+		require.NoError(t, err)
+		assert.False(t, hit)
+		assert.Equal(t, 7, v)
+
+		v, hit, err = c.Load("a", load)
+		require.NoError(t, err)
+		assert.True(t, hit)
+		assert.Equal(t, 7, v)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("load error is not cached", func(t *testing.T) {
+		c := newCache(2)
+		_, _, err := c.Load("a", func() (int, error) { return 0, errors.New("boom") })
+		assert.Error(t, err)
+		assert.Zero(t, c.Len())
+	})
+
+	t.Run("delete during load discards loaded value", func(t *testing.T) {
+		c := newCache(2)
+		v, _, err := c.Load("a", func() (int, error) {
+			c.Delete("a")
+			return 1, nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 1, v)
+
+		_, ok := c.Get("a")
+		assert.False(t, ok)
+	})
+
+	t.Run("purge during load discards loaded value", func(t *testing.T) {
+		c := newCache(2)
+		c.Set("b", 2)
+		_, _, err := c.Load("a", func() (int, error) {
+			c.Purge()
+			return 1, nil
+		})
+		require.NoError(t, err)
+		assert.Zero(t, c.Len())
+	})
+}
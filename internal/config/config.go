@@ -1,20 +1,179 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/ratelimit"
 	"github.com/caarlos0/env/v11"
+	"go.uber.org/zap/zapcore"
+	"net"
+	"time"
+)
+
+// Хранилища данных
+const (
+	StoragePostgres = "postgres"
+	StorageMemory   = "memory"
 )
 
 type Config struct {
+	// Хранилище: postgres или memory. В памяти данные живут до остановки
+	// процесса, параметры базы не нужны
+	Storage string `env:"STORAGE" envDefault:"postgres"`
+
 	DatabasePort     string `env:"DATABASE_PORT" envDefault:"5432"`
-	DatabaseUser     string `env:"DATABASE_USER,required"`
-	DatabasePassword string `env:"DATABASE_PASSWORD,required"`
-	DatabaseName     string `env:"DATABASE_NAME,required"`
-	DatabaseHost     string `env:"DATABASE_HOST,required"`
+	DatabaseUser     string `env:"DATABASE_USER"`
+	DatabasePassword string `env:"DATABASE_PASSWORD"`
+	DatabaseName     string `env:"DATABASE_NAME"`
+	DatabaseHost     string `env:"DATABASE_HOST"`
 	ServerPort       string `env:"SERVER_PORT" envDefault:"8080"`
 	Environment      string `env:"ENVIRONMENT"`
+
+	// Пул соединений, в том числе к репликам: размер, время жизни и простоя
+	// соединения, период проверки простаивающих, таймаут подключения и
+	// statement_timeout (0 — без ограничения)
+	DatabaseMaxConns          int           `env:"DATABASE_MAX_CONNS" envDefault:"20"`
+	DatabaseMinConns          int           `env:"DATABASE_MIN_CONNS" envDefault:"0"`
+	DatabaseMaxConnLifetime   time.Duration `env:"DATABASE_MAX_CONN_LIFETIME" envDefault:"1h"`
+	DatabaseMaxConnIdleTime   time.Duration `env:"DATABASE_MAX_CONN_IDLE_TIME" envDefault:"30m"`
+	DatabaseHealthCheckPeriod time.Duration `env:"DATABASE_HEALTH_CHECK_PERIOD" envDefault:"1m"`
+	DatabaseConnectTimeout    time.Duration `env:"DATABASE_CONNECT_TIMEOUT" envDefault:"5s"`
+	DatabaseStatementTimeout  time.Duration `env:"DATABASE_STATEMENT_TIMEOUT" envDefault:"0"`
+
+	// TLS до primary: sslmode как в libpq и пути к сертификатам. Для реплик
+	// они задаются в DSN
+	DatabaseSSLMode     string `env:"DATABASE_SSLMODE" envDefault:"prefer"`
+	DatabaseSSLRootCert string `env:"DATABASE_SSLROOTCERT"`
+	DatabaseSSLCert     string `env:"DATABASE_SSLCERT"`
+	DatabaseSSLKey      string `env:"DATABASE_SSLKEY"`
+
+	// Сколько при старте ждать, пока база станет доступна
+	DatabaseStartupTimeout time.Duration `env:"DATABASE_STARTUP_TIMEOUT" envDefault:"30s"`
+
+	// Чтения при обрыве соединения повторяются: всего попыток и пауза перед
+	// второй, дальше она растёт вдвое
+	DatabaseReadAttempts   int           `env:"DATABASE_READ_ATTEMPTS" envDefault:"3"`
+	DatabaseReadRetryDelay time.Duration `env:"DATABASE_READ_RETRY_DELAY" envDefault:"50ms"`
+
+	// Уровень логов: debug, info, warn или error. Пустой — debug при
+	// ENVIRONMENT=development, иначе info
+	LogLevel string `env:"LOG_LEVEL" reload:"true"`
+
+	// Ключ подписи JWT и срок жизни выданных токенов
+	JWTSecret string        `env:"JWT_SECRET"`
+	TokenTTL  time.Duration `env:"TOKEN_TTL" envDefault:"24h"`
+
+	// Источники, которым браузер разрешит запросы к API
+	CORSAllowOrigins []string `env:"CORS_ALLOW_ORIGINS" envSeparator:"," envDefault:"http://localhost:8080"`
+
+	// Сети балансировщиков в CIDR. Только от них IP клиента берётся из
+	// X-Forwarded-For, иначе — адрес соединения
+	TrustedProxies []string `env:"TRUSTED_PROXIES" envSeparator:","`
+
+	// Запросы к API дольше порога пишутся в лог
+	SlowRequestThreshold time.Duration `env:"SLOW_REQUEST_THRESHOLD" envDefault:"50ms" reload:"true"`
+
+	// Реплики для чтения, DSN через запятую. Данные пользователя читаются с
+	// реплики, если она отстает не больше DATABASE_REPLICA_MAX_LAG, а сам
+	// пользователь ничего не менял последние READ_YOUR_WRITES_WINDOW
+	DatabaseReplicaDSNs          []string      `env:"DATABASE_REPLICA_DSNS" envSeparator:","`
+	DatabaseReplicaMaxLag        time.Duration `env:"DATABASE_REPLICA_MAX_LAG" envDefault:"1s"`
+	DatabaseReplicaCheckInterval time.Duration `env:"DATABASE_REPLICA_CHECK_INTERVAL" envDefault:"1s"`
+	ReadYourWritesWindow         time.Duration `env:"READ_YOUR_WRITES_WINDOW" envDefault:"5s"`
+
+	// Проверка запросов и ответов по openapi/schema.yaml. Ответы буферизуются
+	// целиком, поэтому их проверка нужна только при разработке и в тестах
+	OpenAPIValidateRequests  bool `env:"OPENAPI_VALIDATE_REQUESTS" envDefault:"true"`
+	OpenAPIValidateResponses bool `env:"OPENAPI_VALIDATE_RESPONSES" envDefault:"false"`
+
+	// Кеш ответов /api/info: сколько пользователей хранить и как долго, 0 —
+	// без кеша. Изменения данных сбрасывают ответ сразу, ttl ограничивает
+	// устаревание того, что меняется без событий на других экземплярах
+	InfoCacheSize int           `env:"INFO_CACHE_SIZE" envDefault:"10000"`
+	InfoCacheTTL  time.Duration `env:"INFO_CACHE_TTL" envDefault:"30s"`
+
+	// Сколько хранится ответ на запрос с заголовком Idempotency-Key. С Postgres
+	// ответы общие для всех экземпляров и истёкшие удаляются раз в
+	// IDEMPOTENCY_CLEANUP_INTERVAL, в памяти держится не больше
+	// IDEMPOTENCY_MAX_KEYS ключей, сверх лимита вытесняются давно не использованные
+	IdempotencyTTL             time.Duration `env:"IDEMPOTENCY_TTL" envDefault:"24h"`
+	IdempotencyMaxKeys         int           `env:"IDEMPOTENCY_MAX_KEYS" envDefault:"100000"`
+	IdempotencyCleanupInterval time.Duration `env:"IDEMPOTENCY_CLEANUP_INTERVAL" envDefault:"10m"`
+
+	// Ограничение частоты запросов для пользователя из токена, без токена — для
+	// IP. Маршруты из RATE_LIMIT_ROUTES считаются каждый отдельно, остальные —
+	// вместе по RATE_LIMIT_DEFAULT. RATE_LIMIT_GLOBAL ограничивает все запросы
+	// к API вместе. Пустой лимит не ограничивает. При RATE_LIMIT_SHARED
+	// корзины хранятся в PostgreSQL и общие для всех экземпляров, полные
+	// удаляются раз в RATE_LIMIT_CLEANUP_INTERVAL
+	RateLimitDefault         ratelimit.Limit  `env:"RATE_LIMIT_DEFAULT" reload:"true"`
+	RateLimitRoutes          ratelimit.Routes `env:"RATE_LIMIT_ROUTES" envDefault:"POST /api/auth=30/1m,POST /api/v2/auth=30/1m,POST /api/sendCoin=5/s,POST /api/v2/transfers=5/s,GET /api/buy/:item=5/s,POST /api/v2/purchases=5/s" reload:"true"`
+	RateLimitGlobal          ratelimit.Limit  `env:"RATE_LIMIT_GLOBAL" reload:"true"`
+	RateLimitShared          bool             `env:"RATE_LIMIT_SHARED" envDefault:"false"`
+	RateLimitCleanupInterval time.Duration    `env:"RATE_LIMIT_CLEANUP_INTERVAL" envDefault:"10m"`
+
+	// Дата отключения /api v1 для заголовка Sunset, пустая — не объявлена
+	APIV1Sunset time.Time `env:"API_V1_SUNSET"`
+
+	// Поток событий /api/v2/events: как часто слать keep-alive, сколько хранить
+	// события для дочитывания по Last-Event-ID и как часто удалять старые
+	EventsHeartbeat       time.Duration `env:"EVENTS_HEARTBEAT" envDefault:"15s"`
+	EventsRetention       time.Duration `env:"EVENTS_RETENTION" envDefault:"24h"`
+	EventsCleanupInterval time.Duration `env:"EVENTS_CLEANUP_INTERVAL" envDefault:"1h"`
+
+	// WebSocket /api/v2/ws: интервал ping, сколько ждать записи клиенту и
+	// сколько соединений пользователь может открыть на одном экземпляре
+	WSPingInterval          time.Duration `env:"WS_PING_INTERVAL" envDefault:"30s"`
+	WSWriteTimeout          time.Duration `env:"WS_WRITE_TIMEOUT" envDefault:"10s"`
+	WSMaxConnectionsPerUser int           `env:"WS_MAX_CONNECTIONS_PER_USER" envDefault:"5"`
+
+	// Доставка webhook: как часто проверять очередь, сколько запросов слать
+	// параллельно, таймаут запроса, число попыток до dead letter и пауза
+	// между ними, растущая от базовой вдвое до максимальной
+	WebhookDispatchInterval time.Duration `env:"WEBHOOK_DISPATCH_INTERVAL" envDefault:"1s"`
+	WebhookWorkers          int           `env:"WEBHOOK_WORKERS" envDefault:"4"`
+	WebhookTimeout          time.Duration `env:"WEBHOOK_TIMEOUT" envDefault:"10s"`
+	WebhookMaxAttempts      int           `env:"WEBHOOK_MAX_ATTEMPTS" envDefault:"12"`
+	WebhookRetryBaseDelay   time.Duration `env:"WEBHOOK_RETRY_BASE_DELAY" envDefault:"10s"`
+	WebhookRetryMaxDelay    time.Duration `env:"WEBHOOK_RETRY_MAX_DELAY" envDefault:"1h"`
+	// Сколько хранятся доставленные события outbox
+	WebhookRetention time.Duration `env:"WEBHOOK_RETENTION" envDefault:"168h"`
+
+	// Применять миграции при старте сервера
+	AutoMigrate bool `env:"AUTO_MIGRATE" envDefault:"false"`
+
+	// Сколько /readyz отвечает ошибкой перед остановкой сервера, чтобы
+	// балансировщик успел снять трафик
+	ShutdownDrainDelay time.Duration `env:"SHUTDOWN_DRAIN_DELAY" envDefault:"5s"`
+
+	// Лимиты переводов по умолчанию, 0 — без ограничения
+	TransferMaxAmount       int64 `env:"TRANSFER_MAX_AMOUNT" envDefault:"0"`
+	TransferDailyLimit      int64 `env:"TRANSFER_DAILY_LIMIT" envDefault:"0"`
+	TransferDailyRecipients int64 `env:"TRANSFER_DAILY_RECIPIENTS" envDefault:"0"`
+
+	// Срок жизни выданных монет и как часто списывать просроченные
+	CoinLifetime       time.Duration `env:"COIN_LIFETIME" envDefault:"8760h"`
+	CoinExpiryWarning  time.Duration `env:"COIN_EXPIRY_WARNING" envDefault:"720h"`
+	CoinExpiryInterval time.Duration `env:"COIN_EXPIRY_INTERVAL" envDefault:"1m"`
+
+	// Срок холда по умолчанию и как часто помечать истёкшие холды
+	HoldTTL             time.Duration `env:"HOLD_TTL" envDefault:"15m"`
+	HoldReleaseInterval time.Duration `env:"HOLD_RELEASE_INTERVAL" envDefault:"30s"`
+
+	// Запросы дольше порога пишутся в лог, для доли из них снимается EXPLAIN.
+	// Нулевой порог отключает лог медленных запросов
+	SlowQueryThreshold   time.Duration `env:"SLOW_QUERY_THRESHOLD" envDefault:"50ms"`
+	SlowQueryExplainRate float64       `env:"SLOW_QUERY_EXPLAIN_RATE" envDefault:"0"`
+
+	// Трейсинг: none, otlp (OTLP/HTTP), stdout или file
+	TracingExporter    string  `env:"TRACING_EXPORTER" envDefault:"none"`
+	TracingEndpoint    string  `env:"TRACING_OTLP_ENDPOINT" envDefault:"localhost:4318"`
+	TracingInsecure    bool    `env:"TRACING_OTLP_INSECURE" envDefault:"true"`
+	TracingFile        string  `env:"TRACING_FILE" envDefault:"traces.json"`
+	TracingSampleRatio float64 `env:"TRACING_SAMPLE_RATIO" envDefault:"1"`
 }
 
+// LoadConfig читает конфигурацию только из переменных окружения.
 func LoadConfig() (*Config, error) {
 	cfg := &Config{}
 	if err := env.Parse(cfg); err != nil {
@@ -22,3 +181,176 @@ func LoadConfig() (*Config, error) {
 	}
 	return cfg, nil
 }
+
+// Level возвращает уровень логов с учётом значения по умолчанию.
+func (c *Config) Level() zapcore.Level {
+	if c.LogLevel == "" {
+		if c.Environment == "development" {
+			return zapcore.DebugLevel
+		}
+		return zapcore.InfoLevel
+	}
+	level, err := zapcore.ParseLevel(c.LogLevel)
+	if err != nil {
+		return zapcore.InfoLevel
+	}
+	return level
+}
+
+// Validate проверяет согласованность настроек и возвращает все найденные
+// ошибки сразу. Ключ JWT обязателен всегда, параметры базы — только для Postgres.
+func (c *Config) Validate() error {
+	var errs []error
+
+	switch c.Storage {
+	case StorageMemory:
+		if c.RateLimitShared {
+			errs = append(errs, fmt.Errorf("RATE_LIMIT_SHARED requires postgres storage"))
+		}
+	case StoragePostgres:
+		errs = append(errs, c.validateDatabase()...)
+	default:
+		errs = append(errs, fmt.Errorf("unknown storage %q", c.Storage))
+	}
+
+	// С пустым ключом любой может подписать токен за любого пользователя
+	if c.JWTSecret == "" {
+		errs = append(errs, fmt.Errorf("JWT_SECRET is required"))
+	}
+	if c.LogLevel != "" {
+		if _, err := zapcore.ParseLevel(c.LogLevel); err != nil {
+			errs = append(errs, fmt.Errorf("LOG_LEVEL: %w", err))
+		}
+	}
+	for _, cidr := range c.TrustedProxies {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			errs = append(errs, fmt.Errorf("TRUSTED_PROXIES: %w", err))
+		}
+	}
+	if len(c.CORSAllowOrigins) == 0 {
+		errs = append(errs, fmt.Errorf("CORS_ALLOW_ORIGINS is required"))
+	}
+
+	// Нулевые интервалы остановили бы фоновые задачи с ошибкой тикера
+	positive := []struct {
+		name  string
+		value time.Duration
+	}{
+		{"TOKEN_TTL", c.TokenTTL},
+		{"DATABASE_REPLICA_CHECK_INTERVAL", c.DatabaseReplicaCheckInterval},
+		{"EVENTS_HEARTBEAT", c.EventsHeartbeat},
+		{"EVENTS_CLEANUP_INTERVAL", c.EventsCleanupInterval},
+		{"WS_PING_INTERVAL", c.WSPingInterval},
+		{"WEBHOOK_DISPATCH_INTERVAL", c.WebhookDispatchInterval},
+		{"WEBHOOK_TIMEOUT", c.WebhookTimeout},
+		{"COIN_EXPIRY_INTERVAL", c.CoinExpiryInterval},
+		{"HOLD_RELEASE_INTERVAL", c.HoldReleaseInterval},
+		{"IDEMPOTENCY_CLEANUP_INTERVAL", c.IdempotencyCleanupInterval},
+		{"RATE_LIMIT_CLEANUP_INTERVAL", c.RateLimitCleanupInterval},
+	}
+	for _, v := range positive {
+		if v.value <= 0 {
+			errs = append(errs, fmt.Errorf("%s must be positive, got %s", v.name, v.value))
+		}
+	}
+
+	nonNegative := []struct {
+		name  string
+		value int64
+	}{
+		{"INFO_CACHE_SIZE", int64(c.InfoCacheSize)},
+		{"IDEMPOTENCY_MAX_KEYS", int64(c.IdempotencyMaxKeys)},
+		{"WS_MAX_CONNECTIONS_PER_USER", int64(c.WSMaxConnectionsPerUser)},
+		{"TRANSFER_MAX_AMOUNT", c.TransferMaxAmount},
+		{"TRANSFER_DAILY_LIMIT", c.TransferDailyLimit},
+		{"TRANSFER_DAILY_RECIPIENTS", c.TransferDailyRecipients},
+	}
+	for _, v := range nonNegative {
+		if v.value < 0 {
+			errs = append(errs, fmt.Errorf("%s must not be negative, got %d", v.name, v.value))
+		}
+	}
+	if c.WebhookWorkers < 1 {
+		errs = append(errs, fmt.Errorf("WEBHOOK_WORKERS must be at least 1, got %d", c.WebhookWorkers))
+	}
+	if c.WebhookMaxAttempts < 1 {
+		errs = append(errs, fmt.Errorf("WEBHOOK_MAX_ATTEMPTS must be at least 1, got %d", c.WebhookMaxAttempts))
+	}
+
+	ratios := []struct {
+		name  string
+		value float64
+	}{
+		{"SLOW_QUERY_EXPLAIN_RATE", c.SlowQueryExplainRate},
+		{"TRACING_SAMPLE_RATIO", c.TracingSampleRatio},
+	}
+	for _, v := range ratios {
+		if v.value < 0 || v.value > 1 {
+			errs = append(errs, fmt.Errorf("%s must be between 0 and 1, got %v", v.name, v.value))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Режимы sslmode, которые понимает pgx
+var sslModes = map[string]bool{
+	"disable": true, "allow": true, "prefer": true, "require": true, "verify-ca": true, "verify-full": true,
+}
+
+// ValidateDatabase проверяет только настройки подключения к базе: подкоманде
+// migrate остальные не нужны.
+func (c *Config) ValidateDatabase() error {
+	return errors.Join(c.validateDatabase()...)
+}
+
+func (c *Config) validateDatabase() []error {
+	var errs []error
+	required := []struct{ name, value string }{
+		{"DATABASE_USER", c.DatabaseUser},
+		{"DATABASE_PASSWORD", c.DatabasePassword},
+		{"DATABASE_NAME", c.DatabaseName},
+		{"DATABASE_HOST", c.DatabaseHost},
+	}
+	for _, v := range required {
+		if v.value == "" {
+			errs = append(errs, fmt.Errorf("%s is required", v.name))
+		}
+	}
+	if c.DatabaseMaxConns < 1 {
+		errs = append(errs, fmt.Errorf("DATABASE_MAX_CONNS must be at least 1, got %d", c.DatabaseMaxConns))
+	}
+	if c.DatabaseMinConns < 0 || c.DatabaseMinConns > c.DatabaseMaxConns {
+		errs = append(errs, fmt.Errorf("DATABASE_MIN_CONNS must be between 0 and DATABASE_MAX_CONNS, got %d", c.DatabaseMinConns))
+	}
+	if !sslModes[c.DatabaseSSLMode] {
+		errs = append(errs, fmt.Errorf("unknown DATABASE_SSLMODE %q", c.DatabaseSSLMode))
+	}
+	if (c.DatabaseSSLCert == "") != (c.DatabaseSSLKey == "") {
+		errs = append(errs, fmt.Errorf("DATABASE_SSLCERT and DATABASE_SSLKEY must be set together"))
+	}
+	if c.DatabaseReadAttempts < 1 {
+		errs = append(errs, fmt.Errorf("DATABASE_READ_ATTEMPTS must be at least 1, got %d", c.DatabaseReadAttempts))
+	}
+
+	nonNegative := []struct {
+		name  string
+		value time.Duration
+	}{
+		{"DATABASE_MAX_CONN_LIFETIME", c.DatabaseMaxConnLifetime},
+		{"DATABASE_MAX_CONN_IDLE_TIME", c.DatabaseMaxConnIdleTime},
+		{"DATABASE_CONNECT_TIMEOUT", c.DatabaseConnectTimeout},
+		{"DATABASE_STATEMENT_TIMEOUT", c.DatabaseStatementTimeout},
+		{"DATABASE_STARTUP_TIMEOUT", c.DatabaseStartupTimeout},
+		{"DATABASE_READ_RETRY_DELAY", c.DatabaseReadRetryDelay},
+	}
+	for _, v := range nonNegative {
+		if v.value < 0 {
+			errs = append(errs, fmt.Errorf("%s must not be negative, got %s", v.name, v.value))
+		}
+	}
+	if c.DatabaseHealthCheckPeriod <= 0 {
+		errs = append(errs, fmt.Errorf("DATABASE_HEALTH_CHECK_PERIOD must be positive, got %s", c.DatabaseHealthCheckPeriod))
+	}
+	return errs
+}
@@ -1,9 +1,14 @@
 package config
 
 import (
+	"github.com/Ki4EH/stunning-octo-waddle/internal/ratelimit"
+	"github.com/caarlos0/env/v11"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestLoadConfig(t *testing.T) {
@@ -41,3 +46,176 @@ func TestLoadConfig(t *testing.T) {
 		assert.Equal(t, "staging", cfg.Environment, "should set optional field")
 	})
 }
+
+func TestValidate(t *testing.T) {
+	database := defaults(t)
+	database.DatabaseUser, database.DatabasePassword, database.DatabaseName, database.DatabaseHost =
+		"user", "pass", "db", "dbhost"
+	database.JWTSecret = "secret"
+
+	tests := []struct {
+		name       string
+		cfg        Config
+		expectErrs []string
+	}{
+		{name: "postgres with database", cfg: withStorage(database, StoragePostgres)},
+		{name: "postgres without database", cfg: withStorage(defaults(t), StoragePostgres), expectErrs: []string{"DATABASE_USER", "JWT_SECRET"}},
+		{name: "memory without database", cfg: func() Config {
+			cfg := withStorage(defaults(t), StorageMemory)
+			cfg.JWTSecret = "secret"
+			return cfg
+		}()},
+		{name: "memory without jwt secret", cfg: withStorage(defaults(t), StorageMemory), expectErrs: []string{"JWT_SECRET"}},
+		{name: "shared rate limits in memory", cfg: func() Config {
+			cfg := withStorage(defaults(t), StorageMemory)
+			cfg.JWTSecret = "secret"
+			cfg.RateLimitShared = true
+			return cfg
+		}(), expectErrs: []string{"RATE_LIMIT_SHARED"}},
+		{name: "unknown storage", cfg: withStorage(database, "sqlite"), expectErrs: []string{`unknown storage "sqlite"`}},
+		{
+			name: "invalid pool and tls settings",
+			cfg: func() Config {
+				cfg := withStorage(database, StoragePostgres)
+				cfg.DatabaseMinConns = cfg.DatabaseMaxConns + 1
+				cfg.DatabaseSSLMode = "strict"
+				cfg.DatabaseSSLCert = "client.crt"
+				cfg.DatabaseReadAttempts = 0
+				return cfg
+			}(),
+			expectErrs: []string{"DATABASE_MIN_CONNS", `DATABASE_SSLMODE "strict"`, "DATABASE_SSLKEY", "DATABASE_READ_ATTEMPTS"},
+		},
+		{
+			name: "all errors are reported",
+			cfg: func() Config {
+				cfg := withStorage(database, StoragePostgres)
+				cfg.LogLevel = "loud"
+				cfg.CoinExpiryInterval = 0
+				cfg.TracingSampleRatio = 2
+				return cfg
+			}(),
+			expectErrs: []string{"LOG_LEVEL", "COIN_EXPIRY_INTERVAL must be positive", "TRACING_SAMPLE_RATIO"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate()
+			if len(tt.expectErrs) == 0 {
+				assert.NoError(t, err)
+			}
+			for _, expected := range tt.expectErrs {
+				assert.ErrorContains(t, err, expected)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	writeFile := func(t *testing.T, data string) string {
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		require.NoError(t, os.WriteFile(path, []byte(data), 0o600))
+		return path
+	}
+
+	t.Run("layers override each other", func(t *testing.T) {
+		path := writeFile(t, `
+storage: memory
+jwt_secret: secret
+server_port: 9000
+log_level: warn
+cors_allow_origins: [https://a.example, https://b.example]
+info_cache:
+  ttl: 1m
+api_v1_sunset: 2026-06-01T00:00:00Z
+rate_limit:
+  default: 100/1m
+  routes:
+    - POST /api/sendCoin=2/s
+    - GET /api/buy/:item=1/s
+`)
+		t.Setenv("SERVER_PORT", "9001")
+		t.Setenv("LOG_LEVEL", "error")
+
+		cfg, err := Load(Sources{File: path, Overrides: map[string]string{"LOG_LEVEL": "debug"}})
+		require.NoError(t, err)
+
+		assert.Equal(t, StorageMemory, cfg.Storage, "file overrides default")
+		assert.Equal(t, "9001", cfg.ServerPort, "env overrides file")
+		assert.Equal(t, "debug", cfg.LogLevel, "flag overrides env")
+		assert.Equal(t, []string{"https://a.example", "https://b.example"}, cfg.CORSAllowOrigins)
+		assert.Equal(t, time.Minute, cfg.InfoCacheTTL, "nested keys are joined")
+		assert.Equal(t, time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC), cfg.APIV1Sunset.UTC())
+		assert.Equal(t, 24*time.Hour, cfg.TokenTTL, "default is kept")
+		assert.Equal(t, ratelimit.Limit{Requests: 100, Period: time.Minute}, cfg.RateLimitDefault)
+		assert.Equal(t, ratelimit.Routes{
+			"POST /api/sendCoin": {Requests: 2, Period: time.Second},
+			"GET /api/buy/:item": {Requests: 1, Period: time.Second},
+		}, cfg.RateLimitRoutes, "list replaces default routes")
+	})
+
+	t.Run("errors are aggregated", func(t *testing.T) {
+		path := writeFile(t, `
+storage: memory
+server_prot: 9000
+token_ttl: soon
+rate_limit_routes: [POST /api/sendCoin]
+`)
+		_, err := Load(Sources{File: path, Overrides: map[string]string{"NOPE": "1"}})
+		assert.ErrorContains(t, err, `unknown setting "SERVER_PROT"`)
+		assert.ErrorContains(t, err, `unknown setting "NOPE"`)
+		assert.ErrorContains(t, err, "TOKEN_TTL")
+		assert.ErrorContains(t, err, "RATE_LIMIT_ROUTES")
+	})
+
+	t.Run("empty env does not override file", func(t *testing.T) {
+		path := writeFile(t, `
+storage: memory
+jwt_secret: secret
+log_level: warn
+api_v1_sunset: 2026-06-01T00:00:00Z
+`)
+		t.Setenv("LOG_LEVEL", "")
+		t.Setenv("API_V1_SUNSET", "")
+
+		cfg, err := Load(Sources{File: path})
+		require.NoError(t, err)
+		assert.Equal(t, "warn", cfg.LogLevel)
+		assert.Equal(t, time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC), cfg.APIV1Sunset.UTC())
+	})
+
+	t.Run("migrate checks only database settings", func(t *testing.T) {
+		path := writeFile(t, `
+storage: postgres
+database: {user: user, password: pass, name: db, host: dbhost}
+cors_allow_origins: []
+`)
+		_, err := Load(Sources{File: path})
+		assert.ErrorContains(t, err, "JWT_SECRET")
+
+		cfg, err := Load(Sources{File: path, Migrate: true})
+		require.NoError(t, err)
+		assert.Equal(t, "dbhost", cfg.DatabaseHost)
+
+		_, err = Load(Sources{File: path, Migrate: true, Overrides: map[string]string{"STORAGE": "memory"}})
+		assert.ErrorContains(t, err, "migrations require postgres storage")
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		_, err := Load(Sources{File: filepath.Join(t.TempDir(), "missing.yaml")})
+		assert.ErrorContains(t, err, "failed to read config file")
+	})
+}
+
+// defaults возвращает конфигурацию со значениями по умолчанию.
+func defaults(t *testing.T) Config {
+	t.Helper()
+	var cfg Config
+	require.NoError(t, env.ParseWithOptions(&cfg, env.Options{Environment: map[string]string{}}))
+	return cfg
+}
+
+func withStorage(cfg Config, storage string) Config {
+	cfg.Storage = storage
+	return cfg
+}
@@ -0,0 +1,182 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"github.com/caarlos0/env/v11"
+	"gopkg.in/yaml.v3"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Sources — откуда читается конфигурация. Слои применяются по порядку:
+// значения по умолчанию, файл, переменные окружения, Overrides.
+type Sources struct {
+	// Путь к YAML-файлу, пустой — без файла
+	File string
+	// Значения из флагов по именам переменных окружения
+	Overrides map[string]string
+	// Конфигурация для подкоманды migrate: проверяются только хранилище и
+	// настройки базы
+	Migrate bool
+}
+
+// Load собирает конфигурацию из всех слоёв и проверяет её. Ошибки файла,
+// разбора значений и Validate возвращаются вместе. Пустая переменная
+// окружения считается незаданной и не затирает значение из файла.
+//
+// Ключи файла — имена переменных окружения в любом регистре. Вложенные
+// разделы склеиваются через "_", поэтому database: {port: 5433} то же, что
+// DATABASE_PORT=5433. Списки записываются как YAML-последовательности.
+func Load(src Sources) (*Config, error) {
+	known := make(map[string]bool)
+	for _, field := range fields() {
+		known[field.key] = true
+	}
+
+	values := make(map[string]string)
+	var errs []error
+	if src.File != "" {
+		fileValues, err := readFile(src.File)
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range fileValues {
+			if !known[key] {
+				errs = append(errs, fmt.Errorf("%s: unknown setting %q", src.File, key))
+				continue
+			}
+			values[key] = value
+		}
+	}
+	for _, kv := range os.Environ() {
+		if key, value, ok := strings.Cut(kv, "="); ok && value != "" {
+			values[key] = value
+		}
+	}
+	for key, value := range src.Overrides {
+		if !known[key] {
+			errs = append(errs, fmt.Errorf("unknown setting %q", key))
+			continue
+		}
+		values[key] = value
+	}
+
+	cfg := &Config{}
+	if err := env.ParseWithOptions(cfg, env.Options{Environment: values}); err != nil {
+		errs = append(errs, parseErrors(err)...)
+	} else if err = validate(cfg, src.Migrate); err != nil {
+		errs = append(errs, err)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func validate(cfg *Config, migrate bool) error {
+	if !migrate {
+		return cfg.Validate()
+	}
+	if cfg.Storage != StoragePostgres {
+		return fmt.Errorf("migrations require postgres storage, got %q", cfg.Storage)
+	}
+	return cfg.ValidateDatabase()
+}
+
+// parseErrors называет ошибки разбора по именам настроек, а не полей Config.
+func parseErrors(err error) []error {
+	var aggregate env.AggregateError
+	if !errors.As(err, &aggregate) {
+		return []error{err}
+	}
+	keys := make(map[string]string)
+	for _, f := range fields() {
+		keys[f.name] = f.key
+	}
+
+	result := make([]error, 0, len(aggregate.Errors))
+	for _, e := range aggregate.Errors {
+		var parseErr env.ParseError
+		if errors.As(e, &parseErr) {
+			e = fmt.Errorf("%s: %w", keys[parseErr.Name], parseErr.Err)
+		}
+		result = append(result, e)
+	}
+	return result
+}
+
+// field — поле Config и имя его переменной окружения.
+type field struct {
+	index  int
+	name   string
+	key    string
+	reload bool
+}
+
+func fields() []field {
+	t := reflect.TypeOf(Config{})
+	result := make([]field, 0, t.NumField())
+	for i := range t.NumField() {
+		key, _, _ := strings.Cut(t.Field(i).Tag.Get("env"), ",")
+		if key == "" {
+			continue
+		}
+		result = append(result, field{
+			index:  i,
+			name:   t.Field(i).Name,
+			key:    key,
+			reload: t.Field(i).Tag.Get("reload") == "true",
+		})
+	}
+	return result
+}
+
+func readFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	var doc map[string]any
+	if err = yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	values := make(map[string]string)
+	flatten(values, "", doc)
+	return values, nil
+}
+
+func flatten(values map[string]string, prefix string, doc map[string]any) {
+	for key, value := range doc {
+		key = strings.ToUpper(strings.ReplaceAll(key, "-", "_"))
+		if prefix != "" {
+			key = prefix + "_" + key
+		}
+		if nested, ok := value.(map[string]any); ok {
+			flatten(values, key, nested)
+			continue
+		}
+		values[key] = scalar(value)
+	}
+}
+
+func scalar(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case time.Time:
+		// Время без кавычек YAML разбирает сам, env ждёт RFC 3339
+		return v.Format(time.RFC3339Nano)
+	case []any:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = scalar(item)
+		}
+		return strings.Join(items, ",")
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,76 @@
+package config
+
+import (
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+// Store хранит действующую конфигурацию. Reload перечитывает источники и
+// применяет только настройки с тегом reload:"true": остальные, например
+// параметры базы, уже использованы при старте и требуют перезапуска.
+type Store struct {
+	current atomic.Pointer[Config]
+	load    func() (*Config, error)
+
+	mu   sync.Mutex
+	subs []func(*Config)
+}
+
+// NewStore создаёт хранилище с конфигурацией cfg. load вызывается при
+// каждом Reload.
+func NewStore(cfg *Config, load func() (*Config, error)) *Store {
+	s := &Store{load: load}
+	s.current.Store(cfg)
+	return s
+}
+
+// Current возвращает действующую конфигурацию. Её нельзя изменять: при
+// перезагрузке создаётся новая.
+func (s *Store) Current() *Config {
+	return s.current.Load()
+}
+
+// OnReload добавляет обработчик, который получает новую конфигурацию после
+// каждой успешной перезагрузки.
+func (s *Store) OnReload(fn func(*Config)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.subs = append(s.subs, fn)
+}
+
+// Reload читает конфигурацию заново. applied — имена применённых настроек,
+// restart — изменённых, но требующих перезапуска. При ошибке конфигурация
+// не меняется.
+func (s *Store) Reload() (applied, restart []string, err error) {
+	next, err := s.load()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cfg := *s.current.Load()
+	current, loaded := reflect.ValueOf(&cfg).Elem(), reflect.ValueOf(next).Elem()
+	for _, f := range fields() {
+		if reflect.DeepEqual(current.Field(f.index).Interface(), loaded.Field(f.index).Interface()) {
+			continue
+		}
+		if !f.reload {
+			restart = append(restart, f.key)
+			continue
+		}
+		current.Field(f.index).Set(loaded.Field(f.index))
+		applied = append(applied, f.key)
+	}
+	if len(applied) == 0 {
+		return nil, restart, nil
+	}
+
+	s.current.Store(&cfg)
+	for _, fn := range s.subs {
+		fn(&cfg)
+	}
+	return applied, restart, nil
+}
@@ -0,0 +1,55 @@
+package config
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestStoreReload(t *testing.T) {
+	initial := &Config{LogLevel: "info", SlowRequestThreshold: time.Second, ServerPort: "8080"}
+
+	t.Run("applies only reloadable settings", func(t *testing.T) {
+		store := NewStore(initial, func() (*Config, error) {
+			return &Config{LogLevel: "debug", SlowRequestThreshold: time.Second, ServerPort: "9090"}, nil
+		})
+		var notified *Config
+		store.OnReload(func(cfg *Config) { notified = cfg })
+
+		applied, restart, err := store.Reload()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"LOG_LEVEL"}, applied)
+		assert.Equal(t, []string{"SERVER_PORT"}, restart)
+
+		current := store.Current()
+		assert.Equal(t, "debug", current.LogLevel)
+		assert.Equal(t, "8080", current.ServerPort)
+		assert.Same(t, current, notified)
+		assert.Equal(t, "info", initial.LogLevel, "previous config is not mutated")
+	})
+
+	t.Run("failed load keeps config", func(t *testing.T) {
+		store := NewStore(initial, func() (*Config, error) { return nil, errors.New("bad file") })
+		store.OnReload(func(*Config) { t.Fatal("must not be notified") })
+
+		_, _, err := store.Reload()
+		assert.Error(t, err)
+		assert.Same(t, initial, store.Current())
+	})
+
+	t.Run("nothing changed", func(t *testing.T) {
+		store := NewStore(initial, func() (*Config, error) {
+			cfg := *initial
+			return &cfg, nil
+		})
+		store.OnReload(func(*Config) { t.Fatal("must not be notified") })
+
+		applied, restart, err := store.Reload()
+		require.NoError(t, err)
+		assert.Empty(t, applied)
+		assert.Empty(t, restart)
+		assert.Same(t, initial, store.Current())
+	})
+}
@@ -0,0 +1,417 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/models"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/repository"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/logger"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"slices"
+	"time"
+)
+
+type coinRepository struct {
+	s    *Store
+	opts repository.CoinOptions
+}
+
+// NewCoinRepository создаёт репозиторий операций с монетами поверх s.
+func NewCoinRepository(s *Store, opts repository.CoinOptions) repository.CoinRepository {
+	return &coinRepository{s: s, opts: opts}
+}
+
+func (r *coinRepository) BuyItemFromShop(ctx context.Context, userID uuid.UUID, itemName string) error {
+	return r.s.update(func(tx *txn) error {
+		if _, err := r.expireLots(ctx, tx, userID); err != nil {
+			return err
+		}
+
+		user := tx.account(userID)
+		if user == nil {
+			return repository.ErrUserNotFound
+		}
+		price, ok := tx.s.shop[itemName]
+		if !ok {
+			return repository.ErrItemNotFound
+		}
+		if user.Coin-user.heldCoins(tx.now) < price {
+			return repository.ErrInsufficientBalance
+		}
+
+		set(tx, &user.Coin, user.Coin-price)
+		r.consumeLots(tx, user, price)
+		addItem(tx, user, itemName)
+
+		err := tx.recordEvent(userID, models.EventPurchaseCompleted, models.PurchaseCompletedEvent{
+			Item:  itemName,
+			Price: price,
+		})
+		if err != nil {
+			return err
+		}
+
+		return tx.writeOutbox(models.OutboxPurchaseCompleted, models.PurchaseOutboxEvent{
+			User:  user.Username,
+			Item:  itemName,
+			Price: price,
+		})
+	})
+}
+
+func addItem(tx *txn, user *account, itemType string) {
+	for i := range user.items {
+		if user.items[i].Type == itemType {
+			set(tx, &user.items[i].Quantity, user.items[i].Quantity+1)
+			return
+		}
+	}
+	set(tx, &user.items, append(user.items, models.UserItem{UserID: user.ID, Type: itemType, Quantity: 1}))
+}
+
+func (r *coinRepository) SendCoins(ctx context.Context, fromUserID, toUserID uuid.UUID, amount int64) error {
+	if amount <= 0 {
+		return repository.ErrInvalidAmount
+	}
+	if fromUserID == toUserID {
+		return repository.ErrSelfTransfer
+	}
+	return r.s.update(func(tx *txn) error {
+		if err := r.checkTransferLimits(tx, fromUserID, toUserID, amount); err != nil {
+			return err
+		}
+		_, err := r.transfer(ctx, tx, fromUserID, toUserID, amount, nil)
+		return err
+	})
+}
+
+// transfer переводит монеты в рамках операции tx. Проверки идут в том же
+// порядке, что и в Postgres, чтобы ошибки совпадали.
+func (r *coinRepository) transfer(ctx context.Context, tx *txn, fromUserID, toUserID uuid.UUID, amount int64, reversalOf *uuid.UUID) (uuid.UUID, error) {
+	if _, err := r.expireLots(ctx, tx, fromUserID); err != nil {
+		return uuid.Nil, err
+	}
+
+	from := tx.account(fromUserID)
+	if from == nil {
+		return uuid.Nil, repository.ErrSenderNotFound
+	}
+	if from.Coin-from.heldCoins(tx.now) < amount {
+		return uuid.Nil, repository.ErrInsufficientBalance
+	}
+	to := tx.account(toUserID)
+	if to == nil {
+		return uuid.Nil, repository.ErrReceiverNotFound
+	}
+
+	set(tx, &from.Coin, from.Coin-amount)
+	set(tx, &to.Coin, to.Coin+amount)
+
+	// Получатель забирает монеты вместе с их сроком действия
+	r.grantLots(tx, to, r.consumeLots(tx, from, amount))
+
+	t := &transaction{
+		id:         uuid.New(),
+		fromUser:   fromUserID,
+		toUser:     toUserID,
+		amount:     amount,
+		reversalOf: reversalOf,
+		createdAt:  tx.now,
+	}
+	set(tx, &tx.s.transactions, append(tx.s.transactions, t))
+	put(tx, tx.s.txByID, t.id, t)
+
+	err := tx.recordEvent(toUserID, models.EventCoinsReceived, models.CoinsReceivedEvent{
+		TransactionID: t.id,
+		FromUser:      from.Username,
+		Amount:        amount,
+		ReversalOf:    reversalOf,
+	})
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	err = tx.recordEvent(fromUserID, models.EventCoinsSent, models.CoinsSentEvent{
+		TransactionID: t.id,
+		ToUser:        to.Username,
+		Amount:        amount,
+		ReversalOf:    reversalOf,
+	})
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	err = tx.writeOutbox(models.OutboxTransferCompleted, models.TransferOutboxEvent{
+		TransactionID: t.id,
+		FromUser:      from.Username,
+		ToUser:        to.Username,
+		Amount:        amount,
+		ReversalOf:    reversalOf,
+	})
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	return t.id, nil
+}
+
+func (r *coinRepository) GetTransactions(ctx context.Context, userID uuid.UUID, transactions *[]models.Transaction) error {
+	r.s.view(func(time.Time) {
+		for _, t := range r.s.transactions {
+			if t.fromUser != userID && t.toUser != userID {
+				continue
+			}
+			*transactions = append(*transactions, models.Transaction{
+				ID:         t.id,
+				FromUser:   r.s.accounts[t.fromUser].Username,
+				ToUser:     r.s.accounts[t.toUser].Username,
+				Amount:     t.amount,
+				Reversed:   t.reversedAt != nil,
+				ReversalOf: t.reversalOf,
+			})
+		}
+	})
+	return nil
+}
+
+// GetHistory возвращает до limit переводов пользователя от новых к старым,
+// начиная после курсора after.
+func (r *coinRepository) GetHistory(ctx context.Context, userID uuid.UUID, limit int, after *models.HistoryCursor) ([]models.HistoryEntry, error) {
+	var matched []*transaction
+	entries := make([]models.HistoryEntry, 0, limit)
+
+	r.s.view(func(time.Time) {
+		for _, t := range r.s.transactions {
+			if (t.fromUser == userID || t.toUser == userID) && (after == nil || before(t, after)) {
+				matched = append(matched, t)
+			}
+		}
+		slices.SortFunc(matched, func(a, b *transaction) int {
+			if c := b.createdAt.Compare(a.createdAt); c != 0 {
+				return c
+			}
+			return bytes.Compare(b.id[:], a.id[:])
+		})
+
+		for _, t := range matched[:min(limit, len(matched))] {
+			e := models.HistoryEntry{
+				ID:         t.id,
+				Direction:  models.HistorySent,
+				Amount:     t.amount,
+				Reversed:   t.reversedAt != nil,
+				ReversalOf: t.reversalOf,
+				CreatedAt:  t.createdAt,
+			}
+			if t.toUser == userID {
+				e.Direction = models.HistoryReceived
+				e.Counterparty = r.s.accounts[t.fromUser].Username
+			} else {
+				e.Counterparty = r.s.accounts[t.toUser].Username
+			}
+			entries = append(entries, e)
+		}
+	})
+	return entries, nil
+}
+
+// before сравнивает (created_at, id) с курсором так же, как Postgres
+// сравнивает строки.
+func before(t *transaction, cursor *models.HistoryCursor) bool {
+	if c := t.createdAt.Compare(cursor.CreatedAt); c != 0 {
+		return c < 0
+	}
+	return bytes.Compare(t.id[:], cursor.ID[:]) < 0
+}
+
+func (r *coinRepository) GetTransferLimits(ctx context.Context, userID uuid.UUID) (*models.UserTransferLimits, error) {
+	var override models.TransferLimitsOverride
+	r.s.view(func(time.Time) {
+		override = r.s.limits[userID]
+	})
+	return &models.UserTransferLimits{Effective: override.Apply(r.opts.Limits), Override: override}, nil
+}
+
+func (r *coinRepository) SetTransferLimits(ctx context.Context, userID, adminID uuid.UUID, override models.TransferLimitsOverride) (*models.UserTransferLimits, error) {
+	for _, v := range []*int64{override.MaxPerTransfer, override.MaxDailyTotal, override.MaxDailyRecipients} {
+		if v != nil && *v < 0 {
+			return nil, repository.ErrNegativeLimits
+		}
+	}
+
+	err := r.s.update(func(tx *txn) error {
+		if tx.account(userID) == nil {
+			return fmt.Errorf("failed to update transfer limits: %w", repository.ErrUserNotFound)
+		}
+		put(tx, tx.s.limits, userID, override)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.UserTransferLimits{Effective: override.Apply(r.opts.Limits), Override: override}, nil
+}
+
+// checkTransferLimits проверяет лимиты отправителя за скользящие 24 часа.
+// Компенсирующие переводы в лимитах не учитываются.
+func (r *coinRepository) checkTransferLimits(tx *txn, fromUserID, toUserID uuid.UUID, amount int64) error {
+	limits := tx.s.limits[fromUserID].Apply(r.opts.Limits)
+
+	if limits.MaxPerTransfer > 0 && amount > limits.MaxPerTransfer {
+		return repository.ErrTransferLimitExceeded
+	}
+	if limits.MaxDailyTotal == 0 && limits.MaxDailyRecipients == 0 {
+		return nil
+	}
+
+	var sentTotal int64
+	recipients := make(map[uuid.UUID]struct{})
+	since := tx.now.Add(-24 * time.Hour)
+	for _, t := range tx.s.transactions {
+		if t.fromUser == fromUserID && t.reversalOf == nil && t.createdAt.After(since) {
+			sentTotal += t.amount
+			recipients[t.toUser] = struct{}{}
+		}
+	}
+
+	if limits.MaxDailyTotal > 0 && sentTotal+amount > limits.MaxDailyTotal {
+		return repository.ErrDailyLimitExceeded
+	}
+	recipients[toUserID] = struct{}{}
+	if limits.MaxDailyRecipients > 0 && int64(len(recipients)) > limits.MaxDailyRecipients {
+		return repository.ErrDailyRecipientsExceeded
+	}
+
+	return nil
+}
+
+func (r *coinRepository) GrantCoins(ctx context.Context, userID uuid.UUID, amount int64) error {
+	if amount <= 0 {
+		return repository.ErrInvalidAmount
+	}
+
+	return r.s.update(func(tx *txn) error {
+		user := tx.account(userID)
+		if user == nil {
+			return repository.ErrUserNotFound
+		}
+
+		set(tx, &user.Coin, user.Coin+amount)
+		r.grantLots(tx, user, []lot{{amount: amount, expiresAt: tx.now.Add(r.coinLifetime())}})
+
+		return tx.recordEvent(userID, models.EventCoinsGranted, models.CoinsGrantedEvent{Amount: amount})
+	})
+}
+
+func (r *coinRepository) GetExpiringCoins(ctx context.Context, userID uuid.UUID) (*models.ExpiringCoins, error) {
+	var expiring models.ExpiringCoins
+	r.s.view(func(now time.Time) {
+		expiring.Before = now.Add(r.expiryWarning())
+		if user, ok := r.s.accounts[userID]; ok {
+			for _, l := range user.lots {
+				if l.amount > 0 && !l.expiresAt.After(expiring.Before) {
+					expiring.Amount += l.amount
+				}
+			}
+		}
+	})
+	return &expiring, nil
+}
+
+// ExpireLots списывает просроченные партии всех пользователей.
+func (r *coinRepository) ExpireLots(ctx context.Context) (int64, error) {
+	var total int64
+	err := r.s.update(func(tx *txn) error {
+		for id := range tx.s.accounts {
+			expired, err := r.expireLots(ctx, tx, id)
+			if err != nil {
+				return err
+			}
+			total += expired
+		}
+		return nil
+	})
+	return total, err
+}
+
+// expireLots списывает с баланса пользователя просроченные партии и сообщает
+// ему, сколько сгорело.
+func (r *coinRepository) expireLots(ctx context.Context, tx *txn, userID uuid.UUID) (int64, error) {
+	user := tx.account(userID)
+	if user == nil {
+		return 0, nil
+	}
+
+	var expired, lots int64
+	for _, l := range user.lots {
+		if l.amount > 0 && !l.expiresAt.After(tx.now) {
+			expired += l.amount
+			lots++
+			set(tx, &l.amount, 0)
+		}
+	}
+	if expired == 0 {
+		return 0, nil
+	}
+	set(tx, &user.Coin, user.Coin-expired)
+	logger.FromContext(ctx).Debug("expired coin lots", zap.Int64("amount", expired), zap.Int64("lots", lots))
+	return expired, tx.recordEvent(userID, models.EventCoinsExpired, models.CoinsExpiredEvent{Amount: expired})
+}
+
+// consumeLots списывает amount монет с партий пользователя, начиная с тех,
+// что сгорают раньше. Монеты сверх партий получают новый срок действия.
+func (r *coinRepository) consumeLots(tx *txn, user *account, amount int64) []lot {
+	active := make([]*lot, 0, len(user.lots))
+	for _, l := range user.lots {
+		if l.amount > 0 && l.expiresAt.After(tx.now) {
+			active = append(active, l)
+		}
+	}
+	slices.SortFunc(active, func(a, b *lot) int { return a.expiresAt.Compare(b.expiresAt) })
+
+	var portions []lot
+	remaining := amount
+	for _, l := range active {
+		if remaining == 0 {
+			break
+		}
+		take := min(l.amount, remaining)
+		set(tx, &l.amount, l.amount-take)
+		portions = append(portions, lot{amount: take, expiresAt: l.expiresAt})
+		remaining -= take
+	}
+	if remaining > 0 {
+		portions = append(portions, lot{amount: remaining, expiresAt: tx.now.Add(r.coinLifetime())})
+	}
+	return portions
+}
+
+// grantLots добавляет партии пользователю. Партии с тем же сроком
+// складываются, как при ON CONFLICT (user_id, expires_at).
+func (r *coinRepository) grantLots(tx *txn, user *account, portions []lot) {
+	for _, p := range portions {
+		i := slices.IndexFunc(user.lots, func(l *lot) bool { return l.expiresAt.Equal(p.expiresAt) })
+		if i >= 0 {
+			set(tx, &user.lots[i].amount, user.lots[i].amount+p.amount)
+			continue
+		}
+		set(tx, &user.lots, append(user.lots, &lot{amount: p.amount, expiresAt: p.expiresAt}))
+	}
+}
+
+func (r *coinRepository) coinLifetime() time.Duration {
+	return orDefault(r.opts.CoinLifetime, repository.DefaultCoinLifetime)
+}
+
+func (r *coinRepository) expiryWarning() time.Duration {
+	return orDefault(r.opts.ExpiryWarning, repository.DefaultExpiryWarning)
+}
+
+func orDefault(d, def time.Duration) time.Duration {
+	if d > 0 {
+		return d
+	}
+	return def
+}
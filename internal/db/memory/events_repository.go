@@ -0,0 +1,51 @@
+package memory
+
+import (
+	"context"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/models"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/repository"
+	"github.com/google/uuid"
+	"time"
+)
+
+type eventRepository struct {
+	s *Store
+}
+
+func NewEventRepository(s *Store) repository.EventRepository {
+	return &eventRepository{s: s}
+}
+
+// GetEventsAfter возвращает до limit событий пользователя с id больше afterID
+// в порядке возрастания.
+func (r *eventRepository) GetEventsAfter(ctx context.Context, userID uuid.UUID, afterID int64, limit int) ([]models.UserEvent, error) {
+	events := make([]models.UserEvent, 0, limit)
+	r.s.view(func(time.Time) {
+		for _, e := range r.s.events {
+			if len(events) == limit {
+				break
+			}
+			if e.UserID == userID && e.ID > afterID {
+				events = append(events, e)
+			}
+		}
+	})
+	return events, nil
+}
+
+func (r *eventRepository) DeleteEventsBefore(ctx context.Context, before time.Time) (int64, error) {
+	var deleted int64
+	err := r.s.update(func(tx *txn) error {
+		kept := make([]models.UserEvent, 0, len(tx.s.events))
+		for _, e := range tx.s.events {
+			if e.CreatedAt.Before(before) {
+				deleted++
+				continue
+			}
+			kept = append(kept, e)
+		}
+		set(tx, &tx.s.events, kept)
+		return nil
+	})
+	return deleted, err
+}
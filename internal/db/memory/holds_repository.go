@@ -0,0 +1,143 @@
+package memory
+
+import (
+	"context"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/models"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/repository"
+	"github.com/google/uuid"
+	"time"
+)
+
+// HoldCoins резервирует монеты пользователя до списания, освобождения или
+// истечения срока холда.
+func (r *coinRepository) HoldCoins(ctx context.Context, userID, createdBy uuid.UUID, request models.HoldRequest) (*models.CoinHold, error) {
+	if request.Amount <= 0 {
+		return nil, repository.ErrInvalidAmount
+	}
+	ttl := orDefault(time.Duration(request.TTLSeconds)*time.Second, orDefault(r.opts.HoldTTL, repository.DefaultHoldTTL))
+
+	var hold models.CoinHold
+	err := r.s.update(func(tx *txn) error {
+		if _, err := r.expireLots(ctx, tx, userID); err != nil {
+			return err
+		}
+
+		user := tx.account(userID)
+		if user == nil {
+			return repository.ErrUserNotFound
+		}
+		if user.Coin-user.heldCoins(tx.now) < request.Amount {
+			return repository.ErrInsufficientBalance
+		}
+
+		h := &models.CoinHold{
+			ID:        uuid.New(),
+			UserID:    userID,
+			Amount:    request.Amount,
+			Reason:    request.Reason,
+			Status:    models.HoldStatusHeld,
+			CreatedAt: tx.now,
+			ExpiresAt: tx.now.Add(ttl),
+		}
+		put(tx, tx.s.holds, h.ID, h)
+		set(tx, &user.holds, append(user.holds, h))
+
+		hold = *h
+		return recordHoldEvent(tx, models.EventHoldCreated, h)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &hold, nil
+}
+
+// CaptureHold списывает зарезервированные монеты с баланса, как при покупке.
+func (r *coinRepository) CaptureHold(ctx context.Context, holdID uuid.UUID) (*models.CoinHold, error) {
+	var hold models.CoinHold
+	err := r.s.update(func(tx *txn) error {
+		active, err := activeHold(tx, holdID)
+		if err != nil {
+			return err
+		}
+
+		if _, err = r.expireLots(ctx, tx, active.UserID); err != nil {
+			return err
+		}
+
+		user := tx.account(active.UserID)
+		if user.Coin < active.Amount {
+			return repository.ErrInsufficientBalance
+		}
+		set(tx, &user.Coin, user.Coin-active.Amount)
+		r.consumeLots(tx, user, active.Amount)
+
+		hold = resolveHold(tx, active, models.HoldStatusCaptured)
+		return recordHoldEvent(tx, models.EventHoldCaptured, active)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &hold, nil
+}
+
+func (r *coinRepository) ReleaseHold(ctx context.Context, holdID uuid.UUID) (*models.CoinHold, error) {
+	var hold models.CoinHold
+	err := r.s.update(func(tx *txn) error {
+		active, err := activeHold(tx, holdID)
+		if err != nil {
+			return err
+		}
+
+		hold = resolveHold(tx, active, models.HoldStatusReleased)
+		return recordHoldEvent(tx, models.EventHoldReleased, active)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &hold, nil
+}
+
+// ReleaseExpiredHolds помечает истёкшие холды. Истёкшие холды перестают
+// учитываться сразу по ExpiresAt, а событие сообщает пользователю, что
+// монеты снова доступны.
+func (r *coinRepository) ReleaseExpiredHolds(ctx context.Context) (int64, error) {
+	var released int64
+	err := r.s.update(func(tx *txn) error {
+		for _, h := range tx.s.holds {
+			if h.Status != models.HoldStatusHeld || h.ExpiresAt.After(tx.now) {
+				continue
+			}
+			resolveHold(tx, h, models.HoldStatusExpired)
+			if err := recordHoldEvent(tx, models.EventHoldExpired, h); err != nil {
+				return err
+			}
+			released++
+		}
+		return nil
+	})
+	return released, err
+}
+
+// recordHoldEvent сообщает владельцу холда об изменении: доступный баланс
+// меняется на каждом этапе холда.
+func recordHoldEvent(tx *txn, eventType string, hold *models.CoinHold) error {
+	return tx.recordEvent(hold.UserID, eventType, models.HoldEvent{HoldID: hold.ID, Amount: hold.Amount})
+}
+
+func activeHold(tx *txn, holdID uuid.UUID) (*models.CoinHold, error) {
+	hold, ok := tx.s.holds[holdID]
+	if !ok {
+		return nil, repository.ErrHoldNotFound
+	}
+	if hold.Status != models.HoldStatusHeld || !hold.ExpiresAt.After(tx.now) {
+		return nil, repository.ErrHoldNotActive
+	}
+	return hold, nil
+}
+
+func resolveHold(tx *txn, hold *models.CoinHold, status string) models.CoinHold {
+	resolvedAt := tx.now
+	set(tx, &hold.Status, status)
+	set(tx, &hold.ResolvedAt, &resolvedAt)
+	return *hold
+}
@@ -0,0 +1,219 @@
+package memory
+
+import (
+	"context"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/models"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/repository"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/logger"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"slices"
+	"time"
+)
+
+func (r *coinRepository) RequestReversal(ctx context.Context, transactionID, requestedBy uuid.UUID, reason string) (*models.TransferReversal, error) {
+	var result models.TransferReversal
+	err := r.s.update(func(tx *txn) error {
+		original, err := reversibleTransaction(tx, transactionID)
+		if err != nil {
+			return err
+		}
+		if original.fromUser != requestedBy {
+			return repository.ErrNotTransactionSender
+		}
+		if pendingReversal(tx, transactionID) != nil {
+			return repository.ErrReversalAlreadyExists
+		}
+
+		rev := &reversal{
+			id:            uuid.New(),
+			transactionID: transactionID,
+			reason:        reason,
+			status:        models.ReversalStatusPending,
+			createdAt:     tx.now,
+		}
+		addReversal(tx, rev)
+
+		result = r.reversalModel(tx.s, rev)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (r *coinRepository) ApproveReversal(ctx context.Context, reversalID, approvedBy uuid.UUID) (*models.TransferReversal, error) {
+	var result models.TransferReversal
+	err := r.s.update(func(tx *txn) error {
+		rev, original, err := lockPendingReversal(tx, reversalID, approvedBy)
+		if err != nil {
+			return err
+		}
+
+		compensationID, err := r.compensate(ctx, tx, original)
+		if err != nil {
+			return err
+		}
+
+		resolveReversal(tx, rev, models.ReversalStatusApproved, &compensationID)
+		result = r.reversalModel(tx.s, rev)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (r *coinRepository) RejectReversal(ctx context.Context, reversalID, rejectedBy uuid.UUID) (*models.TransferReversal, error) {
+	var result models.TransferReversal
+	err := r.s.update(func(tx *txn) error {
+		rev, _, err := lockPendingReversal(tx, reversalID, rejectedBy)
+		if err != nil {
+			return err
+		}
+
+		resolveReversal(tx, rev, models.ReversalStatusRejected, nil)
+		result = r.reversalModel(tx.s, rev)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// ForceReversal отменяет перевод без согласия получателя. Ожидающий запрос
+// по переводу закрывается как принудительно исполненный.
+func (r *coinRepository) ForceReversal(ctx context.Context, transactionID, adminID uuid.UUID, reason string) (*models.TransferReversal, error) {
+	var result models.TransferReversal
+	err := r.s.update(func(tx *txn) error {
+		original, err := reversibleTransaction(tx, transactionID)
+		if err != nil {
+			return err
+		}
+
+		compensationID, err := r.compensate(ctx, tx, original)
+		if err != nil {
+			return err
+		}
+
+		rev := pendingReversal(tx, transactionID)
+		if rev == nil {
+			rev = &reversal{id: uuid.New(), transactionID: transactionID, reason: reason, createdAt: tx.now}
+			addReversal(tx, rev)
+		}
+		resolveReversal(tx, rev, models.ReversalStatusForced, &compensationID)
+
+		result = r.reversalModel(tx.s, rev)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (r *coinRepository) GetReversals(ctx context.Context, userID uuid.UUID, reversals *[]models.TransferReversal) error {
+	r.s.view(func(time.Time) {
+		var found []models.TransferReversal
+		for _, rev := range r.s.reversals {
+			t := r.s.txByID[rev.transactionID]
+			if t.fromUser == userID || t.toUser == userID {
+				found = append(found, r.reversalModel(r.s, rev))
+			}
+		}
+		slices.SortStableFunc(found, func(a, b models.TransferReversal) int { return b.CreatedAt.Compare(a.CreatedAt) })
+		*reversals = append(*reversals, found...)
+	})
+	return nil
+}
+
+func reversibleTransaction(tx *txn, transactionID uuid.UUID) (*transaction, error) {
+	t, ok := tx.s.txByID[transactionID]
+	if !ok {
+		return nil, repository.ErrTransactionNotFound
+	}
+	if t.reversalOf != nil {
+		return nil, repository.ErrCompensatingReversal
+	}
+	if t.reversedAt != nil {
+		return nil, repository.ErrAlreadyReversed
+	}
+	return t, nil
+}
+
+func lockPendingReversal(tx *txn, reversalID, recipientID uuid.UUID) (*reversal, *transaction, error) {
+	rev, ok := tx.s.reversalByID[reversalID]
+	if !ok {
+		return nil, nil, repository.ErrReversalNotFound
+	}
+	if rev.status != models.ReversalStatusPending {
+		return nil, nil, repository.ErrReversalNotPending
+	}
+
+	original, err := reversibleTransaction(tx, rev.transactionID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if original.toUser != recipientID {
+		return nil, nil, repository.ErrNotTransactionRecipient
+	}
+	return rev, original, nil
+}
+
+func pendingReversal(tx *txn, transactionID uuid.UUID) *reversal {
+	for _, rev := range tx.s.reversals {
+		if rev.transactionID == transactionID && rev.status == models.ReversalStatusPending {
+			return rev
+		}
+	}
+	return nil
+}
+
+func addReversal(tx *txn, rev *reversal) {
+	set(tx, &tx.s.reversals, append(tx.s.reversals, rev))
+	put(tx, tx.s.reversalByID, rev.id, rev)
+}
+
+func resolveReversal(tx *txn, rev *reversal, status string, compensationID *uuid.UUID) {
+	resolvedAt := tx.now
+	set(tx, &rev.status, status)
+	set(tx, &rev.compensationID, compensationID)
+	set(tx, &rev.resolvedAt, &resolvedAt)
+}
+
+// compensate возвращает монеты отправителю отдельной транзакцией и помечает
+// исходный перевод как отменённый.
+func (r *coinRepository) compensate(ctx context.Context, tx *txn, original *transaction) (uuid.UUID, error) {
+	compensationID, err := r.transfer(ctx, tx, original.toUser, original.fromUser, original.amount, &original.id)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	reversedAt := tx.now
+	set(tx, &original.reversedAt, &reversedAt)
+
+	logger.FromContext(ctx).Info("transfer reversed",
+		zap.Stringer("transaction_id", original.id), zap.Stringer("compensation_id", compensationID))
+	return compensationID, nil
+}
+
+func (r *coinRepository) reversalModel(s *Store, rev *reversal) models.TransferReversal {
+	t := s.txByID[rev.transactionID]
+	return models.TransferReversal{
+		ID:             rev.id,
+		TransactionID:  rev.transactionID,
+		FromUserID:     t.fromUser,
+		ToUserID:       t.toUser,
+		FromUser:       s.accounts[t.fromUser].Username,
+		ToUser:         s.accounts[t.toUser].Username,
+		Amount:         t.amount,
+		Reason:         rev.reason,
+		Status:         rev.status,
+		CompensationID: rev.compensationID,
+		CreatedAt:      rev.createdAt,
+		ResolvedAt:     rev.resolvedAt,
+	}
+}
@@ -0,0 +1,232 @@
+// Package memory — репозитории в памяти процесса с той же семантикой, что и
+// у Postgres: проверки баланса, ошибки и атомарность операций. Нужны для
+// быстрых тестов и демо без базы, данные теряются при остановке.
+package memory
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/models"
+	"github.com/google/uuid"
+	"slices"
+	"sync"
+	"time"
+)
+
+// StartingCoins — баланс нового пользователя, как DEFAULT колонки credentials.coin.
+const StartingCoins = 1000
+
+// DefaultShop — каталог магазина из миграции 001_init.
+var DefaultShop = []models.Shop{
+	{Item: "t-shirt", Price: 80},
+	{Item: "cup", Price: 20},
+	{Item: "book", Price: 50},
+	{Item: "pen", Price: 10},
+	{Item: "powerbank", Price: 200},
+	{Item: "hoody", Price: 300},
+	{Item: "umbrella", Price: 200},
+	{Item: "socks", Price: 10},
+	{Item: "wallet", Price: 50},
+	{Item: "pink-hoody", Price: 500},
+}
+
+// Store хранит данные всех репозиториев. Каждая операция выполняется под
+// одной блокировкой, а при ошибке её изменения откатываются.
+type Store struct {
+	mu sync.Mutex
+
+	accounts  map[uuid.UUID]*account
+	usernames map[string]uuid.UUID
+	shop      map[string]int64
+
+	transactions []*transaction
+	txByID       map[uuid.UUID]*transaction
+	reversals    []*reversal
+	reversalByID map[uuid.UUID]*reversal
+	limits       map[uuid.UUID]models.TransferLimitsOverride
+	holds        map[uuid.UUID]*models.CoinHold
+
+	events      []models.UserEvent
+	lastEventID int64
+
+	webhooks       []*models.Webhook
+	outbox         []*models.OutboxEvent
+	lastOutboxID   int64
+	deliveries     []*models.WebhookDelivery
+	lastDeliveryID int64
+
+	onEvent func(models.UserEvent)
+}
+
+type account struct {
+	models.Credential
+	items []models.UserItem
+	lots  []*lot
+	holds []*models.CoinHold
+}
+
+type lot struct {
+	amount    int64
+	expiresAt time.Time
+}
+
+type transaction struct {
+	id         uuid.UUID
+	fromUser   uuid.UUID
+	toUser     uuid.UUID
+	amount     int64
+	reversalOf *uuid.UUID
+	reversedAt *time.Time
+	createdAt  time.Time
+}
+
+type reversal struct {
+	id             uuid.UUID
+	transactionID  uuid.UUID
+	reason         string
+	status         string
+	compensationID *uuid.UUID
+	createdAt      time.Time
+	resolvedAt     *time.Time
+}
+
+// NewStore создаёт хранилище с каталогом DefaultShop. onEvent получает
+// события пользователей после успешной операции в порядке их id, как
+// подписчики LISTEN; nil — события только сохраняются.
+func NewStore(onEvent func(models.UserEvent)) *Store {
+	s := &Store{
+		accounts:     make(map[uuid.UUID]*account),
+		usernames:    make(map[string]uuid.UUID),
+		shop:         make(map[string]int64, len(DefaultShop)),
+		txByID:       make(map[uuid.UUID]*transaction),
+		reversalByID: make(map[uuid.UUID]*reversal),
+		limits:       make(map[uuid.UUID]models.TransferLimitsOverride),
+		holds:        make(map[uuid.UUID]*models.CoinHold),
+		onEvent:      onEvent,
+	}
+	for _, item := range DefaultShop {
+		s.shop[item.Item] = item.Price
+	}
+	return s
+}
+
+// txn — изменения одной операции. Каждое изменение запоминает, как его
+// отменить, события публикуются только после успеха.
+type txn struct {
+	s         *Store
+	now       time.Time
+	undo      []func()
+	published []models.UserEvent
+}
+
+// update выполняет fn атомарно: при ошибке все изменения откатываются.
+func (s *Store) update(fn func(tx *txn) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx := &txn{s: s, now: now()}
+	if err := fn(tx); err != nil {
+		for i := len(tx.undo) - 1; i >= 0; i-- {
+			tx.undo[i]()
+		}
+		return err
+	}
+	if s.onEvent != nil {
+		for _, event := range tx.published {
+			s.onEvent(event)
+		}
+	}
+	return nil
+}
+
+// view выполняет чтение под той же блокировкой.
+func (s *Store) view(fn func(now time.Time)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(now())
+}
+
+// now возвращает время с точностью timestamptz, чтобы курсоры истории
+// совпадали с Postgres.
+func now() time.Time {
+	return time.Now().Truncate(time.Microsecond)
+}
+
+func set[T any](tx *txn, p *T, v T) {
+	old := *p
+	tx.undo = append(tx.undo, func() { *p = old })
+	*p = v
+}
+
+func put[K comparable, V any](tx *txn, m map[K]V, k K, v V) {
+	old, ok := m[k]
+	tx.undo = append(tx.undo, func() {
+		if ok {
+			m[k] = old
+		} else {
+			delete(m, k)
+		}
+	})
+	m[k] = v
+}
+
+func (tx *txn) account(id uuid.UUID) *account {
+	return tx.s.accounts[id]
+}
+
+// heldCoins считает активные холды пользователя, как heldCoinsColumn.
+func (a *account) heldCoins(now time.Time) int64 {
+	var held int64
+	for _, h := range a.holds {
+		if h.Status == models.HoldStatusHeld && h.ExpiresAt.After(now) {
+			held += h.Amount
+		}
+	}
+	return held
+}
+
+// recordEvent сохраняет событие пользователя. Подписчики получат его после
+// успешного завершения операции.
+func (tx *txn) recordEvent(userID uuid.UUID, eventType string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	set(tx, &tx.s.lastEventID, tx.s.lastEventID+1)
+	event := models.UserEvent{ID: tx.s.lastEventID, UserID: userID, Type: eventType, Payload: payload, CreatedAt: tx.now}
+	set(tx, &tx.s.events, append(tx.s.events, event))
+	tx.published = append(tx.published, event)
+	return nil
+}
+
+// writeOutbox сохраняет событие для webhook и создаёт доставки подписанным
+// на него получателям.
+func (tx *txn) writeOutbox(eventType string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to encode outbox event: %w", err)
+	}
+
+	s := tx.s
+	set(tx, &s.lastOutboxID, s.lastOutboxID+1)
+	event := &models.OutboxEvent{ID: s.lastOutboxID, Type: eventType, CreatedAt: tx.now, Data: payload}
+	set(tx, &s.outbox, append(s.outbox, event))
+
+	for _, w := range s.webhooks {
+		if len(w.EventTypes) > 0 && !slices.Contains(w.EventTypes, eventType) {
+			continue
+		}
+		set(tx, &s.lastDeliveryID, s.lastDeliveryID+1)
+		set(tx, &s.deliveries, append(s.deliveries, &models.WebhookDelivery{
+			ID:            s.lastDeliveryID,
+			WebhookID:     w.ID,
+			EventID:       event.ID,
+			EventType:     eventType,
+			Status:        models.DeliveryStatusPending,
+			NextAttemptAt: tx.now,
+			CreatedAt:     tx.now,
+		}))
+	}
+	return nil
+}
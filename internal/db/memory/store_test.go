@@ -0,0 +1,19 @@
+package memory
+
+import (
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/repository"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/repository/repotest"
+	"testing"
+)
+
+func TestConformance(t *testing.T) {
+	repotest.Run(t, func(t *testing.T, opts repository.CoinOptions) repotest.Backend {
+		s := NewStore(nil)
+		return repotest.Backend{
+			Users:    NewUserRepository(s, opts.CoinLifetime),
+			Coins:    NewCoinRepository(s, opts),
+			Events:   NewEventRepository(s),
+			Webhooks: NewWebhookRepository(s),
+		}
+	})
+}
@@ -0,0 +1,124 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/models"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/repository"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/logger"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+	"time"
+)
+
+// errUsernameTaken соответствует нарушению uni_credentials_username.
+var errUsernameTaken = errors.New("username already exists")
+
+type userRepository struct {
+	s            *Store
+	coinLifetime time.Duration
+}
+
+// NewUserRepository создаёт репозиторий пользователей поверх s. coinLifetime
+// задаёт срок действия стартовых монет, 0 — срок по умолчанию.
+func NewUserRepository(s *Store, coinLifetime time.Duration) repository.UserRepository {
+	return &userRepository{s: s, coinLifetime: coinLifetime}
+}
+
+// GetUserCredentialByName, как и Postgres-версия, возвращает пустую
+// структуру без ошибки, если пользователя нет.
+func (r *userRepository) GetUserCredentialByName(ctx context.Context, name string) (*models.Credential, error) {
+	var credential models.Credential
+	r.s.view(func(time.Time) {
+		if id, ok := r.s.usernames[name]; ok {
+			a := r.s.accounts[id]
+			credential = models.Credential{ID: a.ID, Username: a.Username, Password: a.Password}
+		}
+	})
+	return &credential, nil
+}
+
+func (r *userRepository) CreateUserCredential(ctx context.Context, credential *models.Credential) error {
+	err := r.s.update(func(tx *txn) error {
+		if _, ok := tx.s.usernames[credential.Username]; ok {
+			return errUsernameTaken
+		}
+
+		a := &account{Credential: models.Credential{
+			ID:       uuid.New(),
+			Username: credential.Username,
+			Password: credential.Password,
+			Coin:     StartingCoins,
+		}}
+		a.lots = []*lot{{amount: a.Coin, expiresAt: tx.now.Add(orDefault(r.coinLifetime, repository.DefaultCoinLifetime))}}
+		put(tx, tx.s.accounts, a.ID, a)
+		put(tx, tx.s.usernames, a.Username, a.ID)
+
+		credential.ID = a.ID
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	logger.FromContext(ctx).Info("user registered", zap.Stringer("user_id", credential.ID))
+	return nil
+}
+
+// GetUserByID возвращает pgx.ErrNoRows для неизвестного пользователя, как
+// Postgres-версия: на это рассчитывают обработчики.
+func (r *userRepository) GetUserByID(ctx context.Context, id uuid.UUID) (*models.Credential, error) {
+	var credential *models.Credential
+	r.s.view(func(now time.Time) {
+		if a, ok := r.s.accounts[id]; ok {
+			credential = &models.Credential{
+				ID:       a.ID,
+				Username: a.Username,
+				Coin:     a.Coin,
+				Held:     a.heldCoins(now),
+				IsAdmin:  a.IsAdmin,
+			}
+		}
+	})
+	if credential == nil {
+		return nil, pgx.ErrNoRows
+	}
+	return credential, nil
+}
+
+func (r *userRepository) GetUserItems(ctx context.Context, id uuid.UUID, userItems *[]models.UserItem) error {
+	r.s.view(func(time.Time) {
+		if a, ok := r.s.accounts[id]; ok {
+			for _, item := range a.items {
+				*userItems = append(*userItems, models.UserItem{Type: item.Type, Quantity: item.Quantity})
+			}
+		}
+	})
+	return nil
+}
+
+func (r *userRepository) GetUsernamesByIDs(ctx context.Context, userIDs []string) (map[string]string, error) {
+	if len(userIDs) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]uuid.UUID, 0, len(userIDs))
+	for _, raw := range userIDs {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	usernameMap := make(map[string]string)
+	r.s.view(func(time.Time) {
+		for _, id := range ids {
+			if a, ok := r.s.accounts[id]; ok {
+				usernameMap[id.String()] = a.Username
+			}
+		}
+	})
+	return usernameMap, nil
+}
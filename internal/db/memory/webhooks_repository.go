@@ -0,0 +1,216 @@
+package memory
+
+import (
+	"context"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/models"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/repository"
+	"github.com/google/uuid"
+	"slices"
+	"time"
+)
+
+type webhookRepository struct {
+	s *Store
+}
+
+func NewWebhookRepository(s *Store) repository.WebhookRepository {
+	return &webhookRepository{s: s}
+}
+
+func (r *webhookRepository) CreateWebhook(ctx context.Context, request models.WebhookRequest) (*models.Webhook, error) {
+	eventTypes := slices.Clone(request.EventTypes)
+	if eventTypes == nil {
+		eventTypes = []string{}
+	}
+
+	var webhook models.Webhook
+	err := r.s.update(func(tx *txn) error {
+		w := &models.Webhook{ID: uuid.New(), URL: request.URL, Secret: request.Secret, EventTypes: eventTypes, CreatedAt: tx.now}
+		set(tx, &tx.s.webhooks, append(tx.s.webhooks, w))
+		webhook = *w
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+func (r *webhookRepository) GetWebhooks(ctx context.Context) ([]models.Webhook, error) {
+	webhooks := make([]models.Webhook, 0)
+	r.s.view(func(time.Time) {
+		for _, w := range r.s.webhooks {
+			webhooks = append(webhooks, models.Webhook{ID: w.ID, URL: w.URL, EventTypes: w.EventTypes, CreatedAt: w.CreatedAt})
+		}
+	})
+	return webhooks, nil
+}
+
+// DeleteWebhook удаляет webhook вместе с его доставками.
+func (r *webhookRepository) DeleteWebhook(ctx context.Context, id uuid.UUID) error {
+	return r.s.update(func(tx *txn) error {
+		i := slices.IndexFunc(tx.s.webhooks, func(w *models.Webhook) bool { return w.ID == id })
+		if i < 0 {
+			return repository.ErrWebhookNotFound
+		}
+		set(tx, &tx.s.webhooks, slices.Delete(slices.Clone(tx.s.webhooks), i, i+1))
+		set(tx, &tx.s.deliveries, slices.DeleteFunc(slices.Clone(tx.s.deliveries), func(d *models.WebhookDelivery) bool {
+			return d.WebhookID == id
+		}))
+		return nil
+	})
+}
+
+// GetDeliveries возвращает последние доставки webhook, status пустой — все.
+func (r *webhookRepository) GetDeliveries(ctx context.Context, webhookID uuid.UUID, status string, limit int) ([]models.WebhookDelivery, error) {
+	var deliveries []models.WebhookDelivery
+	var err error
+	r.s.view(func(time.Time) {
+		if !r.exists(webhookID) {
+			err = repository.ErrWebhookNotFound
+			return
+		}
+
+		deliveries = make([]models.WebhookDelivery, 0)
+		for i := len(r.s.deliveries) - 1; i >= 0 && len(deliveries) < limit; i-- {
+			d := r.s.deliveries[i]
+			if d.WebhookID == webhookID && (status == "" || d.Status == status) {
+				deliveries = append(deliveries, *d)
+			}
+		}
+	})
+	return deliveries, err
+}
+
+// ReplayDeliveries возвращает доставки webhook в очередь с обнулённым
+// счётчиком попыток.
+func (r *webhookRepository) ReplayDeliveries(ctx context.Context, webhookID uuid.UUID, request models.ReplayRequest) (int64, error) {
+	var replayed int64
+	err := r.s.update(func(tx *txn) error {
+		if !r.exists(webhookID) {
+			return repository.ErrWebhookNotFound
+		}
+
+		for _, d := range tx.s.deliveries {
+			replay := d.Status == models.DeliveryStatusDead ||
+				request.IncludeDelivered && d.Status == models.DeliveryStatusDelivered
+			if d.WebhookID != webhookID || !replay || request.Since != nil && d.CreatedAt.Before(*request.Since) {
+				continue
+			}
+			set(tx, &d.Status, models.DeliveryStatusPending)
+			set(tx, &d.Attempts, 0)
+			set(tx, &d.NextAttemptAt, tx.now)
+			set(tx, &d.DeliveredAt, nil)
+			replayed++
+		}
+		return nil
+	})
+	return replayed, err
+}
+
+// ClaimDeliveries берёт в работу до limit доставок, срок которых подошёл,
+// и откладывает следующую попытку на lease.
+func (r *webhookRepository) ClaimDeliveries(ctx context.Context, limit int, lease time.Duration) ([]models.PendingDelivery, error) {
+	claimed := make([]models.PendingDelivery, 0, limit)
+	err := r.s.update(func(tx *txn) error {
+		var due []*models.WebhookDelivery
+		for _, d := range tx.s.deliveries {
+			if d.Status == models.DeliveryStatusPending && !d.NextAttemptAt.After(tx.now) {
+				due = append(due, d)
+			}
+		}
+		slices.SortStableFunc(due, func(a, b *models.WebhookDelivery) int { return a.NextAttemptAt.Compare(b.NextAttemptAt) })
+
+		for _, d := range due[:min(limit, len(due))] {
+			set(tx, &d.Attempts, d.Attempts+1)
+			set(tx, &d.NextAttemptAt, tx.now.Add(lease))
+
+			w := tx.s.webhooks[slices.IndexFunc(tx.s.webhooks, func(w *models.Webhook) bool { return w.ID == d.WebhookID })]
+			event := tx.s.outbox[slices.IndexFunc(tx.s.outbox, func(e *models.OutboxEvent) bool { return e.ID == d.EventID })]
+			claimed = append(claimed, models.PendingDelivery{ID: d.ID, Attempts: d.Attempts, URL: w.URL, Secret: w.Secret, Event: *event})
+		}
+		return nil
+	})
+	return claimed, err
+}
+
+func (r *webhookRepository) MarkDelivered(ctx context.Context, id int64, status int) error {
+	return r.s.update(func(tx *txn) error {
+		if d := r.delivery(id); d != nil {
+			deliveredAt := tx.now
+			set(tx, &d.Status, models.DeliveryStatusDelivered)
+			set(tx, &d.LastStatus, &status)
+			set(tx, &d.LastError, nil)
+			set(tx, &d.DeliveredAt, &deliveredAt)
+		}
+		return nil
+	})
+}
+
+// MarkFailed записывает неудачную попытку. Без retryAt доставка уходит в
+// dead letter. status 0 — ответа не было.
+func (r *webhookRepository) MarkFailed(ctx context.Context, id int64, status int, reason string, retryAt *time.Time) error {
+	return r.s.update(func(tx *txn) error {
+		d := r.delivery(id)
+		if d == nil {
+			return nil
+		}
+
+		var lastStatus *int
+		if status != 0 {
+			lastStatus = &status
+		}
+		if retryAt != nil {
+			set(tx, &d.NextAttemptAt, *retryAt)
+		} else {
+			set(tx, &d.Status, models.DeliveryStatusDead)
+		}
+		set(tx, &d.LastStatus, lastStatus)
+		set(tx, &d.LastError, &reason)
+		return nil
+	})
+}
+
+// DeleteOutboxBefore удаляет события старше before, все доставки которых
+// завершились успешно.
+func (r *webhookRepository) DeleteOutboxBefore(ctx context.Context, before time.Time) (int64, error) {
+	var deleted int64
+	err := r.s.update(func(tx *txn) error {
+		undelivered := make(map[int64]bool)
+		for _, d := range tx.s.deliveries {
+			if d.Status != models.DeliveryStatusDelivered {
+				undelivered[d.EventID] = true
+			}
+		}
+
+		removed := make(map[int64]bool)
+		kept := make([]*models.OutboxEvent, 0, len(tx.s.outbox))
+		for _, e := range tx.s.outbox {
+			if e.CreatedAt.Before(before) && !undelivered[e.ID] {
+				removed[e.ID] = true
+				continue
+			}
+			kept = append(kept, e)
+		}
+		set(tx, &tx.s.outbox, kept)
+		set(tx, &tx.s.deliveries, slices.DeleteFunc(slices.Clone(tx.s.deliveries), func(d *models.WebhookDelivery) bool {
+			return removed[d.EventID]
+		}))
+
+		deleted = int64(len(removed))
+		return nil
+	})
+	return deleted, err
+}
+
+func (r *webhookRepository) exists(id uuid.UUID) bool {
+	return slices.ContainsFunc(r.s.webhooks, func(w *models.Webhook) bool { return w.ID == id })
+}
+
+func (r *webhookRepository) delivery(id int64) *models.WebhookDelivery {
+	i := slices.IndexFunc(r.s.deliveries, func(d *models.WebhookDelivery) bool { return d.ID == id })
+	if i < 0 {
+		return nil
+	}
+	return r.s.deliveries[i]
+}
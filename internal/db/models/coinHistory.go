@@ -2,26 +2,65 @@ package models
 
 import (
 	"github.com/google/uuid"
+	"time"
 )
 
 type Transaction struct {
-	ID       uuid.UUID `json:"-"`
-	FromUser string    `json:"fromUser"`
-	ToUser   string    `json:"toUser"`
-	Amount   int64     `json:"amount"`
+	ID         uuid.UUID  `json:"-"`
+	FromUser   string     `json:"fromUser"`
+	ToUser     string     `json:"toUser"`
+	Amount     int64      `json:"amount"`
+	Reversed   bool       `json:"-"`
+	ReversalOf *uuid.UUID `json:"-"`
 }
 
 type ReceivedTransaction struct {
-	FromUser string `json:"fromUser"`
-	Amount   int64  `json:"amount"`
+	ID         uuid.UUID  `json:"id"`
+	FromUser   string     `json:"fromUser"`
+	Amount     int64      `json:"amount"`
+	Reversed   bool       `json:"reversed"`
+	ReversalOf *uuid.UUID `json:"reversalOf,omitempty"`
 }
 
 type SentTransaction struct {
-	ToUser string `json:"toUser"`
-	Amount int64  `json:"amount"`
+	ID         uuid.UUID  `json:"id"`
+	ToUser     string     `json:"toUser"`
+	Amount     int64      `json:"amount"`
+	Reversed   bool       `json:"reversed"`
+	ReversalOf *uuid.UUID `json:"reversalOf,omitempty"`
 }
 
 type CoinHistory struct {
 	Received []ReceivedTransaction `json:"received"`
 	Sent     []SentTransaction     `json:"sent"`
 }
+
+// Направление перевода в истории
+const (
+	HistorySent     = "sent"
+	HistoryReceived = "received"
+)
+
+// HistoryEntry — перевод с точки зрения пользователя: Counterparty — вторая
+// сторона перевода.
+type HistoryEntry struct {
+	ID           uuid.UUID  `json:"id"`
+	Direction    string     `json:"direction"`
+	Counterparty string     `json:"counterparty"`
+	Amount       int64      `json:"amount"`
+	Reversed     bool       `json:"reversed"`
+	ReversalOf   *uuid.UUID `json:"reversalOf,omitempty"`
+	CreatedAt    time.Time  `json:"createdAt"`
+}
+
+// HistoryCursor — последняя показанная запись, следующая страница
+// начинается после неё.
+type HistoryCursor struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+type HistoryPage struct {
+	Items      []HistoryEntry `json:"items"`
+	NextCursor string         `json:"nextCursor,omitempty"`
+}
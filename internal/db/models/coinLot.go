@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+type ExpiringCoins struct {
+	Amount int64     `json:"amount"`
+	Before time.Time `json:"before"`
+}
+
+type GrantCoins struct {
+	Amount int64 `json:"amount"`
+}
@@ -7,4 +7,6 @@ type Credential struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
 	Coin     int64  `json:"coin"`
+	Held     int64  `json:"-"`
+	IsAdmin  bool   `json:"-"`
 }
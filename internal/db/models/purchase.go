@@ -0,0 +1,5 @@
+package models
+
+type Purchase struct {
+	Item string `json:"item"`
+}
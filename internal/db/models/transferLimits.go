@@ -0,0 +1,37 @@
+package models
+
+// TransferLimits описывает ограничения на переводы. Нулевое значение поля
+// означает отсутствие ограничения.
+type TransferLimits struct {
+	MaxPerTransfer     int64 `json:"maxPerTransfer"`
+	MaxDailyTotal      int64 `json:"maxDailyTotal"`
+	MaxDailyRecipients int64 `json:"maxDailyRecipients"`
+}
+
+// TransferLimitsOverride задаёт персональные лимиты пользователя. nil в поле
+// означает, что действует лимит по умолчанию.
+type TransferLimitsOverride struct {
+	MaxPerTransfer     *int64 `json:"maxPerTransfer"`
+	MaxDailyTotal      *int64 `json:"maxDailyTotal"`
+	MaxDailyRecipients *int64 `json:"maxDailyRecipients"`
+}
+
+type UserTransferLimits struct {
+	Effective TransferLimits         `json:"effective"`
+	Override  TransferLimitsOverride `json:"override"`
+}
+
+// Apply возвращает лимиты с учётом персональных переопределений.
+func (o TransferLimitsOverride) Apply(defaults TransferLimits) TransferLimits {
+	limits := defaults
+	if o.MaxPerTransfer != nil {
+		limits.MaxPerTransfer = *o.MaxPerTransfer
+	}
+	if o.MaxDailyTotal != nil {
+		limits.MaxDailyTotal = *o.MaxDailyTotal
+	}
+	if o.MaxDailyRecipients != nil {
+		limits.MaxDailyRecipients = *o.MaxDailyRecipients
+	}
+	return limits
+}
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+const (
+	ReversalStatusPending  = "pending"
+	ReversalStatusApproved = "approved"
+	ReversalStatusRejected = "rejected"
+	ReversalStatusForced   = "forced"
+)
+
+type TransferReversal struct {
+	ID             uuid.UUID  `json:"id"`
+	TransactionID  uuid.UUID  `json:"transactionId"`
+	FromUserID     uuid.UUID  `json:"-"`
+	ToUserID       uuid.UUID  `json:"-"`
+	FromUser       string     `json:"fromUser"`
+	ToUser         string     `json:"toUser"`
+	Amount         int64      `json:"amount"`
+	Reason         string     `json:"reason"`
+	Status         string     `json:"status"`
+	CompensationID *uuid.UUID `json:"compensationId,omitempty"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	ResolvedAt     *time.Time `json:"resolvedAt,omitempty"`
+}
+
+type ReversalRequest struct {
+	Reason string `json:"reason"`
+}
@@ -1,7 +1,14 @@
 package models
 
 type User struct {
-	Coin        int64       `json:"coins"`
-	Inventory   []UserItem  `json:"inventory"`
+	Wallet
 	CoinHistory CoinHistory `json:"coinHistory"`
 }
+
+// Wallet — баланс и инвентарь пользователя без истории переводов.
+type Wallet struct {
+	Coin         int64         `json:"coins"`
+	HeldCoins    int64         `json:"heldCoins"`
+	ExpiringSoon ExpiringCoins `json:"expiringSoon"`
+	Inventory    []UserItem    `json:"inventory"`
+}
@@ -0,0 +1,64 @@
+package models
+
+import (
+	"encoding/json"
+	"github.com/google/uuid"
+	"time"
+)
+
+// Типы событий для уведомлений пользователя
+const (
+	EventCoinsReceived     = "coins_received"
+	EventCoinsSent         = "coins_sent"
+	EventPurchaseCompleted = "purchase_completed"
+	EventCoinsGranted      = "coins_granted"
+	EventCoinsExpired      = "coins_expired"
+	EventHoldCreated       = "hold_created"
+	EventHoldCaptured      = "hold_captured"
+	EventHoldReleased      = "hold_released"
+	EventHoldExpired       = "hold_expired"
+)
+
+// UserEvent — событие, адресованное пользователю. Теги совпадают с колонками
+// user_events: в таком виде событие приходит через NOTIFY.
+type UserEvent struct {
+	ID        int64           `json:"id"`
+	UserID    uuid.UUID       `json:"user_id"`
+	Type      string          `json:"type"`
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+type CoinsReceivedEvent struct {
+	TransactionID uuid.UUID  `json:"transactionId"`
+	FromUser      string     `json:"fromUser"`
+	Amount        int64      `json:"amount"`
+	ReversalOf    *uuid.UUID `json:"reversalOf,omitempty"`
+}
+
+type CoinsSentEvent struct {
+	TransactionID uuid.UUID  `json:"transactionId"`
+	ToUser        string     `json:"toUser"`
+	Amount        int64      `json:"amount"`
+	ReversalOf    *uuid.UUID `json:"reversalOf,omitempty"`
+}
+
+type PurchaseCompletedEvent struct {
+	Item  string `json:"item"`
+	Price int64  `json:"price"`
+}
+
+type CoinsGrantedEvent struct {
+	Amount int64 `json:"amount"`
+}
+
+type CoinsExpiredEvent struct {
+	Amount int64 `json:"amount"`
+}
+
+// HoldEvent — событие любого этапа холда: создание, списание, освобождение
+// или истечение срока.
+type HoldEvent struct {
+	HoldID uuid.UUID `json:"holdId"`
+	Amount int64     `json:"amount"`
+}
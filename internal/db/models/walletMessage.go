@@ -0,0 +1,32 @@
+package models
+
+// Типы сообщений WebSocket /api/v2/ws
+const (
+	WalletMessageSnapshot  = "wallet"
+	WalletMessageBalance   = "balance"
+	WalletMessageInventory = "inventory"
+)
+
+// WalletSnapshotMessage — состояние кошелька, отправляется сразу после
+// подключения.
+type WalletSnapshotMessage struct {
+	Type   string `json:"type"`
+	Wallet Wallet `json:"wallet"`
+}
+
+// BalanceMessage отправляется, когда изменился баланс. Reason — тип
+// события, после которого кошелёк был перечитан.
+type BalanceMessage struct {
+	Type         string        `json:"type"`
+	Reason       string        `json:"reason,omitempty"`
+	Coins        int64         `json:"coins"`
+	HeldCoins    int64         `json:"heldCoins"`
+	ExpiringSoon ExpiringCoins `json:"expiringSoon"`
+}
+
+// InventoryMessage отправляется, когда изменился инвентарь.
+type InventoryMessage struct {
+	Type      string     `json:"type"`
+	Reason    string     `json:"reason,omitempty"`
+	Inventory []UserItem `json:"inventory"`
+}
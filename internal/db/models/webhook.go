@@ -0,0 +1,90 @@
+package models
+
+import (
+	"encoding/json"
+	"github.com/google/uuid"
+	"time"
+)
+
+// Типы событий outbox для внешних систем
+const (
+	OutboxTransferCompleted = "transfer.completed"
+	OutboxPurchaseCompleted = "purchase.completed"
+)
+
+const (
+	DeliveryStatusPending   = "pending"
+	DeliveryStatusDelivered = "delivered"
+	DeliveryStatusDead      = "dead"
+)
+
+type Webhook struct {
+	ID  uuid.UUID `json:"id"`
+	URL string    `json:"url"`
+	// Secret отдаётся только при создании
+	Secret     string    `json:"secret,omitempty"`
+	EventTypes []string  `json:"eventTypes"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+type WebhookRequest struct {
+	URL        string   `json:"url"`
+	Secret     string   `json:"secret"`
+	EventTypes []string `json:"eventTypes"`
+}
+
+type WebhookDelivery struct {
+	ID            int64      `json:"id"`
+	WebhookID     uuid.UUID  `json:"webhookId"`
+	EventID       int64      `json:"eventId"`
+	EventType     string     `json:"eventType"`
+	Status        string     `json:"status"`
+	Attempts      int        `json:"attempts"`
+	NextAttemptAt time.Time  `json:"nextAttemptAt"`
+	LastStatus    *int       `json:"lastStatus,omitempty"`
+	LastError     *string    `json:"lastError,omitempty"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	DeliveredAt   *time.Time `json:"deliveredAt,omitempty"`
+}
+
+// ReplayRequest — какие доставки webhook отправить заново. По умолчанию
+// только попавшие в dead letter.
+type ReplayRequest struct {
+	Since            *time.Time `json:"since"`
+	IncludeDelivered bool       `json:"includeDelivered"`
+}
+
+type ReplayResult struct {
+	Replayed int64 `json:"replayed"`
+}
+
+// OutboxEvent — тело запроса к webhook.
+type OutboxEvent struct {
+	ID        int64           `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"createdAt"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// PendingDelivery — доставка, взятая диспетчером в работу.
+type PendingDelivery struct {
+	ID       int64
+	Attempts int
+	URL      string
+	Secret   string
+	Event    OutboxEvent
+}
+
+type TransferOutboxEvent struct {
+	TransactionID uuid.UUID  `json:"transactionId"`
+	FromUser      string     `json:"fromUser"`
+	ToUser        string     `json:"toUser"`
+	Amount        int64      `json:"amount"`
+	ReversalOf    *uuid.UUID `json:"reversalOf,omitempty"`
+}
+
+type PurchaseOutboxEvent struct {
+	User  string `json:"user"`
+	Item  string `json:"item"`
+	Price int64  `json:"price"`
+}
@@ -4,24 +4,132 @@ import (
 	"context"
 	"fmt"
 	"github.com/Ki4EH/stunning-octo-waddle/internal/config"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/logger"
+	"github.com/jackc/pgx/v5/multitracer"
 	"github.com/jackc/pgx/v5/pgxpool"
-	"os"
+	"go.uber.org/zap"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
 )
 
+// Пауза между попытками подключиться при старте
+const (
+	minStartupDelay = 100 * time.Millisecond
+	maxStartupDelay = 5 * time.Second
+)
+
+// NewPostgresDB подключается к primary. Если база ещё не доступна, например
+// контейнер с ней только стартует, попытки повторяются до
+// DATABASE_STARTUP_TIMEOUT.
 func NewPostgresDB(cfg *config.Config) (*pgxpool.Pool, error) {
+	pool, err := newPool(primaryDSN(cfg), cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err = waitReady(context.Background(), pool, cfg.DatabaseStartupTimeout); err != nil {
+		pool.Close()
+		return nil, err
+	}
+	return pool, nil
+}
+
+// NewReplicaPools создаёт пулы реплик из DATABASE_REPLICA_DSNS. Доступность
+// при старте не проверяется: пока реплика не ответит на проверку
+// отставания, чтения идут в primary.
+func NewReplicaPools(cfg *config.Config) ([]*pgxpool.Pool, error) {
+	pools := make([]*pgxpool.Pool, 0, len(cfg.DatabaseReplicaDSNs))
+	for i, dsn := range cfg.DatabaseReplicaDSNs {
+		pool, err := newPool(dsn, cfg)
+		if err != nil {
+			for _, p := range pools {
+				p.Close()
+			}
+			return nil, fmt.Errorf("replica %d: %w", i, err)
+		}
+		pools = append(pools, pool)
+	}
+	return pools, nil
+}
+
+// primaryDSN собирает DSN primary. Логин и пароль экранируются, поэтому
+// могут содержать любые символы.
+func primaryDSN(cfg *config.Config) string {
+	query := url.Values{}
+	query.Set("sslmode", cfg.DatabaseSSLMode)
+	for name, value := range map[string]string{
+		"sslrootcert": cfg.DatabaseSSLRootCert,
+		"sslcert":     cfg.DatabaseSSLCert,
+		"sslkey":      cfg.DatabaseSSLKey,
+	} {
+		if value != "" {
+			query.Set(name, value)
+		}
+	}
 
-	dsn := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?pool_max_conns=20",
-		cfg.DatabaseUser, cfg.DatabasePassword, cfg.DatabaseHost, cfg.DatabasePort, cfg.DatabaseName)
+	dsn := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(cfg.DatabaseUser, cfg.DatabasePassword),
+		Host:     net.JoinHostPort(cfg.DatabaseHost, cfg.DatabasePort),
+		Path:     "/" + cfg.DatabaseName,
+		RawQuery: query.Encode(),
+	}
+	return dsn.String()
+}
 
-	dbpool, err := pgxpool.New(context.Background(), dsn)
+func newPool(dsn string, cfg *config.Config) (*pgxpool.Pool, error) {
+	poolConfig, err := pgxpool.ParseConfig(dsn)
 	if err != nil {
-		return nil, fmt.Errorf("%v Unable to create connection pool: %v\n", os.Stderr, err)
+		return nil, fmt.Errorf("unable to parse database config: %w", err)
+	}
+	poolConfig.MaxConns = int32(cfg.DatabaseMaxConns)
+	poolConfig.MinConns = int32(cfg.DatabaseMinConns)
+	poolConfig.MaxConnLifetime = cfg.DatabaseMaxConnLifetime
+	poolConfig.MaxConnIdleTime = cfg.DatabaseMaxConnIdleTime
+	poolConfig.HealthCheckPeriod = cfg.DatabaseHealthCheckPeriod
+	if cfg.DatabaseConnectTimeout > 0 {
+		poolConfig.ConnConfig.ConnectTimeout = cfg.DatabaseConnectTimeout
 	}
+	if cfg.DatabaseStatementTimeout > 0 {
+		poolConfig.ConnConfig.RuntimeParams["statement_timeout"] = strconv.FormatInt(cfg.DatabaseStatementTimeout.Milliseconds(), 10)
+	}
+
+	slowQueries := newSlowQueryTracer(cfg.SlowQueryThreshold, cfg.SlowQueryExplainRate)
+	poolConfig.ConnConfig.Tracer = multitracer.New(queryTracer{}, slowQueries)
 
-	err = dbpool.Ping(context.Background())
+	dbpool, err := pgxpool.NewWithConfig(context.Background(), poolConfig)
 	if err != nil {
-		return nil, fmt.Errorf("%v Unable to ping database: %v\n", os.Stderr, err)
+		return nil, fmt.Errorf("unable to create connection pool: %w", err)
 	}
+	slowQueries.pool = dbpool
 
 	return dbpool, nil
 }
+
+// waitReady проверяет базу, пока она не ответит или не пройдёт timeout.
+// Пауза между попытками растёт вдвое. При нулевом timeout попытка одна.
+func waitReady(ctx context.Context, pool *pgxpool.Pool, timeout time.Duration) error {
+	if timeout <= 0 {
+		return pool.Ping(ctx)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	delay := minStartupDelay
+	for attempt := 1; ; attempt++ {
+		err := pool.Ping(ctx)
+		if err == nil {
+			return nil
+		}
+		logger.FromContext(ctx).Warn("database is not ready, retrying",
+			zap.Int("attempt", attempt), zap.Duration("retry_in", delay), zap.Error(err))
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("database is not ready after %s: %w", timeout, err)
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxStartupDelay)
+	}
+}
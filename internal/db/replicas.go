@@ -0,0 +1,161 @@
+package db
+
+import (
+	"context"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/logger"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/metrics"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+	"math"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Отставание считается нулевым, если реплика применила все полученные WAL:
+// иначе при простое primary время последней транзакции растёт без конца.
+const replicaLagQuery = `
+	SELECT CASE
+		WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+		ELSE coalesce(extract(epoch FROM now() - pg_last_xact_replay_timestamp()), 0)
+	END`
+
+// ReplicaSet выбирает реплику для чтения данных пользователя. Реплика
+// подходит, если по последней проверке отстаёт не больше maxLag. Пользователь,
+// менявший данные за последние window, читает с primary, чтобы увидеть свои
+// изменения.
+type ReplicaSet struct {
+	replicas []*replica
+	maxLag   time.Duration
+	window   time.Duration
+	next     atomic.Uint64
+
+	mu     sync.Mutex
+	writes map[uuid.UUID]time.Time
+}
+
+type replica struct {
+	pool *pgxpool.Pool
+	name string
+	// Отставание в наносекундах, math.MaxInt64 — реплика не проверена или
+	// недоступна
+	lag atomic.Int64
+}
+
+// NewReplicaSet создаёт набор реплик. До первой проверки в Run все чтения
+// идут на primary.
+func NewReplicaSet(pools []*pgxpool.Pool, maxLag, window time.Duration) *ReplicaSet {
+	s := &ReplicaSet{
+		maxLag: maxLag,
+		window: window,
+		writes: make(map[uuid.UUID]time.Time),
+	}
+	for i, pool := range pools {
+		r := &replica{pool: pool, name: strconv.Itoa(i)}
+		r.lag.Store(math.MaxInt64)
+		s.replicas = append(s.replicas, r)
+	}
+	return s
+}
+
+// Replica возвращает номер реплики для чтения данных userID или -1, если
+// читать нужно с primary. Подходящие реплики выбираются по очереди.
+func (s *ReplicaSet) Replica(userID uuid.UUID) int {
+	if s.wroteRecently(userID, time.Now()) {
+		metrics.ReplicaReads.WithLabelValues("recent_write").Inc()
+		return -1
+	}
+
+	start := s.next.Add(1)
+	for i := range s.replicas {
+		n := int((start + uint64(i)) % uint64(len(s.replicas)))
+		if time.Duration(s.replicas[n].lag.Load()) <= s.maxLag {
+			metrics.ReplicaReads.WithLabelValues("replica").Inc()
+			return n
+		}
+	}
+	metrics.ReplicaReads.WithLabelValues("lagging").Inc()
+	return -1
+}
+
+// Wrote отмечает, что данные пользователей изменились на primary.
+func (s *ReplicaSet) Wrote(userIDs ...uuid.UUID) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range userIDs {
+		s.writes[id] = now
+	}
+}
+
+func (s *ReplicaSet) wroteRecently(userID uuid.UUID, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	at, ok := s.writes[userID]
+	return ok && now.Sub(at) < s.window
+}
+
+// Run проверяет отставание реплик каждые interval и забывает записи старше
+// window.
+func (s *ReplicaSet) Run(ctx context.Context, interval time.Duration, log logger.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		s.check(ctx, log)
+		s.forget(time.Now())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *ReplicaSet) check(ctx context.Context, log logger.Logger) {
+	for _, r := range s.replicas {
+		var seconds float64
+		if err := r.pool.QueryRow(ctx, replicaLagQuery).Scan(&seconds); err != nil {
+			if ctx.Err() == nil && r.lag.Swap(math.MaxInt64) != math.MaxInt64 {
+				log.Warn("replica unavailable, reading from primary", zap.String("replica", r.name), zap.Error(err))
+			}
+			metrics.ReplicaLag.WithLabelValues(r.name).Set(-1)
+			continue
+		}
+
+		lag := time.Duration(seconds * float64(time.Second))
+		if r.lag.Swap(int64(lag)) > int64(s.maxLag) && lag <= s.maxLag {
+			log.Info("replica caught up", zap.String("replica", r.name), zap.Duration("lag", lag))
+		}
+		metrics.ReplicaLag.WithLabelValues(r.name).Set(seconds)
+	}
+}
+
+func (s *ReplicaSet) forget(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, at := range s.writes {
+		if now.Sub(at) >= s.window {
+			delete(s.writes, id)
+		}
+	}
+}
+
+// Pools возвращает пулы реплик в порядке их номеров.
+func (s *ReplicaSet) Pools() []*pgxpool.Pool {
+	pools := make([]*pgxpool.Pool, 0, len(s.replicas))
+	for _, r := range s.replicas {
+		pools = append(pools, r.pool)
+	}
+	return pools
+}
+
+// Close закрывает пулы реплик.
+func (s *ReplicaSet) Close() {
+	for _, r := range s.replicas {
+		r.pool.Close()
+	}
+}
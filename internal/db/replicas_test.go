@@ -0,0 +1,68 @@
+package db
+
+import (
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestReplicaSet(t *testing.T) {
+	// Пулы не нужны: отставание выставляется вручную вместо проверки
+	newSet := func(lags ...time.Duration) *ReplicaSet {
+		s := NewReplicaSet(make([]*pgxpool.Pool, len(lags)), time.Second, time.Minute)
+		for i, lag := range lags {
+			s.replicas[i].lag.Store(int64(lag))
+		}
+		return s
+	}
+	userID := uuid.New()
+
+	t.Run("unchecked replicas are not used", func(t *testing.T) {
+		s := NewReplicaSet(make([]*pgxpool.Pool, 2), time.Second, time.Minute)
+		assert.Equal(t, -1, s.Replica(userID))
+	})
+
+	t.Run("fresh replicas are used in turn", func(t *testing.T) {
+		s := newSet(0, 500*time.Millisecond)
+		picked := map[int]int{}
+		for i := 0; i < 10; i++ {
+			picked[s.Replica(userID)]++
+		}
+		assert.Equal(t, map[int]int{0: 5, 1: 5}, picked)
+	})
+
+	t.Run("lagging replica is skipped", func(t *testing.T) {
+		s := newSet(2*time.Second, 0)
+		for i := 0; i < 4; i++ {
+			assert.Equal(t, 1, s.Replica(userID))
+		}
+	})
+
+	t.Run("primary when all replicas lag", func(t *testing.T) {
+		s := newSet(2*time.Second, time.Minute)
+		assert.Equal(t, -1, s.Replica(userID))
+	})
+
+	t.Run("user reads own writes from primary", func(t *testing.T) {
+		s := newSet(0)
+		other := uuid.New()
+		s.Wrote(userID)
+
+		assert.Equal(t, -1, s.Replica(userID))
+		assert.Equal(t, 0, s.Replica(other))
+	})
+
+	t.Run("writes are forgotten after window", func(t *testing.T) {
+		s := newSet(0)
+		s.Wrote(userID)
+
+		s.forget(time.Now())
+		assert.Len(t, s.writes, 1)
+
+		s.forget(time.Now().Add(time.Minute))
+		assert.Empty(t, s.writes)
+		assert.Equal(t, 0, s.Replica(userID))
+	})
+}
@@ -0,0 +1,120 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/models"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/metrics"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"sync"
+	"sync/atomic"
+)
+
+// CatalogChannel — канал LISTEN/NOTIFY, в который триггер на shops
+// отправляет новую версию каталога.
+const CatalogChannel = "catalog_changes"
+
+// CatalogSnapshot — каталог магазина на момент версии Version.
+type CatalogSnapshot struct {
+	Version int64
+	Items   map[string]models.Shop
+}
+
+// Catalog держит копию каталога в памяти, чтобы покупка не читала shops.
+// Копия обновляется через Refresh по уведомлениям из CatalogChannel, а
+// покупка при списании сверяет версию и при расхождении повторяется с ценой
+// из базы, поэтому смена цены не пропускается, даже если уведомление опоздало.
+type Catalog struct {
+	db      *pgxpool.Pool
+	mu      sync.Mutex
+	current atomic.Pointer[CatalogSnapshot]
+}
+
+func NewCatalog(db *pgxpool.Pool) *Catalog {
+	return &Catalog{db: db}
+}
+
+// Refresh перечитывает каталог. Версия и товары читаются одним запросом,
+// то есть из одного снимка базы.
+func (c *Catalog) Refresh(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	rows, err := c.db.Query(ctx, `
+		SELECT v.version, s.item, s.price
+		FROM catalog_version v
+		LEFT JOIN shops s ON true`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	snapshot := &CatalogSnapshot{Items: make(map[string]models.Shop)}
+	for rows.Next() {
+		var item *string
+		var price *int64
+		if err = rows.Scan(&snapshot.Version, &item, &price); err != nil {
+			return err
+		}
+		// Пустой каталог — одна строка с версией без товара
+		if item != nil {
+			snapshot.Items[*item] = models.Shop{Item: *item, Price: *price}
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	c.current.Store(snapshot)
+	return nil
+}
+
+// Snapshot возвращает последнюю загруженную версию каталога или nil, если
+// каталог ещё не загружен.
+func (c *Catalog) Snapshot() *CatalogSnapshot {
+	if c == nil {
+		return nil
+	}
+	return c.current.Load()
+}
+
+// errCatalogChanged — версия каталога сменилась после того, как покупка
+// взяла цену из копии.
+var errCatalogChanged = errors.New("catalog changed during purchase")
+
+// shopItem возвращает товар из копии каталога snapshot или из shops, если
+// копии нет. Совпадение версии копии с базой проверяет chargeUser при
+// списании. Товар, которого нет в копии, ищется в shops: он мог появиться
+// после её загрузки.
+func (r *coinRepository) shopItem(ctx context.Context, tx pgx.Tx, itemName string, snapshot *CatalogSnapshot) (*models.Shop, error) {
+	if snapshot == nil {
+		return r.getShopItem(ctx, tx, itemName)
+	}
+	shop, ok := snapshot.Items[itemName]
+	if !ok {
+		return r.getShopItem(ctx, tx, itemName)
+	}
+	return &shop, nil
+}
+
+// chargeCatalogPrice списывает цену, взятую из копии каталога, только если
+// версия каталога в базе всё ещё совпадает с версией копии. Иначе возвращает
+// errCatalogChanged, и покупка повторяется с ценой из базы.
+func (r *coinRepository) chargeCatalogPrice(ctx context.Context, tx pgx.Tx, userID uuid.UUID, price int64, snapshot *CatalogSnapshot) error {
+	tag, err := tx.Exec(ctx, `
+		UPDATE credentials SET coin = coin - $1
+		WHERE id = $2 AND (SELECT version FROM catalog_version) = $3`,
+		price, userID, snapshot.Version)
+	if err != nil {
+		return fmt.Errorf("failed to update user balance: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		metrics.CatalogLookups.WithLabelValues("stale").Inc()
+		return errCatalogChanged
+	}
+	metrics.CatalogLookups.WithLabelValues("cached").Inc()
+	return nil
+}
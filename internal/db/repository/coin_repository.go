@@ -5,65 +5,103 @@ import (
 	"errors"
 	"fmt"
 	"github.com/Ki4EH/stunning-octo-waddle/internal/db/models"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/logger"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+	"math/rand/v2"
+	"time"
+)
+
+const (
+	maxTxAttempts  = 5
+	retryBaseDelay = 10 * time.Millisecond
+
+	// Коды ошибок PostgreSQL, после которых транзакцию можно повторить
+	serializationFailure = "40001"
+	deadlockDetected     = "40P01"
 )
 
 type CoinRepository interface {
 	BuyItemFromShop(ctx context.Context, userID uuid.UUID, itemName string) error
 	SendCoins(ctx context.Context, fromUserID, toUserID uuid.UUID, amount int64) error
 	GetTransactions(ctx context.Context, userID uuid.UUID, transactions *[]models.Transaction) error
+	GetHistory(ctx context.Context, userID uuid.UUID, limit int, after *models.HistoryCursor) ([]models.HistoryEntry, error)
+	RequestReversal(ctx context.Context, transactionID, requestedBy uuid.UUID, reason string) (*models.TransferReversal, error)
+	ApproveReversal(ctx context.Context, reversalID, approvedBy uuid.UUID) (*models.TransferReversal, error)
+	RejectReversal(ctx context.Context, reversalID, rejectedBy uuid.UUID) (*models.TransferReversal, error)
+	ForceReversal(ctx context.Context, transactionID, adminID uuid.UUID, reason string) (*models.TransferReversal, error)
+	GetReversals(ctx context.Context, userID uuid.UUID, reversals *[]models.TransferReversal) error
+	GetTransferLimits(ctx context.Context, userID uuid.UUID) (*models.UserTransferLimits, error)
+	SetTransferLimits(ctx context.Context, userID, adminID uuid.UUID, override models.TransferLimitsOverride) (*models.UserTransferLimits, error)
+	GrantCoins(ctx context.Context, userID uuid.UUID, amount int64) error
+	GetExpiringCoins(ctx context.Context, userID uuid.UUID) (*models.ExpiringCoins, error)
+	ExpireLots(ctx context.Context) (int64, error)
+	HoldCoins(ctx context.Context, userID, createdBy uuid.UUID, request models.HoldRequest) (*models.CoinHold, error)
+	CaptureHold(ctx context.Context, holdID uuid.UUID) (*models.CoinHold, error)
+	ReleaseHold(ctx context.Context, holdID uuid.UUID) (*models.CoinHold, error)
+	ReleaseExpiredHolds(ctx context.Context) (int64, error)
+}
+
+// CoinOptions задаёт правила экономики: лимиты переводов, срок жизни монет
+// и холдов. Нулевые сроки заменяются значениями по умолчанию. Без Catalog
+// цена читается из shops при каждой покупке.
+type CoinOptions struct {
+	Limits        models.TransferLimits
+	CoinLifetime  time.Duration
+	ExpiryWarning time.Duration
+	HoldTTL       time.Duration
+	Catalog       *Catalog
 }
 
 type coinRepository struct {
-	db *pgxpool.Pool
+	db   *pgxpool.Pool
+	opts CoinOptions
 }
 
-func NewCoinRepository(db *pgxpool.Pool) CoinRepository {
+func NewCoinRepository(db *pgxpool.Pool, opts CoinOptions) CoinRepository {
 	return &coinRepository{
-		db: db,
+		db:   db,
+		opts: opts,
 	}
 }
 
 func (r *coinRepository) BuyItemFromShop(ctx context.Context, userID uuid.UUID, itemName string) error {
-	conn, err := r.db.Acquire(ctx)
-	if err != nil {
+	snapshot := r.opts.Catalog.Snapshot()
+	err := r.withTx(ctx, func(tx pgx.Tx) error {
+		return r.processTransaction(ctx, tx, userID, itemName, snapshot)
+	})
+	if !errors.Is(err, errCatalogChanged) {
 		return err
 	}
-	defer conn.Release()
 
-	tx, err := conn.Begin(ctx)
-	if err != nil {
-		return err
+	// Копия каталога отстала: она перечитывается для следующих покупок, а эта
+	// повторяется один раз с ценой из shops
+	if err = r.opts.Catalog.Refresh(ctx); err != nil {
+		logger.FromContext(ctx).Warn("failed to refresh catalog", zap.Error(err))
 	}
+	return r.withTx(ctx, func(tx pgx.Tx) error {
+		return r.processTransaction(ctx, tx, userID, itemName, nil)
+	})
+}
 
-	defer func() {
-		if rec := recover(); rec != nil {
-			tx.Rollback(ctx)
-		}
-	}()
-
-	if err = r.processTransaction(ctx, tx, userID, itemName); err != nil {
-		tx.Rollback(ctx)
+func (r *coinRepository) processTransaction(ctx context.Context, tx pgx.Tx, userID uuid.UUID, itemName string, snapshot *CatalogSnapshot) error {
+	if err := lockAccounts(ctx, tx, userID); err != nil {
 		return err
 	}
 
-	if err = tx.Commit(ctx); err != nil {
-		tx.Rollback(ctx)
-		return errors.New("failed to commit transaction")
+	if _, _, err := r.expireLots(ctx, tx, &userID, expireBatchSize); err != nil {
+		return err
 	}
 
-	return nil
-}
-
-func (r *coinRepository) processTransaction(ctx context.Context, tx pgx.Tx, userID uuid.UUID, itemName string) error {
 	user, err := r.getUser(ctx, tx, userID)
 	if err != nil {
 		return err
 	}
 
-	shop, err := r.getShopItem(ctx, tx, itemName)
+	shop, err := r.shopItem(ctx, tx, itemName, snapshot)
 	if err != nil {
 		return err
 	}
@@ -72,7 +110,16 @@ func (r *coinRepository) processTransaction(ctx context.Context, tx pgx.Tx, user
 		return err
 	}
 
-	if err = r.updateUserBalance(ctx, tx, user, shop.Price); err != nil {
+	if snapshot != nil {
+		err = r.chargeCatalogPrice(ctx, tx, userID, shop.Price, snapshot)
+	} else {
+		err = r.updateUserBalance(ctx, tx, user, shop.Price)
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err = r.consumeLots(ctx, tx, userID, shop.Price); err != nil {
 		return err
 	}
 
@@ -80,16 +127,28 @@ func (r *coinRepository) processTransaction(ctx context.Context, tx pgx.Tx, user
 		return err
 	}
 
-	return nil
+	err = recordEvent(ctx, tx, userID, models.EventPurchaseCompleted, models.PurchaseCompletedEvent{
+		Item:  shop.Item,
+		Price: shop.Price,
+	})
+	if err != nil {
+		return err
+	}
+
+	return writeOutbox(ctx, tx, models.OutboxPurchaseCompleted, models.PurchaseOutboxEvent{
+		User:  user.Username,
+		Item:  shop.Item,
+		Price: shop.Price,
+	})
 }
 
 func (r *coinRepository) getUser(ctx context.Context, tx pgx.Tx, userID uuid.UUID) (*models.Credential, error) {
 	var user models.Credential
-	err := tx.QueryRow(ctx, "SELECT id, username, coin FROM credentials WHERE id = $1", userID).
-		Scan(&user.ID, &user.Username, &user.Coin)
+	err := tx.QueryRow(ctx, "SELECT id, username, coin, "+heldCoinsColumn+" FROM credentials WHERE id = $1", userID).
+		Scan(&user.ID, &user.Username, &user.Coin, &user.Held)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			return nil, errors.New("user not found")
+			return nil, ErrUserNotFound
 		}
 		return nil, err
 	}
@@ -98,11 +157,11 @@ func (r *coinRepository) getUser(ctx context.Context, tx pgx.Tx, userID uuid.UUI
 
 func (r *coinRepository) getShopItem(ctx context.Context, tx pgx.Tx, itemName string) (*models.Shop, error) {
 	var shop models.Shop
-	err := tx.QueryRow(ctx, "SELECT item, price FROM shops WHERE item = $1", itemName).
+	err := tx.QueryRow(ctx, "SELECT item, price FROM shops WHERE item = $1 FOR SHARE", itemName).
 		Scan(&shop.Item, &shop.Price)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			return nil, errors.New("item not found")
+			return nil, ErrItemNotFound
 		}
 		return nil, err
 	}
@@ -110,8 +169,8 @@ func (r *coinRepository) getShopItem(ctx context.Context, tx pgx.Tx, itemName st
 }
 
 func (r *coinRepository) validateBalance(user *models.Credential, price int64) error {
-	if user.Coin < price {
-		return errors.New("insufficient balance")
+	if user.Coin-user.Held < price {
+		return ErrInsufficientBalance
 	}
 	return nil
 }
@@ -119,7 +178,7 @@ func (r *coinRepository) validateBalance(user *models.Credential, price int64) e
 func (r *coinRepository) updateUserBalance(ctx context.Context, tx pgx.Tx, user *models.Credential, price int64) error {
 	_, err := tx.Exec(ctx, "UPDATE credentials SET coin = coin - $1 WHERE id = $2", price, user.ID)
 	if err != nil {
-		return errors.New("failed to update user balance")
+		return fmt.Errorf("failed to update user balance: %w", err)
 	}
 	return nil
 }
@@ -132,22 +191,57 @@ func (r *coinRepository) updateUserInventory(ctx context.Context, tx pgx.Tx, use
 		if errors.Is(err, pgx.ErrNoRows) {
 			_, err = tx.Exec(ctx, "INSERT INTO user_items (user_id, type, quantity) VALUES ($1, $2, $3)", userID, itemType, 1)
 			if err != nil {
-				return errors.New("failed to add item to inventory")
+				return fmt.Errorf("failed to add item to inventory: %w", err)
 			}
 			return nil
 		}
-		return errors.New("failed to check user inventory")
+		return fmt.Errorf("failed to check user inventory: %w", err)
 	}
 
 	_, err = tx.Exec(ctx, "UPDATE user_items SET quantity = quantity + 1 WHERE user_id = $1 AND type = $2", userID, itemType)
 	if err != nil {
-		return fmt.Errorf("failed to update item quantity: %v", err)
+		return fmt.Errorf("failed to update item quantity: %w", err)
 	}
 
 	return nil
 }
 
 func (r *coinRepository) SendCoins(ctx context.Context, fromUserID, toUserID uuid.UUID, amount int64) error {
+	if amount <= 0 {
+		return ErrInvalidAmount
+	}
+	if fromUserID == toUserID {
+		return ErrSelfTransfer
+	}
+	return r.withTx(ctx, func(tx pgx.Tx) error {
+		if err := r.checkTransferLimits(ctx, tx, fromUserID, toUserID, amount); err != nil {
+			return err
+		}
+		_, err := r.transfer(ctx, tx, fromUserID, toUserID, amount, nil)
+		return err
+	})
+}
+
+// withTx выполняет fn в транзакции. При конфликте сериализации или взаимной
+// блокировке транзакция целиком повторяется с небольшой случайной паузой.
+func (r *coinRepository) withTx(ctx context.Context, fn func(tx pgx.Tx) error) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = r.runTx(ctx, fn)
+		if err == nil || !isRetryable(err) || attempt == maxTxAttempts {
+			return err
+		}
+		logger.FromContext(ctx).Warn("retrying transaction", zap.Int("attempt", attempt), zap.Error(err))
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(retryDelay(attempt)):
+		}
+	}
+}
+
+func (r *coinRepository) runTx(ctx context.Context, fn func(tx pgx.Tx) error) error {
 	conn, err := r.db.Acquire(ctx)
 	if err != nil {
 		return err
@@ -161,49 +255,138 @@ func (r *coinRepository) SendCoins(ctx context.Context, fromUserID, toUserID uui
 	defer func() {
 		if rec := recover(); rec != nil {
 			tx.Rollback(ctx)
+			panic(rec)
 		}
 	}()
 
-	var fromUser models.Credential
-	err = tx.QueryRow(ctx, "SELECT id, coin FROM credentials WHERE id = $1", fromUserID).
-		Scan(&fromUser.ID, &fromUser.Coin)
-	if err != nil {
+	if err = fn(tx); err != nil {
 		tx.Rollback(ctx)
-		return errors.New("sender not found")
+		return err
 	}
-	if fromUser.Coin < amount {
+
+	if err = tx.Commit(ctx); err != nil {
 		tx.Rollback(ctx)
-		return errors.New("insufficient balance")
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// lockAccounts блокирует строки пользователей в порядке id. Единый порядок
+// исключает взаимные блокировки встречных переводов.
+func lockAccounts(ctx context.Context, tx pgx.Tx, userIDs ...uuid.UUID) error {
+	_, err := tx.Exec(ctx, "SELECT id FROM credentials WHERE id = ANY($1::uuid[]) ORDER BY id FOR UPDATE", userIDs)
+	if err != nil {
+		return fmt.Errorf("failed to lock accounts: %w", err)
+	}
+	return nil
+}
+
+func isRetryable(err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+	return pgErr.Code == serializationFailure || pgErr.Code == deadlockDetected
+}
+
+func retryDelay(attempt int) time.Duration {
+	backoff := retryBaseDelay << (attempt - 1)
+	return backoff/2 + rand.N(backoff/2+1)
+}
+
+// transfer переводит монеты между пользователями в рамках транзакции tx.
+// Для компенсирующих переводов reversalOf указывает на исходную транзакцию.
+func (r *coinRepository) transfer(ctx context.Context, tx pgx.Tx, fromUserID, toUserID uuid.UUID, amount int64, reversalOf *uuid.UUID) (uuid.UUID, error) {
+	if err := lockAccounts(ctx, tx, fromUserID, toUserID); err != nil {
+		return uuid.Nil, err
+	}
+
+	if _, _, err := r.expireLots(ctx, tx, &fromUserID, expireBatchSize); err != nil {
+		return uuid.Nil, err
+	}
+
+	var fromUser models.Credential
+	err := tx.QueryRow(ctx, "SELECT id, username, coin, "+heldCoinsColumn+" FROM credentials WHERE id = $1", fromUserID).
+		Scan(&fromUser.ID, &fromUser.Username, &fromUser.Coin, &fromUser.Held)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return uuid.Nil, ErrSenderNotFound
+		}
+		return uuid.Nil, err
+	}
+	if fromUser.Coin-fromUser.Held < amount {
+		return uuid.Nil, ErrInsufficientBalance
 	}
 
 	_, err = tx.Exec(ctx, "UPDATE credentials SET coin = coin - $1 WHERE id = $2", amount, fromUserID)
 	if err != nil {
-		tx.Rollback(ctx)
-		return errors.New("failed to update sender balance")
+		return uuid.Nil, fmt.Errorf("failed to update sender balance: %w", err)
 	}
 
-	_, err = tx.Exec(ctx, "UPDATE credentials SET coin = coin + $1 WHERE id = $2", amount, toUserID)
+	var toUsername string
+	err = tx.QueryRow(ctx, "UPDATE credentials SET coin = coin + $1 WHERE id = $2 RETURNING username", amount, toUserID).
+		Scan(&toUsername)
 	if err != nil {
-		tx.Rollback(ctx)
-		return errors.New("failed to update receiver balance")
+		if errors.Is(err, pgx.ErrNoRows) {
+			return uuid.Nil, ErrReceiverNotFound
+		}
+		return uuid.Nil, fmt.Errorf("failed to update receiver balance: %w", err)
 	}
 
-	_, err = tx.Exec(ctx, "INSERT INTO transactions (from_user, to_user, amount) VALUES ($1, $2, $3)", fromUserID, toUserID, amount)
+	// Получатель забирает монеты вместе с их сроком действия
+	portions, err := r.consumeLots(ctx, tx, fromUserID, amount)
 	if err != nil {
-		tx.Rollback(ctx)
-		return fmt.Errorf("failed to record transaction: %v", err)
+		return uuid.Nil, err
+	}
+	if err = r.grantLots(ctx, tx, toUserID, portions); err != nil {
+		return uuid.Nil, err
 	}
 
-	if err = tx.Commit(ctx); err != nil {
-		tx.Rollback(ctx)
-		return errors.New("failed to commit transaction")
+	var transactionID uuid.UUID
+	err = tx.QueryRow(ctx, "INSERT INTO transactions (from_user, to_user, amount, reversal_of) VALUES ($1, $2, $3, $4) RETURNING id",
+		fromUserID, toUserID, amount, reversalOf).Scan(&transactionID)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to record transaction: %w", err)
 	}
-	return nil
+
+	err = recordEvent(ctx, tx, toUserID, models.EventCoinsReceived, models.CoinsReceivedEvent{
+		TransactionID: transactionID,
+		FromUser:      fromUser.Username,
+		Amount:        amount,
+		ReversalOf:    reversalOf,
+	})
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	err = recordEvent(ctx, tx, fromUserID, models.EventCoinsSent, models.CoinsSentEvent{
+		TransactionID: transactionID,
+		ToUser:        toUsername,
+		Amount:        amount,
+		ReversalOf:    reversalOf,
+	})
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	err = writeOutbox(ctx, tx, models.OutboxTransferCompleted, models.TransferOutboxEvent{
+		TransactionID: transactionID,
+		FromUser:      fromUser.Username,
+		ToUser:        toUsername,
+		Amount:        amount,
+		ReversalOf:    reversalOf,
+	})
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	return transactionID, nil
 }
 
 func (r *coinRepository) GetTransactions(ctx context.Context, userID uuid.UUID, transactions *[]models.Transaction) error {
 	query := `
-		SELECT t.id, cf.username AS from_user, ct.username AS to_user, t.amount
+		SELECT t.id, cf.username AS from_user, ct.username AS to_user, t.amount,
+		       t.reversed_at IS NOT NULL AS reversed, t.reversal_of
 		FROM transactions t
 		JOIN credentials cf ON t.from_user = cf.id
 		JOIN credentials ct ON t.to_user = ct.id
@@ -218,7 +401,7 @@ func (r *coinRepository) GetTransactions(ctx context.Context, userID uuid.UUID,
 
 	for rows.Next() {
 		var t models.Transaction
-		if err = rows.Scan(&t.ID, &t.FromUser, &t.ToUser, &t.Amount); err != nil {
+		if err = rows.Scan(&t.ID, &t.FromUser, &t.ToUser, &t.Amount, &t.Reversed, &t.ReversalOf); err != nil {
 			return err
 		}
 		*transactions = append(*transactions, t)
@@ -226,3 +409,44 @@ func (r *coinRepository) GetTransactions(ctx context.Context, userID uuid.UUID,
 
 	return nil
 }
+
+// GetHistory возвращает до limit переводов пользователя от новых к старым,
+// начиная после курсора after.
+func (r *coinRepository) GetHistory(ctx context.Context, userID uuid.UUID, limit int, after *models.HistoryCursor) ([]models.HistoryEntry, error) {
+	query := `
+		SELECT t.id,
+		       CASE WHEN t.to_user = $1 THEN 'received' ELSE 'sent' END,
+		       CASE WHEN t.to_user = $1 THEN cf.username ELSE ct.username END,
+		       t.amount, t.reversed_at IS NOT NULL, t.reversal_of, t.created_at
+		FROM transactions t
+		JOIN credentials cf ON t.from_user = cf.id
+		JOIN credentials ct ON t.to_user = ct.id
+		WHERE (t.from_user = $1 OR t.to_user = $1)
+		  AND ($2::timestamptz IS NULL OR (t.created_at, t.id) < ($2::timestamptz, $3::uuid))
+		ORDER BY t.created_at DESC, t.id DESC
+		LIMIT $4
+	`
+
+	var afterTime *time.Time
+	var afterID *uuid.UUID
+	if after != nil {
+		afterTime, afterID = &after.CreatedAt, &after.ID
+	}
+
+	rows, err := r.db.Query(ctx, query, userID, afterTime, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := make([]models.HistoryEntry, 0, limit)
+	for rows.Next() {
+		var e models.HistoryEntry
+		if err = rows.Scan(&e.ID, &e.Direction, &e.Counterparty, &e.Amount, &e.Reversed, &e.ReversalOf, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, rows.Err()
+}
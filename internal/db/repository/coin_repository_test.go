@@ -9,7 +9,11 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/mock/gomock"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestInterfaceBuyItemFromShop(t *testing.T) {
@@ -33,10 +37,10 @@ func TestInterfaceBuyItemFromShop(t *testing.T) {
 	t.Run("item not found", func(t *testing.T) {
 		mockRepo.EXPECT().
 			BuyItemFromShop(ctx, userID, "invalid_item").
-			Return(errors.New("item not found"))
+			Return(ErrItemNotFound)
 
 		err := mockRepo.BuyItemFromShop(ctx, userID, "invalid_item")
-		assert.ErrorContains(t, err, "item not found")
+		assert.ErrorIs(t, err, ErrItemNotFound)
 	})
 }
 
@@ -62,10 +66,10 @@ func TestInterfaceSendCoins(t *testing.T) {
 	t.Run("insufficient balance", func(t *testing.T) {
 		mockRepo.EXPECT().
 			SendCoins(ctx, fromUser, toUser, amount).
-			Return(errors.New("insufficient balance"))
+			Return(ErrInsufficientBalance)
 
 		err := mockRepo.SendCoins(ctx, fromUser, toUser, amount)
-		assert.ErrorContains(t, err, "insufficient balance")
+		assert.ErrorIs(t, err, ErrInsufficientBalance)
 	})
 }
 
@@ -162,7 +166,7 @@ func TestBuyItemFromShop(t *testing.T) {
 		require.NoError(t, err)
 
 		err = repo.BuyItemFromShop(ctx, userID, itemName)
-		require.ErrorContains(t, err, "insufficient balance")
+		require.ErrorIs(t, err, ErrInsufficientBalance)
 	})
 }
 
@@ -213,7 +217,7 @@ func TestSendCoins(t *testing.T) {
 		require.NoError(t, err)
 
 		err = repo.SendCoins(ctx, fromUser, toUser, amount)
-		require.ErrorContains(t, err, "insufficient balance")
+		require.ErrorIs(t, err, ErrInsufficientBalance)
 	})
 }
 
@@ -255,3 +259,469 @@ func TestGetTransactions(t *testing.T) {
 		require.Equal(t, int64(50), txMap[user2.String()+user1.String()].Amount)
 	})
 }
+
+func TestGetHistory(t *testing.T) {
+	repo, ctx := setupCoin(t)
+
+	user1 := uuid.New()
+	user2 := uuid.New()
+	_, err := repo.db.Exec(ctx, `
+		INSERT INTO credentials (id, username, password)
+		VALUES ($1, $2, 'user1'), ($3, $4, 'user2')
+	`, user1, user1.String(), user2, user2.String())
+	require.NoError(t, err)
+
+	// Две записи с одинаковым временем проверяют, что курсор учитывает id
+	_, err = repo.db.Exec(ctx, `
+		INSERT INTO transactions (from_user, to_user, amount, created_at)
+		VALUES ($1, $2, 1, now() - interval '2 minutes'),
+		       ($2, $1, 2, now() - interval '1 minute'),
+		       ($1, $2, 3, now() - interval '1 minute'),
+		       ($1, $2, 4, now())
+	`, user1, user2)
+	require.NoError(t, err)
+
+	var seen []models.HistoryEntry
+	var after *models.HistoryCursor
+	for {
+		page, err := repo.GetHistory(ctx, user1, 3, after)
+		require.NoError(t, err)
+		seen = append(seen, page...)
+		if len(page) < 3 {
+			break
+		}
+		last := page[len(page)-1]
+		after = &models.HistoryCursor{CreatedAt: last.CreatedAt, ID: last.ID}
+	}
+
+	require.Len(t, seen, 4)
+	require.Equal(t, int64(4), seen[0].Amount)
+	require.Equal(t, int64(1), seen[3].Amount)
+	for i, entry := range seen {
+		require.Equal(t, user2.String(), entry.Counterparty)
+		if entry.Amount == 2 {
+			require.Equal(t, models.HistoryReceived, entry.Direction)
+		} else {
+			require.Equal(t, models.HistorySent, entry.Direction)
+		}
+		if i > 0 {
+			require.False(t, entry.CreatedAt.After(seen[i-1].CreatedAt))
+		}
+	}
+}
+
+func TestReversal(t *testing.T) {
+	repo, ctx := setupCoin(t)
+
+	createPair := func(t *testing.T, senderCoin, receiverCoin int64) (uuid.UUID, uuid.UUID) {
+		fromUser := uuid.New()
+		toUser := uuid.New()
+		_, err := repo.db.Exec(ctx, `
+            INSERT INTO credentials (id, username, password, coin)
+            VALUES ($1, $2, 'pass', $3), ($4, $5, 'pass', $6)
+        `, fromUser, fromUser.String(), senderCoin, toUser, toUser.String(), receiverCoin)
+		require.NoError(t, err)
+		return fromUser, toUser
+	}
+
+	lastTransaction := func(t *testing.T, fromUser uuid.UUID) uuid.UUID {
+		var id uuid.UUID
+		err := repo.db.QueryRow(ctx, "SELECT id FROM transactions WHERE from_user = $1", fromUser).Scan(&id)
+		require.NoError(t, err)
+		return id
+	}
+
+	t.Run("recipient approves reversal", func(t *testing.T) {
+		fromUser, toUser := createPair(t, 100, 0)
+		require.NoError(t, repo.SendCoins(ctx, fromUser, toUser, 40))
+		transactionID := lastTransaction(t, fromUser)
+
+		reversal, err := repo.RequestReversal(ctx, transactionID, fromUser, "wrong recipient")
+		require.NoError(t, err)
+		require.Equal(t, "pending", reversal.Status)
+
+		_, err = repo.RequestReversal(ctx, transactionID, fromUser, "again")
+		require.ErrorIs(t, err, ErrReversalAlreadyExists)
+
+		reversal, err = repo.ApproveReversal(ctx, reversal.ID, toUser)
+		require.NoError(t, err)
+		require.Equal(t, "approved", reversal.Status)
+		require.NotNil(t, reversal.CompensationID)
+
+		var fromBalance, toBalance int64
+		require.NoError(t, repo.db.QueryRow(ctx, "SELECT coin FROM credentials WHERE id = $1", fromUser).Scan(&fromBalance))
+		require.NoError(t, repo.db.QueryRow(ctx, "SELECT coin FROM credentials WHERE id = $1", toUser).Scan(&toBalance))
+		require.Equal(t, int64(100), fromBalance)
+		require.Equal(t, int64(0), toBalance)
+
+		var transactions []models.Transaction
+		require.NoError(t, repo.GetTransactions(ctx, fromUser, &transactions))
+		require.Len(t, transactions, 2)
+		for _, tx := range transactions {
+			if tx.ID == transactionID {
+				require.True(t, tx.Reversed)
+			} else {
+				require.Equal(t, &transactionID, tx.ReversalOf)
+			}
+		}
+	})
+
+	t.Run("only sender can request and only recipient can approve", func(t *testing.T) {
+		fromUser, toUser := createPair(t, 100, 0)
+		require.NoError(t, repo.SendCoins(ctx, fromUser, toUser, 40))
+		transactionID := lastTransaction(t, fromUser)
+
+		_, err := repo.RequestReversal(ctx, transactionID, toUser, "")
+		require.ErrorIs(t, err, ErrNotTransactionSender)
+
+		reversal, err := repo.RequestReversal(ctx, transactionID, fromUser, "")
+		require.NoError(t, err)
+
+		_, err = repo.ApproveReversal(ctx, reversal.ID, fromUser)
+		require.ErrorIs(t, err, ErrNotTransactionRecipient)
+
+		reversal, err = repo.RejectReversal(ctx, reversal.ID, toUser)
+		require.NoError(t, err)
+		require.Equal(t, "rejected", reversal.Status)
+	})
+
+	t.Run("admin forces reversal", func(t *testing.T) {
+		fromUser, toUser := createPair(t, 100, 0)
+		require.NoError(t, repo.SendCoins(ctx, fromUser, toUser, 40))
+		transactionID := lastTransaction(t, fromUser)
+
+		reversal, err := repo.ForceReversal(ctx, transactionID, fromUser, "fraud")
+		require.NoError(t, err)
+		require.Equal(t, "forced", reversal.Status)
+
+		_, err = repo.ForceReversal(ctx, transactionID, fromUser, "fraud")
+		require.ErrorIs(t, err, ErrAlreadyReversed)
+	})
+
+	t.Run("recipient already spent the coins", func(t *testing.T) {
+		fromUser, toUser := createPair(t, 100, 0)
+		require.NoError(t, repo.SendCoins(ctx, fromUser, toUser, 40))
+		transactionID := lastTransaction(t, fromUser)
+
+		_, err := repo.db.Exec(ctx, "UPDATE credentials SET coin = 10 WHERE id = $1", toUser)
+		require.NoError(t, err)
+
+		_, err = repo.ForceReversal(ctx, transactionID, fromUser, "")
+		require.ErrorIs(t, err, ErrInsufficientBalance)
+	})
+}
+
+func TestTransferLimits(t *testing.T) {
+	repo, ctx := setupCoin(t)
+	repo.opts.Limits = models.TransferLimits{MaxPerTransfer: 100, MaxDailyTotal: 150, MaxDailyRecipients: 2}
+
+	createUsers := func(t *testing.T, n int) []uuid.UUID {
+		ids := make([]uuid.UUID, n)
+		for i := range ids {
+			ids[i] = uuid.New()
+			_, err := repo.db.Exec(ctx, `
+            INSERT INTO credentials (id, username, password, coin)
+            VALUES ($1, $2, 'pass', 1000)
+        `, ids[i], ids[i].String())
+			require.NoError(t, err)
+		}
+		return ids
+	}
+
+	t.Run("per transfer limit", func(t *testing.T) {
+		users := createUsers(t, 2)
+
+		err := repo.SendCoins(ctx, users[0], users[1], 101)
+		require.ErrorIs(t, err, ErrTransferLimitExceeded)
+	})
+
+	t.Run("daily total limit", func(t *testing.T) {
+		users := createUsers(t, 2)
+
+		require.NoError(t, repo.SendCoins(ctx, users[0], users[1], 100))
+		err := repo.SendCoins(ctx, users[0], users[1], 51)
+		require.ErrorIs(t, err, ErrDailyLimitExceeded)
+		require.NoError(t, repo.SendCoins(ctx, users[0], users[1], 50))
+	})
+
+	t.Run("daily recipients limit", func(t *testing.T) {
+		users := createUsers(t, 4)
+
+		require.NoError(t, repo.SendCoins(ctx, users[0], users[1], 10))
+		require.NoError(t, repo.SendCoins(ctx, users[0], users[2], 10))
+		require.NoError(t, repo.SendCoins(ctx, users[0], users[1], 10))
+		err := repo.SendCoins(ctx, users[0], users[3], 10)
+		require.ErrorIs(t, err, ErrDailyRecipientsExceeded)
+	})
+
+	t.Run("admin override", func(t *testing.T) {
+		users := createUsers(t, 2)
+		unlimited := int64(0)
+		maxPerTransfer := int64(500)
+
+		limits, err := repo.SetTransferLimits(ctx, users[0], users[1], models.TransferLimitsOverride{
+			MaxPerTransfer: &maxPerTransfer,
+			MaxDailyTotal:  &unlimited,
+		})
+		require.NoError(t, err)
+		require.Equal(t, models.TransferLimits{MaxPerTransfer: 500, MaxDailyTotal: 0, MaxDailyRecipients: 2}, limits.Effective)
+
+		require.NoError(t, repo.SendCoins(ctx, users[0], users[1], 500))
+
+		limits, err = repo.GetTransferLimits(ctx, users[0])
+		require.NoError(t, err)
+		require.Equal(t, int64(500), limits.Effective.MaxPerTransfer)
+		require.Nil(t, limits.Override.MaxDailyRecipients)
+	})
+}
+
+func TestCoinLots(t *testing.T) {
+	repo, ctx := setupCoin(t)
+
+	createUser := func(t *testing.T) uuid.UUID {
+		id := uuid.New()
+		_, err := repo.db.Exec(ctx, `
+            INSERT INTO credentials (id, username, password, coin)
+            VALUES ($1, $2, 'pass', 0)
+        `, id, id.String())
+		require.NoError(t, err)
+		return id
+	}
+
+	addLot := func(t *testing.T, userID uuid.UUID, amount int64, expiresIn time.Duration) {
+		_, err := repo.db.Exec(ctx, `
+            INSERT INTO coin_lots (user_id, amount, expires_at) VALUES ($1, $2, now() + $3::interval);
+        `, userID, amount, expiresIn)
+		require.NoError(t, err)
+		_, err = repo.db.Exec(ctx, "UPDATE credentials SET coin = coin + $1 WHERE id = $2", amount, userID)
+		require.NoError(t, err)
+	}
+
+	lots := func(t *testing.T, userID uuid.UUID) []int64 {
+		rows, err := repo.db.Query(ctx, "SELECT amount FROM coin_lots WHERE user_id = $1 ORDER BY expires_at", userID)
+		require.NoError(t, err)
+		defer rows.Close()
+		var amounts []int64
+		for rows.Next() {
+			var amount int64
+			require.NoError(t, rows.Scan(&amount))
+			amounts = append(amounts, amount)
+		}
+		return amounts
+	}
+
+	balance := func(t *testing.T, userID uuid.UUID) int64 {
+		var coin int64
+		require.NoError(t, repo.db.QueryRow(ctx, "SELECT coin FROM credentials WHERE id = $1", userID).Scan(&coin))
+		return coin
+	}
+
+	t.Run("transfer consumes oldest lots first and keeps expiry", func(t *testing.T) {
+		sender := createUser(t)
+		receiver := createUser(t)
+		addLot(t, sender, 30, 24*time.Hour)
+		addLot(t, sender, 50, 48*time.Hour)
+
+		require.NoError(t, repo.SendCoins(ctx, sender, receiver, 40))
+
+		require.Equal(t, []int64{0, 40}, lots(t, sender))
+		require.Equal(t, []int64{30, 10}, lots(t, receiver))
+		require.Equal(t, int64(40), balance(t, receiver))
+
+		expiring, err := repo.GetExpiringCoins(ctx, receiver)
+		require.NoError(t, err)
+		require.Equal(t, int64(40), expiring.Amount)
+	})
+
+	t.Run("purchase consumes oldest lots first", func(t *testing.T) {
+		userID := createUser(t)
+		addLot(t, userID, 10, 24*time.Hour)
+		addLot(t, userID, 50, 48*time.Hour)
+
+		require.NoError(t, repo.BuyItemFromShop(ctx, userID, "cup"))
+
+		require.Equal(t, []int64{0, 40}, lots(t, userID))
+		require.Equal(t, int64(40), balance(t, userID))
+	})
+
+	t.Run("expired lots are written off", func(t *testing.T) {
+		userID := createUser(t)
+		addLot(t, userID, 25, -time.Hour)
+		addLot(t, userID, 75, 48*time.Hour)
+
+		expired, err := repo.ExpireLots(ctx)
+		require.NoError(t, err)
+		require.GreaterOrEqual(t, expired, int64(25))
+
+		require.Equal(t, int64(75), balance(t, userID))
+		require.Equal(t, []int64{0, 75}, lots(t, userID))
+	})
+
+	t.Run("expired coins cannot be spent before the job runs", func(t *testing.T) {
+		sender := createUser(t)
+		receiver := createUser(t)
+		addLot(t, sender, 100, -time.Hour)
+
+		err := repo.SendCoins(ctx, sender, receiver, 50)
+		require.ErrorIs(t, err, ErrInsufficientBalance)
+	})
+
+	t.Run("grant creates a lot", func(t *testing.T) {
+		userID := createUser(t)
+
+		require.NoError(t, repo.GrantCoins(ctx, userID, 200))
+		require.Equal(t, int64(200), balance(t, userID))
+		require.Equal(t, []int64{200}, lots(t, userID))
+	})
+}
+
+func TestCoinHolds(t *testing.T) {
+	repo, ctx := setupCoin(t)
+
+	createUser := func(t *testing.T, coin int64) uuid.UUID {
+		id := uuid.New()
+		_, err := repo.db.Exec(ctx, `
+            INSERT INTO credentials (id, username, password, coin)
+            VALUES ($1, $2, 'pass', $3)
+        `, id, id.String(), coin)
+		require.NoError(t, err)
+		return id
+	}
+
+	balance := func(t *testing.T, userID uuid.UUID) int64 {
+		var coin int64
+		require.NoError(t, repo.db.QueryRow(ctx, "SELECT coin FROM credentials WHERE id = $1", userID).Scan(&coin))
+		return coin
+	}
+
+	t.Run("held coins are not available", func(t *testing.T) {
+		userID := createUser(t, 100)
+		receiver := createUser(t, 0)
+
+		hold, err := repo.HoldCoins(ctx, userID, userID, models.HoldRequest{Amount: 70, Reason: "order"})
+		require.NoError(t, err)
+		require.Equal(t, "held", hold.Status)
+
+		err = repo.SendCoins(ctx, userID, receiver, 40)
+		require.ErrorIs(t, err, ErrInsufficientBalance)
+
+		_, err = repo.HoldCoins(ctx, userID, userID, models.HoldRequest{Amount: 40})
+		require.ErrorIs(t, err, ErrInsufficientBalance)
+
+		require.NoError(t, repo.SendCoins(ctx, userID, receiver, 30))
+	})
+
+	t.Run("capture spends held coins", func(t *testing.T) {
+		userID := createUser(t, 100)
+
+		hold, err := repo.HoldCoins(ctx, userID, userID, models.HoldRequest{Amount: 60})
+		require.NoError(t, err)
+
+		hold, err = repo.CaptureHold(ctx, hold.ID)
+		require.NoError(t, err)
+		require.Equal(t, "captured", hold.Status)
+		require.Equal(t, int64(40), balance(t, userID))
+
+		_, err = repo.CaptureHold(ctx, hold.ID)
+		require.ErrorIs(t, err, ErrHoldNotActive)
+	})
+
+	t.Run("release returns coins to available balance", func(t *testing.T) {
+		userID := createUser(t, 100)
+		receiver := createUser(t, 0)
+
+		hold, err := repo.HoldCoins(ctx, userID, userID, models.HoldRequest{Amount: 100})
+		require.NoError(t, err)
+
+		hold, err = repo.ReleaseHold(ctx, hold.ID)
+		require.NoError(t, err)
+		require.Equal(t, "released", hold.Status)
+
+		require.NoError(t, repo.SendCoins(ctx, userID, receiver, 100))
+	})
+
+	t.Run("expired holds are released automatically", func(t *testing.T) {
+		userID := createUser(t, 100)
+		receiver := createUser(t, 0)
+
+		hold, err := repo.HoldCoins(ctx, userID, userID, models.HoldRequest{Amount: 100, TTLSeconds: 1})
+		require.NoError(t, err)
+		_, err = repo.db.Exec(ctx, "UPDATE coin_holds SET expires_at = now() - interval '1 second' WHERE id = $1", hold.ID)
+		require.NoError(t, err)
+
+		require.NoError(t, repo.SendCoins(ctx, userID, receiver, 50))
+
+		released, err := repo.ReleaseExpiredHolds(ctx)
+		require.NoError(t, err)
+		require.GreaterOrEqual(t, released, int64(1))
+
+		_, err = repo.ReleaseHold(ctx, hold.ID)
+		require.ErrorIs(t, err, ErrHoldNotActive)
+	})
+}
+
+func TestConcurrentBalanceUpdates(t *testing.T) {
+	repo, ctx := setupCoin(t)
+
+	const (
+		users          = 4
+		initialBalance = int64(1000)
+		workers        = 16
+		operations     = 50
+		itemName       = "cup"
+		itemPrice      = int64(20)
+	)
+
+	ids := make([]uuid.UUID, users)
+	for i := range ids {
+		ids[i] = uuid.New()
+		_, err := repo.db.Exec(ctx, "INSERT INTO credentials (id, username, password, coin) VALUES ($1, $2, 'pass', $3)",
+			ids[i], ids[i].String(), initialBalance)
+		require.NoError(t, err)
+	}
+
+	var purchases atomic.Int64
+	var wg sync.WaitGroup
+	errs := make(chan error, workers*operations)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(seed uint64) {
+			defer wg.Done()
+			rnd := rand.New(rand.NewPCG(seed, seed))
+			for i := 0; i < operations; i++ {
+				from := ids[rnd.IntN(users)]
+				var err error
+				if rnd.IntN(4) == 0 {
+					if err = repo.BuyItemFromShop(ctx, from, itemName); err == nil {
+						purchases.Add(1)
+					}
+				} else {
+					to := ids[rnd.IntN(users)]
+					if to == from {
+						continue
+					}
+					err = repo.SendCoins(ctx, from, to, rnd.Int64N(300)+1)
+				}
+				if err != nil {
+					errs <- err
+				}
+			}
+		}(uint64(w))
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		require.ErrorIs(t, err, ErrInsufficientBalance)
+	}
+
+	var total int64
+	for _, id := range ids {
+		var balance int64
+		err := repo.db.QueryRow(ctx, "SELECT coin FROM credentials WHERE id = $1", id).Scan(&balance)
+		require.NoError(t, err)
+		require.GreaterOrEqual(t, balance, int64(0))
+		total += balance
+	}
+	require.Equal(t, initialBalance*users-purchases.Load()*itemPrice, total)
+}
@@ -0,0 +1,34 @@
+package repository
+
+import "errors"
+
+// Доменные ошибки репозиториев. Обработчики сравнивают их через errors.Is,
+// HTTP-статус и код ответа выбираются в пакете problem.
+var (
+	ErrUserNotFound        = errors.New("user not found")
+	ErrSenderNotFound      = errors.New("sender not found")
+	ErrReceiverNotFound    = errors.New("receiver not found")
+	ErrItemNotFound        = errors.New("item not found")
+	ErrInsufficientBalance = errors.New("insufficient balance")
+	ErrSelfTransfer        = errors.New("cannot send coins to yourself")
+	ErrInvalidAmount       = errors.New("amount must be positive")
+
+	ErrNegativeLimits          = errors.New("limits must not be negative")
+	ErrTransferLimitExceeded   = errors.New("transfer amount exceeds limit")
+	ErrDailyLimitExceeded      = errors.New("daily transfer limit exceeded")
+	ErrDailyRecipientsExceeded = errors.New("daily recipients limit exceeded")
+
+	ErrTransactionNotFound     = errors.New("transaction not found")
+	ErrCompensatingReversal    = errors.New("cannot reverse a compensating transaction")
+	ErrAlreadyReversed         = errors.New("transaction already reversed")
+	ErrReversalNotFound        = errors.New("reversal not found")
+	ErrReversalAlreadyExists   = errors.New("reversal already requested")
+	ErrReversalNotPending      = errors.New("reversal is not pending")
+	ErrNotTransactionSender    = errors.New("only the sender can request a reversal")
+	ErrNotTransactionRecipient = errors.New("only the recipient can resolve a reversal")
+
+	ErrHoldNotFound  = errors.New("hold not found")
+	ErrHoldNotActive = errors.New("hold is not active")
+
+	ErrWebhookNotFound = errors.New("webhook not found")
+)
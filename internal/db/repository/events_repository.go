@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/models"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"time"
+)
+
+// EventsChannel — канал LISTEN/NOTIFY, в который уходят события пользователей.
+const EventsChannel = "user_events"
+
+type EventRepository interface {
+	GetEventsAfter(ctx context.Context, userID uuid.UUID, afterID int64, limit int) ([]models.UserEvent, error)
+	DeleteEventsBefore(ctx context.Context, before time.Time) (int64, error)
+}
+
+type eventRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewEventRepository(db *pgxpool.Pool) EventRepository {
+	return &eventRepository{db: db}
+}
+
+// GetEventsAfter возвращает до limit событий пользователя с id больше afterID
+// в порядке возрастания.
+func (r *eventRepository) GetEventsAfter(ctx context.Context, userID uuid.UUID, afterID int64, limit int) ([]models.UserEvent, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT id, user_id, type, payload, created_at
+		FROM user_events
+		WHERE user_id = $1 AND id > $2
+		ORDER BY id
+		LIMIT $3`, userID, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := make([]models.UserEvent, 0, limit)
+	for rows.Next() {
+		var e models.UserEvent
+		if err = rows.Scan(&e.ID, &e.UserID, &e.Type, &e.Payload, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+
+	return events, rows.Err()
+}
+
+// DeleteEventsBefore удаляет события старше before, после этого их уже
+// нельзя дочитать по Last-Event-ID.
+func (r *eventRepository) DeleteEventsBefore(ctx context.Context, before time.Time) (int64, error) {
+	tag, err := r.db.Exec(ctx, "DELETE FROM user_events WHERE created_at < $1", before)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// recordEvent сохраняет событие и отправляет его в EventsChannel. NOTIFY
+// доставляется только после коммита, поэтому при откате транзакции
+// подписчики ничего не увидят.
+func recordEvent(ctx context.Context, tx pgx.Tx, userID uuid.UUID, eventType string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		WITH event AS (
+			INSERT INTO user_events (user_id, type, payload)
+			VALUES ($1, $2, $3)
+			RETURNING id, user_id, type, payload, created_at
+		)
+		SELECT pg_notify($4, row_to_json(event)::text) FROM event`,
+		userID, eventType, payload, EventsChannel)
+	if err != nil {
+		return fmt.Errorf("failed to record event: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/models"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"time"
+)
+
+const DefaultHoldTTL = 15 * time.Minute
+
+// heldCoinsColumn считает зарезервированные монеты пользователя из строки credentials
+const heldCoinsColumn = `(
+	SELECT coalesce(sum(h.amount), 0)
+	FROM coin_holds h
+	WHERE h.user_id = credentials.id AND h.status = 'held' AND h.expires_at > now()
+)`
+
+const holdColumns = "id, user_id, amount, reason, status, created_at, expires_at, resolved_at"
+
+// HoldCoins резервирует монеты пользователя. Зарезервированные монеты нельзя
+// потратить, пока холд не будет списан, освобождён или не истечёт его срок.
+func (r *coinRepository) HoldCoins(ctx context.Context, userID, createdBy uuid.UUID, request models.HoldRequest) (*models.CoinHold, error) {
+	if request.Amount <= 0 {
+		return nil, ErrInvalidAmount
+	}
+	ttl := orDefault(time.Duration(request.TTLSeconds)*time.Second, orDefault(r.opts.HoldTTL, DefaultHoldTTL))
+
+	var hold *models.CoinHold
+	err := r.withTx(ctx, func(tx pgx.Tx) error {
+		if err := lockAccounts(ctx, tx, userID); err != nil {
+			return err
+		}
+
+		if _, _, err := r.expireLots(ctx, tx, &userID, expireBatchSize); err != nil {
+			return err
+		}
+
+		var coin, held int64
+		err := tx.QueryRow(ctx, "SELECT coin, "+heldCoinsColumn+" FROM credentials WHERE id = $1", userID).
+			Scan(&coin, &held)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrUserNotFound
+			}
+			return err
+		}
+		if coin-held < request.Amount {
+			return ErrInsufficientBalance
+		}
+
+		hold, err = scanHold(tx.QueryRow(ctx, `
+			INSERT INTO coin_holds (user_id, amount, reason, created_by, expires_at)
+			VALUES ($1, $2, $3, $4, now() + $5::interval)
+			RETURNING `+holdColumns, userID, request.Amount, request.Reason, createdBy, ttl))
+		if err != nil {
+			return fmt.Errorf("failed to create hold: %w", err)
+		}
+		return recordHoldEvent(ctx, tx, models.EventHoldCreated, hold)
+	})
+	return hold, err
+}
+
+// CaptureHold списывает зарезервированные монеты с баланса, как при покупке.
+func (r *coinRepository) CaptureHold(ctx context.Context, holdID uuid.UUID) (*models.CoinHold, error) {
+	var hold *models.CoinHold
+	err := r.withTx(ctx, func(tx pgx.Tx) error {
+		active, err := r.lockActiveHold(ctx, tx, holdID)
+		if err != nil {
+			return err
+		}
+
+		if err = lockAccounts(ctx, tx, active.UserID); err != nil {
+			return err
+		}
+
+		if _, _, err = r.expireLots(ctx, tx, &active.UserID, expireBatchSize); err != nil {
+			return err
+		}
+
+		tag, err := tx.Exec(ctx, "UPDATE credentials SET coin = coin - $1 WHERE id = $2 AND coin >= $1", active.Amount, active.UserID)
+		if err != nil {
+			return fmt.Errorf("failed to update user balance: %w", err)
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrInsufficientBalance
+		}
+
+		if _, err = r.consumeLots(ctx, tx, active.UserID, active.Amount); err != nil {
+			return err
+		}
+
+		hold, err = r.resolveHold(ctx, tx, holdID, models.HoldStatusCaptured)
+		if err != nil {
+			return err
+		}
+		return recordHoldEvent(ctx, tx, models.EventHoldCaptured, hold)
+	})
+	return hold, err
+}
+
+func (r *coinRepository) ReleaseHold(ctx context.Context, holdID uuid.UUID) (*models.CoinHold, error) {
+	var hold *models.CoinHold
+	err := r.withTx(ctx, func(tx pgx.Tx) error {
+		if _, err := r.lockActiveHold(ctx, tx, holdID); err != nil {
+			return err
+		}
+
+		var err error
+		hold, err = r.resolveHold(ctx, tx, holdID, models.HoldStatusReleased)
+		if err != nil {
+			return err
+		}
+		return recordHoldEvent(ctx, tx, models.EventHoldReleased, hold)
+	})
+	return hold, err
+}
+
+// ReleaseExpiredHolds помечает истёкшие холды. Истёкшие холды перестают
+// учитываться сразу по expires_at, а событие сообщает пользователю, что
+// монеты снова доступны.
+func (r *coinRepository) ReleaseExpiredHolds(ctx context.Context) (int64, error) {
+	var released int64
+	err := r.withTx(ctx, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, `
+			UPDATE coin_holds
+			SET status = $1, resolved_at = now()
+			WHERE status = $2 AND expires_at <= now()
+			RETURNING `+holdColumns, models.HoldStatusExpired, models.HoldStatusHeld)
+		if err != nil {
+			return err
+		}
+		holds, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (*models.CoinHold, error) {
+			return scanHold(row)
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, hold := range holds {
+			if err = recordHoldEvent(ctx, tx, models.EventHoldExpired, hold); err != nil {
+				return err
+			}
+		}
+		released = int64(len(holds))
+		return nil
+	})
+	return released, err
+}
+
+// recordHoldEvent сообщает владельцу холда об изменении: доступный баланс
+// меняется на каждом этапе холда.
+func recordHoldEvent(ctx context.Context, tx pgx.Tx, eventType string, hold *models.CoinHold) error {
+	return recordEvent(ctx, tx, hold.UserID, eventType, models.HoldEvent{HoldID: hold.ID, Amount: hold.Amount})
+}
+
+func (r *coinRepository) lockActiveHold(ctx context.Context, tx pgx.Tx, holdID uuid.UUID) (*models.CoinHold, error) {
+	hold, err := scanHold(tx.QueryRow(ctx, "SELECT "+holdColumns+" FROM coin_holds WHERE id = $1 FOR UPDATE", holdID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrHoldNotFound
+		}
+		return nil, err
+	}
+	if hold.Status != models.HoldStatusHeld || !hold.ExpiresAt.After(time.Now()) {
+		return nil, ErrHoldNotActive
+	}
+	return hold, nil
+}
+
+func (r *coinRepository) resolveHold(ctx context.Context, tx pgx.Tx, holdID uuid.UUID, status string) (*models.CoinHold, error) {
+	hold, err := scanHold(tx.QueryRow(ctx, `
+		UPDATE coin_holds
+		SET status = $2, resolved_at = now()
+		WHERE id = $1
+		RETURNING `+holdColumns, holdID, status))
+	if err != nil {
+		return nil, fmt.Errorf("failed to update hold: %w", err)
+	}
+	return hold, nil
+}
+
+func scanHold(row pgx.Row) (*models.CoinHold, error) {
+	var hold models.CoinHold
+	err := row.Scan(&hold.ID, &hold.UserID, &hold.Amount, &hold.Reason, &hold.Status,
+		&hold.CreatedAt, &hold.ExpiresAt, &hold.ResolvedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &hold, nil
+}
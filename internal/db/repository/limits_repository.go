@@ -0,0 +1,104 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/models"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+type queryRower interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+func (r *coinRepository) GetTransferLimits(ctx context.Context, userID uuid.UUID) (*models.UserTransferLimits, error) {
+	override, err := r.getLimitsOverride(ctx, r.db, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &models.UserTransferLimits{Effective: override.Apply(r.opts.Limits), Override: *override}, nil
+}
+
+func (r *coinRepository) SetTransferLimits(ctx context.Context, userID, adminID uuid.UUID, override models.TransferLimitsOverride) (*models.UserTransferLimits, error) {
+	for _, v := range []*int64{override.MaxPerTransfer, override.MaxDailyTotal, override.MaxDailyRecipients} {
+		if v != nil && *v < 0 {
+			return nil, ErrNegativeLimits
+		}
+	}
+
+	_, err := r.db.Exec(ctx, `
+		INSERT INTO transfer_limit_overrides (user_id, max_per_transfer, max_daily_total, max_daily_recipients, updated_by)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (user_id) DO UPDATE
+		SET max_per_transfer = EXCLUDED.max_per_transfer,
+		    max_daily_total = EXCLUDED.max_daily_total,
+		    max_daily_recipients = EXCLUDED.max_daily_recipients,
+		    updated_by = EXCLUDED.updated_by,
+		    updated_at = now()`,
+		userID, override.MaxPerTransfer, override.MaxDailyTotal, override.MaxDailyRecipients, adminID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update transfer limits: %w", err)
+	}
+
+	return &models.UserTransferLimits{Effective: override.Apply(r.opts.Limits), Override: override}, nil
+}
+
+func (r *coinRepository) getLimitsOverride(ctx context.Context, q queryRower, userID uuid.UUID) (*models.TransferLimitsOverride, error) {
+	var override models.TransferLimitsOverride
+	err := q.QueryRow(ctx, `
+		SELECT max_per_transfer, max_daily_total, max_daily_recipients
+		FROM transfer_limit_overrides
+		WHERE user_id = $1`, userID).
+		Scan(&override.MaxPerTransfer, &override.MaxDailyTotal, &override.MaxDailyRecipients)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+	return &override, nil
+}
+
+// checkTransferLimits проверяет лимиты отправителя за скользящие 24 часа.
+// Строки участников блокируются, чтобы параллельные переводы не обошли лимит.
+// Компенсирующие переводы в лимитах не учитываются.
+func (r *coinRepository) checkTransferLimits(ctx context.Context, tx pgx.Tx, fromUserID, toUserID uuid.UUID, amount int64) error {
+	override, err := r.getLimitsOverride(ctx, tx, fromUserID)
+	if err != nil {
+		return err
+	}
+	limits := override.Apply(r.opts.Limits)
+
+	if limits.MaxPerTransfer > 0 && amount > limits.MaxPerTransfer {
+		return ErrTransferLimitExceeded
+	}
+	if limits.MaxDailyTotal == 0 && limits.MaxDailyRecipients == 0 {
+		return nil
+	}
+
+	if err = lockAccounts(ctx, tx, fromUserID, toUserID); err != nil {
+		return err
+	}
+
+	var sentTotal, recipients int64
+	var knownRecipient bool
+	err = tx.QueryRow(ctx, `
+		SELECT coalesce(sum(amount), 0), count(DISTINCT to_user), coalesce(bool_or(to_user = $2), false)
+		FROM transactions
+		WHERE from_user = $1 AND reversal_of IS NULL AND created_at > now() - interval '24 hours'`,
+		fromUserID, toUserID).Scan(&sentTotal, &recipients, &knownRecipient)
+	if err != nil {
+		return err
+	}
+
+	if limits.MaxDailyTotal > 0 && sentTotal+amount > limits.MaxDailyTotal {
+		return ErrDailyLimitExceeded
+	}
+	if !knownRecipient {
+		recipients++
+	}
+	if limits.MaxDailyRecipients > 0 && recipients > limits.MaxDailyRecipients {
+		return ErrDailyRecipientsExceeded
+	}
+
+	return nil
+}
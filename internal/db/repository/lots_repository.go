@@ -0,0 +1,221 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/models"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/logger"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+	"time"
+)
+
+const (
+	DefaultCoinLifetime  = 365 * 24 * time.Hour
+	DefaultExpiryWarning = 30 * 24 * time.Hour
+
+	expireBatchSize = 1000
+)
+
+type lotPortion struct {
+	amount    int64
+	expiresAt time.Time
+}
+
+// expiredLots — сколько монет и партий сгорело у пользователя.
+type expiredLots struct {
+	userID uuid.UUID
+	amount int64
+	lots   int64
+}
+
+func (r *coinRepository) GrantCoins(ctx context.Context, userID uuid.UUID, amount int64) error {
+	if amount <= 0 {
+		return ErrInvalidAmount
+	}
+
+	return r.withTx(ctx, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, "UPDATE credentials SET coin = coin + $1 WHERE id = $2", amount, userID)
+		if err != nil {
+			return fmt.Errorf("failed to update user balance: %w", err)
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrUserNotFound
+		}
+
+		err = r.grantLots(ctx, tx, userID, []lotPortion{{amount: amount, expiresAt: time.Now().Add(r.coinLifetime())}})
+		if err != nil {
+			return err
+		}
+
+		return recordEvent(ctx, tx, userID, models.EventCoinsGranted, models.CoinsGrantedEvent{Amount: amount})
+	})
+}
+
+func (r *coinRepository) GetExpiringCoins(ctx context.Context, userID uuid.UUID) (*models.ExpiringCoins, error) {
+	expiring := models.ExpiringCoins{Before: time.Now().Add(r.expiryWarning())}
+	err := r.db.QueryRow(ctx, `
+		SELECT coalesce(sum(amount), 0)
+		FROM coin_lots
+		WHERE user_id = $1 AND amount > 0 AND expires_at <= $2`, userID, expiring.Before).
+		Scan(&expiring.Amount)
+	if err != nil {
+		return nil, err
+	}
+	return &expiring, nil
+}
+
+// ExpireLots списывает просроченные партии всех пользователей. Партии
+// обрабатываются пачками, чтобы не держать блокировки долго.
+func (r *coinRepository) ExpireLots(ctx context.Context) (int64, error) {
+	var total int64
+	for {
+		var expired, lots int64
+		err := r.withTx(ctx, func(tx pgx.Tx) error {
+			var err error
+			expired, lots, err = r.expireLots(ctx, tx, nil, expireBatchSize)
+			return err
+		})
+		if err != nil {
+			return total, err
+		}
+		total += expired
+		if lots < expireBatchSize {
+			return total, nil
+		}
+	}
+}
+
+// expireLots списывает с баланса просроченные партии и сообщает каждому
+// пользователю, сколько у него сгорело. Если userID задан, обрабатываются
+// только партии этого пользователя.
+func (r *coinRepository) expireLots(ctx context.Context, tx pgx.Tx, userID *uuid.UUID, limit int) (int64, int64, error) {
+	rows, err := tx.Query(ctx, `
+		WITH due AS (
+			SELECT id, user_id, amount
+			FROM coin_lots
+			WHERE amount > 0 AND expires_at <= now() AND ($1::uuid IS NULL OR user_id = $1)
+			ORDER BY expires_at
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		), expired AS (
+			UPDATE coin_lots l
+			SET expired_amount = l.expired_amount + due.amount, amount = 0, expired_at = now()
+			FROM due
+			WHERE l.id = due.id
+			RETURNING due.user_id, due.amount
+		), totals AS (
+			SELECT user_id, sum(amount)::bigint AS total, count(*) AS lots FROM expired GROUP BY user_id
+		), balances AS (
+			UPDATE credentials c
+			SET coin = c.coin - t.total
+			FROM totals t
+			WHERE c.id = t.user_id
+		)
+		SELECT user_id, total, lots FROM totals`, userID, limit)
+	if err != nil {
+		return 0, 0, err
+	}
+	totals, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (expiredLots, error) {
+		var e expiredLots
+		err := row.Scan(&e.userID, &e.amount, &e.lots)
+		return e, err
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var expired, lots int64
+	for _, e := range totals {
+		expired += e.amount
+		lots += e.lots
+		if err = recordEvent(ctx, tx, e.userID, models.EventCoinsExpired, models.CoinsExpiredEvent{Amount: e.amount}); err != nil {
+			return 0, 0, err
+		}
+	}
+	if expired > 0 {
+		logger.FromContext(ctx).Debug("expired coin lots", zap.Int64("amount", expired), zap.Int64("lots", lots))
+	}
+	return expired, lots, nil
+}
+
+// consumeLots списывает amount монет с партий пользователя, начиная с тех,
+// что сгорают раньше. Монеты сверх партий (например, баланс, заведённый
+// напрямую в базе) списываются последними и получают новый срок действия.
+func (r *coinRepository) consumeLots(ctx context.Context, tx pgx.Tx, userID uuid.UUID, amount int64) ([]lotPortion, error) {
+	rows, err := tx.Query(ctx, `
+		SELECT id, amount, expires_at
+		FROM coin_lots
+		WHERE user_id = $1 AND amount > 0 AND expires_at > now()
+		ORDER BY expires_at
+		FOR UPDATE`, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	type lot struct {
+		id uuid.UUID
+		lotPortion
+	}
+	var lots []lot
+	var covered int64
+	for rows.Next() && covered < amount {
+		var l lot
+		if err = rows.Scan(&l.id, &l.amount, &l.expiresAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		lots = append(lots, l)
+		covered += l.amount
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	portions := make([]lotPortion, 0, len(lots)+1)
+	remaining := amount
+	for _, l := range lots {
+		take := min(l.amount, remaining)
+		if _, err = tx.Exec(ctx, "UPDATE coin_lots SET amount = amount - $1 WHERE id = $2", take, l.id); err != nil {
+			return nil, fmt.Errorf("failed to update coin lots: %w", err)
+		}
+		portions = append(portions, lotPortion{amount: take, expiresAt: l.expiresAt})
+		remaining -= take
+	}
+	if remaining > 0 {
+		portions = append(portions, lotPortion{amount: remaining, expiresAt: time.Now().Add(r.coinLifetime())})
+	}
+
+	return portions, nil
+}
+
+func (r *coinRepository) grantLots(ctx context.Context, tx pgx.Tx, userID uuid.UUID, portions []lotPortion) error {
+	for _, p := range portions {
+		_, err := tx.Exec(ctx, `
+			INSERT INTO coin_lots (user_id, amount, expires_at)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (user_id, expires_at) DO UPDATE
+			SET amount = coin_lots.amount + EXCLUDED.amount`, userID, p.amount, p.expiresAt)
+		if err != nil {
+			return fmt.Errorf("failed to update coin lots: %w", err)
+		}
+	}
+	return nil
+}
+
+func (r *coinRepository) coinLifetime() time.Duration {
+	return orDefault(r.opts.CoinLifetime, DefaultCoinLifetime)
+}
+
+func (r *coinRepository) expiryWarning() time.Duration {
+	return orDefault(r.opts.ExpiryWarning, DefaultExpiryWarning)
+}
+
+func orDefault(d, def time.Duration) time.Duration {
+	if d > 0 {
+		return d
+	}
+	return def
+}
@@ -0,0 +1,173 @@
+package repository
+
+import (
+	"context"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/models"
+	"github.com/google/uuid"
+)
+
+// WriteObserver получает пользователей, чьи данные изменила успешная
+// операция: реплики отправляют их чтения в primary, кеши сбрасывают ответы.
+type WriteObserver func(userIDs ...uuid.UUID)
+
+// Обёртки сообщают наблюдателям об изменениях после успешного вызова.
+// Массовые фоновые операции не сообщаются: их результат виден с задержкой.
+
+type observedUserRepository struct {
+	next      UserRepository
+	observers []WriteObserver
+}
+
+func NewObservedUserRepository(next UserRepository, observers ...WriteObserver) UserRepository {
+	return &observedUserRepository{next: next, observers: observers}
+}
+
+func (r *observedUserRepository) wrote(userIDs ...uuid.UUID) {
+	for _, observe := range r.observers {
+		observe(userIDs...)
+	}
+}
+
+func (r *observedUserRepository) GetUserCredentialByName(ctx context.Context, name string) (*models.Credential, error) {
+	return r.next.GetUserCredentialByName(ctx, name)
+}
+
+func (r *observedUserRepository) CreateUserCredential(ctx context.Context, credential *models.Credential) error {
+	if err := r.next.CreateUserCredential(ctx, credential); err != nil {
+		return err
+	}
+	r.wrote(credential.ID)
+	return nil
+}
+
+func (r *observedUserRepository) GetUserByID(ctx context.Context, id uuid.UUID) (*models.Credential, error) {
+	return r.next.GetUserByID(ctx, id)
+}
+
+func (r *observedUserRepository) GetUserItems(ctx context.Context, id uuid.UUID, userItems *[]models.UserItem) error {
+	return r.next.GetUserItems(ctx, id, userItems)
+}
+
+func (r *observedUserRepository) GetUsernamesByIDs(ctx context.Context, userIDs []string) (map[string]string, error) {
+	return r.next.GetUsernamesByIDs(ctx, userIDs)
+}
+
+type observedCoinRepository struct {
+	next      CoinRepository
+	observers []WriteObserver
+}
+
+func NewObservedCoinRepository(next CoinRepository, observers ...WriteObserver) CoinRepository {
+	return &observedCoinRepository{next: next, observers: observers}
+}
+
+func (r *observedCoinRepository) wrote(userIDs ...uuid.UUID) {
+	for _, observe := range r.observers {
+		observe(userIDs...)
+	}
+}
+
+func (r *observedCoinRepository) BuyItemFromShop(ctx context.Context, userID uuid.UUID, itemName string) error {
+	if err := r.next.BuyItemFromShop(ctx, userID, itemName); err != nil {
+		return err
+	}
+	r.wrote(userID)
+	return nil
+}
+
+func (r *observedCoinRepository) SendCoins(ctx context.Context, fromUserID, toUserID uuid.UUID, amount int64) error {
+	if err := r.next.SendCoins(ctx, fromUserID, toUserID, amount); err != nil {
+		return err
+	}
+	r.wrote(fromUserID, toUserID)
+	return nil
+}
+
+func (r *observedCoinRepository) GetTransactions(ctx context.Context, userID uuid.UUID, transactions *[]models.Transaction) error {
+	return r.next.GetTransactions(ctx, userID, transactions)
+}
+
+func (r *observedCoinRepository) GetHistory(ctx context.Context, userID uuid.UUID, limit int, after *models.HistoryCursor) ([]models.HistoryEntry, error) {
+	return r.next.GetHistory(ctx, userID, limit, after)
+}
+
+func (r *observedCoinRepository) RequestReversal(ctx context.Context, transactionID, requestedBy uuid.UUID, reason string) (*models.TransferReversal, error) {
+	return r.reversal(r.next.RequestReversal(ctx, transactionID, requestedBy, reason))
+}
+
+func (r *observedCoinRepository) ApproveReversal(ctx context.Context, reversalID, approvedBy uuid.UUID) (*models.TransferReversal, error) {
+	return r.reversal(r.next.ApproveReversal(ctx, reversalID, approvedBy))
+}
+
+func (r *observedCoinRepository) RejectReversal(ctx context.Context, reversalID, rejectedBy uuid.UUID) (*models.TransferReversal, error) {
+	return r.reversal(r.next.RejectReversal(ctx, reversalID, rejectedBy))
+}
+
+func (r *observedCoinRepository) ForceReversal(ctx context.Context, transactionID, adminID uuid.UUID, reason string) (*models.TransferReversal, error) {
+	return r.reversal(r.next.ForceReversal(ctx, transactionID, adminID, reason))
+}
+
+func (r *observedCoinRepository) reversal(reversal *models.TransferReversal, err error) (*models.TransferReversal, error) {
+	if err != nil {
+		return nil, err
+	}
+	r.wrote(reversal.FromUserID, reversal.ToUserID)
+	return reversal, nil
+}
+
+func (r *observedCoinRepository) GetReversals(ctx context.Context, userID uuid.UUID, reversals *[]models.TransferReversal) error {
+	return r.next.GetReversals(ctx, userID, reversals)
+}
+
+func (r *observedCoinRepository) GetTransferLimits(ctx context.Context, userID uuid.UUID) (*models.UserTransferLimits, error) {
+	return r.next.GetTransferLimits(ctx, userID)
+}
+
+func (r *observedCoinRepository) SetTransferLimits(ctx context.Context, userID, adminID uuid.UUID, override models.TransferLimitsOverride) (*models.UserTransferLimits, error) {
+	limits, err := r.next.SetTransferLimits(ctx, userID, adminID, override)
+	if err != nil {
+		return nil, err
+	}
+	r.wrote(userID)
+	return limits, nil
+}
+
+func (r *observedCoinRepository) GrantCoins(ctx context.Context, userID uuid.UUID, amount int64) error {
+	if err := r.next.GrantCoins(ctx, userID, amount); err != nil {
+		return err
+	}
+	r.wrote(userID)
+	return nil
+}
+
+func (r *observedCoinRepository) GetExpiringCoins(ctx context.Context, userID uuid.UUID) (*models.ExpiringCoins, error) {
+	return r.next.GetExpiringCoins(ctx, userID)
+}
+
+func (r *observedCoinRepository) ExpireLots(ctx context.Context) (int64, error) {
+	return r.next.ExpireLots(ctx)
+}
+
+func (r *observedCoinRepository) HoldCoins(ctx context.Context, userID, createdBy uuid.UUID, request models.HoldRequest) (*models.CoinHold, error) {
+	return r.hold(r.next.HoldCoins(ctx, userID, createdBy, request))
+}
+
+func (r *observedCoinRepository) CaptureHold(ctx context.Context, holdID uuid.UUID) (*models.CoinHold, error) {
+	return r.hold(r.next.CaptureHold(ctx, holdID))
+}
+
+func (r *observedCoinRepository) ReleaseHold(ctx context.Context, holdID uuid.UUID) (*models.CoinHold, error) {
+	return r.hold(r.next.ReleaseHold(ctx, holdID))
+}
+
+func (r *observedCoinRepository) hold(hold *models.CoinHold, err error) (*models.CoinHold, error) {
+	if err != nil {
+		return nil, err
+	}
+	r.wrote(hold.UserID)
+	return hold, nil
+}
+
+func (r *observedCoinRepository) ReleaseExpiredHolds(ctx context.Context) (int64, error) {
+	return r.next.ReleaseExpiredHolds(ctx)
+}
@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"context"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/models"
+	mock_repository "github.com/Ki4EH/stunning-octo-waddle/internal/mocks/repository"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+	"testing"
+)
+
+func TestObservedRepositories(t *testing.T) {
+	ctx := context.Background()
+	fromID, toID := uuid.New(), uuid.New()
+
+	tests := []struct {
+		name          string
+		setupMocks    func(users *mock_repository.MockUserRepository, coins *mock_repository.MockCoinRepository)
+		call          func(users UserRepository, coins CoinRepository) error
+		expectedErr   error
+		expectedWrote []uuid.UUID
+	}{
+		{
+			name: "registration marks new user",
+			setupMocks: func(users *mock_repository.MockUserRepository, coins *mock_repository.MockCoinRepository) {
+				users.EXPECT().CreateUserCredential(ctx, gomock.Any()).
+					DoAndReturn(func(_ context.Context, credential *models.Credential) error {
+						credential.ID = fromID
+						return nil
+					})
+			},
+			call: func(users UserRepository, coins CoinRepository) error {
+				return users.CreateUserCredential(ctx, &models.Credential{Username: "alice"})
+			},
+			expectedWrote: []uuid.UUID{fromID},
+		},
+		{
+			name: "transfer marks both users",
+			setupMocks: func(users *mock_repository.MockUserRepository, coins *mock_repository.MockCoinRepository) {
+				coins.EXPECT().SendCoins(ctx, fromID, toID, int64(10)).Return(nil)
+			},
+			call: func(users UserRepository, coins CoinRepository) error {
+				return coins.SendCoins(ctx, fromID, toID, 10)
+			},
+			expectedWrote: []uuid.UUID{fromID, toID},
+		},
+		{
+			name: "failed purchase is not reported",
+			setupMocks: func(users *mock_repository.MockUserRepository, coins *mock_repository.MockCoinRepository) {
+				coins.EXPECT().BuyItemFromShop(ctx, fromID, "cup").Return(ErrInsufficientBalance)
+			},
+			call: func(users UserRepository, coins CoinRepository) error {
+				return coins.BuyItemFromShop(ctx, fromID, "cup")
+			},
+			expectedErr: ErrInsufficientBalance,
+		},
+		{
+			name: "captured hold marks its owner",
+			setupMocks: func(users *mock_repository.MockUserRepository, coins *mock_repository.MockCoinRepository) {
+				coins.EXPECT().CaptureHold(ctx, gomock.Any()).Return(&models.CoinHold{UserID: fromID}, nil)
+			},
+			call: func(users UserRepository, coins CoinRepository) error {
+				_, err := coins.CaptureHold(ctx, uuid.New())
+				return err
+			},
+			expectedWrote: []uuid.UUID{fromID},
+		},
+		{
+			name: "approved reversal marks both users",
+			setupMocks: func(users *mock_repository.MockUserRepository, coins *mock_repository.MockCoinRepository) {
+				coins.EXPECT().ApproveReversal(ctx, gomock.Any(), toID).
+					Return(&models.TransferReversal{FromUserID: fromID, ToUserID: toID}, nil)
+			},
+			call: func(users UserRepository, coins CoinRepository) error {
+				_, err := coins.ApproveReversal(ctx, uuid.New(), toID)
+				return err
+			},
+			expectedWrote: []uuid.UUID{fromID, toID},
+		},
+		{
+			name: "reads are not reported",
+			setupMocks: func(users *mock_repository.MockUserRepository, coins *mock_repository.MockCoinRepository) {
+				users.EXPECT().GetUserByID(ctx, fromID).Return(&models.Credential{}, nil)
+				coins.EXPECT().GetExpiringCoins(ctx, fromID).Return(&models.ExpiringCoins{}, nil)
+			},
+			call: func(users UserRepository, coins CoinRepository) error {
+				if _, err := users.GetUserByID(ctx, fromID); err != nil {
+					return err
+				}
+				_, err := coins.GetExpiringCoins(ctx, fromID)
+				return err
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			users := mock_repository.NewMockUserRepository(ctrl)
+			coins := mock_repository.NewMockCoinRepository(ctrl)
+			tt.setupMocks(users, coins)
+
+			// Каждый наблюдатель получает все изменения
+			var first, second []uuid.UUID
+			observers := []WriteObserver{
+				func(ids ...uuid.UUID) { first = append(first, ids...) },
+				func(ids ...uuid.UUID) { second = append(second, ids...) },
+			}
+
+			err := tt.call(NewObservedUserRepository(users, observers...), NewObservedCoinRepository(coins, observers...))
+			assert.ErrorIs(t, err, tt.expectedErr)
+			assert.Equal(t, tt.expectedWrote, first)
+			assert.Equal(t, tt.expectedWrote, second)
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package repository
+
+import (
+	"context"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/models"
+	"github.com/google/uuid"
+)
+
+// Обёртки читают данные пользователя с реплик, а запись отправляют в
+// primary. Чтобы пользователь сразу видел свои изменения, роутер должен
+// получать их через NewObservedUserRepository и NewObservedCoinRepository.
+
+// ReadRouter выбирает, откуда читать данные пользователя.
+type ReadRouter interface {
+	// Replica возвращает номер реплики или -1, если читать нужно с primary
+	Replica(userID uuid.UUID) int
+}
+
+type replicatedUserRepository struct {
+	primary  UserRepository
+	replicas []UserRepository
+	router   ReadRouter
+}
+
+// NewReplicatedUserRepository создаёт репозиторий, читающий с replicas[i],
+// когда router выбирает i-ю реплику.
+func NewReplicatedUserRepository(primary UserRepository, replicas []UserRepository, router ReadRouter) UserRepository {
+	return &replicatedUserRepository{primary: primary, replicas: replicas, router: router}
+}
+
+func (r *replicatedUserRepository) reader(userID uuid.UUID) UserRepository {
+	if i := r.router.Replica(userID); i >= 0 {
+		return r.replicas[i]
+	}
+	return r.primary
+}
+
+// GetUserCredentialByName всегда читает с primary: вход сразу после
+// регистрации на другом экземпляре не должен создавать пользователя повторно.
+func (r *replicatedUserRepository) GetUserCredentialByName(ctx context.Context, name string) (*models.Credential, error) {
+	return r.primary.GetUserCredentialByName(ctx, name)
+}
+
+func (r *replicatedUserRepository) CreateUserCredential(ctx context.Context, credential *models.Credential) error {
+	return r.primary.CreateUserCredential(ctx, credential)
+}
+
+func (r *replicatedUserRepository) GetUserByID(ctx context.Context, id uuid.UUID) (*models.Credential, error) {
+	return r.reader(id).GetUserByID(ctx, id)
+}
+
+func (r *replicatedUserRepository) GetUserItems(ctx context.Context, id uuid.UUID, userItems *[]models.UserItem) error {
+	return r.reader(id).GetUserItems(ctx, id, userItems)
+}
+
+func (r *replicatedUserRepository) GetUsernamesByIDs(ctx context.Context, userIDs []string) (map[string]string, error) {
+	return r.primary.GetUsernamesByIDs(ctx, userIDs)
+}
+
+type replicatedCoinRepository struct {
+	primary  CoinRepository
+	replicas []CoinRepository
+	router   ReadRouter
+}
+
+// NewReplicatedCoinRepository создаёт репозиторий, читающий с replicas[i],
+// когда router выбирает i-ю реплику.
+func NewReplicatedCoinRepository(primary CoinRepository, replicas []CoinRepository, router ReadRouter) CoinRepository {
+	return &replicatedCoinRepository{primary: primary, replicas: replicas, router: router}
+}
+
+func (r *replicatedCoinRepository) reader(userID uuid.UUID) CoinRepository {
+	if i := r.router.Replica(userID); i >= 0 {
+		return r.replicas[i]
+	}
+	return r.primary
+}
+
+func (r *replicatedCoinRepository) BuyItemFromShop(ctx context.Context, userID uuid.UUID, itemName string) error {
+	return r.primary.BuyItemFromShop(ctx, userID, itemName)
+}
+
+func (r *replicatedCoinRepository) SendCoins(ctx context.Context, fromUserID, toUserID uuid.UUID, amount int64) error {
+	return r.primary.SendCoins(ctx, fromUserID, toUserID, amount)
+}
+
+func (r *replicatedCoinRepository) GetTransactions(ctx context.Context, userID uuid.UUID, transactions *[]models.Transaction) error {
+	return r.reader(userID).GetTransactions(ctx, userID, transactions)
+}
+
+func (r *replicatedCoinRepository) GetHistory(ctx context.Context, userID uuid.UUID, limit int, after *models.HistoryCursor) ([]models.HistoryEntry, error) {
+	return r.reader(userID).GetHistory(ctx, userID, limit, after)
+}
+
+func (r *replicatedCoinRepository) RequestReversal(ctx context.Context, transactionID, requestedBy uuid.UUID, reason string) (*models.TransferReversal, error) {
+	return r.primary.RequestReversal(ctx, transactionID, requestedBy, reason)
+}
+
+func (r *replicatedCoinRepository) ApproveReversal(ctx context.Context, reversalID, approvedBy uuid.UUID) (*models.TransferReversal, error) {
+	return r.primary.ApproveReversal(ctx, reversalID, approvedBy)
+}
+
+func (r *replicatedCoinRepository) RejectReversal(ctx context.Context, reversalID, rejectedBy uuid.UUID) (*models.TransferReversal, error) {
+	return r.primary.RejectReversal(ctx, reversalID, rejectedBy)
+}
+
+func (r *replicatedCoinRepository) ForceReversal(ctx context.Context, transactionID, adminID uuid.UUID, reason string) (*models.TransferReversal, error) {
+	return r.primary.ForceReversal(ctx, transactionID, adminID, reason)
+}
+
+func (r *replicatedCoinRepository) GetReversals(ctx context.Context, userID uuid.UUID, reversals *[]models.TransferReversal) error {
+	return r.reader(userID).GetReversals(ctx, userID, reversals)
+}
+
+func (r *replicatedCoinRepository) GetTransferLimits(ctx context.Context, userID uuid.UUID) (*models.UserTransferLimits, error) {
+	return r.reader(userID).GetTransferLimits(ctx, userID)
+}
+
+func (r *replicatedCoinRepository) SetTransferLimits(ctx context.Context, userID, adminID uuid.UUID, override models.TransferLimitsOverride) (*models.UserTransferLimits, error) {
+	return r.primary.SetTransferLimits(ctx, userID, adminID, override)
+}
+
+func (r *replicatedCoinRepository) GrantCoins(ctx context.Context, userID uuid.UUID, amount int64) error {
+	return r.primary.GrantCoins(ctx, userID, amount)
+}
+
+func (r *replicatedCoinRepository) GetExpiringCoins(ctx context.Context, userID uuid.UUID) (*models.ExpiringCoins, error) {
+	return r.reader(userID).GetExpiringCoins(ctx, userID)
+}
+
+func (r *replicatedCoinRepository) ExpireLots(ctx context.Context) (int64, error) {
+	return r.primary.ExpireLots(ctx)
+}
+
+func (r *replicatedCoinRepository) HoldCoins(ctx context.Context, userID, createdBy uuid.UUID, request models.HoldRequest) (*models.CoinHold, error) {
+	return r.primary.HoldCoins(ctx, userID, createdBy, request)
+}
+
+func (r *replicatedCoinRepository) CaptureHold(ctx context.Context, holdID uuid.UUID) (*models.CoinHold, error) {
+	return r.primary.CaptureHold(ctx, holdID)
+}
+
+func (r *replicatedCoinRepository) ReleaseHold(ctx context.Context, holdID uuid.UUID) (*models.CoinHold, error) {
+	return r.primary.ReleaseHold(ctx, holdID)
+}
+
+func (r *replicatedCoinRepository) ReleaseExpiredHolds(ctx context.Context) (int64, error) {
+	return r.primary.ReleaseExpiredHolds(ctx)
+}
@@ -0,0 +1,157 @@
+package repository
+
+import (
+	"context"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/models"
+	mock_repository "github.com/Ki4EH/stunning-octo-waddle/internal/mocks/repository"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"testing"
+)
+
+// fixedRouter всегда выбирает одну и ту же реплику.
+type fixedRouter int
+
+func (r fixedRouter) Replica(uuid.UUID) int { return int(r) }
+
+func TestReplicatedUserRepository(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+
+	tests := []struct {
+		name       string
+		replica    int
+		setupMocks func(primary, replica *mock_repository.MockUserRepository)
+		call       func(repo UserRepository) error
+	}{
+		{
+			name:    "user read goes to replica",
+			replica: 0,
+			setupMocks: func(primary, replica *mock_repository.MockUserRepository) {
+				replica.EXPECT().GetUserByID(ctx, userID).Return(&models.Credential{ID: userID}, nil)
+			},
+			call: func(repo UserRepository) error {
+				_, err := repo.GetUserByID(ctx, userID)
+				return err
+			},
+		},
+		{
+			name:    "read goes to primary when router says so",
+			replica: -1,
+			setupMocks: func(primary, replica *mock_repository.MockUserRepository) {
+				primary.EXPECT().GetUserItems(ctx, userID, gomock.Any()).Return(nil)
+			},
+			call: func(repo UserRepository) error {
+				var items []models.UserItem
+				return repo.GetUserItems(ctx, userID, &items)
+			},
+		},
+		{
+			name:    "login always reads primary",
+			replica: 0,
+			setupMocks: func(primary, replica *mock_repository.MockUserRepository) {
+				primary.EXPECT().GetUserCredentialByName(ctx, "alice").Return(&models.Credential{}, nil)
+			},
+			call: func(repo UserRepository) error {
+				_, err := repo.GetUserCredentialByName(ctx, "alice")
+				return err
+			},
+		},
+		{
+			name:    "registration goes to primary",
+			replica: 0,
+			setupMocks: func(primary, replica *mock_repository.MockUserRepository) {
+				primary.EXPECT().CreateUserCredential(ctx, gomock.Any()).Return(nil)
+			},
+			call: func(repo UserRepository) error {
+				return repo.CreateUserCredential(ctx, &models.Credential{Username: "alice"})
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			primary := mock_repository.NewMockUserRepository(ctrl)
+			replica := mock_repository.NewMockUserRepository(ctrl)
+			tt.setupMocks(primary, replica)
+
+			repo := NewReplicatedUserRepository(primary, []UserRepository{replica}, fixedRouter(tt.replica))
+
+			require.NoError(t, tt.call(repo))
+		})
+	}
+}
+
+func TestReplicatedCoinRepository(t *testing.T) {
+	ctx := context.Background()
+	fromID, toID := uuid.New(), uuid.New()
+
+	tests := []struct {
+		name       string
+		replica    int
+		setupMocks func(primary, replica *mock_repository.MockCoinRepository)
+		call       func(repo CoinRepository) error
+	}{
+		{
+			name:    "transactions are read from chosen replica",
+			replica: 1,
+			setupMocks: func(primary, replica *mock_repository.MockCoinRepository) {
+				replica.EXPECT().GetTransactions(ctx, fromID, gomock.Any()).Return(nil)
+			},
+			call: func(repo CoinRepository) error {
+				var transactions []models.Transaction
+				return repo.GetTransactions(ctx, fromID, &transactions)
+			},
+		},
+		{
+			name:    "expiring coins are read from primary when replicas lag",
+			replica: -1,
+			setupMocks: func(primary, replica *mock_repository.MockCoinRepository) {
+				primary.EXPECT().GetExpiringCoins(ctx, fromID).Return(&models.ExpiringCoins{}, nil)
+			},
+			call: func(repo CoinRepository) error {
+				_, err := repo.GetExpiringCoins(ctx, fromID)
+				return err
+			},
+		},
+		{
+			name:    "transfer goes to primary",
+			replica: 0,
+			setupMocks: func(primary, replica *mock_repository.MockCoinRepository) {
+				primary.EXPECT().SendCoins(ctx, fromID, toID, int64(10)).Return(nil)
+			},
+			call: func(repo CoinRepository) error {
+				return repo.SendCoins(ctx, fromID, toID, 10)
+			},
+		},
+		{
+			name:    "background expiry runs on primary",
+			replica: 0,
+			setupMocks: func(primary, replica *mock_repository.MockCoinRepository) {
+				primary.EXPECT().ExpireLots(ctx).Return(int64(5), nil)
+			},
+			call: func(repo CoinRepository) error {
+				_, err := repo.ExpireLots(ctx)
+				return err
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			primary := mock_repository.NewMockCoinRepository(ctrl)
+			replicas := []*mock_repository.MockCoinRepository{
+				mock_repository.NewMockCoinRepository(ctrl),
+				mock_repository.NewMockCoinRepository(ctrl),
+			}
+			tt.setupMocks(primary, replicas[max(tt.replica, 0)])
+
+			repo := NewReplicatedCoinRepository(primary, []CoinRepository{replicas[0], replicas[1]}, fixedRouter(tt.replica))
+
+			require.NoError(t, tt.call(repo))
+		})
+	}
+}
@@ -0,0 +1,666 @@
+// Package repotest — общий набор тестов для реализаций репозиториев. Его
+// проходят и Postgres (в e2e), и хранилище в памяти, поэтому семантика
+// баланса, ошибок и атомарности у них совпадает.
+package repotest
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/models"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/repository"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+	"time"
+)
+
+// StartingCoins — баланс только что созданного пользователя.
+const StartingCoins = 1000
+
+// Backend — проверяемые репозитории над одним хранилищем.
+type Backend struct {
+	Users    repository.UserRepository
+	Coins    repository.CoinRepository
+	Events   repository.EventRepository
+	Webhooks repository.WebhookRepository
+}
+
+// Factory создаёт пустое хранилище с каталогом магазина из миграций.
+type Factory func(t *testing.T, opts repository.CoinOptions) Backend
+
+// Run запускает весь набор. Каждый тест получает новое хранилище.
+func Run(t *testing.T, newBackend Factory) {
+	tests := []struct {
+		name string
+		opts repository.CoinOptions
+		run  func(t *testing.T, b Backend)
+	}{
+		{name: "users", run: testUsers},
+		{name: "purchase", run: testPurchase},
+		{name: "transfer", run: testTransfer},
+		{name: "history", run: testHistory},
+		{name: "concurrent transfers", run: testConcurrentTransfers},
+		{name: "transfer limits", opts: repository.CoinOptions{Limits: models.TransferLimits{
+			MaxPerTransfer: 100, MaxDailyTotal: 150, MaxDailyRecipients: 2,
+		}}, run: testTransferLimits},
+		{name: "coin expiry", opts: repository.CoinOptions{CoinLifetime: 200 * time.Millisecond}, run: testCoinExpiry},
+		{name: "holds", run: testHolds},
+		{name: "hold expiry", opts: repository.CoinOptions{HoldTTL: 200 * time.Millisecond}, run: testHoldExpiry},
+		{name: "reversals", run: testReversals},
+		{name: "events", run: testEvents},
+		{name: "webhooks", run: testWebhooks},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.run(t, newBackend(t, tt.opts))
+		})
+	}
+}
+
+func createUser(t *testing.T, b Backend, name string) uuid.UUID {
+	t.Helper()
+	credential := &models.Credential{Username: name, Password: "secret"}
+	require.NoError(t, b.Users.CreateUserCredential(context.Background(), credential))
+	require.NotEqual(t, uuid.Nil, credential.ID)
+	return credential.ID
+}
+
+func balance(t *testing.T, b Backend, userID uuid.UUID) (coin, held int64) {
+	t.Helper()
+	user, err := b.Users.GetUserByID(context.Background(), userID)
+	require.NoError(t, err)
+	return user.Coin, user.Held
+}
+
+func requireBalance(t *testing.T, b Backend, userID uuid.UUID, expected int64) {
+	t.Helper()
+	coin, _ := balance(t, b, userID)
+	require.Equal(t, expected, coin)
+}
+
+func items(t *testing.T, b Backend, userID uuid.UUID) []models.UserItem {
+	t.Helper()
+	var userItems []models.UserItem
+	require.NoError(t, b.Users.GetUserItems(context.Background(), userID, &userItems))
+	return userItems
+}
+
+func eventTypes(t *testing.T, b Backend, userID uuid.UUID) []string {
+	t.Helper()
+	events, err := b.Events.GetEventsAfter(context.Background(), userID, 0, 100)
+	require.NoError(t, err)
+	types := make([]string, 0, len(events))
+	for _, e := range events {
+		types = append(types, e.Type)
+	}
+	return types
+}
+
+func testUsers(t *testing.T, b Backend) {
+	ctx := context.Background()
+	aliceID := createUser(t, b, "alice")
+	bobID := createUser(t, b, "bob")
+
+	alice, err := b.Users.GetUserCredentialByName(ctx, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, aliceID, alice.ID)
+	assert.Equal(t, "secret", alice.Password)
+
+	// Неизвестное имя — пустая структура без ошибки
+	unknown, err := b.Users.GetUserCredentialByName(ctx, "nobody")
+	require.NoError(t, err)
+	assert.Equal(t, uuid.Nil, unknown.ID)
+
+	assert.Error(t, b.Users.CreateUserCredential(ctx, &models.Credential{Username: "alice", Password: "other"}))
+
+	user, err := b.Users.GetUserByID(ctx, aliceID)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", user.Username)
+	assert.Equal(t, int64(StartingCoins), user.Coin)
+	assert.Zero(t, user.Held)
+	assert.False(t, user.IsAdmin)
+
+	_, err = b.Users.GetUserByID(ctx, uuid.New())
+	assert.Error(t, err)
+
+	assert.Empty(t, items(t, b, aliceID))
+
+	names, err := b.Users.GetUsernamesByIDs(ctx, []string{aliceID.String(), bobID.String(), uuid.NewString()})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{aliceID.String(): "alice", bobID.String(): "bob"}, names)
+
+	// Стартовые монеты сгорают через срок по умолчанию
+	expiring, err := b.Coins.GetExpiringCoins(ctx, aliceID)
+	require.NoError(t, err)
+	assert.Zero(t, expiring.Amount)
+}
+
+func testPurchase(t *testing.T, b Backend) {
+	ctx := context.Background()
+	userID := createUser(t, b, "alice")
+
+	require.NoError(t, b.Coins.BuyItemFromShop(ctx, userID, "cup"))
+	require.NoError(t, b.Coins.BuyItemFromShop(ctx, userID, "cup"))
+	require.NoError(t, b.Coins.BuyItemFromShop(ctx, userID, "pen"))
+	requireBalance(t, b, userID, StartingCoins-20-20-10)
+	assert.ElementsMatch(t, []models.UserItem{{Type: "cup", Quantity: 2}, {Type: "pen", Quantity: 1}}, items(t, b, userID))
+
+	assert.ErrorIs(t, b.Coins.BuyItemFromShop(ctx, userID, "car"), repository.ErrItemNotFound)
+	assert.ErrorIs(t, b.Coins.BuyItemFromShop(ctx, uuid.New(), "cup"), repository.ErrUserNotFound)
+
+	// 950 монет: одна розовая толстовка за 500, на вторую не хватает
+	require.NoError(t, b.Coins.BuyItemFromShop(ctx, userID, "pink-hoody"))
+	assert.ErrorIs(t, b.Coins.BuyItemFromShop(ctx, userID, "pink-hoody"), repository.ErrInsufficientBalance)
+	requireBalance(t, b, userID, 450)
+	assert.Len(t, items(t, b, userID), 3)
+
+	assert.Equal(t, []string{
+		models.EventPurchaseCompleted, models.EventPurchaseCompleted, models.EventPurchaseCompleted, models.EventPurchaseCompleted,
+	}, eventTypes(t, b, userID))
+}
+
+func testTransfer(t *testing.T, b Backend) {
+	ctx := context.Background()
+	aliceID := createUser(t, b, "alice")
+	bobID := createUser(t, b, "bob")
+
+	require.NoError(t, b.Coins.SendCoins(ctx, aliceID, bobID, 300))
+	requireBalance(t, b, aliceID, StartingCoins-300)
+	requireBalance(t, b, bobID, StartingCoins+300)
+
+	tests := []struct {
+		name     string
+		from, to uuid.UUID
+		amount   int64
+		expected error
+	}{
+		{name: "zero amount", from: aliceID, to: bobID, amount: 0, expected: repository.ErrInvalidAmount},
+		{name: "negative amount", from: aliceID, to: bobID, amount: -5, expected: repository.ErrInvalidAmount},
+		{name: "self", from: aliceID, to: aliceID, amount: 1, expected: repository.ErrSelfTransfer},
+		{name: "insufficient balance", from: aliceID, to: bobID, amount: 701, expected: repository.ErrInsufficientBalance},
+		{name: "unknown sender", from: uuid.New(), to: bobID, amount: 1, expected: repository.ErrSenderNotFound},
+		{name: "unknown receiver", from: aliceID, to: uuid.New(), amount: 1, expected: repository.ErrReceiverNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.ErrorIs(t, b.Coins.SendCoins(ctx, tt.from, tt.to, tt.amount), tt.expected)
+		})
+	}
+
+	// Неудачные переводы ничего не меняют
+	requireBalance(t, b, aliceID, StartingCoins-300)
+	requireBalance(t, b, bobID, StartingCoins+300)
+
+	var transactions []models.Transaction
+	require.NoError(t, b.Coins.GetTransactions(ctx, bobID, &transactions))
+	require.Len(t, transactions, 1)
+	assert.Equal(t, "alice", transactions[0].FromUser)
+	assert.Equal(t, "bob", transactions[0].ToUser)
+	assert.Equal(t, int64(300), transactions[0].Amount)
+	assert.False(t, transactions[0].Reversed)
+
+	assert.Equal(t, []string{models.EventCoinsSent}, eventTypes(t, b, aliceID))
+	events, err := b.Events.GetEventsAfter(ctx, bobID, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	var received models.CoinsReceivedEvent
+	require.NoError(t, json.Unmarshal(events[0].Payload, &received))
+	assert.Equal(t, models.CoinsReceivedEvent{TransactionID: transactions[0].ID, FromUser: "alice", Amount: 300}, received)
+
+	// Монеты переходят вместе со сроком, поэтому все еще не сгорают скоро
+	expiring, err := b.Coins.GetExpiringCoins(ctx, bobID)
+	require.NoError(t, err)
+	assert.Zero(t, expiring.Amount)
+}
+
+func testHistory(t *testing.T, b Backend) {
+	ctx := context.Background()
+	aliceID := createUser(t, b, "alice")
+	bobID := createUser(t, b, "bob")
+
+	for i := 1; i <= 5; i++ {
+		from, to := aliceID, bobID
+		if i%2 == 0 {
+			from, to = bobID, aliceID
+		}
+		require.NoError(t, b.Coins.SendCoins(ctx, from, to, int64(i)))
+	}
+
+	var pages [][]models.HistoryEntry
+	var cursor *models.HistoryCursor
+	for {
+		page, err := b.Coins.GetHistory(ctx, aliceID, 2, cursor)
+		require.NoError(t, err)
+		if len(page) == 0 {
+			break
+		}
+		pages = append(pages, page)
+		last := page[len(page)-1]
+		cursor = &models.HistoryCursor{CreatedAt: last.CreatedAt, ID: last.ID}
+	}
+
+	require.Len(t, pages, 3)
+	var amounts []int64
+	for _, page := range pages {
+		for _, e := range page {
+			amounts = append(amounts, e.Amount)
+			assert.Equal(t, "bob", e.Counterparty)
+			if e.Amount%2 == 0 {
+				assert.Equal(t, models.HistoryReceived, e.Direction)
+			} else {
+				assert.Equal(t, models.HistorySent, e.Direction)
+			}
+		}
+	}
+	assert.Equal(t, []int64{5, 4, 3, 2, 1}, amounts)
+}
+
+// testConcurrentTransfers гоняет встречные переводы: баланс не уходит в
+// минус, а сумма монет сохраняется.
+func testConcurrentTransfers(t *testing.T, b Backend) {
+	ctx := context.Background()
+	aliceID := createUser(t, b, "alice")
+	bobID := createUser(t, b, "bob")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_ = b.Coins.SendCoins(ctx, aliceID, bobID, 150)
+		}()
+		go func() {
+			defer wg.Done()
+			_ = b.Coins.SendCoins(ctx, bobID, aliceID, 100)
+		}()
+	}
+	wg.Wait()
+
+	aliceCoins, _ := balance(t, b, aliceID)
+	bobCoins, _ := balance(t, b, bobID)
+	assert.GreaterOrEqual(t, aliceCoins, int64(0))
+	assert.GreaterOrEqual(t, bobCoins, int64(0))
+	assert.Equal(t, int64(2*StartingCoins), aliceCoins+bobCoins)
+}
+
+func testTransferLimits(t *testing.T, b Backend) {
+	ctx := context.Background()
+	aliceID := createUser(t, b, "alice")
+	bobID := createUser(t, b, "bob")
+	carolID := createUser(t, b, "carol")
+	daveID := createUser(t, b, "dave")
+
+	assert.ErrorIs(t, b.Coins.SendCoins(ctx, aliceID, bobID, 101), repository.ErrTransferLimitExceeded)
+	require.NoError(t, b.Coins.SendCoins(ctx, aliceID, bobID, 100))
+	assert.ErrorIs(t, b.Coins.SendCoins(ctx, aliceID, bobID, 51), repository.ErrDailyLimitExceeded)
+	require.NoError(t, b.Coins.SendCoins(ctx, aliceID, carolID, 10))
+	assert.ErrorIs(t, b.Coins.SendCoins(ctx, aliceID, daveID, 10), repository.ErrDailyRecipientsExceeded)
+	// Уже известному получателю можно отправить и сверх лимита получателей
+	require.NoError(t, b.Coins.SendCoins(ctx, aliceID, bobID, 10))
+
+	unlimited := int64(0)
+	more := int64(3)
+	_, err := b.Coins.SetTransferLimits(ctx, aliceID, bobID, models.TransferLimitsOverride{MaxDailyTotal: &unlimited, MaxDailyRecipients: &more})
+	require.NoError(t, err)
+
+	limits, err := b.Coins.GetTransferLimits(ctx, aliceID)
+	require.NoError(t, err)
+	assert.Equal(t, models.TransferLimits{MaxPerTransfer: 100, MaxDailyTotal: 0, MaxDailyRecipients: 3}, limits.Effective)
+	require.NoError(t, b.Coins.SendCoins(ctx, aliceID, daveID, 100))
+
+	negative := int64(-1)
+	_, err = b.Coins.SetTransferLimits(ctx, aliceID, bobID, models.TransferLimitsOverride{MaxPerTransfer: &negative})
+	assert.ErrorIs(t, err, repository.ErrNegativeLimits)
+
+	// Лимиты других пользователей не затронуты
+	limits, err = b.Coins.GetTransferLimits(ctx, bobID)
+	require.NoError(t, err)
+	assert.Equal(t, models.TransferLimits{MaxPerTransfer: 100, MaxDailyTotal: 150, MaxDailyRecipients: 2}, limits.Effective)
+	assert.Nil(t, limits.Override.MaxPerTransfer)
+}
+
+func testCoinExpiry(t *testing.T, b Backend) {
+	ctx := context.Background()
+	aliceID := createUser(t, b, "alice")
+	bobID := createUser(t, b, "bob")
+
+	expiring, err := b.Coins.GetExpiringCoins(ctx, aliceID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(StartingCoins), expiring.Amount)
+
+	time.Sleep(300 * time.Millisecond)
+
+	// Просроченные монеты нельзя потратить, даже если фоновое списание
+	// еще не прошло
+	assert.ErrorIs(t, b.Coins.SendCoins(ctx, aliceID, bobID, 1), repository.ErrInsufficientBalance)
+
+	expired, err := b.Coins.ExpireLots(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2*StartingCoins), expired)
+	requireBalance(t, b, aliceID, 0)
+	requireBalance(t, b, bobID, 0)
+	// По событию сбрасывается кеш /api/info
+	assert.Contains(t, eventTypes(t, b, aliceID), models.EventCoinsExpired)
+	assert.Contains(t, eventTypes(t, b, bobID), models.EventCoinsExpired)
+
+	expired, err = b.Coins.ExpireLots(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, expired)
+
+	assert.ErrorIs(t, b.Coins.GrantCoins(ctx, aliceID, 0), repository.ErrInvalidAmount)
+	assert.ErrorIs(t, b.Coins.GrantCoins(ctx, uuid.New(), 10), repository.ErrUserNotFound)
+	require.NoError(t, b.Coins.GrantCoins(ctx, aliceID, 50))
+	requireBalance(t, b, aliceID, 50)
+	assert.Contains(t, eventTypes(t, b, aliceID), models.EventCoinsGranted)
+}
+
+func testHolds(t *testing.T, b Backend) {
+	ctx := context.Background()
+	aliceID := createUser(t, b, "alice")
+	bobID := createUser(t, b, "bob")
+
+	_, err := b.Coins.HoldCoins(ctx, aliceID, bobID, models.HoldRequest{Amount: 0})
+	assert.ErrorIs(t, err, repository.ErrInvalidAmount)
+	_, err = b.Coins.HoldCoins(ctx, uuid.New(), bobID, models.HoldRequest{Amount: 10})
+	assert.ErrorIs(t, err, repository.ErrUserNotFound)
+	_, err = b.Coins.HoldCoins(ctx, aliceID, bobID, models.HoldRequest{Amount: StartingCoins + 1})
+	assert.ErrorIs(t, err, repository.ErrInsufficientBalance)
+
+	hold, err := b.Coins.HoldCoins(ctx, aliceID, bobID, models.HoldRequest{Amount: 600, Reason: "order", TTLSeconds: 60})
+	require.NoError(t, err)
+	assert.Equal(t, models.HoldStatusHeld, hold.Status)
+	assert.Equal(t, "order", hold.Reason)
+	assert.WithinDuration(t, hold.CreatedAt.Add(time.Minute), hold.ExpiresAt, time.Second)
+
+	coin, held := balance(t, b, aliceID)
+	assert.Equal(t, int64(StartingCoins), coin)
+	assert.Equal(t, int64(600), held)
+
+	// Зарезервированные монеты нельзя потратить
+	assert.ErrorIs(t, b.Coins.SendCoins(ctx, aliceID, bobID, 401), repository.ErrInsufficientBalance)
+	assert.ErrorIs(t, b.Coins.BuyItemFromShop(ctx, aliceID, "pink-hoody"), repository.ErrInsufficientBalance)
+
+	captured, err := b.Coins.CaptureHold(ctx, hold.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.HoldStatusCaptured, captured.Status)
+	assert.NotNil(t, captured.ResolvedAt)
+	coin, held = balance(t, b, aliceID)
+	assert.Equal(t, int64(400), coin)
+	assert.Zero(t, held)
+
+	_, err = b.Coins.CaptureHold(ctx, hold.ID)
+	assert.ErrorIs(t, err, repository.ErrHoldNotActive)
+	_, err = b.Coins.ReleaseHold(ctx, uuid.New())
+	assert.ErrorIs(t, err, repository.ErrHoldNotFound)
+
+	second, err := b.Coins.HoldCoins(ctx, aliceID, bobID, models.HoldRequest{Amount: 100})
+	require.NoError(t, err)
+	released, err := b.Coins.ReleaseHold(ctx, second.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.HoldStatusReleased, released.Status)
+	coin, held = balance(t, b, aliceID)
+	assert.Equal(t, int64(400), coin)
+	assert.Zero(t, held)
+
+	// Каждый этап холда меняет доступный баланс и сбрасывает кеш /api/info
+	types := eventTypes(t, b, aliceID)
+	assert.Contains(t, types, models.EventHoldCreated)
+	assert.Contains(t, types, models.EventHoldCaptured)
+	assert.Contains(t, types, models.EventHoldReleased)
+}
+
+func testHoldExpiry(t *testing.T, b Backend) {
+	ctx := context.Background()
+	aliceID := createUser(t, b, "alice")
+
+	hold, err := b.Coins.HoldCoins(ctx, aliceID, aliceID, models.HoldRequest{Amount: 100})
+	require.NoError(t, err)
+
+	time.Sleep(300 * time.Millisecond)
+
+	// Истекший холд перестает учитываться сразу
+	_, held := balance(t, b, aliceID)
+	assert.Zero(t, held)
+	_, err = b.Coins.CaptureHold(ctx, hold.ID)
+	assert.ErrorIs(t, err, repository.ErrHoldNotActive)
+
+	released, err := b.Coins.ReleaseExpiredHolds(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), released)
+	assert.Contains(t, eventTypes(t, b, aliceID), models.EventHoldExpired)
+	released, err = b.Coins.ReleaseExpiredHolds(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, released)
+}
+
+func testReversals(t *testing.T, b Backend) {
+	ctx := context.Background()
+	aliceID := createUser(t, b, "alice")
+	bobID := createUser(t, b, "bob")
+	adminID := createUser(t, b, "admin")
+
+	transfer := func(amount int64) uuid.UUID {
+		t.Helper()
+		require.NoError(t, b.Coins.SendCoins(ctx, aliceID, bobID, amount))
+		history, err := b.Coins.GetHistory(ctx, aliceID, 1, nil)
+		require.NoError(t, err)
+		return history[0].ID
+	}
+
+	first := transfer(100)
+
+	_, err := b.Coins.RequestReversal(ctx, uuid.New(), aliceID, "")
+	assert.ErrorIs(t, err, repository.ErrTransactionNotFound)
+	_, err = b.Coins.RequestReversal(ctx, first, bobID, "")
+	assert.ErrorIs(t, err, repository.ErrNotTransactionSender)
+
+	request, err := b.Coins.RequestReversal(ctx, first, aliceID, "typo")
+	require.NoError(t, err)
+	assert.Equal(t, models.ReversalStatusPending, request.Status)
+	assert.Equal(t, "alice", request.FromUser)
+	assert.Equal(t, "bob", request.ToUser)
+	assert.Equal(t, int64(100), request.Amount)
+	assert.Equal(t, "typo", request.Reason)
+
+	_, err = b.Coins.RequestReversal(ctx, first, aliceID, "again")
+	assert.ErrorIs(t, err, repository.ErrReversalAlreadyExists)
+	_, err = b.Coins.ApproveReversal(ctx, request.ID, aliceID)
+	assert.ErrorIs(t, err, repository.ErrNotTransactionRecipient)
+	_, err = b.Coins.ApproveReversal(ctx, uuid.New(), bobID)
+	assert.ErrorIs(t, err, repository.ErrReversalNotFound)
+
+	approved, err := b.Coins.ApproveReversal(ctx, request.ID, bobID)
+	require.NoError(t, err)
+	assert.Equal(t, models.ReversalStatusApproved, approved.Status)
+	require.NotNil(t, approved.CompensationID)
+	requireBalance(t, b, aliceID, StartingCoins)
+	requireBalance(t, b, bobID, StartingCoins)
+
+	_, err = b.Coins.RejectReversal(ctx, request.ID, bobID)
+	assert.ErrorIs(t, err, repository.ErrReversalNotPending)
+	_, err = b.Coins.RequestReversal(ctx, first, aliceID, "")
+	assert.ErrorIs(t, err, repository.ErrAlreadyReversed)
+	_, err = b.Coins.ForceReversal(ctx, *approved.CompensationID, adminID, "")
+	assert.ErrorIs(t, err, repository.ErrCompensatingReversal)
+
+	var transactions []models.Transaction
+	require.NoError(t, b.Coins.GetTransactions(ctx, aliceID, &transactions))
+	require.Len(t, transactions, 2)
+	for _, tr := range transactions {
+		if tr.ID == first {
+			assert.True(t, tr.Reversed)
+		} else {
+			assert.Equal(t, &first, tr.ReversalOf)
+		}
+	}
+
+	second := transfer(50)
+	request, err = b.Coins.RequestReversal(ctx, second, aliceID, "")
+	require.NoError(t, err)
+	rejected, err := b.Coins.RejectReversal(ctx, request.ID, bobID)
+	require.NoError(t, err)
+	assert.Equal(t, models.ReversalStatusRejected, rejected.Status)
+	assert.Nil(t, rejected.CompensationID)
+	requireBalance(t, b, bobID, StartingCoins+50)
+
+	// Принудительная отмена закрывает ожидающий запрос
+	third := transfer(30)
+	request, err = b.Coins.RequestReversal(ctx, third, aliceID, "")
+	require.NoError(t, err)
+	forced, err := b.Coins.ForceReversal(ctx, third, adminID, "fraud")
+	require.NoError(t, err)
+	assert.Equal(t, request.ID, forced.ID)
+	assert.Equal(t, models.ReversalStatusForced, forced.Status)
+
+	forced, err = b.Coins.ForceReversal(ctx, second, adminID, "fraud")
+	require.NoError(t, err)
+	assert.NotEqual(t, rejected.ID, forced.ID)
+	assert.Equal(t, "fraud", forced.Reason)
+	requireBalance(t, b, aliceID, StartingCoins)
+	requireBalance(t, b, bobID, StartingCoins)
+
+	// Отмена не проходит, если получатель уже потратил монеты
+	fourth := transfer(500)
+	require.NoError(t, b.Coins.SendCoins(ctx, bobID, adminID, StartingCoins+500))
+	_, err = b.Coins.ForceReversal(ctx, fourth, adminID, "")
+	assert.ErrorIs(t, err, repository.ErrInsufficientBalance)
+
+	var reversals []models.TransferReversal
+	require.NoError(t, b.Coins.GetReversals(ctx, bobID, &reversals))
+	assert.Len(t, reversals, 4)
+}
+
+func testEvents(t *testing.T, b Backend) {
+	ctx := context.Background()
+	aliceID := createUser(t, b, "alice")
+	bobID := createUser(t, b, "bob")
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, b.Coins.SendCoins(ctx, aliceID, bobID, 1))
+	}
+
+	events, err := b.Events.GetEventsAfter(ctx, bobID, 0, 2)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Less(t, events[0].ID, events[1].ID)
+
+	rest, err := b.Events.GetEventsAfter(ctx, bobID, events[1].ID, 10)
+	require.NoError(t, err)
+	require.Len(t, rest, 1)
+	assert.Equal(t, bobID, rest[0].UserID)
+	assert.Equal(t, models.EventCoinsReceived, rest[0].Type)
+
+	deleted, err := b.Events.DeleteEventsBefore(ctx, time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Zero(t, deleted)
+	deleted, err = b.Events.DeleteEventsBefore(ctx, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), deleted)
+	assert.Empty(t, eventTypes(t, b, bobID))
+}
+
+func testWebhooks(t *testing.T, b Backend) {
+	ctx := context.Background()
+	aliceID := createUser(t, b, "alice")
+	bobID := createUser(t, b, "bob")
+
+	transfers, err := b.Webhooks.CreateWebhook(ctx, models.WebhookRequest{
+		URL: "https://example.com/transfers", Secret: "s1", EventTypes: []string{models.OutboxTransferCompleted},
+	})
+	require.NoError(t, err)
+	all, err := b.Webhooks.CreateWebhook(ctx, models.WebhookRequest{URL: "https://example.com/all", Secret: "s2"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{}, all.EventTypes)
+
+	webhooks, err := b.Webhooks.GetWebhooks(ctx)
+	require.NoError(t, err)
+	require.Len(t, webhooks, 2)
+	assert.Empty(t, webhooks[0].Secret)
+
+	require.NoError(t, b.Coins.SendCoins(ctx, aliceID, bobID, 10))
+	require.NoError(t, b.Coins.BuyItemFromShop(ctx, aliceID, "cup"))
+	// Неудачная операция не оставляет событий
+	require.Error(t, b.Coins.BuyItemFromShop(ctx, aliceID, "car"))
+
+	claimed, err := b.Webhooks.ClaimDeliveries(ctx, 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, claimed, 3)
+	for _, d := range claimed {
+		assert.Equal(t, 1, d.Attempts)
+		if d.Event.Type == models.OutboxPurchaseCompleted {
+			assert.Equal(t, all.URL, d.URL)
+			var purchase models.PurchaseOutboxEvent
+			require.NoError(t, json.Unmarshal(d.Event.Data, &purchase))
+			assert.Equal(t, models.PurchaseOutboxEvent{User: "alice", Item: "cup", Price: 20}, purchase)
+		}
+	}
+
+	// Взятые доставки отложены на время аренды
+	again, err := b.Webhooks.ClaimDeliveries(ctx, 10, time.Minute)
+	require.NoError(t, err)
+	assert.Empty(t, again)
+
+	for _, d := range claimed {
+		if d.URL == transfers.URL {
+			require.NoError(t, b.Webhooks.MarkDelivered(ctx, d.ID, 200))
+		} else {
+			require.NoError(t, b.Webhooks.MarkFailed(ctx, d.ID, 503, "unexpected status 503", nil))
+		}
+	}
+
+	delivered, err := b.Webhooks.GetDeliveries(ctx, transfers.ID, models.DeliveryStatusDelivered, 10)
+	require.NoError(t, err)
+	require.Len(t, delivered, 1)
+	assert.Equal(t, 200, *delivered[0].LastStatus)
+	assert.NotNil(t, delivered[0].DeliveredAt)
+
+	dead, err := b.Webhooks.GetDeliveries(ctx, all.ID, models.DeliveryStatusDead, 10)
+	require.NoError(t, err)
+	require.Len(t, dead, 2)
+	assert.Greater(t, dead[0].ID, dead[1].ID)
+	assert.Equal(t, "unexpected status 503", *dead[0].LastError)
+
+	_, err = b.Webhooks.GetDeliveries(ctx, uuid.New(), "", 10)
+	assert.ErrorIs(t, err, repository.ErrWebhookNotFound)
+
+	// Событие перевода доставлено не всем, поэтому не удаляется
+	deleted, err := b.Webhooks.DeleteOutboxBefore(ctx, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.Zero(t, deleted)
+
+	replayed, err := b.Webhooks.ReplayDeliveries(ctx, all.ID, models.ReplayRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), replayed)
+	claimed, err = b.Webhooks.ClaimDeliveries(ctx, 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, claimed, 2)
+	for _, d := range claimed {
+		assert.Equal(t, 1, d.Attempts)
+		retryAt := time.Now().Add(-time.Second)
+		require.NoError(t, b.Webhooks.MarkFailed(ctx, d.ID, 0, "connection refused", &retryAt))
+	}
+
+	pending, err := b.Webhooks.GetDeliveries(ctx, all.ID, models.DeliveryStatusPending, 10)
+	require.NoError(t, err)
+	require.Len(t, pending, 2)
+	assert.Nil(t, pending[0].LastStatus)
+
+	claimed, err = b.Webhooks.ClaimDeliveries(ctx, 1, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	assert.Equal(t, 2, claimed[0].Attempts)
+
+	_, err = b.Webhooks.ReplayDeliveries(ctx, uuid.New(), models.ReplayRequest{})
+	assert.ErrorIs(t, err, repository.ErrWebhookNotFound)
+
+	require.NoError(t, b.Webhooks.DeleteWebhook(ctx, all.ID))
+	assert.ErrorIs(t, b.Webhooks.DeleteWebhook(ctx, all.ID), repository.ErrWebhookNotFound)
+
+	// После удаления получателя событие перевода доставлено всем
+	deleted, err = b.Webhooks.DeleteOutboxBefore(ctx, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), deleted)
+}
@@ -0,0 +1,286 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/models"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/logger"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/metrics"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.uber.org/zap"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// ReadRetry — сколько раз повторять чтение после обрыва соединения.
+type ReadRetry struct {
+	// Всего попыток, 1 — без повторов
+	Attempts int
+	// Пауза перед второй попыткой, дальше растёт вдвое
+	BaseDelay time.Duration
+}
+
+// Обёртки повторяют чтения, упавшие из-за соединения: база перезапустилась,
+// соединение закрыл балансировщик или реплика недоступна. Чтение не меняет
+// данных, поэтому его можно повторить, даже если запрос дошёл до базы.
+// Записи не повторяются: после обрыва неизвестно, применилась ли она.
+
+// isTransient сообщает, что ошибка вызвана соединением, а не запросом.
+func isTransient(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if pgconn.SafeToRetry(err) {
+		return true
+	}
+	var connectErr *pgconn.ConnectError
+	if errors.As(err, &connectErr) {
+		return true
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		// 08 — ошибки соединения, 57P01–57P03 — сервер останавливается или
+		// ещё не принимает подключения
+		return strings.HasPrefix(pgErr.Code, "08") ||
+			pgErr.Code == "57P01" || pgErr.Code == "57P02" || pgErr.Code == "57P03"
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+func retryRead(ctx context.Context, retry ReadRetry, read func() error) error {
+	delay := retry.BaseDelay
+	for attempt := 1; ; attempt++ {
+		err := read()
+		if err == nil || attempt >= retry.Attempts || !isTransient(err) {
+			return err
+		}
+		metrics.DBReadRetries.Inc()
+		logger.FromContext(ctx).Warn("retrying read", zap.Int("attempt", attempt), zap.Error(err))
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+func retryValue[T any](ctx context.Context, retry ReadRetry, read func() (T, error)) (T, error) {
+	var value T
+	err := retryRead(ctx, retry, func() (err error) {
+		value, err = read()
+		return err
+	})
+	return value, err
+}
+
+// retryInto повторяет чтение в срез, отбрасывая строки неудачной попытки.
+func retryInto[T any](ctx context.Context, retry ReadRetry, into *[]T, read func() error) error {
+	n := len(*into)
+	return retryRead(ctx, retry, func() error {
+		*into = (*into)[:n]
+		return read()
+	})
+}
+
+type retryingUserRepository struct {
+	next  UserRepository
+	retry ReadRetry
+}
+
+func NewRetryingUserRepository(next UserRepository, retry ReadRetry) UserRepository {
+	return &retryingUserRepository{next: next, retry: retry}
+}
+
+func (r *retryingUserRepository) GetUserCredentialByName(ctx context.Context, name string) (*models.Credential, error) {
+	return retryValue(ctx, r.retry, func() (*models.Credential, error) {
+		return r.next.GetUserCredentialByName(ctx, name)
+	})
+}
+
+func (r *retryingUserRepository) CreateUserCredential(ctx context.Context, credential *models.Credential) error {
+	return r.next.CreateUserCredential(ctx, credential)
+}
+
+func (r *retryingUserRepository) GetUserByID(ctx context.Context, id uuid.UUID) (*models.Credential, error) {
+	return retryValue(ctx, r.retry, func() (*models.Credential, error) {
+		return r.next.GetUserByID(ctx, id)
+	})
+}
+
+func (r *retryingUserRepository) GetUserItems(ctx context.Context, id uuid.UUID, userItems *[]models.UserItem) error {
+	return retryInto(ctx, r.retry, userItems, func() error {
+		return r.next.GetUserItems(ctx, id, userItems)
+	})
+}
+
+func (r *retryingUserRepository) GetUsernamesByIDs(ctx context.Context, userIDs []string) (map[string]string, error) {
+	return retryValue(ctx, r.retry, func() (map[string]string, error) {
+		return r.next.GetUsernamesByIDs(ctx, userIDs)
+	})
+}
+
+type retryingCoinRepository struct {
+	next  CoinRepository
+	retry ReadRetry
+}
+
+func NewRetryingCoinRepository(next CoinRepository, retry ReadRetry) CoinRepository {
+	return &retryingCoinRepository{next: next, retry: retry}
+}
+
+func (r *retryingCoinRepository) BuyItemFromShop(ctx context.Context, userID uuid.UUID, itemName string) error {
+	return r.next.BuyItemFromShop(ctx, userID, itemName)
+}
+
+func (r *retryingCoinRepository) SendCoins(ctx context.Context, fromUserID, toUserID uuid.UUID, amount int64) error {
+	return r.next.SendCoins(ctx, fromUserID, toUserID, amount)
+}
+
+func (r *retryingCoinRepository) GetTransactions(ctx context.Context, userID uuid.UUID, transactions *[]models.Transaction) error {
+	return retryInto(ctx, r.retry, transactions, func() error {
+		return r.next.GetTransactions(ctx, userID, transactions)
+	})
+}
+
+func (r *retryingCoinRepository) GetHistory(ctx context.Context, userID uuid.UUID, limit int, after *models.HistoryCursor) ([]models.HistoryEntry, error) {
+	return retryValue(ctx, r.retry, func() ([]models.HistoryEntry, error) {
+		return r.next.GetHistory(ctx, userID, limit, after)
+	})
+}
+
+func (r *retryingCoinRepository) RequestReversal(ctx context.Context, transactionID, requestedBy uuid.UUID, reason string) (*models.TransferReversal, error) {
+	return r.next.RequestReversal(ctx, transactionID, requestedBy, reason)
+}
+
+func (r *retryingCoinRepository) ApproveReversal(ctx context.Context, reversalID, approvedBy uuid.UUID) (*models.TransferReversal, error) {
+	return r.next.ApproveReversal(ctx, reversalID, approvedBy)
+}
+
+func (r *retryingCoinRepository) RejectReversal(ctx context.Context, reversalID, rejectedBy uuid.UUID) (*models.TransferReversal, error) {
+	return r.next.RejectReversal(ctx, reversalID, rejectedBy)
+}
+
+func (r *retryingCoinRepository) ForceReversal(ctx context.Context, transactionID, adminID uuid.UUID, reason string) (*models.TransferReversal, error) {
+	return r.next.ForceReversal(ctx, transactionID, adminID, reason)
+}
+
+func (r *retryingCoinRepository) GetReversals(ctx context.Context, userID uuid.UUID, reversals *[]models.TransferReversal) error {
+	return retryInto(ctx, r.retry, reversals, func() error {
+		return r.next.GetReversals(ctx, userID, reversals)
+	})
+}
+
+func (r *retryingCoinRepository) GetTransferLimits(ctx context.Context, userID uuid.UUID) (*models.UserTransferLimits, error) {
+	return retryValue(ctx, r.retry, func() (*models.UserTransferLimits, error) {
+		return r.next.GetTransferLimits(ctx, userID)
+	})
+}
+
+func (r *retryingCoinRepository) SetTransferLimits(ctx context.Context, userID, adminID uuid.UUID, override models.TransferLimitsOverride) (*models.UserTransferLimits, error) {
+	return r.next.SetTransferLimits(ctx, userID, adminID, override)
+}
+
+func (r *retryingCoinRepository) GrantCoins(ctx context.Context, userID uuid.UUID, amount int64) error {
+	return r.next.GrantCoins(ctx, userID, amount)
+}
+
+func (r *retryingCoinRepository) GetExpiringCoins(ctx context.Context, userID uuid.UUID) (*models.ExpiringCoins, error) {
+	return retryValue(ctx, r.retry, func() (*models.ExpiringCoins, error) {
+		return r.next.GetExpiringCoins(ctx, userID)
+	})
+}
+
+func (r *retryingCoinRepository) ExpireLots(ctx context.Context) (int64, error) {
+	return r.next.ExpireLots(ctx)
+}
+
+func (r *retryingCoinRepository) HoldCoins(ctx context.Context, userID, createdBy uuid.UUID, request models.HoldRequest) (*models.CoinHold, error) {
+	return r.next.HoldCoins(ctx, userID, createdBy, request)
+}
+
+func (r *retryingCoinRepository) CaptureHold(ctx context.Context, holdID uuid.UUID) (*models.CoinHold, error) {
+	return r.next.CaptureHold(ctx, holdID)
+}
+
+func (r *retryingCoinRepository) ReleaseHold(ctx context.Context, holdID uuid.UUID) (*models.CoinHold, error) {
+	return r.next.ReleaseHold(ctx, holdID)
+}
+
+func (r *retryingCoinRepository) ReleaseExpiredHolds(ctx context.Context) (int64, error) {
+	return r.next.ReleaseExpiredHolds(ctx)
+}
+
+type retryingEventRepository struct {
+	next  EventRepository
+	retry ReadRetry
+}
+
+func NewRetryingEventRepository(next EventRepository, retry ReadRetry) EventRepository {
+	return &retryingEventRepository{next: next, retry: retry}
+}
+
+func (r *retryingEventRepository) GetEventsAfter(ctx context.Context, userID uuid.UUID, afterID int64, limit int) ([]models.UserEvent, error) {
+	return retryValue(ctx, r.retry, func() ([]models.UserEvent, error) {
+		return r.next.GetEventsAfter(ctx, userID, afterID, limit)
+	})
+}
+
+func (r *retryingEventRepository) DeleteEventsBefore(ctx context.Context, before time.Time) (int64, error) {
+	return r.next.DeleteEventsBefore(ctx, before)
+}
+
+type retryingWebhookRepository struct {
+	next  WebhookRepository
+	retry ReadRetry
+}
+
+func NewRetryingWebhookRepository(next WebhookRepository, retry ReadRetry) WebhookRepository {
+	return &retryingWebhookRepository{next: next, retry: retry}
+}
+
+func (r *retryingWebhookRepository) CreateWebhook(ctx context.Context, request models.WebhookRequest) (*models.Webhook, error) {
+	return r.next.CreateWebhook(ctx, request)
+}
+
+func (r *retryingWebhookRepository) GetWebhooks(ctx context.Context) ([]models.Webhook, error) {
+	return retryValue(ctx, r.retry, func() ([]models.Webhook, error) {
+		return r.next.GetWebhooks(ctx)
+	})
+}
+
+func (r *retryingWebhookRepository) DeleteWebhook(ctx context.Context, id uuid.UUID) error {
+	return r.next.DeleteWebhook(ctx, id)
+}
+
+func (r *retryingWebhookRepository) GetDeliveries(ctx context.Context, webhookID uuid.UUID, status string, limit int) ([]models.WebhookDelivery, error) {
+	return retryValue(ctx, r.retry, func() ([]models.WebhookDelivery, error) {
+		return r.next.GetDeliveries(ctx, webhookID, status, limit)
+	})
+}
+
+func (r *retryingWebhookRepository) ReplayDeliveries(ctx context.Context, webhookID uuid.UUID, request models.ReplayRequest) (int64, error) {
+	return r.next.ReplayDeliveries(ctx, webhookID, request)
+}
+
+// ClaimDeliveries не повторяется: он захватывает доставки на время lease.
+func (r *retryingWebhookRepository) ClaimDeliveries(ctx context.Context, limit int, lease time.Duration) ([]models.PendingDelivery, error) {
+	return r.next.ClaimDeliveries(ctx, limit, lease)
+}
+
+func (r *retryingWebhookRepository) MarkDelivered(ctx context.Context, id int64, status int) error {
+	return r.next.MarkDelivered(ctx, id, status)
+}
+
+func (r *retryingWebhookRepository) MarkFailed(ctx context.Context, id int64, status int, reason string, retryAt *time.Time) error {
+	return r.next.MarkFailed(ctx, id, status, reason, retryAt)
+}
+
+func (r *retryingWebhookRepository) DeleteOutboxBefore(ctx context.Context, before time.Time) (int64, error) {
+	return r.next.DeleteOutboxBefore(ctx, before)
+}
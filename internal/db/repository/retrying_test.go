@@ -0,0 +1,143 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/models"
+	mock_repository "github.com/Ki4EH/stunning-octo-waddle/internal/mocks/repository"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestRetryingRepositories(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+	connErr := &pgconn.ConnectError{}
+	shutdown := &pgconn.PgError{Code: "57P01"}
+
+	tests := []struct {
+		name        string
+		setupMocks  func(users *mock_repository.MockUserRepository, coins *mock_repository.MockCoinRepository)
+		call        func(users UserRepository, coins CoinRepository) error
+		expectedErr error
+	}{
+		{
+			name: "read retried after connection error",
+			setupMocks: func(users *mock_repository.MockUserRepository, coins *mock_repository.MockCoinRepository) {
+				gomock.InOrder(
+					users.EXPECT().GetUserByID(ctx, userID).Return(nil, connErr),
+					users.EXPECT().GetUserByID(ctx, userID).Return(&models.Credential{ID: userID}, nil),
+				)
+			},
+			call: func(users UserRepository, coins CoinRepository) error {
+				credential, err := users.GetUserByID(ctx, userID)
+				if err == nil && credential.ID != userID {
+					return fmt.Errorf("unexpected user %s", credential.ID)
+				}
+				return err
+			},
+		},
+		{
+			name: "rows of failed attempt are dropped",
+			setupMocks: func(users *mock_repository.MockUserRepository, coins *mock_repository.MockCoinRepository) {
+				gomock.InOrder(
+					users.EXPECT().GetUserItems(ctx, userID, gomock.Any()).
+						DoAndReturn(func(_ context.Context, _ uuid.UUID, items *[]models.UserItem) error {
+							*items = append(*items, models.UserItem{Type: "cup", Quantity: 1})
+							return io.ErrUnexpectedEOF
+						}),
+					users.EXPECT().GetUserItems(ctx, userID, gomock.Any()).
+						DoAndReturn(func(_ context.Context, _ uuid.UUID, items *[]models.UserItem) error {
+							*items = append(*items, models.UserItem{Type: "cup", Quantity: 1})
+							return nil
+						}),
+				)
+			},
+			call: func(users UserRepository, coins CoinRepository) error {
+				var items []models.UserItem
+				if err := users.GetUserItems(ctx, userID, &items); err != nil {
+					return err
+				}
+				if len(items) != 1 {
+					return fmt.Errorf("got %d items", len(items))
+				}
+				return nil
+			},
+		},
+		{
+			name: "gives up after all attempts",
+			setupMocks: func(users *mock_repository.MockUserRepository, coins *mock_repository.MockCoinRepository) {
+				coins.EXPECT().GetTransferLimits(ctx, userID).Return(nil, shutdown).Times(3)
+			},
+			call: func(users UserRepository, coins CoinRepository) error {
+				_, err := coins.GetTransferLimits(ctx, userID)
+				return err
+			},
+			expectedErr: shutdown,
+		},
+		{
+			name: "query error is not retried",
+			setupMocks: func(users *mock_repository.MockUserRepository, coins *mock_repository.MockCoinRepository) {
+				users.EXPECT().GetUserCredentialByName(ctx, "alice").Return(nil, ErrUserNotFound)
+			},
+			call: func(users UserRepository, coins CoinRepository) error {
+				_, err := users.GetUserCredentialByName(ctx, "alice")
+				return err
+			},
+			expectedErr: ErrUserNotFound,
+		},
+		{
+			name: "write is not retried",
+			setupMocks: func(users *mock_repository.MockUserRepository, coins *mock_repository.MockCoinRepository) {
+				coins.EXPECT().SendCoins(ctx, userID, gomock.Any(), int64(10)).Return(connErr)
+			},
+			call: func(users UserRepository, coins CoinRepository) error {
+				return coins.SendCoins(ctx, userID, uuid.New(), 10)
+			},
+			expectedErr: connErr,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			users := mock_repository.NewMockUserRepository(ctrl)
+			coins := mock_repository.NewMockCoinRepository(ctrl)
+			tt.setupMocks(users, coins)
+
+			retry := ReadRetry{Attempts: 3, BaseDelay: time.Millisecond}
+			err := tt.call(NewRetryingUserRepository(users, retry), NewRetryingCoinRepository(coins, retry))
+			assert.ErrorIs(t, err, tt.expectedErr)
+		})
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{name: "connect error", err: &pgconn.ConnectError{}, expected: true},
+		{name: "connection exception", err: &pgconn.PgError{Code: "08006"}, expected: true},
+		{name: "cannot connect now", err: &pgconn.PgError{Code: "57P03"}, expected: true},
+		{name: "wrapped eof", err: fmt.Errorf("read: %w", io.EOF), expected: true},
+		{name: "unique violation", err: &pgconn.PgError{Code: "23505"}},
+		{name: "statement timeout", err: &pgconn.PgError{Code: "57014"}},
+		{name: "context canceled", err: fmt.Errorf("query: %w", context.Canceled)},
+		{name: "domain error", err: ErrUserNotFound},
+		{name: "plain error", err: errors.New("boom")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, isTransient(tt.err))
+		})
+	}
+}
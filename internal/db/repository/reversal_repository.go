@@ -0,0 +1,260 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/models"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/logger"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+	"time"
+)
+
+const reversalSelect = `
+	SELECT r.id, r.transaction_id, t.from_user, t.to_user, cf.username, ct.username, t.amount,
+	       r.reason, r.status, r.compensation_id, r.created_at, r.resolved_at
+	FROM transfer_reversals r
+	JOIN transactions t ON t.id = r.transaction_id
+	JOIN credentials cf ON cf.id = t.from_user
+	JOIN credentials ct ON ct.id = t.to_user
+`
+
+type reversibleTransaction struct {
+	id         uuid.UUID
+	fromUser   uuid.UUID
+	toUser     uuid.UUID
+	amount     int64
+	reversalOf *uuid.UUID
+	reversedAt *time.Time
+}
+
+func (r *coinRepository) RequestReversal(ctx context.Context, transactionID, requestedBy uuid.UUID, reason string) (*models.TransferReversal, error) {
+	var reversal *models.TransferReversal
+	err := r.withTx(ctx, func(tx pgx.Tx) error {
+		original, err := r.lockReversibleTransaction(ctx, tx, transactionID)
+		if err != nil {
+			return err
+		}
+		if original.fromUser != requestedBy {
+			return ErrNotTransactionSender
+		}
+
+		var pending bool
+		err = tx.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM transfer_reversals WHERE transaction_id = $1 AND status = $2)",
+			transactionID, models.ReversalStatusPending).Scan(&pending)
+		if err != nil {
+			return err
+		}
+		if pending {
+			return ErrReversalAlreadyExists
+		}
+
+		var reversalID uuid.UUID
+		err = tx.QueryRow(ctx, "INSERT INTO transfer_reversals (transaction_id, requested_by, reason) VALUES ($1, $2, $3) RETURNING id",
+			transactionID, requestedBy, reason).Scan(&reversalID)
+		if err != nil {
+			return fmt.Errorf("failed to create reversal request: %w", err)
+		}
+
+		reversal, err = r.getReversal(ctx, tx, reversalID)
+		return err
+	})
+	return reversal, err
+}
+
+func (r *coinRepository) ApproveReversal(ctx context.Context, reversalID, approvedBy uuid.UUID) (*models.TransferReversal, error) {
+	var reversal *models.TransferReversal
+	err := r.withTx(ctx, func(tx pgx.Tx) error {
+		original, err := r.lockPendingReversal(ctx, tx, reversalID, approvedBy)
+		if err != nil {
+			return err
+		}
+
+		compensationID, err := r.compensate(ctx, tx, original)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, `
+			UPDATE transfer_reversals
+			SET status = $2, resolved_by = $3, compensation_id = $4, resolved_at = now()
+			WHERE id = $1`, reversalID, models.ReversalStatusApproved, approvedBy, compensationID)
+		if err != nil {
+			return fmt.Errorf("failed to update reversal: %w", err)
+		}
+
+		reversal, err = r.getReversal(ctx, tx, reversalID)
+		return err
+	})
+	return reversal, err
+}
+
+func (r *coinRepository) RejectReversal(ctx context.Context, reversalID, rejectedBy uuid.UUID) (*models.TransferReversal, error) {
+	var reversal *models.TransferReversal
+	err := r.withTx(ctx, func(tx pgx.Tx) error {
+		if _, err := r.lockPendingReversal(ctx, tx, reversalID, rejectedBy); err != nil {
+			return err
+		}
+
+		_, err := tx.Exec(ctx, `
+			UPDATE transfer_reversals
+			SET status = $2, resolved_by = $3, resolved_at = now()
+			WHERE id = $1`, reversalID, models.ReversalStatusRejected, rejectedBy)
+		if err != nil {
+			return fmt.Errorf("failed to update reversal: %w", err)
+		}
+
+		reversal, err = r.getReversal(ctx, tx, reversalID)
+		return err
+	})
+	return reversal, err
+}
+
+// ForceReversal отменяет перевод без согласия получателя. Если по переводу уже
+// есть ожидающий запрос, он закрывается как принудительно исполненный.
+func (r *coinRepository) ForceReversal(ctx context.Context, transactionID, adminID uuid.UUID, reason string) (*models.TransferReversal, error) {
+	var reversal *models.TransferReversal
+	err := r.withTx(ctx, func(tx pgx.Tx) error {
+		original, err := r.lockReversibleTransaction(ctx, tx, transactionID)
+		if err != nil {
+			return err
+		}
+
+		compensationID, err := r.compensate(ctx, tx, original)
+		if err != nil {
+			return err
+		}
+
+		var reversalID uuid.UUID
+		err = tx.QueryRow(ctx, `
+			UPDATE transfer_reversals
+			SET status = $2, resolved_by = $3, compensation_id = $4, resolved_at = now()
+			WHERE transaction_id = $1 AND status = $5
+			RETURNING id`, transactionID, models.ReversalStatusForced, adminID, compensationID, models.ReversalStatusPending).
+			Scan(&reversalID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			err = tx.QueryRow(ctx, `
+				INSERT INTO transfer_reversals (transaction_id, requested_by, reason, status, resolved_by, compensation_id, resolved_at)
+				VALUES ($1, $2, $3, $4, $2, $5, now())
+				RETURNING id`, transactionID, adminID, reason, models.ReversalStatusForced, compensationID).
+				Scan(&reversalID)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to record reversal: %w", err)
+		}
+
+		reversal, err = r.getReversal(ctx, tx, reversalID)
+		return err
+	})
+	return reversal, err
+}
+
+func (r *coinRepository) GetReversals(ctx context.Context, userID uuid.UUID, reversals *[]models.TransferReversal) error {
+	rows, err := r.db.Query(ctx, reversalSelect+`
+		WHERE t.from_user = $1 OR t.to_user = $1
+		ORDER BY r.created_at DESC`, userID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		reversal, err := scanReversal(rows)
+		if err != nil {
+			return err
+		}
+		*reversals = append(*reversals, *reversal)
+	}
+
+	return rows.Err()
+}
+
+func (r *coinRepository) lockReversibleTransaction(ctx context.Context, tx pgx.Tx, transactionID uuid.UUID) (*reversibleTransaction, error) {
+	var t reversibleTransaction
+	err := tx.QueryRow(ctx, `
+		SELECT id, from_user, to_user, amount, reversal_of, reversed_at
+		FROM transactions
+		WHERE id = $1
+		FOR UPDATE`, transactionID).
+		Scan(&t.id, &t.fromUser, &t.toUser, &t.amount, &t.reversalOf, &t.reversedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrTransactionNotFound
+		}
+		return nil, err
+	}
+	if t.reversalOf != nil {
+		return nil, ErrCompensatingReversal
+	}
+	if t.reversedAt != nil {
+		return nil, ErrAlreadyReversed
+	}
+	return &t, nil
+}
+
+func (r *coinRepository) lockPendingReversal(ctx context.Context, tx pgx.Tx, reversalID, recipientID uuid.UUID) (*reversibleTransaction, error) {
+	var transactionID uuid.UUID
+	var status string
+	err := tx.QueryRow(ctx, "SELECT transaction_id, status FROM transfer_reversals WHERE id = $1 FOR UPDATE", reversalID).
+		Scan(&transactionID, &status)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrReversalNotFound
+		}
+		return nil, err
+	}
+	if status != models.ReversalStatusPending {
+		return nil, ErrReversalNotPending
+	}
+
+	original, err := r.lockReversibleTransaction(ctx, tx, transactionID)
+	if err != nil {
+		return nil, err
+	}
+	if original.toUser != recipientID {
+		return nil, ErrNotTransactionRecipient
+	}
+	return original, nil
+}
+
+// compensate возвращает монеты отправителю отдельной транзакцией и помечает
+// исходный перевод как отменённый.
+func (r *coinRepository) compensate(ctx context.Context, tx pgx.Tx, original *reversibleTransaction) (uuid.UUID, error) {
+	compensationID, err := r.transfer(ctx, tx, original.toUser, original.fromUser, original.amount, &original.id)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	_, err = tx.Exec(ctx, "UPDATE transactions SET reversed_at = now() WHERE id = $1", original.id)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to mark transaction as reversed: %w", err)
+	}
+
+	logger.FromContext(ctx).Info("transfer reversed",
+		zap.Stringer("transaction_id", original.id), zap.Stringer("compensation_id", compensationID))
+	return compensationID, nil
+}
+
+func (r *coinRepository) getReversal(ctx context.Context, tx pgx.Tx, reversalID uuid.UUID) (*models.TransferReversal, error) {
+	reversal, err := scanReversal(tx.QueryRow(ctx, reversalSelect+"WHERE r.id = $1", reversalID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrReversalNotFound
+		}
+		return nil, err
+	}
+	return reversal, nil
+}
+
+func scanReversal(row pgx.Row) (*models.TransferReversal, error) {
+	var reversal models.TransferReversal
+	err := row.Scan(&reversal.ID, &reversal.TransactionID, &reversal.FromUserID, &reversal.ToUserID,
+		&reversal.FromUser, &reversal.ToUser, &reversal.Amount, &reversal.Reason, &reversal.Status,
+		&reversal.CompensationID, &reversal.CreatedAt, &reversal.ResolvedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &reversal, nil
+}
@@ -0,0 +1,248 @@
+package repository
+
+import (
+	"context"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/models"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/tracing"
+	"github.com/google/uuid"
+	"time"
+)
+
+// Обёртки открывают спан на каждый вызов репозитория. SQL-запросы внутри
+// вызова становятся дочерними спанами через трейсер pgx.
+
+type tracedUserRepository struct {
+	next UserRepository
+}
+
+func NewTracedUserRepository(next UserRepository) UserRepository {
+	return &tracedUserRepository{next: next}
+}
+
+func (r *tracedUserRepository) GetUserCredentialByName(ctx context.Context, name string) (res *models.Credential, err error) {
+	ctx, span := tracing.Start(ctx, "UserRepository.GetUserCredentialByName")
+	defer func() { tracing.End(span, err) }()
+	return r.next.GetUserCredentialByName(ctx, name)
+}
+
+func (r *tracedUserRepository) CreateUserCredential(ctx context.Context, credential *models.Credential) (err error) {
+	ctx, span := tracing.Start(ctx, "UserRepository.CreateUserCredential")
+	defer func() { tracing.End(span, err) }()
+	return r.next.CreateUserCredential(ctx, credential)
+}
+
+func (r *tracedUserRepository) GetUserByID(ctx context.Context, id uuid.UUID) (res *models.Credential, err error) {
+	ctx, span := tracing.Start(ctx, "UserRepository.GetUserByID")
+	defer func() { tracing.End(span, err) }()
+	return r.next.GetUserByID(ctx, id)
+}
+
+func (r *tracedUserRepository) GetUserItems(ctx context.Context, id uuid.UUID, userItems *[]models.UserItem) (err error) {
+	ctx, span := tracing.Start(ctx, "UserRepository.GetUserItems")
+	defer func() { tracing.End(span, err) }()
+	return r.next.GetUserItems(ctx, id, userItems)
+}
+
+func (r *tracedUserRepository) GetUsernamesByIDs(ctx context.Context, userIDs []string) (res map[string]string, err error) {
+	ctx, span := tracing.Start(ctx, "UserRepository.GetUsernamesByIDs")
+	defer func() { tracing.End(span, err) }()
+	return r.next.GetUsernamesByIDs(ctx, userIDs)
+}
+
+type tracedCoinRepository struct {
+	next CoinRepository
+}
+
+func NewTracedCoinRepository(next CoinRepository) CoinRepository {
+	return &tracedCoinRepository{next: next}
+}
+
+func (r *tracedCoinRepository) BuyItemFromShop(ctx context.Context, userID uuid.UUID, itemName string) (err error) {
+	ctx, span := tracing.Start(ctx, "CoinRepository.BuyItemFromShop")
+	defer func() { tracing.End(span, err) }()
+	return r.next.BuyItemFromShop(ctx, userID, itemName)
+}
+
+func (r *tracedCoinRepository) SendCoins(ctx context.Context, fromUserID, toUserID uuid.UUID, amount int64) (err error) {
+	ctx, span := tracing.Start(ctx, "CoinRepository.SendCoins")
+	defer func() { tracing.End(span, err) }()
+	return r.next.SendCoins(ctx, fromUserID, toUserID, amount)
+}
+
+func (r *tracedCoinRepository) GetTransactions(ctx context.Context, userID uuid.UUID, transactions *[]models.Transaction) (err error) {
+	ctx, span := tracing.Start(ctx, "CoinRepository.GetTransactions")
+	defer func() { tracing.End(span, err) }()
+	return r.next.GetTransactions(ctx, userID, transactions)
+}
+
+func (r *tracedCoinRepository) GetHistory(ctx context.Context, userID uuid.UUID, limit int, after *models.HistoryCursor) (res []models.HistoryEntry, err error) {
+	ctx, span := tracing.Start(ctx, "CoinRepository.GetHistory")
+	defer func() { tracing.End(span, err) }()
+	return r.next.GetHistory(ctx, userID, limit, after)
+}
+
+func (r *tracedCoinRepository) RequestReversal(ctx context.Context, transactionID, requestedBy uuid.UUID, reason string) (res *models.TransferReversal, err error) {
+	ctx, span := tracing.Start(ctx, "CoinRepository.RequestReversal")
+	defer func() { tracing.End(span, err) }()
+	return r.next.RequestReversal(ctx, transactionID, requestedBy, reason)
+}
+
+func (r *tracedCoinRepository) ApproveReversal(ctx context.Context, reversalID, approvedBy uuid.UUID) (res *models.TransferReversal, err error) {
+	ctx, span := tracing.Start(ctx, "CoinRepository.ApproveReversal")
+	defer func() { tracing.End(span, err) }()
+	return r.next.ApproveReversal(ctx, reversalID, approvedBy)
+}
+
+func (r *tracedCoinRepository) RejectReversal(ctx context.Context, reversalID, rejectedBy uuid.UUID) (res *models.TransferReversal, err error) {
+	ctx, span := tracing.Start(ctx, "CoinRepository.RejectReversal")
+	defer func() { tracing.End(span, err) }()
+	return r.next.RejectReversal(ctx, reversalID, rejectedBy)
+}
+
+func (r *tracedCoinRepository) ForceReversal(ctx context.Context, transactionID, adminID uuid.UUID, reason string) (res *models.TransferReversal, err error) {
+	ctx, span := tracing.Start(ctx, "CoinRepository.ForceReversal")
+	defer func() { tracing.End(span, err) }()
+	return r.next.ForceReversal(ctx, transactionID, adminID, reason)
+}
+
+func (r *tracedCoinRepository) GetReversals(ctx context.Context, userID uuid.UUID, reversals *[]models.TransferReversal) (err error) {
+	ctx, span := tracing.Start(ctx, "CoinRepository.GetReversals")
+	defer func() { tracing.End(span, err) }()
+	return r.next.GetReversals(ctx, userID, reversals)
+}
+
+func (r *tracedCoinRepository) GetTransferLimits(ctx context.Context, userID uuid.UUID) (res *models.UserTransferLimits, err error) {
+	ctx, span := tracing.Start(ctx, "CoinRepository.GetTransferLimits")
+	defer func() { tracing.End(span, err) }()
+	return r.next.GetTransferLimits(ctx, userID)
+}
+
+func (r *tracedCoinRepository) SetTransferLimits(ctx context.Context, userID, adminID uuid.UUID, override models.TransferLimitsOverride) (res *models.UserTransferLimits, err error) {
+	ctx, span := tracing.Start(ctx, "CoinRepository.SetTransferLimits")
+	defer func() { tracing.End(span, err) }()
+	return r.next.SetTransferLimits(ctx, userID, adminID, override)
+}
+
+func (r *tracedCoinRepository) GrantCoins(ctx context.Context, userID uuid.UUID, amount int64) (err error) {
+	ctx, span := tracing.Start(ctx, "CoinRepository.GrantCoins")
+	defer func() { tracing.End(span, err) }()
+	return r.next.GrantCoins(ctx, userID, amount)
+}
+
+func (r *tracedCoinRepository) GetExpiringCoins(ctx context.Context, userID uuid.UUID) (res *models.ExpiringCoins, err error) {
+	ctx, span := tracing.Start(ctx, "CoinRepository.GetExpiringCoins")
+	defer func() { tracing.End(span, err) }()
+	return r.next.GetExpiringCoins(ctx, userID)
+}
+
+func (r *tracedCoinRepository) ExpireLots(ctx context.Context) (res int64, err error) {
+	ctx, span := tracing.Start(ctx, "CoinRepository.ExpireLots")
+	defer func() { tracing.End(span, err) }()
+	return r.next.ExpireLots(ctx)
+}
+
+func (r *tracedCoinRepository) HoldCoins(ctx context.Context, userID, createdBy uuid.UUID, request models.HoldRequest) (res *models.CoinHold, err error) {
+	ctx, span := tracing.Start(ctx, "CoinRepository.HoldCoins")
+	defer func() { tracing.End(span, err) }()
+	return r.next.HoldCoins(ctx, userID, createdBy, request)
+}
+
+func (r *tracedCoinRepository) CaptureHold(ctx context.Context, holdID uuid.UUID) (res *models.CoinHold, err error) {
+	ctx, span := tracing.Start(ctx, "CoinRepository.CaptureHold")
+	defer func() { tracing.End(span, err) }()
+	return r.next.CaptureHold(ctx, holdID)
+}
+
+func (r *tracedCoinRepository) ReleaseHold(ctx context.Context, holdID uuid.UUID) (res *models.CoinHold, err error) {
+	ctx, span := tracing.Start(ctx, "CoinRepository.ReleaseHold")
+	defer func() { tracing.End(span, err) }()
+	return r.next.ReleaseHold(ctx, holdID)
+}
+
+func (r *tracedCoinRepository) ReleaseExpiredHolds(ctx context.Context) (res int64, err error) {
+	ctx, span := tracing.Start(ctx, "CoinRepository.ReleaseExpiredHolds")
+	defer func() { tracing.End(span, err) }()
+	return r.next.ReleaseExpiredHolds(ctx)
+}
+
+type tracedEventRepository struct {
+	next EventRepository
+}
+
+func NewTracedEventRepository(next EventRepository) EventRepository {
+	return &tracedEventRepository{next: next}
+}
+
+func (r *tracedEventRepository) GetEventsAfter(ctx context.Context, userID uuid.UUID, afterID int64, limit int) (res []models.UserEvent, err error) {
+	ctx, span := tracing.Start(ctx, "EventRepository.GetEventsAfter")
+	defer func() { tracing.End(span, err) }()
+	return r.next.GetEventsAfter(ctx, userID, afterID, limit)
+}
+
+func (r *tracedEventRepository) DeleteEventsBefore(ctx context.Context, before time.Time) (res int64, err error) {
+	ctx, span := tracing.Start(ctx, "EventRepository.DeleteEventsBefore")
+	defer func() { tracing.End(span, err) }()
+	return r.next.DeleteEventsBefore(ctx, before)
+}
+
+type tracedWebhookRepository struct {
+	next WebhookRepository
+}
+
+func NewTracedWebhookRepository(next WebhookRepository) WebhookRepository {
+	return &tracedWebhookRepository{next: next}
+}
+
+func (r *tracedWebhookRepository) CreateWebhook(ctx context.Context, request models.WebhookRequest) (res *models.Webhook, err error) {
+	ctx, span := tracing.Start(ctx, "WebhookRepository.CreateWebhook")
+	defer func() { tracing.End(span, err) }()
+	return r.next.CreateWebhook(ctx, request)
+}
+
+func (r *tracedWebhookRepository) GetWebhooks(ctx context.Context) (res []models.Webhook, err error) {
+	ctx, span := tracing.Start(ctx, "WebhookRepository.GetWebhooks")
+	defer func() { tracing.End(span, err) }()
+	return r.next.GetWebhooks(ctx)
+}
+
+func (r *tracedWebhookRepository) DeleteWebhook(ctx context.Context, id uuid.UUID) (err error) {
+	ctx, span := tracing.Start(ctx, "WebhookRepository.DeleteWebhook")
+	defer func() { tracing.End(span, err) }()
+	return r.next.DeleteWebhook(ctx, id)
+}
+
+func (r *tracedWebhookRepository) GetDeliveries(ctx context.Context, webhookID uuid.UUID, status string, limit int) (res []models.WebhookDelivery, err error) {
+	ctx, span := tracing.Start(ctx, "WebhookRepository.GetDeliveries")
+	defer func() { tracing.End(span, err) }()
+	return r.next.GetDeliveries(ctx, webhookID, status, limit)
+}
+
+func (r *tracedWebhookRepository) ReplayDeliveries(ctx context.Context, webhookID uuid.UUID, request models.ReplayRequest) (res int64, err error) {
+	ctx, span := tracing.Start(ctx, "WebhookRepository.ReplayDeliveries")
+	defer func() { tracing.End(span, err) }()
+	return r.next.ReplayDeliveries(ctx, webhookID, request)
+}
+
+func (r *tracedWebhookRepository) ClaimDeliveries(ctx context.Context, limit int, lease time.Duration) (res []models.PendingDelivery, err error) {
+	ctx, span := tracing.Start(ctx, "WebhookRepository.ClaimDeliveries")
+	defer func() { tracing.End(span, err) }()
+	return r.next.ClaimDeliveries(ctx, limit, lease)
+}
+
+func (r *tracedWebhookRepository) MarkDelivered(ctx context.Context, id int64, status int) (err error) {
+	ctx, span := tracing.Start(ctx, "WebhookRepository.MarkDelivered")
+	defer func() { tracing.End(span, err) }()
+	return r.next.MarkDelivered(ctx, id, status)
+}
+
+func (r *tracedWebhookRepository) MarkFailed(ctx context.Context, id int64, status int, reason string, retryAt *time.Time) (err error) {
+	ctx, span := tracing.Start(ctx, "WebhookRepository.MarkFailed")
+	defer func() { tracing.End(span, err) }()
+	return r.next.MarkFailed(ctx, id, status, reason, retryAt)
+}
+
+func (r *tracedWebhookRepository) DeleteOutboxBefore(ctx context.Context, before time.Time) (res int64, err error) {
+	ctx, span := tracing.Start(ctx, "WebhookRepository.DeleteOutboxBefore")
+	defer func() { tracing.End(span, err) }()
+	return r.next.DeleteOutboxBefore(ctx, before)
+}
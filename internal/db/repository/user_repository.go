@@ -3,8 +3,11 @@ package repository
 import (
 	"context"
 	"github.com/Ki4EH/stunning-octo-waddle/internal/db/models"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/logger"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+	"time"
 )
 
 type UserRepository interface {
@@ -16,12 +19,16 @@ type UserRepository interface {
 }
 
 type userRepository struct {
-	db *pgxpool.Pool
+	db           *pgxpool.Pool
+	coinLifetime time.Duration
 }
 
-func NewUserRepository(db *pgxpool.Pool) UserRepository {
+// NewUserRepository создаёт репозиторий пользователей. coinLifetime задаёт срок
+// действия стартовых монет нового пользователя, 0 — срок по умолчанию.
+func NewUserRepository(db *pgxpool.Pool, coinLifetime time.Duration) UserRepository {
 	return &userRepository{
-		db: db,
+		db:           db,
+		coinLifetime: coinLifetime,
 	}
 }
 
@@ -36,17 +43,27 @@ func (r *userRepository) GetUserCredentialByName(ctx context.Context, name strin
 }
 
 func (r *userRepository) CreateUserCredential(ctx context.Context, credential *models.Credential) error {
-	err := r.db.QueryRow(ctx, "INSERT INTO credentials (username, password) VALUES ($1, $2) RETURNING id", credential.Username, credential.Password).Scan(&credential.ID)
+	// Стартовые монеты выдаются отдельной партией в том же запросе
+	err := r.db.QueryRow(ctx, `
+		WITH c AS (
+			INSERT INTO credentials (username, password) VALUES ($1, $2) RETURNING id, coin
+		), l AS (
+			INSERT INTO coin_lots (user_id, amount, expires_at)
+			SELECT id, coin, now() + $3::interval FROM c WHERE coin > 0
+		)
+		SELECT id FROM c`, credential.Username, credential.Password, orDefault(r.coinLifetime, DefaultCoinLifetime)).Scan(&credential.ID)
 	if err != nil {
 		return err
 	}
+
+	logger.FromContext(ctx).Info("user registered", zap.Stringer("user_id", credential.ID))
 	return nil
 }
 
 func (r *userRepository) GetUserByID(ctx context.Context, id uuid.UUID) (*models.Credential, error) {
 	var credential models.Credential
-	row := r.db.QueryRow(ctx, "SELECT id, username, coin FROM credentials WHERE id = $1", id)
-	err := row.Scan(&credential.ID, &credential.Username, &credential.Coin)
+	row := r.db.QueryRow(ctx, "SELECT id, username, coin, "+heldCoinsColumn+", is_admin FROM credentials WHERE id = $1", id)
+	err := row.Scan(&credential.ID, &credential.Username, &credential.Coin, &credential.Held, &credential.IsAdmin)
 	if err != nil {
 		return nil, err
 	}
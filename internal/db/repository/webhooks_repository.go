@@ -0,0 +1,246 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/models"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"time"
+)
+
+type WebhookRepository interface {
+	CreateWebhook(ctx context.Context, request models.WebhookRequest) (*models.Webhook, error)
+	GetWebhooks(ctx context.Context) ([]models.Webhook, error)
+	DeleteWebhook(ctx context.Context, id uuid.UUID) error
+	GetDeliveries(ctx context.Context, webhookID uuid.UUID, status string, limit int) ([]models.WebhookDelivery, error)
+	ReplayDeliveries(ctx context.Context, webhookID uuid.UUID, request models.ReplayRequest) (int64, error)
+
+	ClaimDeliveries(ctx context.Context, limit int, lease time.Duration) ([]models.PendingDelivery, error)
+	MarkDelivered(ctx context.Context, id int64, status int) error
+	MarkFailed(ctx context.Context, id int64, status int, reason string, retryAt *time.Time) error
+	DeleteOutboxBefore(ctx context.Context, before time.Time) (int64, error)
+}
+
+type webhookRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewWebhookRepository(db *pgxpool.Pool) WebhookRepository {
+	return &webhookRepository{db: db}
+}
+
+func (r *webhookRepository) CreateWebhook(ctx context.Context, request models.WebhookRequest) (*models.Webhook, error) {
+	eventTypes := request.EventTypes
+	if eventTypes == nil {
+		eventTypes = []string{}
+	}
+
+	webhook := models.Webhook{URL: request.URL, Secret: request.Secret, EventTypes: eventTypes}
+	err := r.db.QueryRow(ctx, `
+		INSERT INTO webhooks (url, secret, event_types)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at`, request.URL, request.Secret, eventTypes).
+		Scan(&webhook.ID, &webhook.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+func (r *webhookRepository) GetWebhooks(ctx context.Context) ([]models.Webhook, error) {
+	rows, err := r.db.Query(ctx, "SELECT id, url, event_types, created_at FROM webhooks ORDER BY created_at")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := make([]models.Webhook, 0)
+	for rows.Next() {
+		var w models.Webhook
+		if err = rows.Scan(&w.ID, &w.URL, &w.EventTypes, &w.CreatedAt); err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, w)
+	}
+	return webhooks, rows.Err()
+}
+
+// DeleteWebhook удаляет webhook вместе с его доставками.
+func (r *webhookRepository) DeleteWebhook(ctx context.Context, id uuid.UUID) error {
+	tag, err := r.db.Exec(ctx, "DELETE FROM webhooks WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrWebhookNotFound
+	}
+	return nil
+}
+
+// GetDeliveries возвращает последние доставки webhook, status пустой — все.
+func (r *webhookRepository) GetDeliveries(ctx context.Context, webhookID uuid.UUID, status string, limit int) ([]models.WebhookDelivery, error) {
+	if err := r.webhookExists(ctx, webhookID); err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.Query(ctx, `
+		SELECT d.id, d.webhook_id, d.outbox_id, o.event_type, d.status, d.attempts, d.next_attempt_at,
+		       d.last_status, d.last_error, d.created_at, d.delivered_at
+		FROM webhook_deliveries d
+		JOIN outbox o ON o.id = d.outbox_id
+		WHERE d.webhook_id = $1 AND ($2 = '' OR d.status = $2)
+		ORDER BY d.id DESC
+		LIMIT $3`, webhookID, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := make([]models.WebhookDelivery, 0)
+	for rows.Next() {
+		var d models.WebhookDelivery
+		err = rows.Scan(&d.ID, &d.WebhookID, &d.EventID, &d.EventType, &d.Status, &d.Attempts, &d.NextAttemptAt,
+			&d.LastStatus, &d.LastError, &d.CreatedAt, &d.DeliveredAt)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// ReplayDeliveries возвращает доставки webhook в очередь с обнулённым
+// счётчиком попыток.
+func (r *webhookRepository) ReplayDeliveries(ctx context.Context, webhookID uuid.UUID, request models.ReplayRequest) (int64, error) {
+	if err := r.webhookExists(ctx, webhookID); err != nil {
+		return 0, err
+	}
+
+	statuses := []string{models.DeliveryStatusDead}
+	if request.IncludeDelivered {
+		statuses = append(statuses, models.DeliveryStatusDelivered)
+	}
+	tag, err := r.db.Exec(ctx, `
+		UPDATE webhook_deliveries
+		SET status = 'pending', attempts = 0, next_attempt_at = now(), delivered_at = NULL
+		WHERE webhook_id = $1 AND status = ANY($2) AND ($3::timestamptz IS NULL OR created_at >= $3)`,
+		webhookID, statuses, request.Since)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// ClaimDeliveries берёт в работу до limit доставок, срок которых подошёл.
+// Попытка сразу откладывается на lease: если экземпляр упадёт посреди
+// отправки, доставку через lease подберёт другой. SKIP LOCKED не даёт двум
+// экземплярам взять одну доставку.
+func (r *webhookRepository) ClaimDeliveries(ctx context.Context, limit int, lease time.Duration) ([]models.PendingDelivery, error) {
+	rows, err := r.db.Query(ctx, `
+		UPDATE webhook_deliveries d
+		SET attempts = d.attempts + 1, next_attempt_at = now() + $2::interval
+		FROM webhooks w, outbox o
+		WHERE d.id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= now()
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		) AND w.id = d.webhook_id AND o.id = d.outbox_id
+		RETURNING d.id, d.attempts, w.url, w.secret, o.id, o.event_type, o.created_at, o.payload`,
+		limit, lease)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := make([]models.PendingDelivery, 0, limit)
+	for rows.Next() {
+		var d models.PendingDelivery
+		err = rows.Scan(&d.ID, &d.Attempts, &d.URL, &d.Secret, &d.Event.ID, &d.Event.Type, &d.Event.CreatedAt, &d.Event.Data)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+func (r *webhookRepository) MarkDelivered(ctx context.Context, id int64, status int) error {
+	_, err := r.db.Exec(ctx, `
+		UPDATE webhook_deliveries
+		SET status = 'delivered', last_status = $2, last_error = NULL, delivered_at = now()
+		WHERE id = $1`, id, status)
+	return err
+}
+
+// MarkFailed записывает неудачную попытку. Без retryAt доставка уходит в
+// dead letter и ждёт ручного повтора. status 0 — ответа не было.
+func (r *webhookRepository) MarkFailed(ctx context.Context, id int64, status int, reason string, retryAt *time.Time) error {
+	var lastStatus *int
+	if status != 0 {
+		lastStatus = &status
+	}
+	_, err := r.db.Exec(ctx, `
+		UPDATE webhook_deliveries
+		SET status = CASE WHEN $4::timestamptz IS NULL THEN 'dead' ELSE 'pending' END,
+		    next_attempt_at = COALESCE($4, next_attempt_at),
+		    last_status = $2, last_error = $3
+		WHERE id = $1`, id, lastStatus, reason, retryAt)
+	return err
+}
+
+// DeleteOutboxBefore удаляет события старше before, все доставки которых
+// завершились успешно. Недоставленные остаются для повтора.
+func (r *webhookRepository) DeleteOutboxBefore(ctx context.Context, before time.Time) (int64, error) {
+	tag, err := r.db.Exec(ctx, `
+		DELETE FROM outbox o
+		WHERE o.created_at < $1 AND NOT EXISTS (
+			SELECT 1 FROM webhook_deliveries d
+			WHERE d.outbox_id = o.id AND d.status <> 'delivered'
+		)`, before)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+func (r *webhookRepository) webhookExists(ctx context.Context, id uuid.UUID) error {
+	var exists bool
+	err := r.db.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM webhooks WHERE id = $1)", id).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrWebhookNotFound
+	}
+	return nil
+}
+
+// writeOutbox сохраняет событие для внешних систем и создаёт по доставке на
+// каждый подписанный на него webhook. Вызывается в транзакции операции.
+func writeOutbox(ctx context.Context, tx pgx.Tx, eventType string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to encode outbox event: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		WITH event AS (
+			INSERT INTO outbox (event_type, payload)
+			VALUES ($1, $2)
+			RETURNING id
+		)
+		INSERT INTO webhook_deliveries (webhook_id, outbox_id)
+		SELECT w.id, event.id
+		FROM webhooks w, event
+		WHERE cardinality(w.event_types) = 0 OR $1 = ANY(w.event_types)`,
+		eventType, payload)
+	if err != nil {
+		return fmt.Errorf("failed to write outbox event: %w", err)
+	}
+	return nil
+}
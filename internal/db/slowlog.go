@@ -0,0 +1,132 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/logger"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+	"math/rand/v2"
+	"runtime"
+	"strings"
+	"time"
+)
+
+const explainTimeout = 5 * time.Second
+
+type slowQueryKey struct{}
+
+type queryStart struct {
+	sql   string
+	args  []any
+	start time.Time
+}
+
+// slowQueryTracer пишет в лог запросы дольше threshold. Логгер берётся из
+// контекста запроса, поэтому запись содержит request ID. Для доли explainRate
+// медленных запросов в фоне снимается план EXPLAIN.
+type slowQueryTracer struct {
+	threshold   time.Duration
+	explainRate float64
+	pool        *pgxpool.Pool
+	// explaining ограничивает число одновременных EXPLAIN одним
+	explaining chan struct{}
+}
+
+func newSlowQueryTracer(threshold time.Duration, explainRate float64) *slowQueryTracer {
+	return &slowQueryTracer{
+		threshold:   threshold,
+		explainRate: explainRate,
+		explaining:  make(chan struct{}, 1),
+	}
+}
+
+func (t *slowQueryTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	if t.threshold <= 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, slowQueryKey{}, &queryStart{sql: data.SQL, args: data.Args, start: time.Now()})
+}
+
+func (t *slowQueryTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	query, ok := ctx.Value(slowQueryKey{}).(*queryStart)
+	if !ok {
+		return
+	}
+	elapsed := time.Since(query.start)
+	if elapsed < t.threshold {
+		return
+	}
+
+	// TraceQueryEnd вызывается из Scan/Close, то есть ещё из кода репозитория
+	log := logger.FromContext(ctx)
+	log.Warn("slow sql",
+		zap.String("sql", compactSQL(query.sql)),
+		zap.Int("args", len(query.args)),
+		zap.Duration("duration", elapsed),
+		zap.String("caller", queryCaller()),
+		zap.Error(data.Err),
+	)
+
+	if data.Err == nil && t.pool != nil && explainable(query.sql) && rand.Float64() < t.explainRate {
+		t.explain(log, query)
+	}
+}
+
+func (t *slowQueryTracer) explain(log logger.Logger, query *queryStart) {
+	select {
+	case t.explaining <- struct{}{}:
+	default:
+		return
+	}
+
+	go func() {
+		defer func() { <-t.explaining }()
+
+		ctx, cancel := context.WithTimeout(context.Background(), explainTimeout)
+		defer cancel()
+
+		rows, err := t.pool.Query(ctx, "EXPLAIN "+query.sql, query.args...)
+		if err != nil {
+			log.Warn("failed to explain slow sql", zap.Error(err))
+			return
+		}
+		plan, err := pgx.CollectRows(rows, pgx.RowTo[string])
+		if err != nil {
+			log.Warn("failed to explain slow sql", zap.Error(err))
+			return
+		}
+		log.Info("slow sql plan", zap.String("sql", compactSQL(query.sql)), zap.String("plan", strings.Join(plan, "\n")))
+	}()
+}
+
+// queryCaller находит первый кадр стека вне pgx и пакета db — место в
+// репозитории, откуда пришёл запрос.
+func queryCaller() string {
+	pcs := make([]uintptr, 32)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(3, pcs)])
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, "github.com/jackc/") &&
+			!strings.HasPrefix(frame.Function, "github.com/Ki4EH/stunning-octo-waddle/internal/db.") {
+			return fmt.Sprintf("%s:%d", frame.Function, frame.Line)
+		}
+		if !more {
+			return "unknown"
+		}
+	}
+}
+
+// explainable отсекает служебные команды: BEGIN, COMMIT, SET и т.п.
+func explainable(sql string) bool {
+	switch sqlOperation(sql) {
+	case "SELECT", "WITH", "INSERT", "UPDATE", "DELETE":
+		return true
+	}
+	return false
+}
+
+func compactSQL(sql string) string {
+	return strings.Join(strings.Fields(sql), " ")
+}
@@ -0,0 +1,58 @@
+package db
+
+import (
+	"context"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/logger"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"testing"
+	"time"
+)
+
+func TestSlowQueryTracer(t *testing.T) {
+	core, logs := observer.New(zap.DebugLevel)
+	ctx := logger.WithContext(context.Background(), logger.NewFromZap(zap.New(core)))
+
+	t.Run("fast query is not logged", func(t *testing.T) {
+		tracer := newSlowQueryTracer(time.Hour, 0)
+		qctx := tracer.TraceQueryStart(ctx, nil, pgx.TraceQueryStartData{SQL: "SELECT 1"})
+		tracer.TraceQueryEnd(qctx, nil, pgx.TraceQueryEndData{})
+
+		assert.Zero(t, logs.Len())
+	})
+
+	t.Run("slow query is logged with caller", func(t *testing.T) {
+		tracer := newSlowQueryTracer(time.Nanosecond, 0)
+		qctx := tracer.TraceQueryStart(ctx, nil, pgx.TraceQueryStartData{
+			SQL:  "SELECT coin\n\t\tFROM credentials WHERE id = $1",
+			Args: []any{1},
+		})
+		time.Sleep(time.Millisecond)
+		tracer.TraceQueryEnd(qctx, nil, pgx.TraceQueryEndData{})
+
+		entries := logs.TakeAll()
+		require.Len(t, entries, 1)
+		fields := entries[0].ContextMap()
+		assert.Equal(t, "SELECT coin FROM credentials WHERE id = $1", fields["sql"])
+		assert.EqualValues(t, 1, fields["args"])
+		assert.Contains(t, fields["caller"], "testing.tRunner")
+	})
+
+	t.Run("zero threshold disables the log", func(t *testing.T) {
+		tracer := newSlowQueryTracer(0, 0)
+		qctx := tracer.TraceQueryStart(ctx, nil, pgx.TraceQueryStartData{SQL: "SELECT 1"})
+		tracer.TraceQueryEnd(qctx, nil, pgx.TraceQueryEndData{})
+
+		assert.Zero(t, logs.Len())
+	})
+}
+
+func TestExplainable(t *testing.T) {
+	assert.True(t, explainable("  select 1"))
+	assert.True(t, explainable("WITH due AS (SELECT 1) SELECT * FROM due"))
+	assert.False(t, explainable("begin"))
+	assert.False(t, explainable(""))
+}
@@ -0,0 +1,155 @@
+// Package events доставляет события пользователей подключённым клиентам.
+// Источник событий — LISTEN/NOTIFY Postgres, поэтому событие, записанное
+// любым экземпляром сервиса, получают клиенты всех экземпляров.
+package events
+
+import (
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/models"
+	"github.com/google/uuid"
+	"sync"
+)
+
+// subscriptionBuffer — сколько событий ждёт медленного клиента. При
+// переполнении подписка закрывается, и клиент дочитывает пропущенное
+// по Last-Event-ID после переподключения.
+const subscriptionBuffer = 64
+
+// Broker раздаёт события подпискам пользователя на этом экземпляре.
+type Broker struct {
+	mu        sync.Mutex
+	subs      map[uuid.UUID]map[*Subscription]struct{}
+	observers []Observer
+	closed    bool
+}
+
+// Observer получает все события экземпляра, например чтобы сбрасывать
+// кеши. Reset вызывается, когда события могли быть потеряны. Вызовы идут под
+// блокировкой брокера, поэтому не должны блокироваться.
+type Observer struct {
+	Event func(models.UserEvent)
+	Reset func()
+}
+
+// Subscription — поток событий одного пользователя. Events закрывается,
+// когда подписка снята, отстала или брокер остановлен.
+type Subscription struct {
+	Events <-chan models.UserEvent
+
+	events chan models.UserEvent
+	userID uuid.UUID
+	broker *Broker
+	once   sync.Once
+}
+
+func NewBroker() *Broker {
+	return &Broker{subs: make(map[uuid.UUID]map[*Subscription]struct{})}
+}
+
+func (b *Broker) Subscribe(userID uuid.UUID) *Subscription {
+	events := make(chan models.UserEvent, subscriptionBuffer)
+	sub := &Subscription{Events: events, events: events, userID: userID, broker: b}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		sub.once.Do(func() { close(events) })
+		return sub
+	}
+	if b.subs[userID] == nil {
+		b.subs[userID] = make(map[*Subscription]struct{})
+	}
+	b.subs[userID][sub] = struct{}{}
+	return sub
+}
+
+// Observe добавляет наблюдателя. Он получает событие раньше подписчиков,
+// поэтому подписчик, перечитывающий данные по событию, не увидит старые.
+func (b *Broker) Observe(o Observer) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.observers = append(b.observers, o)
+}
+
+// Close снимает подписку. Повторный вызов ничего не делает.
+func (s *Subscription) Close() {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	s.broker.remove(s)
+}
+
+// Publish отправляет событие подпискам его получателя, не блокируясь.
+func (b *Broker) Publish(event models.UserEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, o := range b.observers {
+		o.Event(event)
+	}
+	for sub := range b.subs[event.UserID] {
+		select {
+		case sub.events <- event:
+		default:
+			b.remove(sub)
+		}
+	}
+}
+
+// Reset закрывает все подписки. Вызывается, когда события могли быть
+// потеряны, например после переподключения к базе: клиенты переподключатся
+// и дочитают пропущенное из таблицы.
+func (b *Broker) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, o := range b.observers {
+		o.Reset()
+	}
+	b.removeAll()
+}
+
+// Close закрывает все подписки и не даёт создавать новые. Нужен при
+// остановке сервера, чтобы открытые потоки не держали Shutdown.
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	b.removeAll()
+}
+
+// Closed сообщает, что брокер остановлен и новых событий не будет.
+func (b *Broker) Closed() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.closed
+}
+
+// Subscribers возвращает число открытых подписок.
+func (b *Broker) Subscribers() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	n := 0
+	for _, subs := range b.subs {
+		n += len(subs)
+	}
+	return n
+}
+
+func (b *Broker) removeAll() {
+	for _, subs := range b.subs {
+		for sub := range subs {
+			b.remove(sub)
+		}
+	}
+}
+
+func (b *Broker) remove(sub *Subscription) {
+	sub.once.Do(func() {
+		close(sub.events)
+		subs := b.subs[sub.userID]
+		delete(subs, sub)
+		if len(subs) == 0 {
+			delete(b.subs, sub.userID)
+		}
+	})
+}
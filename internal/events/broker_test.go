@@ -0,0 +1,99 @@
+package events
+
+import (
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/models"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestBroker(t *testing.T) {
+	alice := uuid.New()
+	bob := uuid.New()
+
+	t.Run("events reach only the recipient", func(t *testing.T) {
+		b := NewBroker()
+		aliceSub := b.Subscribe(alice)
+		bobSub := b.Subscribe(bob)
+		defer aliceSub.Close()
+		defer bobSub.Close()
+
+		b.Publish(models.UserEvent{ID: 1, UserID: alice, Type: models.EventCoinsGranted})
+
+		event := <-aliceSub.Events
+		assert.Equal(t, int64(1), event.ID)
+		assert.Empty(t, bobSub.Events)
+	})
+
+	t.Run("every subscription of the user gets the event", func(t *testing.T) {
+		b := NewBroker()
+		first := b.Subscribe(alice)
+		second := b.Subscribe(alice)
+
+		b.Publish(models.UserEvent{ID: 1, UserID: alice})
+
+		assert.Len(t, first.Events, 1)
+		assert.Len(t, second.Events, 1)
+		first.Close()
+		first.Close()
+		assert.Equal(t, 1, b.Subscribers())
+	})
+
+	t.Run("slow subscriber is dropped", func(t *testing.T) {
+		b := NewBroker()
+		sub := b.Subscribe(alice)
+
+		for i := range subscriptionBuffer + 1 {
+			b.Publish(models.UserEvent{ID: int64(i), UserID: alice})
+		}
+
+		received := 0
+		for range sub.Events {
+			received++
+		}
+		assert.Equal(t, subscriptionBuffer, received)
+		assert.Equal(t, 0, b.Subscribers())
+		sub.Close()
+	})
+
+	t.Run("close ends subscriptions and rejects new ones", func(t *testing.T) {
+		b := NewBroker()
+		sub := b.Subscribe(alice)
+
+		b.Close()
+		_, ok := <-sub.Events
+		assert.False(t, ok)
+
+		late := b.Subscribe(bob)
+		_, ok = <-late.Events
+		require.False(t, ok)
+		late.Close()
+		assert.Equal(t, 0, b.Subscribers())
+	})
+
+	t.Run("observer sees every event before subscribers and resets", func(t *testing.T) {
+		b := NewBroker()
+		sub := b.Subscribe(alice)
+		defer sub.Close()
+
+		var observed []uuid.UUID
+		resets := 0
+		b.Observe(Observer{
+			Event: func(event models.UserEvent) {
+				if event.ID == 1 {
+					assert.Empty(t, sub.Events, "observer must run before delivery")
+				}
+				observed = append(observed, event.UserID)
+			},
+			Reset: func() { resets++ },
+		})
+
+		b.Publish(models.UserEvent{ID: 1, UserID: alice})
+		b.Publish(models.UserEvent{ID: 2, UserID: bob})
+		assert.Equal(t, []uuid.UUID{alice, bob}, observed)
+
+		b.Reset()
+		assert.Equal(t, 1, resets)
+	})
+}
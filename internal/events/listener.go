@@ -0,0 +1,91 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/models"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/repository"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/logger"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+	"time"
+)
+
+const (
+	minReconnectDelay = 100 * time.Millisecond
+	maxReconnectDelay = 10 * time.Second
+)
+
+// Listen слушает repository.EventsChannel на отдельном соединении из пула и
+// передаёт события брокеру. При обрыве переподключается, а подписки
+// сбрасывает: события за время обрыва клиенты дочитают по Last-Event-ID.
+// Блокируется до отмены ctx.
+func Listen(ctx context.Context, pool *pgxpool.Pool, broker *Broker, log logger.Logger) {
+	log = log.With(zap.String("component", "events_listener"))
+	connected := false
+
+	Watch(ctx, pool, repository.EventsChannel, log, func() {
+		if connected {
+			broker.Reset()
+		}
+		connected = true
+	}, func(payload string) {
+		var event models.UserEvent
+		if err := json.Unmarshal([]byte(payload), &event); err != nil {
+			log.Error("failed to decode event", zap.Error(err))
+			return
+		}
+		broker.Publish(event)
+	})
+}
+
+// Watch слушает канал channel на отдельном соединении из пула и передаёт
+// тела уведомлений в onNotification. onConnect вызывается после каждого
+// подключения: уведомления за время обрыва потеряны, и их нужно восполнить.
+// Блокируется до отмены ctx.
+func Watch(ctx context.Context, pool *pgxpool.Pool, channel string, log logger.Logger, onConnect func(), onNotification func(payload string)) {
+	delay := minReconnectDelay
+
+	for ctx.Err() == nil {
+		err := listen(ctx, pool, channel, func() {
+			onConnect()
+			delay = minReconnectDelay
+		}, onNotification)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Warn("listener disconnected", zap.String("channel", channel), zap.Error(err), zap.Duration("retry_in", delay))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxReconnectDelay)
+	}
+}
+
+func listen(ctx context.Context, pool *pgxpool.Pool, channel string, onConnect func(), onNotification func(string)) error {
+	pooled, err := pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	// Соединение забирается из пула насовсем: подписка LISTEN осталась бы
+	// у следующего пользователя соединения
+	conn := pooled.Hijack()
+	defer conn.Close(context.Background())
+
+	if _, err = conn.Exec(ctx, "LISTEN "+pgx.Identifier{channel}.Sanitize()); err != nil {
+		return err
+	}
+	onConnect()
+
+	for {
+		n, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		onNotification(n.Payload)
+	}
+}
@@ -0,0 +1,136 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/migrate"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	StatusOK          = "ok"
+	StatusUnavailable = "unavailable"
+
+	checkTimeout = 2 * time.Second
+)
+
+var ErrShuttingDown = errors.New("server is shutting down")
+
+type Check func(ctx context.Context) error
+
+type CheckResult struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type Report struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+// Checker собирает проверки готовности. После SetShuttingDown сервис
+// перестаёт быть готовым, чтобы балансировщик успел снять с него трафик.
+type Checker struct {
+	mu           sync.RWMutex
+	names        []string
+	checks       map[string]Check
+	shuttingDown atomic.Bool
+}
+
+func NewChecker() *Checker {
+	return &Checker{checks: make(map[string]Check)}
+}
+
+func (h *Checker) AddCheck(name string, check Check) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.checks[name]; !ok {
+		h.names = append(h.names, name)
+	}
+	h.checks[name] = check
+}
+
+func (h *Checker) SetShuttingDown() {
+	h.shuttingDown.Store(true)
+}
+
+func (h *Checker) ShuttingDown() bool {
+	return h.shuttingDown.Load()
+}
+
+// Ready выполняет все проверки параллельно и возвращает отчёт.
+func (h *Checker) Ready(ctx context.Context) Report {
+	if h.ShuttingDown() {
+		return Report{Status: StatusUnavailable, Checks: map[string]CheckResult{
+			"shutdown": {Status: StatusUnavailable, Error: ErrShuttingDown.Error()},
+		}}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	h.mu.RLock()
+	names := append([]string(nil), h.names...)
+	checks := make([]Check, len(names))
+	for i, name := range names {
+		checks[i] = h.checks[name]
+	}
+	h.mu.RUnlock()
+
+	results := make([]CheckResult, len(names))
+	var wg sync.WaitGroup
+	for i := range checks {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = CheckResult{Status: StatusOK}
+			if err := checks[i](ctx); err != nil {
+				results[i] = CheckResult{Status: StatusUnavailable, Error: err.Error()}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOK, Checks: make(map[string]CheckResult, len(names))}
+	for i, name := range names {
+		report.Checks[name] = results[i]
+		if results[i].Status != StatusOK {
+			report.Status = StatusUnavailable
+		}
+	}
+	return report
+}
+
+func DatabaseCheck(db *pgxpool.Pool) Check {
+	return db.Ping
+}
+
+// PoolCheck не проходит, когда все соединения пула заняты: новые запросы
+// будут ждать свободного соединения.
+func PoolCheck(db *pgxpool.Pool) Check {
+	return func(context.Context) error {
+		stat := db.Stat()
+		if stat.AcquiredConns() >= stat.MaxConns() {
+			return fmt.Errorf("connection pool exhausted: %d/%d in use", stat.AcquiredConns(), stat.MaxConns())
+		}
+		return nil
+	}
+}
+
+// MigrationsCheck не проходит, пока в базе есть неприменённые миграции.
+func MigrationsCheck(migrator *migrate.Migrator) Check {
+	return func(ctx context.Context) error {
+		pending, err := migrator.Pending(ctx)
+		if err != nil {
+			return err
+		}
+		if pending > 0 {
+			return fmt.Errorf("%d migrations pending", pending)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,56 @@
+// Package idempotency — хранилища ответов на запросы с заголовком
+// Idempotency-Key.
+package idempotency
+
+import (
+	"context"
+	"crypto/sha256"
+	"github.com/google/uuid"
+	"time"
+)
+
+const (
+	DefaultTTL = 24 * time.Hour
+
+	// Сколько ключ считается занятым выполняющимся запросом. Если экземпляр
+	// упал посреди запроса, повтор получит 409 не дольше этого срока
+	leaseTTL = 5 * time.Minute
+)
+
+type State int
+
+const (
+	// New — ключ занят этим запросом, ответ нужно сохранить через Complete
+	New State = iota
+	// Replay — запрос уже выполнен, в Lease.Response его ответ
+	Replay
+	// InFlight — запрос с этим ключом ещё выполняется
+	InFlight
+	// KeyReused — ключ уже использован с другим телом запроса
+	KeyReused
+)
+
+// Lease — результат Begin. Token передаётся в Complete и Forget, чтобы они
+// не тронули ключ, который после истечения занял другой запрос.
+type Lease struct {
+	State    State
+	Token    uuid.UUID
+	Response Response
+}
+
+// Response — сохранённый ответ.
+type Response struct {
+	Status      int
+	ContentType string
+	Body        []byte
+}
+
+// Fingerprint — хеш тела запроса: повтор с тем же ключом и другим телом
+// отклоняется.
+type Fingerprint = [sha256.Size]byte
+
+type Store interface {
+	Begin(ctx context.Context, key string, fingerprint Fingerprint) (Lease, error)
+	Complete(ctx context.Context, key string, token uuid.UUID, response Response) error
+	Forget(ctx context.Context, key string, token uuid.UUID) error
+}
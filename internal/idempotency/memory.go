@@ -0,0 +1,88 @@
+package idempotency
+
+import (
+	"context"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/cache"
+	"github.com/google/uuid"
+	"sync"
+	"time"
+)
+
+const DefaultMaxKeys = 100000
+
+// Memory хранит ответы в памяти процесса, поэтому повтор должен прийти на
+// тот же экземпляр. Сверх лимита ключей вытесняются давно не
+// использованные.
+type Memory struct {
+	// mu делает проверку и запись ключа в Begin атомарными
+	mu      sync.Mutex
+	entries *cache.LRU[string, *entry]
+}
+
+type entry struct {
+	fingerprint Fingerprint
+	token       uuid.UUID
+	done        bool
+	response    Response
+}
+
+// NewMemory создаёт хранилище не больше чем на size ключей, ответы в
+// котором живут ttl. Нулевые значения заменяются DefaultTTL и
+// DefaultMaxKeys.
+func NewMemory(ttl time.Duration, size int) *Memory {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	if size <= 0 {
+		size = DefaultMaxKeys
+	}
+	return &Memory{entries: cache.NewLRU[string, *entry](size, ttl)}
+}
+
+func (m *Memory) Begin(_ context.Context, key string, fingerprint Fingerprint) (Lease, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.entries.Get(key)
+	switch {
+	case !ok:
+		e = &entry{fingerprint: fingerprint, token: uuid.New()}
+		m.entries.Set(key, e)
+		return Lease{State: New, Token: e.token}, nil
+	case e.fingerprint != fingerprint:
+		return Lease{State: KeyReused}, nil
+	case !e.done:
+		return Lease{State: InFlight}, nil
+	}
+	return Lease{State: Replay, Response: e.response}, nil
+}
+
+func (m *Memory) Complete(_ context.Context, key string, token uuid.UUID, response Response) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.entries.Get(key)
+	if !ok || e.token != token {
+		return nil
+	}
+	e.done = true
+	e.response = response
+	// Срок хранения отсчитывается от ответа
+	m.entries.Set(key, e)
+	return nil
+}
+
+func (m *Memory) Forget(_ context.Context, key string, token uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if e, ok := m.entries.Get(key); ok && e.token == token {
+		m.entries.Delete(key)
+	}
+	return nil
+}
+
+// Len возвращает число хранимых ключей.
+func (m *Memory) Len() int {
+	return m.entries.Len()
+}
@@ -0,0 +1,38 @@
+package idempotency
+
+import (
+	"context"
+	"crypto/sha256"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+)
+
+func TestMemory(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemory(0, 1)
+	body := sha256.Sum256([]byte("body"))
+
+	lease, err := store.Begin(ctx, "a", body)
+	require.NoError(t, err)
+	require.Equal(t, New, lease.State)
+
+	// Ключ вытеснен и занят заново: ответ первого запроса не сохраняется
+	_, err = store.Begin(ctx, "b", body)
+	require.NoError(t, err)
+	again, err := store.Begin(ctx, "a", body)
+	require.NoError(t, err)
+	require.Equal(t, New, again.State)
+
+	require.NoError(t, store.Complete(ctx, "a", lease.Token, Response{Status: http.StatusCreated}))
+	inFlight, err := store.Begin(ctx, "a", body)
+	require.NoError(t, err)
+	assert.Equal(t, InFlight, inFlight.State)
+
+	require.NoError(t, store.Forget(ctx, "a", lease.Token))
+	require.NoError(t, store.Complete(ctx, "a", again.Token, Response{Status: http.StatusOK}))
+	replay, err := store.Begin(ctx, "a", body)
+	require.NoError(t, err)
+	assert.Equal(t, Lease{State: Replay, Response: Response{Status: http.StatusOK}}, replay)
+}
@@ -0,0 +1,112 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"time"
+)
+
+// Сколько раз Begin перечитывает ключ, который освободился между вставкой и
+// чтением
+const beginAttempts = 3
+
+// Postgres хранит ответы в таблице idempotency_keys, поэтому повтор
+// получает сохранённый ответ, на какой бы экземпляр ни пришёл.
+type Postgres struct {
+	db  *pgxpool.Pool
+	ttl time.Duration
+}
+
+// NewPostgres создаёт хранилище, ответы в котором живут ttl. Нулевой ttl
+// заменяется DefaultTTL.
+func NewPostgres(db *pgxpool.Pool, ttl time.Duration) *Postgres {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	return &Postgres{db: db, ttl: ttl}
+}
+
+func (p *Postgres) Begin(ctx context.Context, key string, fingerprint Fingerprint) (Lease, error) {
+	for range beginAttempts {
+		// Истёкший ключ занимается заново, как новый
+		token := uuid.New()
+		err := p.db.QueryRow(ctx, `
+			INSERT INTO idempotency_keys (key, fingerprint, token, expires_at)
+			VALUES ($1, $2, $3, now() + $4::interval)
+			ON CONFLICT (key) DO UPDATE
+			SET fingerprint = excluded.fingerprint, token = excluded.token, done = false,
+				status = NULL, content_type = NULL, body = NULL, expires_at = excluded.expires_at
+			WHERE idempotency_keys.expires_at <= now()
+			RETURNING token`, key, fingerprint[:], token, leaseTTL).Scan(&token)
+		if err == nil {
+			return Lease{State: New, Token: token}, nil
+		}
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return Lease{}, fmt.Errorf("failed to begin idempotent request: %w", err)
+		}
+
+		var stored []byte
+		var done bool
+		var response Response
+		var status *int
+		var contentType *string
+		err = p.db.QueryRow(ctx, `
+			SELECT fingerprint, done, status, content_type, body
+			FROM idempotency_keys
+			WHERE key = $1 AND expires_at > now()`, key).
+			Scan(&stored, &done, &status, &contentType, &response.Body)
+		if errors.Is(err, pgx.ErrNoRows) {
+			// Ключ освободили или он истёк между запросами
+			continue
+		}
+		if err != nil {
+			return Lease{}, fmt.Errorf("failed to read idempotent response: %w", err)
+		}
+
+		switch {
+		case Fingerprint(stored) != fingerprint:
+			return Lease{State: KeyReused}, nil
+		case !done:
+			return Lease{State: InFlight}, nil
+		}
+		response.Status = *status
+		if contentType != nil {
+			response.ContentType = *contentType
+		}
+		return Lease{State: Replay, Response: response}, nil
+	}
+	return Lease{State: InFlight}, nil
+}
+
+func (p *Postgres) Complete(ctx context.Context, key string, token uuid.UUID, response Response) error {
+	_, err := p.db.Exec(ctx, `
+		UPDATE idempotency_keys
+		SET done = true, status = $3, content_type = $4, body = $5, expires_at = now() + $6::interval
+		WHERE key = $1 AND token = $2`,
+		key, token, response.Status, response.ContentType, response.Body, p.ttl)
+	if err != nil {
+		return fmt.Errorf("failed to store idempotent response: %w", err)
+	}
+	return nil
+}
+
+func (p *Postgres) Forget(ctx context.Context, key string, token uuid.UUID) error {
+	_, err := p.db.Exec(ctx, "DELETE FROM idempotency_keys WHERE key = $1 AND token = $2", key, token)
+	if err != nil {
+		return fmt.Errorf("failed to release idempotency key: %w", err)
+	}
+	return nil
+}
+
+// DeleteExpired удаляет истёкшие ключи и возвращает их число.
+func (p *Postgres) DeleteExpired(ctx context.Context) (int64, error) {
+	tag, err := p.db.Exec(ctx, "DELETE FROM idempotency_keys WHERE expires_at <= now()")
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired idempotency keys: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
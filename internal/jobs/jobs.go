@@ -0,0 +1,127 @@
+package jobs
+
+import (
+	"context"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/repository"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/idempotency"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/logger"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/ratelimit"
+	"go.uber.org/zap"
+	"time"
+)
+
+// RunCoinExpiry раз в interval списывает просроченные партии монет.
+// Блокируется до отмены ctx.
+func RunCoinExpiry(ctx context.Context, repo repository.CoinRepository, interval time.Duration, log logger.Logger) {
+	log = log.With(zap.String("job", "coin_expiry"))
+	ctx = logger.WithContext(ctx, log)
+	runEvery(ctx, interval, func() {
+		expired, err := repo.ExpireLots(ctx)
+		if err != nil {
+			log.Error("failed to expire coin lots", zap.Error(err))
+			return
+		}
+		if expired > 0 {
+			log.Info("expired coin lots", zap.Int64("amount", expired))
+		}
+	})
+}
+
+// RunHoldRelease раз в interval закрывает холды с истёкшим сроком.
+// Блокируется до отмены ctx.
+func RunHoldRelease(ctx context.Context, repo repository.CoinRepository, interval time.Duration, log logger.Logger) {
+	log = log.With(zap.String("job", "hold_release"))
+	ctx = logger.WithContext(ctx, log)
+	runEvery(ctx, interval, func() {
+		released, err := repo.ReleaseExpiredHolds(ctx)
+		if err != nil {
+			log.Error("failed to release expired holds", zap.Error(err))
+			return
+		}
+		if released > 0 {
+			log.Info("released expired holds", zap.Int64("count", released))
+		}
+	})
+}
+
+// RunEventCleanup раз в interval удаляет события старше retention.
+// Блокируется до отмены ctx.
+func RunEventCleanup(ctx context.Context, repo repository.EventRepository, interval, retention time.Duration, log logger.Logger) {
+	log = log.With(zap.String("job", "event_cleanup"))
+	ctx = logger.WithContext(ctx, log)
+	runEvery(ctx, interval, func() {
+		deleted, err := repo.DeleteEventsBefore(ctx, time.Now().Add(-retention))
+		if err != nil {
+			log.Error("failed to delete old events", zap.Error(err))
+			return
+		}
+		if deleted > 0 {
+			log.Info("deleted old events", zap.Int64("count", deleted))
+		}
+	})
+}
+
+// RunOutboxCleanup раз в interval удаляет доставленные события outbox
+// старше retention. Блокируется до отмены ctx.
+func RunOutboxCleanup(ctx context.Context, repo repository.WebhookRepository, interval, retention time.Duration, log logger.Logger) {
+	log = log.With(zap.String("job", "outbox_cleanup"))
+	ctx = logger.WithContext(ctx, log)
+	runEvery(ctx, interval, func() {
+		deleted, err := repo.DeleteOutboxBefore(ctx, time.Now().Add(-retention))
+		if err != nil {
+			log.Error("failed to delete old outbox events", zap.Error(err))
+			return
+		}
+		if deleted > 0 {
+			log.Info("deleted old outbox events", zap.Int64("count", deleted))
+		}
+	})
+}
+
+// RunRateLimitCleanup раз в interval удаляет наполнившиеся корзины
+// ограничения частоты запросов. Блокируется до отмены ctx.
+func RunRateLimitCleanup(ctx context.Context, store *ratelimit.Postgres, interval time.Duration, log logger.Logger) {
+	log = log.With(zap.String("job", "rate_limit_cleanup"))
+	ctx = logger.WithContext(ctx, log)
+	runEvery(ctx, interval, func() {
+		deleted, err := store.DeleteFull(ctx)
+		if err != nil {
+			log.Error("failed to delete full rate limit buckets", zap.Error(err))
+			return
+		}
+		if deleted > 0 {
+			log.Debug("deleted full rate limit buckets", zap.Int64("count", deleted))
+		}
+	})
+}
+
+// RunIdempotencyCleanup раз в interval удаляет истёкшие ключи
+// идемпотентности. Блокируется до отмены ctx.
+func RunIdempotencyCleanup(ctx context.Context, store *idempotency.Postgres, interval time.Duration, log logger.Logger) {
+	log = log.With(zap.String("job", "idempotency_cleanup"))
+	ctx = logger.WithContext(ctx, log)
+	runEvery(ctx, interval, func() {
+		deleted, err := store.DeleteExpired(ctx)
+		if err != nil {
+			log.Error("failed to delete expired idempotency keys", zap.Error(err))
+			return
+		}
+		if deleted > 0 {
+			log.Debug("deleted expired idempotency keys", zap.Int64("count", deleted))
+		}
+	})
+}
+
+func runEvery(ctx context.Context, interval time.Duration, fn func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			fn()
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/logger"
+	mock_repository "github.com/Ki4EH/stunning-octo-waddle/internal/mocks/repository"
+	"go.uber.org/mock/gomock"
+	"testing"
+	"time"
+)
+
+func TestRunCoinExpiry(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mock_repository.NewMockCoinRepository(ctrl)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	calls := 0
+	mockRepo.EXPECT().
+		ExpireLots(gomock.Any()).
+		DoAndReturn(func(context.Context) (int64, error) {
+			calls++
+			if calls == 1 {
+				return 0, errors.New("database error")
+			}
+			cancel()
+			return 10, nil
+		}).
+		MinTimes(2)
+
+	done := make(chan struct{})
+	go func() {
+		RunCoinExpiry(ctx, mockRepo, time.Millisecond, logger.Nop())
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("RunCoinExpiry did not stop after context cancellation")
+	}
+}
+
+func TestRunHoldRelease(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mock_repository.NewMockCoinRepository(ctrl)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mockRepo.EXPECT().
+		ReleaseExpiredHolds(gomock.Any()).
+		DoAndReturn(func(context.Context) (int64, error) {
+			cancel()
+			return 3, nil
+		}).
+		MinTimes(1)
+
+	done := make(chan struct{})
+	go func() {
+		RunHoldRelease(ctx, mockRepo, time.Millisecond, logger.Nop())
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("RunHoldRelease did not stop after context cancellation")
+	}
+}
+
+func TestRunEventCleanup(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mock_repository.NewMockEventRepository(ctrl)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	retention := time.Hour
+	mockRepo.EXPECT().
+		DeleteEventsBefore(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, before time.Time) (int64, error) {
+			if d := time.Since(before); d < retention || d > retention+time.Minute {
+				t.Errorf("unexpected cutoff: %s ago", d)
+			}
+			cancel()
+			return 5, nil
+		}).
+		MinTimes(1)
+
+	done := make(chan struct{})
+	go func() {
+		RunEventCleanup(ctx, mockRepo, time.Millisecond, retention, logger.Nop())
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("RunEventCleanup did not stop after context cancellation")
+	}
+}
+
+func TestRunOutboxCleanup(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mock_repository.NewMockWebhookRepository(ctrl)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	retention := 24 * time.Hour
+	mockRepo.EXPECT().
+		DeleteOutboxBefore(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, before time.Time) (int64, error) {
+			if d := time.Since(before); d < retention || d > retention+time.Minute {
+				t.Errorf("unexpected cutoff: %s ago", d)
+			}
+			cancel()
+			return 2, nil
+		}).
+		MinTimes(1)
+
+	done := make(chan struct{})
+	go func() {
+		RunOutboxCleanup(ctx, mockRepo, time.Millisecond, retention, logger.Nop())
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("RunOutboxCleanup did not stop after context cancellation")
+	}
+}
@@ -0,0 +1,33 @@
+package logger
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+type contextKey struct{}
+
+var defaultLogger atomic.Pointer[Logger]
+
+func init() {
+	SetDefault(Nop())
+}
+
+// SetDefault задаёт логгер, который FromContext вернёт для контекста без
+// своего логгера (фоновые задачи, тесты).
+func SetDefault(l Logger) {
+	defaultLogger.Store(&l)
+}
+
+// WithContext кладёт логгер в контекст. Middleware добавляет в него request ID,
+// маршрут и пользователя, поэтому записи одного запроса легко найти вместе.
+func WithContext(ctx context.Context, l Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, l)
+}
+
+func FromContext(ctx context.Context) Logger {
+	if l, ok := ctx.Value(contextKey{}).(Logger); ok {
+		return l
+	}
+	return *defaultLogger.Load()
+}
@@ -6,23 +6,41 @@ import (
 )
 
 type Logger interface {
+	Debug(msg string, fields ...zap.Field)
 	Info(msg string, fields ...zap.Field)
+	Warn(msg string, fields ...zap.Field)
 	Error(msg string, fields ...zap.Field)
+	// With возвращает логгер, добавляющий fields к каждой записи
+	With(fields ...zap.Field) Logger
 }
 
 type ZapLogger struct {
 	logger *zap.Logger
 }
 
+func (z *ZapLogger) Debug(msg string, fields ...zap.Field) {
+	z.logger.Debug(msg, fields...)
+}
+
 func (z *ZapLogger) Info(msg string, fields ...zap.Field) {
 	z.logger.Info(msg, fields...)
 }
 
+func (z *ZapLogger) Warn(msg string, fields ...zap.Field) {
+	z.logger.Warn(msg, fields...)
+}
+
 func (z *ZapLogger) Error(msg string, fields ...zap.Field) {
 	z.logger.Error(msg, fields...)
 }
 
-func NewZapLogger(env string) (Logger, error) {
+func (z *ZapLogger) With(fields ...zap.Field) Logger {
+	return &ZapLogger{logger: z.logger.With(fields...)}
+}
+
+// NewZapLogger создаёт логгер для окружения env. Уровень берётся из level,
+// поэтому его можно менять на ходу.
+func NewZapLogger(env string, level zap.AtomicLevel) (Logger, error) {
 	var config zap.Config
 	if env == "development" {
 		config = zap.NewDevelopmentConfig()
@@ -32,6 +50,16 @@ func NewZapLogger(env string) (Logger, error) {
 		config.EncoderConfig.TimeKey = "timestamp"
 		config.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
 	}
+	config.Level = level
 	zl, err := config.Build()
 	return &ZapLogger{logger: zl}, err
 }
+
+func NewFromZap(zl *zap.Logger) Logger {
+	return &ZapLogger{logger: zl}
+}
+
+// Nop возвращает логгер, который ничего не пишет
+func Nop() Logger {
+	return &ZapLogger{logger: zap.NewNop()}
+}
@@ -0,0 +1,145 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "merch_shop"
+
+var (
+	// RequestDuration нужна для SLI из задания: 99.99% запросов быстрее 50мс,
+	// поэтому граница 0.05 обязательно есть среди бакетов.
+	RequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "HTTP request latency by route and status.",
+		Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+	}, []string{"method", "route", "status"})
+
+	Errors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "errors_total",
+		Help:      "Failed requests by error type.",
+	}, []string{"type"})
+
+	CoinsTransferred = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "coins_transferred_total",
+		Help:      "Coins sent between users.",
+	})
+
+	ItemsSold = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "items_sold_total",
+		Help:      "Shop items sold by type.",
+	}, []string{"item"})
+
+	Logins = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "logins_total",
+		Help:      "Successful logins of existing users.",
+	})
+
+	Registrations = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "registrations_total",
+		Help:      "Users created on first login.",
+	})
+
+	EventStreams = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "event_streams",
+		Help:      "Open Server-Sent Events connections.",
+	})
+
+	WalletSockets = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "wallet_sockets",
+		Help:      "Open WebSocket wallet connections.",
+	})
+
+	// WalletSocketsClosed — закрытые сервером WebSocket-соединения по причине:
+	// отставший клиент, истёкший токен, остановка сервера.
+	WalletSocketsClosed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "wallet_sockets_closed_total",
+		Help:      "WebSocket wallet connections closed by the server by reason.",
+	}, []string{"reason"})
+
+	// WebhookDeliveries — попытки доставки webhook по результату: delivered,
+	// failed (будет повтор) или dead (ушла в dead letter).
+	WebhookDeliveries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_deliveries_total",
+		Help:      "Webhook delivery attempts by result.",
+	}, []string{"result"})
+
+	WebhookDeliveryDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "webhook_delivery_duration_seconds",
+		Help:      "Duration of webhook delivery requests.",
+		Buckets:   prometheus.DefBuckets,
+	})
+
+	// DeprecatedRequests показывает, кто ещё ходит в /api v1 и когда его
+	// можно отключать.
+	DeprecatedRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "deprecated_requests_total",
+		Help:      "Requests to deprecated routes by route.",
+	}, []string{"method", "route"})
+
+	// RateLimited — запросы, отклонённые с 429: лимитом клиента (client) или
+	// общим (global).
+	RateLimited = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "rate_limited_total",
+		Help:      "Requests rejected by rate limits by route and scope.",
+	}, []string{"method", "route", "scope"})
+
+	// ReplicaLag — отставание реплик по последней проверке, -1 — реплика
+	// недоступна.
+	ReplicaLag = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "db",
+		Name:      "replica_lag_seconds",
+		Help:      "Replication lag of read replicas, -1 if unavailable.",
+	}, []string{"replica"})
+
+	// ReplicaReads — куда ушли чтения данных пользователя: replica, primary
+	// после недавней записи (recent_write) или primary из-за отставания
+	// реплик (lagging).
+	ReplicaReads = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "db",
+		Name:      "routed_reads_total",
+		Help:      "User reads by routing decision.",
+	}, []string{"route"})
+
+	// InfoCacheLookups — обращения к кешу ответов /api/info по результату:
+	// hit или miss.
+	InfoCacheLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "info_cache_lookups_total",
+		Help:      "Info response cache lookups by result.",
+	}, []string{"result"})
+
+	// CatalogLookups — цены при покупке: cached из копии каталога или stale,
+	// если копия отстала и покупка повторена с ценой из базы.
+	CatalogLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "catalog_lookups_total",
+		Help:      "Shop catalog lookups during purchases by result.",
+	}, []string{"result"})
+
+	// DBReadRetries — повторы чтений после обрыва соединения с базой.
+	DBReadRetries = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "db_read_retries_total",
+		Help:      "Database reads retried after a connection error.",
+	})
+)
@@ -0,0 +1,51 @@
+package migrate
+
+import (
+	"github.com/Ki4EH/stunning-octo-waddle/migrations"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoad(t *testing.T) {
+	t.Run("sorted by version", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"010_later.up.sql":    {Data: []byte("SELECT 10")},
+			"002_second.up.sql":   {Data: []byte("SELECT 2")},
+			"002_second.down.sql": {Data: []byte("SELECT -2")},
+			"001_first.up.sql":    {Data: []byte("SELECT 1")},
+			"README.md":           {Data: []byte("not a migration")},
+		}
+
+		loaded, err := Load(fsys)
+		require.NoError(t, err)
+		require.Len(t, loaded, 3)
+		assert.Equal(t, []int{1, 2, 10}, []int{loaded[0].Version, loaded[1].Version, loaded[2].Version})
+		assert.Equal(t, Migration{Version: 2, Name: "second", Up: "SELECT 2", Down: "SELECT -2"}, loaded[1])
+	})
+
+	t.Run("down without up", func(t *testing.T) {
+		_, err := Load(fstest.MapFS{"001_first.down.sql": {Data: []byte("SELECT 1")}})
+		assert.ErrorContains(t, err, "has no up script")
+	})
+
+	t.Run("same version with different names", func(t *testing.T) {
+		_, err := Load(fstest.MapFS{
+			"001_first.up.sql": {Data: []byte("SELECT 1")},
+			"001_other.up.sql": {Data: []byte("SELECT 1")},
+		})
+		assert.ErrorContains(t, err, "different names")
+	})
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	loaded, err := Load(migrations.FS)
+	require.NoError(t, err)
+	require.NotEmpty(t, loaded)
+
+	for i, m := range loaded {
+		assert.Equal(t, i+1, m.Version, "migrations must be numbered without gaps")
+		assert.NotEmpty(t, m.Down, "migration %d_%s has no down script", m.Version, m.Name)
+	}
+}
@@ -42,6 +42,21 @@ func (m *MockCoinRepository) EXPECT() *MockCoinRepositoryMockRecorder {
 	return m.recorder
 }
 
+// ApproveReversal mocks base method.
+func (m *MockCoinRepository) ApproveReversal(ctx context.Context, reversalID, approvedBy uuid.UUID) (*models.TransferReversal, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ApproveReversal", ctx, reversalID, approvedBy)
+	ret0, _ := ret[0].(*models.TransferReversal)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ApproveReversal indicates an expected call of ApproveReversal.
+func (mr *MockCoinRepositoryMockRecorder) ApproveReversal(ctx, reversalID, approvedBy any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ApproveReversal", reflect.TypeOf((*MockCoinRepository)(nil).ApproveReversal), ctx, reversalID, approvedBy)
+}
+
 // BuyItemFromShop mocks base method.
 func (m *MockCoinRepository) BuyItemFromShop(ctx context.Context, userID uuid.UUID, itemName string) error {
 	m.ctrl.T.Helper()
@@ -56,32 +71,93 @@ func (mr *MockCoinRepositoryMockRecorder) BuyItemFromShop(ctx, userID, itemName
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BuyItemFromShop", reflect.TypeOf((*MockCoinRepository)(nil).BuyItemFromShop), ctx, userID, itemName)
 }
 
-// GetReceiveTransaction mocks base method.
-func (m *MockCoinRepository) GetReceiveTransaction(ctx context.Context, userID uuid.UUID, transactions *[]models.Transaction) error {
+// CaptureHold mocks base method.
+func (m *MockCoinRepository) CaptureHold(ctx context.Context, holdID uuid.UUID) (*models.CoinHold, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetReceiveTransaction", ctx, userID, transactions)
-	ret0, _ := ret[0].(error)
-	return ret0
+	ret := m.ctrl.Call(m, "CaptureHold", ctx, holdID)
+	ret0, _ := ret[0].(*models.CoinHold)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
-// GetReceiveTransaction indicates an expected call of GetReceiveTransaction.
-func (mr *MockCoinRepositoryMockRecorder) GetReceiveTransaction(ctx, userID, transactions any) *gomock.Call {
+// CaptureHold indicates an expected call of CaptureHold.
+func (mr *MockCoinRepositoryMockRecorder) CaptureHold(ctx, holdID any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetReceiveTransaction", reflect.TypeOf((*MockCoinRepository)(nil).GetReceiveTransaction), ctx, userID, transactions)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CaptureHold", reflect.TypeOf((*MockCoinRepository)(nil).CaptureHold), ctx, holdID)
 }
 
-// GetSentTransaction mocks base method.
-func (m *MockCoinRepository) GetSentTransaction(ctx context.Context, userID uuid.UUID, transactions *[]models.Transaction) error {
+// ExpireLots mocks base method.
+func (m *MockCoinRepository) ExpireLots(ctx context.Context) (int64, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetSentTransaction", ctx, userID, transactions)
+	ret := m.ctrl.Call(m, "ExpireLots", ctx)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ExpireLots indicates an expected call of ExpireLots.
+func (mr *MockCoinRepositoryMockRecorder) ExpireLots(ctx any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExpireLots", reflect.TypeOf((*MockCoinRepository)(nil).ExpireLots), ctx)
+}
+
+// ForceReversal mocks base method.
+func (m *MockCoinRepository) ForceReversal(ctx context.Context, transactionID, adminID uuid.UUID, reason string) (*models.TransferReversal, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ForceReversal", ctx, transactionID, adminID, reason)
+	ret0, _ := ret[0].(*models.TransferReversal)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ForceReversal indicates an expected call of ForceReversal.
+func (mr *MockCoinRepositoryMockRecorder) ForceReversal(ctx, transactionID, adminID, reason any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ForceReversal", reflect.TypeOf((*MockCoinRepository)(nil).ForceReversal), ctx, transactionID, adminID, reason)
+}
+
+// GetExpiringCoins mocks base method.
+func (m *MockCoinRepository) GetExpiringCoins(ctx context.Context, userID uuid.UUID) (*models.ExpiringCoins, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetExpiringCoins", ctx, userID)
+	ret0, _ := ret[0].(*models.ExpiringCoins)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetExpiringCoins indicates an expected call of GetExpiringCoins.
+func (mr *MockCoinRepositoryMockRecorder) GetExpiringCoins(ctx, userID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetExpiringCoins", reflect.TypeOf((*MockCoinRepository)(nil).GetExpiringCoins), ctx, userID)
+}
+
+// GetHistory mocks base method.
+func (m *MockCoinRepository) GetHistory(ctx context.Context, userID uuid.UUID, limit int, after *models.HistoryCursor) ([]models.HistoryEntry, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetHistory", ctx, userID, limit, after)
+	ret0, _ := ret[0].([]models.HistoryEntry)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetHistory indicates an expected call of GetHistory.
+func (mr *MockCoinRepositoryMockRecorder) GetHistory(ctx, userID, limit, after any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetHistory", reflect.TypeOf((*MockCoinRepository)(nil).GetHistory), ctx, userID, limit, after)
+}
+
+// GetReversals mocks base method.
+func (m *MockCoinRepository) GetReversals(ctx context.Context, userID uuid.UUID, reversals *[]models.TransferReversal) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetReversals", ctx, userID, reversals)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-// GetSentTransaction indicates an expected call of GetSentTransaction.
-func (mr *MockCoinRepositoryMockRecorder) GetSentTransaction(ctx, userID, transactions any) *gomock.Call {
+// GetReversals indicates an expected call of GetReversals.
+func (mr *MockCoinRepositoryMockRecorder) GetReversals(ctx, userID, reversals any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSentTransaction", reflect.TypeOf((*MockCoinRepository)(nil).GetSentTransaction), ctx, userID, transactions)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetReversals", reflect.TypeOf((*MockCoinRepository)(nil).GetReversals), ctx, userID, reversals)
 }
 
 // GetTransactions mocks base method.
@@ -98,6 +174,110 @@ func (mr *MockCoinRepositoryMockRecorder) GetTransactions(ctx, userID, transacti
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTransactions", reflect.TypeOf((*MockCoinRepository)(nil).GetTransactions), ctx, userID, transactions)
 }
 
+// GetTransferLimits mocks base method.
+func (m *MockCoinRepository) GetTransferLimits(ctx context.Context, userID uuid.UUID) (*models.UserTransferLimits, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTransferLimits", ctx, userID)
+	ret0, _ := ret[0].(*models.UserTransferLimits)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetTransferLimits indicates an expected call of GetTransferLimits.
+func (mr *MockCoinRepositoryMockRecorder) GetTransferLimits(ctx, userID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTransferLimits", reflect.TypeOf((*MockCoinRepository)(nil).GetTransferLimits), ctx, userID)
+}
+
+// GrantCoins mocks base method.
+func (m *MockCoinRepository) GrantCoins(ctx context.Context, userID uuid.UUID, amount int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GrantCoins", ctx, userID, amount)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// GrantCoins indicates an expected call of GrantCoins.
+func (mr *MockCoinRepositoryMockRecorder) GrantCoins(ctx, userID, amount any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GrantCoins", reflect.TypeOf((*MockCoinRepository)(nil).GrantCoins), ctx, userID, amount)
+}
+
+// HoldCoins mocks base method.
+func (m *MockCoinRepository) HoldCoins(ctx context.Context, userID, createdBy uuid.UUID, request models.HoldRequest) (*models.CoinHold, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "HoldCoins", ctx, userID, createdBy, request)
+	ret0, _ := ret[0].(*models.CoinHold)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// HoldCoins indicates an expected call of HoldCoins.
+func (mr *MockCoinRepositoryMockRecorder) HoldCoins(ctx, userID, createdBy, request any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HoldCoins", reflect.TypeOf((*MockCoinRepository)(nil).HoldCoins), ctx, userID, createdBy, request)
+}
+
+// RejectReversal mocks base method.
+func (m *MockCoinRepository) RejectReversal(ctx context.Context, reversalID, rejectedBy uuid.UUID) (*models.TransferReversal, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RejectReversal", ctx, reversalID, rejectedBy)
+	ret0, _ := ret[0].(*models.TransferReversal)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RejectReversal indicates an expected call of RejectReversal.
+func (mr *MockCoinRepositoryMockRecorder) RejectReversal(ctx, reversalID, rejectedBy any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RejectReversal", reflect.TypeOf((*MockCoinRepository)(nil).RejectReversal), ctx, reversalID, rejectedBy)
+}
+
+// ReleaseExpiredHolds mocks base method.
+func (m *MockCoinRepository) ReleaseExpiredHolds(ctx context.Context) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReleaseExpiredHolds", ctx)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReleaseExpiredHolds indicates an expected call of ReleaseExpiredHolds.
+func (mr *MockCoinRepositoryMockRecorder) ReleaseExpiredHolds(ctx any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReleaseExpiredHolds", reflect.TypeOf((*MockCoinRepository)(nil).ReleaseExpiredHolds), ctx)
+}
+
+// ReleaseHold mocks base method.
+func (m *MockCoinRepository) ReleaseHold(ctx context.Context, holdID uuid.UUID) (*models.CoinHold, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReleaseHold", ctx, holdID)
+	ret0, _ := ret[0].(*models.CoinHold)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReleaseHold indicates an expected call of ReleaseHold.
+func (mr *MockCoinRepositoryMockRecorder) ReleaseHold(ctx, holdID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReleaseHold", reflect.TypeOf((*MockCoinRepository)(nil).ReleaseHold), ctx, holdID)
+}
+
+// RequestReversal mocks base method.
+func (m *MockCoinRepository) RequestReversal(ctx context.Context, transactionID, requestedBy uuid.UUID, reason string) (*models.TransferReversal, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RequestReversal", ctx, transactionID, requestedBy, reason)
+	ret0, _ := ret[0].(*models.TransferReversal)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RequestReversal indicates an expected call of RequestReversal.
+func (mr *MockCoinRepositoryMockRecorder) RequestReversal(ctx, transactionID, requestedBy, reason any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RequestReversal", reflect.TypeOf((*MockCoinRepository)(nil).RequestReversal), ctx, transactionID, requestedBy, reason)
+}
+
 // SendCoins mocks base method.
 func (m *MockCoinRepository) SendCoins(ctx context.Context, fromUserID, toUserID uuid.UUID, amount int64) error {
 	m.ctrl.T.Helper()
@@ -111,3 +291,18 @@ func (mr *MockCoinRepositoryMockRecorder) SendCoins(ctx, fromUserID, toUserID, a
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendCoins", reflect.TypeOf((*MockCoinRepository)(nil).SendCoins), ctx, fromUserID, toUserID, amount)
 }
+
+// SetTransferLimits mocks base method.
+func (m *MockCoinRepository) SetTransferLimits(ctx context.Context, userID, adminID uuid.UUID, override models.TransferLimitsOverride) (*models.UserTransferLimits, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetTransferLimits", ctx, userID, adminID, override)
+	ret0, _ := ret[0].(*models.UserTransferLimits)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SetTransferLimits indicates an expected call of SetTransferLimits.
+func (mr *MockCoinRepositoryMockRecorder) SetTransferLimits(ctx, userID, adminID, override any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetTransferLimits", reflect.TypeOf((*MockCoinRepository)(nil).SetTransferLimits), ctx, userID, adminID, override)
+}
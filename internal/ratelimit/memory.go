@@ -0,0 +1,80 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Как часто Memory удаляет наполнившиеся корзины
+const sweepInterval = time.Minute
+
+// Memory хранит корзины в памяти процесса, поэтому на каждом экземпляре
+// лимит свой.
+type Memory struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type bucket struct {
+	tokens    float64
+	updatedAt time.Time
+	// Наполнившуюся корзину можно удалить: новая будет такой же
+	fullAt time.Time
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+func (m *Memory) Take(_ context.Context, key string, limit Limit) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	if now.Sub(m.lastSweep) > sweepInterval {
+		for k, b := range m.buckets {
+			if now.After(b.fullAt) {
+				delete(m.buckets, k)
+			}
+		}
+		m.lastSweep = now
+	}
+
+	burst, rate := float64(limit.Requests), limit.rate()
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: burst, updatedAt: now}
+		m.buckets[key] = b
+	}
+
+	// Лимит мог уменьшиться после перезагрузки конфигурации
+	b.tokens = min(burst, b.tokens+now.Sub(b.updatedAt).Seconds()*rate)
+	b.updatedAt = now
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+	b.fullAt = now.Add(seconds((burst - b.tokens) / rate))
+
+	return result(limit, allowed, b.tokens), nil
+}
+
+func (m *Memory) Refund(_ context.Context, key string, limit Limit) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b, ok := m.buckets[key]
+	if !ok {
+		return nil
+	}
+	burst := float64(limit.Requests)
+	b.tokens = min(burst, b.tokens+1)
+	b.fullAt = b.updatedAt.Add(seconds((burst - b.tokens) / limit.rate()))
+	return nil
+}
@@ -0,0 +1,49 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Postgres хранит корзины в таблице rate_limit_buckets, поэтому лимит общий
+// для всех экземпляров. Каждый запрос — один вызов take_rate_limit.
+type Postgres struct {
+	db *pgxpool.Pool
+}
+
+func NewPostgres(db *pgxpool.Pool) *Postgres {
+	return &Postgres{db: db}
+}
+
+func (p *Postgres) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	var allowed bool
+	var tokens float64
+	err := p.db.QueryRow(ctx, "SELECT allowed, remaining FROM take_rate_limit($1, $2, $3)",
+		key, limit.rate(), float64(limit.Requests)).Scan(&allowed, &tokens)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to take rate limit token: %w", err)
+	}
+	return result(limit, allowed, tokens), nil
+}
+
+func (p *Postgres) Refund(ctx context.Context, key string, limit Limit) error {
+	_, err := p.db.Exec(ctx, `
+		UPDATE rate_limit_buckets
+		SET tokens = least(tokens + 1, $2),
+			full_at = updated_at + make_interval(secs => ($2 - least(tokens + 1, $2)) / $3)
+		WHERE key = $1`, key, float64(limit.Requests), limit.rate())
+	if err != nil {
+		return fmt.Errorf("failed to refund rate limit token: %w", err)
+	}
+	return nil
+}
+
+// DeleteFull удаляет наполнившиеся корзины и возвращает их число.
+func (p *Postgres) DeleteFull(ctx context.Context) (int64, error) {
+	tag, err := p.db.Exec(ctx, "DELETE FROM rate_limit_buckets WHERE full_at < now()")
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete full rate limit buckets: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
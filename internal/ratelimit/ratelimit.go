@@ -0,0 +1,157 @@
+// Package ratelimit — ограничение частоты запросов по алгоритму token
+// bucket.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit — не больше Requests запросов за Period. Весь запас можно потратить
+// сразу, дальше он восстанавливается равномерно. Нулевой Limit не
+// ограничивает.
+type Limit struct {
+	Requests int
+	Period   time.Duration
+}
+
+func (l Limit) Enabled() bool {
+	return l.Requests > 0
+}
+
+// rate — сколько запросов восстанавливается за секунду.
+func (l Limit) rate() float64 {
+	return float64(l.Requests) / l.Period.Seconds()
+}
+
+// UnmarshalText разбирает лимит вида "10/s", "100/1m" или "1000/24h".
+// Пустая строка — без ограничения.
+func (l *Limit) UnmarshalText(text []byte) error {
+	value := strings.TrimSpace(string(text))
+	if value == "" {
+		*l = Limit{}
+		return nil
+	}
+
+	count, period, ok := strings.Cut(value, "/")
+	if !ok {
+		return fmt.Errorf("invalid rate limit %q: expected requests/period, e.g. 10/s", value)
+	}
+	requests, err := strconv.Atoi(count)
+	if err != nil || requests < 0 {
+		return fmt.Errorf("invalid rate limit %q: requests must be a non-negative integer", value)
+	}
+	// "s" — то же, что "1s"
+	if period != "" && (period[0] < '0' || period[0] > '9') {
+		period = "1" + period
+	}
+	duration, err := time.ParseDuration(period)
+	if err != nil || duration <= 0 {
+		return fmt.Errorf("invalid rate limit %q: period must be a positive duration", value)
+	}
+
+	*l = Limit{Requests: requests, Period: duration}
+	return nil
+}
+
+func (l Limit) String() string {
+	if !l.Enabled() {
+		return ""
+	}
+	return strconv.Itoa(l.Requests) + "/" + l.Period.String()
+}
+
+// Routes — лимиты маршрутов по ключу "METHOD /path", путь записывается как
+// при регистрации в echo, например "GET /api/buy/:item".
+type Routes map[string]Limit
+
+// UnmarshalText разбирает лимиты через запятую:
+// "POST /api/sendCoin=10/s,GET /api/buy/:item=5/s".
+func (r *Routes) UnmarshalText(text []byte) error {
+	routes := make(Routes)
+	for _, item := range strings.Split(string(text), ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		route, value, ok := strings.Cut(item, "=")
+		if !ok {
+			return fmt.Errorf("invalid route limit %q: expected METHOD /path=limit", item)
+		}
+		method, path, ok := strings.Cut(strings.TrimSpace(route), " ")
+		path = strings.TrimSpace(path)
+		if !ok || !validMethod(method) || !strings.HasPrefix(path, "/") {
+			return fmt.Errorf("invalid route %q: expected METHOD /path", route)
+		}
+
+		var limit Limit
+		if err := limit.UnmarshalText([]byte(value)); err != nil {
+			return fmt.Errorf("%s: %w", route, err)
+		}
+		routes[method+" "+path] = limit
+	}
+	*r = routes
+	return nil
+}
+
+func (r Routes) String() string {
+	items := make([]string, 0, len(r))
+	for route, limit := range r {
+		items = append(items, route+"="+limit.String())
+	}
+	sort.Strings(items)
+	return strings.Join(items, ",")
+}
+
+func validMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+		http.MethodPatch, http.MethodDelete, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// Store выдаёт запросы из корзины key с лимитом limit. Refund возвращает
+// выданный запрос, если его всё же отклонили по другому лимиту.
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+	Refund(ctx context.Context, key string, limit Limit) error
+}
+
+// Result — ответ корзины на запрос.
+type Result struct {
+	Allowed bool
+	// Лимит запросов за период и сколько из них осталось
+	Limit     int
+	Remaining int
+	// Через сколько корзина наполнится целиком
+	Reset time.Duration
+	// Через сколько появится следующий запрос, если этот отклонён
+	RetryAfter time.Duration
+}
+
+// result описывает корзину, в которой после запроса осталось tokens.
+func result(limit Limit, allowed bool, tokens float64) Result {
+	rate := limit.rate()
+	res := Result{
+		Allowed:   allowed,
+		Limit:     limit.Requests,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     seconds((float64(limit.Requests) - tokens) / rate),
+	}
+	if !allowed {
+		res.RetryAfter = seconds((1 - tokens) / rate)
+	}
+	return res
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(math.Max(s, 0) * float64(time.Second))
+}
@@ -0,0 +1,99 @@
+package ratelimit
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestLimitUnmarshalText(t *testing.T) {
+	tests := []struct {
+		value       string
+		expected    Limit
+		expectedErr bool
+	}{
+		{value: "10/s", expected: Limit{Requests: 10, Period: time.Second}},
+		{value: "100/1m", expected: Limit{Requests: 100, Period: time.Minute}},
+		{value: " 5/30s ", expected: Limit{Requests: 5, Period: 30 * time.Second}},
+		{value: ""},
+		{value: "10", expectedErr: true},
+		{value: "-1/s", expectedErr: true},
+		{value: "10/0s", expectedErr: true},
+		{value: "ten/s", expectedErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			var limit Limit
+			err := limit.UnmarshalText([]byte(tt.value))
+			if tt.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, limit)
+		})
+	}
+}
+
+func TestRoutesUnmarshalText(t *testing.T) {
+	var routes Routes
+	require.NoError(t, routes.UnmarshalText([]byte("POST /api/sendCoin=10/s, GET /api/buy/:item=5/1m,")))
+	assert.Equal(t, Routes{
+		"POST /api/sendCoin": {Requests: 10, Period: time.Second},
+		"GET /api/buy/:item": {Requests: 5, Period: time.Minute},
+	}, routes)
+	assert.Equal(t, "GET /api/buy/:item=5/1m0s,POST /api/sendCoin=10/1s", routes.String())
+
+	for _, invalid := range []string{"/api/sendCoin=10/s", "post /api/sendCoin=10/s", "POST api=10/s", "POST /api/sendCoin"} {
+		assert.Error(t, routes.UnmarshalText([]byte(invalid)), invalid)
+	}
+}
+
+func TestMemory(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	store := NewMemory()
+	store.now = func() time.Time { return now }
+	limit := Limit{Requests: 2, Period: 2 * time.Second}
+
+	take := func(key string) Result {
+		res, err := store.Take(ctx, key, limit)
+		require.NoError(t, err)
+		return res
+	}
+
+	assert.Equal(t, Result{Allowed: true, Limit: 2, Remaining: 1, Reset: time.Second}, take("alice"))
+	assert.Equal(t, Result{Allowed: true, Limit: 2, Remaining: 0, Reset: 2 * time.Second}, take("alice"))
+	assert.Equal(t, Result{Limit: 2, Remaining: 0, Reset: 2 * time.Second, RetryAfter: time.Second}, take("alice"))
+	assert.True(t, take("bob").Allowed, "buckets are independent")
+
+	// Запас восстанавливается равномерно
+	now = now.Add(500 * time.Millisecond)
+	res := take("alice")
+	assert.False(t, res.Allowed)
+	assert.Equal(t, 500*time.Millisecond, res.RetryAfter)
+
+	now = now.Add(500 * time.Millisecond)
+	assert.True(t, take("alice").Allowed)
+
+	// Уменьшенный лимит обрезает накопленный запас
+	now = now.Add(time.Hour)
+	limit = Limit{Requests: 1, Period: time.Second}
+	assert.True(t, take("alice").Allowed)
+	assert.False(t, take("alice").Allowed)
+
+	// Возвращённый запрос можно выдать снова, но не сверх лимита
+	require.NoError(t, store.Refund(ctx, "alice", limit))
+	require.NoError(t, store.Refund(ctx, "alice", limit))
+	assert.Equal(t, Result{Allowed: true, Limit: 1, Remaining: 0, Reset: time.Second}, take("alice"))
+	assert.False(t, take("alice").Allowed)
+	require.NoError(t, store.Refund(ctx, "dave", limit))
+
+	// Наполнившиеся корзины удаляются
+	now = now.Add(2 * sweepInterval)
+	take("carol")
+	assert.Len(t, store.buckets, 1)
+}
@@ -5,11 +5,13 @@ import (
 	"github.com/google/uuid"
 	echojwt "github.com/labstack/echo-jwt/v4"
 	"github.com/labstack/echo/v4"
-	"os"
 	"time"
 )
 
-var jwtSecret = []byte(os.Getenv("JWT_SECRET"))
+var (
+	jwtSecret []byte
+	tokenTTL  = 24 * time.Hour
+)
 
 var JwtConfig = echojwt.Config{SigningKey: jwtSecret, NewClaimsFunc: func(c echo.Context) jwt.Claims {
 	return new(Claims)
@@ -20,18 +22,43 @@ type Claims struct {
 	jwt.RegisteredClaims
 }
 
+// UserIDFromContext достаёт идентификатор пользователя из токена, который
+// положил в контекст echojwt.
+func UserIDFromContext(c echo.Context) (uuid.UUID, bool) {
+	user, ok := c.Get("user").(*jwt.Token)
+	if !ok {
+		return uuid.Nil, false
+	}
+	claims, ok := user.Claims.(*Claims)
+	if !ok {
+		return uuid.Nil, false
+	}
+	return claims.UserID, true
+}
+
+// ConfigureTokens задаёт ключ подписи и срок жизни токенов. Вызывается при
+// старте до InitRoutes.
+func ConfigureTokens(secret []byte, ttl time.Duration) {
+	jwtSecret = secret
+	tokenTTL = ttl
+	JwtConfig.SigningKey = secret
+}
+
 func GenerateToken(userID uuid.UUID) (string, error) {
-	expirationTime := time.Now().Add(24 * time.Hour)
-	claims := &Claims{
+	expirationTime := time.Now().Add(tokenTTL)
+	return SignToken(&Claims{
 		UserID: userID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			Issuer:    "avito_winter_internship_2025",
 		},
-	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtSecret)
+	})
+}
+
+// SignToken подписывает произвольные claims текущим ключом.
+func SignToken(claims *Claims) (string, error) {
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(jwtSecret)
 }
 
 func ParseToken(tokenString string) (*Claims, error) {
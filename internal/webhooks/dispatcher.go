@@ -0,0 +1,214 @@
+// Package webhooks доставляет события outbox на зарегистрированные webhook.
+// Доставки берутся из базы с SKIP LOCKED, поэтому диспетчер можно запускать
+// на всех экземплярах сервиса.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/models"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/repository"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/logger"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/metrics"
+	"go.uber.org/zap"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	HeaderSignature = "X-Webhook-Signature"
+	HeaderEventID   = "X-Webhook-Id"
+	HeaderEventType = "X-Webhook-Event"
+	HeaderAttempt   = "X-Webhook-Attempt"
+
+	userAgent = "merch-shop-webhooks"
+	// Тело ответа получателя не нужно, но его дочитывают, чтобы соединение
+	// вернулось в пул
+	maxResponseBody = 64 << 10
+)
+
+type Options struct {
+	// Как часто проверять очередь, если она опустела
+	Interval time.Duration
+	// Сколько доставок отправляется параллельно
+	Workers int
+	// Таймаут одного запроса к получателю
+	Timeout time.Duration
+	// После стольких неудачных попыток доставка уходит в dead letter
+	MaxAttempts int
+	// Пауза перед повтором растёт от BaseDelay вдвое до MaxDelay
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+type Dispatcher struct {
+	repo   repository.WebhookRepository
+	client *http.Client
+	opts   Options
+	log    logger.Logger
+}
+
+func NewDispatcher(repo repository.WebhookRepository, client *http.Client, opts Options, log logger.Logger) *Dispatcher {
+	if opts.Interval <= 0 {
+		opts.Interval = time.Second
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = 1
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 1
+	}
+	if opts.BaseDelay <= 0 {
+		opts.BaseDelay = time.Second
+	}
+	if opts.MaxDelay < opts.BaseDelay {
+		opts.MaxDelay = opts.BaseDelay
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Dispatcher{
+		repo:   repo,
+		client: client,
+		opts:   opts,
+		log:    log.With(zap.String("job", "webhook_dispatcher")),
+	}
+}
+
+// Run раз в Interval отправляет подошедшие доставки. Блокируется до отмены ctx.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ctx = logger.WithContext(ctx, d.log)
+	ticker := time.NewTicker(d.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			d.Dispatch(ctx)
+		}
+	}
+}
+
+// Dispatch отправляет доставки, пока в очереди есть подошедшие, и
+// возвращает их число. За раз берётся по Workers доставок, каждая
+// закрепляется за экземпляром на два таймаута запроса.
+func (d *Dispatcher) Dispatch(ctx context.Context) int {
+	total := 0
+	for ctx.Err() == nil {
+		batch, err := d.repo.ClaimDeliveries(ctx, d.opts.Workers, 2*d.opts.Timeout)
+		if err != nil {
+			d.log.Error("failed to claim webhook deliveries", zap.Error(err))
+			return total
+		}
+
+		var wg sync.WaitGroup
+		for _, delivery := range batch {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				d.deliver(ctx, delivery)
+			}()
+		}
+		wg.Wait()
+
+		total += len(batch)
+		if len(batch) < d.opts.Workers {
+			return total
+		}
+	}
+	return total
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, delivery models.PendingDelivery) {
+	log := d.log.With(zap.Int64("delivery_id", delivery.ID), zap.Int64("event_id", delivery.Event.ID),
+		zap.Int("attempt", delivery.Attempts))
+
+	start := time.Now()
+	status, err := d.send(ctx, delivery)
+	metrics.WebhookDeliveryDuration.Observe(time.Since(start).Seconds())
+
+	if err == nil {
+		if err = d.repo.MarkDelivered(ctx, delivery.ID, status); err != nil {
+			log.Error("failed to mark webhook delivered", zap.Error(err))
+		}
+		metrics.WebhookDeliveries.WithLabelValues(models.DeliveryStatusDelivered).Inc()
+		return
+	}
+	if ctx.Err() != nil {
+		// Остановка сервера: доставку подберут после истечения аренды
+		return
+	}
+
+	var retryAt *time.Time
+	result := "failed"
+	if delivery.Attempts < d.opts.MaxAttempts {
+		next := time.Now().Add(d.retryDelay(delivery.Attempts))
+		retryAt = &next
+		log.Warn("webhook delivery failed", zap.Int("status", status), zap.Error(err), zap.Time("retry_at", next))
+	} else {
+		result = models.DeliveryStatusDead
+		log.Error("webhook delivery moved to dead letter", zap.Int("status", status), zap.Error(err))
+	}
+	metrics.WebhookDeliveries.WithLabelValues(result).Inc()
+
+	if err = d.repo.MarkFailed(ctx, delivery.ID, status, err.Error(), retryAt); err != nil {
+		log.Error("failed to record webhook failure", zap.Error(err))
+	}
+}
+
+// send отправляет событие и возвращает статус ответа, 0 — ответа не было.
+// Успехом считается любой 2xx.
+func (d *Dispatcher) send(ctx context.Context, delivery models.PendingDelivery) (int, error) {
+	body, err := json.Marshal(delivery.Event)
+	if err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, d.opts.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set(HeaderEventID, strconv.FormatInt(delivery.Event.ID, 10))
+	req.Header.Set(HeaderEventType, delivery.Event.Type)
+	req.Header.Set(HeaderAttempt, strconv.Itoa(delivery.Attempts))
+	req.Header.Set(HeaderSignature, Sign(delivery.Secret, time.Now(), body))
+
+	res, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, maxResponseBody))
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Errorf("unexpected status %d", res.StatusCode)
+	}
+	return res.StatusCode, nil
+}
+
+// retryDelay — экспоненциальная пауза со случайной половиной, чтобы
+// повторы к упавшему получателю не приходили одной волной.
+func (d *Dispatcher) retryDelay(attempt int) time.Duration {
+	backoff := d.opts.BaseDelay
+	for i := 1; i < attempt && backoff < d.opts.MaxDelay; i++ {
+		backoff *= 2
+	}
+	backoff = min(backoff, d.opts.MaxDelay)
+	return backoff/2 + rand.N(backoff/2+1)
+}
@@ -0,0 +1,156 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/models"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/logger"
+	mock_repository "github.com/Ki4EH/stunning-octo-waddle/internal/mocks/repository"
+	"github.com/Ki4EH/stunning-octo-waddle/pkg/client"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const testSecret = "s3cret"
+
+func testDelivery(url string, attempts int) models.PendingDelivery {
+	return models.PendingDelivery{
+		ID:       7,
+		Attempts: attempts,
+		URL:      url,
+		Secret:   testSecret,
+		Event: models.OutboxEvent{
+			ID:        42,
+			Type:      models.OutboxTransferCompleted,
+			CreatedAt: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+			Data:      json.RawMessage(`{"amount":10}`),
+		},
+	}
+}
+
+func TestDispatcher_Deliver(t *testing.T) {
+	opts := Options{Workers: 1, Timeout: time.Second, MaxAttempts: 3, BaseDelay: time.Minute, MaxDelay: time.Hour}
+
+	tests := []struct {
+		name       string
+		status     int
+		attempts   int
+		closed     bool
+		setupMocks func(*mock_repository.MockWebhookRepository)
+	}{
+		{
+			name:     "delivered",
+			status:   http.StatusNoContent,
+			attempts: 1,
+			setupMocks: func(repo *mock_repository.MockWebhookRepository) {
+				repo.EXPECT().MarkDelivered(gomock.Any(), int64(7), http.StatusNoContent).Return(nil)
+			},
+		},
+		{
+			name:     "retry on server error",
+			status:   http.StatusInternalServerError,
+			attempts: 1,
+			setupMocks: func(repo *mock_repository.MockWebhookRepository) {
+				repo.EXPECT().
+					MarkFailed(gomock.Any(), int64(7), http.StatusInternalServerError, "unexpected status 500", gomock.Not(gomock.Nil())).
+					DoAndReturn(func(_ context.Context, _ int64, _ int, _ string, retryAt *time.Time) error {
+						// Первая пауза — от половины до целой BaseDelay
+						if d := time.Until(*retryAt); d < 29*time.Second || d > time.Minute {
+							t.Errorf("unexpected retry delay: %s", d)
+						}
+						return nil
+					})
+			},
+		},
+		{
+			name:     "dead after max attempts",
+			status:   http.StatusBadRequest,
+			attempts: 3,
+			setupMocks: func(repo *mock_repository.MockWebhookRepository) {
+				repo.EXPECT().MarkFailed(gomock.Any(), int64(7), http.StatusBadRequest, "unexpected status 400", nil).Return(nil)
+			},
+		},
+		{
+			name:     "connection refused",
+			closed:   true,
+			attempts: 1,
+			setupMocks: func(repo *mock_repository.MockWebhookRepository) {
+				repo.EXPECT().MarkFailed(gomock.Any(), int64(7), 0, gomock.Any(), gomock.Not(gomock.Nil())).Return(nil)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				assert.Equal(t, "42", r.Header.Get(HeaderEventID))
+				assert.Equal(t, models.OutboxTransferCompleted, r.Header.Get(HeaderEventType))
+				// Подпись проверяется так же, как у получателя с клиентом SDK
+				assert.NoError(t, client.VerifyWebhook(testSecret, r.Header.Get(HeaderSignature), body, time.Minute))
+				assert.JSONEq(t, `{"id":42,"type":"transfer.completed","createdAt":"2025-01-01T00:00:00Z","data":{"amount":10}}`, string(body))
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+			if tt.closed {
+				server.Close()
+			}
+
+			repo := mock_repository.NewMockWebhookRepository(ctrl)
+			tt.setupMocks(repo)
+
+			d := NewDispatcher(repo, server.Client(), opts, logger.Nop())
+			d.deliver(context.Background(), testDelivery(server.URL, tt.attempts))
+		})
+	}
+}
+
+func TestDispatcher_Dispatch(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	repo := mock_repository.NewMockWebhookRepository(ctrl)
+	full := []models.PendingDelivery{testDelivery(server.URL, 1), testDelivery(server.URL, 1)}
+	// Полная пачка — в очереди могут быть ещё доставки, неполная — очередь пуста
+	gomock.InOrder(
+		repo.EXPECT().ClaimDeliveries(gomock.Any(), 2, 2*time.Second).Return(full, nil),
+		repo.EXPECT().ClaimDeliveries(gomock.Any(), 2, 2*time.Second).Return(full[:1], nil),
+	)
+	repo.EXPECT().MarkDelivered(gomock.Any(), int64(7), http.StatusOK).Return(nil).Times(3)
+
+	d := NewDispatcher(repo, server.Client(), Options{Workers: 2, Timeout: time.Second}, logger.Nop())
+	assert.Equal(t, 3, d.Dispatch(context.Background()))
+}
+
+func TestDispatcher_RetryDelay(t *testing.T) {
+	d := NewDispatcher(nil, nil, Options{BaseDelay: time.Second, MaxDelay: 10 * time.Second}, logger.Nop())
+
+	tests := []struct {
+		attempt  int
+		min, max time.Duration
+	}{
+		{attempt: 1, min: 500 * time.Millisecond, max: time.Second},
+		{attempt: 3, min: 2 * time.Second, max: 4 * time.Second},
+		{attempt: 5, min: 5 * time.Second, max: 10 * time.Second},
+		{attempt: 1000, min: 5 * time.Second, max: 10 * time.Second},
+	}
+
+	for _, tt := range tests {
+		delay := d.retryDelay(tt.attempt)
+		assert.GreaterOrEqual(t, delay, tt.min, "attempt %d", tt.attempt)
+		assert.LessOrEqual(t, delay, tt.max, "attempt %d", tt.attempt)
+	}
+}
@@ -0,0 +1,4 @@
+DROP TABLE public.user_items;
+DROP TABLE public.transactions;
+DROP TABLE public.shops;
+DROP TABLE public.credentials;
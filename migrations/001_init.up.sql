@@ -1,20 +1,8 @@
 --
--- PostgreSQL database dump
+-- Исходная схема из pg_dump (PostgreSQL 16.2). Данные переведены из COPY
+-- в INSERT, настройки сессии убраны: миграции выполняются через пул.
 --
 
--- Dumped from database version 16.2
--- Dumped by pg_dump version 16.2
-
-SET statement_timeout = 0;
-SET lock_timeout = 0;
-SET idle_in_transaction_session_timeout = 0;
-SET client_encoding = 'UTF8';
-SET standard_conforming_strings = on;
-SELECT pg_catalog.set_config('search_path', '', false);
-SET check_function_bodies = false;
-SET xmloption = content;
-SET client_min_messages = warning;
-SET row_security = off;
 --
 -- Name: uuid-ossp; Type: EXTENSION; Schema: -; Owner: -
 --
@@ -22,17 +10,6 @@ SET row_security = off;
 CREATE EXTENSION IF NOT EXISTS "uuid-ossp" WITH SCHEMA public;
 
 
---
--- Name: EXTENSION "uuid-ossp"; Type: COMMENT; Schema: -; Owner: 
---
-
-COMMENT ON EXTENSION "uuid-ossp" IS 'generate universally unique identifiers (UUIDs)';
-
-
-SET default_tablespace = '';
-
-SET default_table_access_method = heap;
-
 --
 -- Name: credentials; Type: TABLE; Schema: public; Owner: postgres
 --
@@ -45,8 +22,6 @@ CREATE TABLE public.credentials (
 );
 
 
-ALTER TABLE public.credentials OWNER TO postgres;
-
 --
 -- Name: shops; Type: TABLE; Schema: public; Owner: postgres
 --
@@ -57,8 +32,6 @@ CREATE TABLE public.shops (
 );
 
 
-ALTER TABLE public.shops OWNER TO postgres;
-
 --
 -- Name: transactions; Type: TABLE; Schema: public; Owner: postgres
 --
@@ -71,8 +44,6 @@ CREATE TABLE public.transactions (
 );
 
 
-ALTER TABLE public.transactions OWNER TO postgres;
-
 --
 -- Name: user_items; Type: TABLE; Schema: public; Owner: postgres
 --
@@ -84,52 +55,46 @@ CREATE TABLE public.user_items (
 );
 
 
-ALTER TABLE public.user_items OWNER TO postgres;
-
 --
 -- Data for Name: credentials; Type: TABLE DATA; Schema: public; Owner: postgres
 --
 
-COPY public.credentials (id, username, password, coin) FROM stdin;
-6483741f-64d7-4cbf-8e01-37e31a1a850e	test	password	985
-0eaef374-cfa0-4256-90bc-eb24c3200a79	test2	password	1005
-\.
+INSERT INTO public.credentials (id, username, password, coin) VALUES
+    ('6483741f-64d7-4cbf-8e01-37e31a1a850e', 'test', 'password', 985),
+    ('0eaef374-cfa0-4256-90bc-eb24c3200a79', 'test2', 'password', 1005);
 
 
 --
 -- Data for Name: shops; Type: TABLE DATA; Schema: public; Owner: postgres
 --
 
-COPY public.shops (item, price) FROM stdin;
-t-shirt	80
-cup	20
-book	50
-pen	10
-powerbank	200
-hoody	300
-umbrella	200
-socks	10
-wallet	50
-pink-hoody	500
-\.
+INSERT INTO public.shops (item, price) VALUES
+    ('t-shirt', 80),
+    ('cup', 20),
+    ('book', 50),
+    ('pen', 10),
+    ('powerbank', 200),
+    ('hoody', 300),
+    ('umbrella', 200),
+    ('socks', 10),
+    ('wallet', 50),
+    ('pink-hoody', 500);
 
 
 --
 -- Data for Name: transactions; Type: TABLE DATA; Schema: public; Owner: postgres
 --
 
-COPY public.transactions (id, from_user, to_user, amount) FROM stdin;
-14f9a618-6d1a-404a-b225-d7088c7f0b66	6483741f-64d7-4cbf-8e01-37e31a1a850e	0eaef374-cfa0-4256-90bc-eb24c3200a79	5
-\.
+INSERT INTO public.transactions (id, from_user, to_user, amount) VALUES
+    ('14f9a618-6d1a-404a-b225-d7088c7f0b66', '6483741f-64d7-4cbf-8e01-37e31a1a850e', '0eaef374-cfa0-4256-90bc-eb24c3200a79', 5);
 
 
 --
 -- Data for Name: user_items; Type: TABLE DATA; Schema: public; Owner: postgres
 --
 
-COPY public.user_items (user_id, type, quantity) FROM stdin;
-6483741f-64d7-4cbf-8e01-37e31a1a850e	pen	1
-\.
+INSERT INTO public.user_items (user_id, type, quantity) VALUES
+    ('6483741f-64d7-4cbf-8e01-37e31a1a850e', 'pen', 1);
 
 
 --
@@ -0,0 +1,11 @@
+DROP TABLE public.transfer_reversals;
+
+DROP INDEX public.uni_transactions_reversal_of;
+
+ALTER TABLE public.transactions
+    DROP COLUMN reversed_at,
+    DROP COLUMN reversal_of,
+    DROP COLUMN created_at;
+
+ALTER TABLE public.credentials
+    DROP COLUMN is_admin;
@@ -0,0 +1,31 @@
+-- Отмена переводов: компенсирующая транзакция ссылается на исходную,
+-- история не удаляется.
+
+ALTER TABLE public.credentials
+    ADD COLUMN is_admin boolean DEFAULT false NOT NULL;
+
+ALTER TABLE public.transactions
+    ADD COLUMN created_at timestamp with time zone DEFAULT now() NOT NULL,
+    ADD COLUMN reversal_of uuid REFERENCES public.transactions (id),
+    ADD COLUMN reversed_at timestamp with time zone;
+
+CREATE UNIQUE INDEX uni_transactions_reversal_of ON public.transactions USING btree (reversal_of)
+    WHERE reversal_of IS NOT NULL;
+
+CREATE TABLE public.transfer_reversals (
+    id uuid DEFAULT public.uuid_generate_v4() NOT NULL,
+    transaction_id uuid NOT NULL REFERENCES public.transactions (id),
+    requested_by uuid NOT NULL REFERENCES public.credentials (id),
+    reason text DEFAULT '' NOT NULL,
+    status text DEFAULT 'pending' NOT NULL,
+    resolved_by uuid REFERENCES public.credentials (id),
+    compensation_id uuid REFERENCES public.transactions (id),
+    created_at timestamp with time zone DEFAULT now() NOT NULL,
+    resolved_at timestamp with time zone,
+    CONSTRAINT transfer_reversals_pkey PRIMARY KEY (id),
+    CONSTRAINT transfer_reversals_status_check CHECK (status IN ('pending', 'approved', 'rejected', 'forced'))
+);
+
+CREATE UNIQUE INDEX uni_transfer_reversals_pending ON public.transfer_reversals USING btree (transaction_id)
+    WHERE status = 'pending';
+CREATE INDEX idx_transfer_reversals_requested_by ON public.transfer_reversals USING btree (requested_by);
@@ -0,0 +1,3 @@
+DROP INDEX public.idx_transaction_from_user_created_at;
+
+DROP TABLE public.transfer_limit_overrides;
@@ -0,0 +1,19 @@
+-- Персональные лимиты переводов. NULL в колонке означает лимит по умолчанию
+-- из конфигурации, 0 — отсутствие лимита.
+
+CREATE TABLE public.transfer_limit_overrides (
+    user_id uuid NOT NULL REFERENCES public.credentials (id),
+    max_per_transfer bigint,
+    max_daily_total bigint,
+    max_daily_recipients bigint,
+    updated_by uuid REFERENCES public.credentials (id),
+    updated_at timestamp with time zone DEFAULT now() NOT NULL,
+    CONSTRAINT transfer_limit_overrides_pkey PRIMARY KEY (user_id),
+    CONSTRAINT transfer_limit_overrides_non_negative CHECK (
+        coalesce(max_per_transfer, 0) >= 0 AND
+        coalesce(max_daily_total, 0) >= 0 AND
+        coalesce(max_daily_recipients, 0) >= 0
+    )
+);
+
+CREATE INDEX idx_transaction_from_user_created_at ON public.transactions USING btree (from_user, created_at);
@@ -0,0 +1,2 @@
+-- Баланс в credentials.coin не меняется, теряется только срок действия монет
+DROP TABLE public.coin_lots;
@@ -0,0 +1,24 @@
+-- Партии монет со сроком действия. credentials.coin остаётся балансом
+-- пользователя, партии показывают из чего он состоит и когда сгорит.
+-- Партии с одинаковым сроком у одного пользователя объединяются.
+
+CREATE TABLE public.coin_lots (
+    id uuid DEFAULT public.uuid_generate_v4() NOT NULL,
+    user_id uuid NOT NULL REFERENCES public.credentials (id),
+    amount bigint NOT NULL,
+    expired_amount bigint DEFAULT 0 NOT NULL,
+    granted_at timestamp with time zone DEFAULT now() NOT NULL,
+    expires_at timestamp with time zone NOT NULL,
+    expired_at timestamp with time zone,
+    CONSTRAINT coin_lots_pkey PRIMARY KEY (id),
+    CONSTRAINT coin_lots_amount_non_negative CHECK (amount >= 0)
+);
+
+CREATE UNIQUE INDEX uni_coin_lots_user_expires ON public.coin_lots USING btree (user_id, expires_at);
+CREATE INDEX idx_coin_lots_active_expires ON public.coin_lots USING btree (expires_at) WHERE amount > 0;
+
+-- Текущие балансы считаем выданными в момент миграции
+INSERT INTO public.coin_lots (user_id, amount, expires_at)
+SELECT id, coin, now() + interval '1 year'
+FROM public.credentials
+WHERE coin > 0;
@@ -0,0 +1,2 @@
+-- Активные холды перестают действовать, монеты снова доступны пользователям
+DROP TABLE public.coin_holds;
@@ -0,0 +1,20 @@
+-- Резервирование монет. Активные холды (status = 'held' и срок не истек)
+-- не входят в доступный баланс, но остаются в credentials.coin до списания.
+
+CREATE TABLE public.coin_holds (
+    id uuid DEFAULT public.uuid_generate_v4() NOT NULL,
+    user_id uuid NOT NULL REFERENCES public.credentials (id),
+    amount bigint NOT NULL,
+    reason text DEFAULT '' NOT NULL,
+    status text DEFAULT 'held' NOT NULL,
+    created_by uuid REFERENCES public.credentials (id),
+    created_at timestamp with time zone DEFAULT now() NOT NULL,
+    expires_at timestamp with time zone NOT NULL,
+    resolved_at timestamp with time zone,
+    CONSTRAINT coin_holds_pkey PRIMARY KEY (id),
+    CONSTRAINT coin_holds_amount_positive CHECK (amount > 0),
+    CONSTRAINT coin_holds_status_check CHECK (status IN ('held', 'captured', 'released', 'expired'))
+);
+
+CREATE INDEX idx_coin_holds_user_active ON public.coin_holds USING btree (user_id) WHERE status = 'held';
+CREATE INDEX idx_coin_holds_active_expires ON public.coin_holds USING btree (expires_at) WHERE status = 'held';
@@ -0,0 +1,2 @@
+ALTER TABLE public.credentials
+    DROP CONSTRAINT credentials_coin_non_negative;
@@ -0,0 +1,5 @@
+-- Баланс не может уйти в минус даже при ошибке в коде: такая транзакция
+-- будет отклонена базой.
+
+ALTER TABLE public.credentials
+    ADD CONSTRAINT credentials_coin_non_negative CHECK (coin >= 0);
@@ -0,0 +1,5 @@
+DROP INDEX public.idx_transactions_to_user_history;
+
+DROP INDEX public.idx_transactions_from_user_history;
+
+CREATE INDEX idx_transaction_from_user_created_at ON public.transactions USING btree (from_user, created_at);
@@ -0,0 +1,8 @@
+-- Постраничная история переводов идёт от новых к старым по (created_at, id)
+-- отдельно по отправителю и получателю.
+
+DROP INDEX public.idx_transaction_from_user_created_at;
+
+CREATE INDEX idx_transactions_from_user_history ON public.transactions USING btree (from_user, created_at DESC, id DESC);
+
+CREATE INDEX idx_transactions_to_user_history ON public.transactions USING btree (to_user, created_at DESC, id DESC);
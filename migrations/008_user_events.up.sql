@@ -0,0 +1,16 @@
+-- События для уведомлений пользователей. Запись и NOTIFY делаются в той же
+-- транзакции, что и изменение баланса; по id клиент дочитывает пропущенное
+-- после переподключения.
+
+CREATE TABLE public.user_events (
+    id bigserial NOT NULL,
+    user_id uuid NOT NULL REFERENCES public.credentials (id),
+    type text NOT NULL,
+    payload jsonb NOT NULL,
+    created_at timestamp with time zone DEFAULT now() NOT NULL,
+    CONSTRAINT user_events_pkey PRIMARY KEY (id)
+);
+
+CREATE INDEX idx_user_events_user_id ON public.user_events USING btree (user_id, id);
+
+CREATE INDEX idx_user_events_created_at ON public.user_events USING btree (created_at);
@@ -0,0 +1,5 @@
+DROP TABLE public.webhook_deliveries;
+
+DROP TABLE public.outbox;
+
+DROP TABLE public.webhooks;
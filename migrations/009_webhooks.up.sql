@@ -0,0 +1,45 @@
+-- Outbox для внешних систем. Событие и доставки на подписанные webhook
+-- пишутся в той же транзакции, что и перевод или покупка, поэтому событие
+-- не потеряется и не уйдёт для откатившейся операции.
+
+CREATE TABLE public.webhooks (
+    id uuid DEFAULT public.uuid_generate_v4() NOT NULL,
+    url text NOT NULL,
+    secret text NOT NULL,
+    -- пустой список — все события
+    event_types text[] DEFAULT '{}' NOT NULL,
+    created_at timestamp with time zone DEFAULT now() NOT NULL,
+    CONSTRAINT webhooks_pkey PRIMARY KEY (id)
+);
+
+CREATE TABLE public.outbox (
+    id bigserial NOT NULL,
+    event_type text NOT NULL,
+    payload jsonb NOT NULL,
+    created_at timestamp with time zone DEFAULT now() NOT NULL,
+    CONSTRAINT outbox_pkey PRIMARY KEY (id)
+);
+
+CREATE TABLE public.webhook_deliveries (
+    id bigserial NOT NULL,
+    webhook_id uuid NOT NULL REFERENCES public.webhooks (id) ON DELETE CASCADE,
+    outbox_id bigint NOT NULL REFERENCES public.outbox (id) ON DELETE CASCADE,
+    status text DEFAULT 'pending' NOT NULL,
+    attempts integer DEFAULT 0 NOT NULL,
+    next_attempt_at timestamp with time zone DEFAULT now() NOT NULL,
+    last_status integer,
+    last_error text,
+    created_at timestamp with time zone DEFAULT now() NOT NULL,
+    delivered_at timestamp with time zone,
+    CONSTRAINT webhook_deliveries_pkey PRIMARY KEY (id),
+    CONSTRAINT webhook_deliveries_status_check CHECK (status IN ('pending', 'delivered', 'dead'))
+);
+
+CREATE INDEX idx_webhook_deliveries_due ON public.webhook_deliveries USING btree (next_attempt_at)
+    WHERE status = 'pending';
+
+CREATE INDEX idx_webhook_deliveries_webhook_id ON public.webhook_deliveries USING btree (webhook_id, id);
+
+CREATE INDEX idx_webhook_deliveries_outbox_id ON public.webhook_deliveries USING btree (outbox_id);
+
+CREATE INDEX idx_outbox_created_at ON public.outbox USING btree (created_at);
@@ -0,0 +1,5 @@
+DROP TRIGGER shops_catalog_version ON public.shops;
+
+DROP FUNCTION public.bump_catalog_version();
+
+DROP TABLE public.catalog_version;
@@ -0,0 +1,29 @@
+-- Версия каталога магазина. Любое изменение shops увеличивает её в той же
+-- транзакции и отправляет новую версию в канал catalog_changes: экземпляры
+-- перечитывают каталог, а покупка сверяет версию со своей копией.
+
+CREATE TABLE public.catalog_version (
+    id boolean DEFAULT true NOT NULL,
+    version bigint DEFAULT 1 NOT NULL,
+    CONSTRAINT catalog_version_pkey PRIMARY KEY (id),
+    -- строка ровно одна
+    CONSTRAINT catalog_version_single_row CHECK (id)
+);
+
+INSERT INTO public.catalog_version DEFAULT VALUES;
+
+CREATE FUNCTION public.bump_catalog_version() RETURNS trigger
+    LANGUAGE plpgsql
+    AS $$
+DECLARE
+    new_version bigint;
+BEGIN
+    UPDATE public.catalog_version SET version = version + 1 RETURNING version INTO new_version;
+    PERFORM pg_notify('catalog_changes', new_version::text);
+    RETURN NULL;
+END;
+$$;
+
+CREATE TRIGGER shops_catalog_version
+    AFTER INSERT OR UPDATE OR DELETE OR TRUNCATE ON public.shops
+    FOR EACH STATEMENT EXECUTE FUNCTION public.bump_catalog_version();
@@ -0,0 +1,3 @@
+DROP FUNCTION public.take_rate_limit(text, double precision, double precision);
+
+DROP TABLE public.rate_limit_buckets;
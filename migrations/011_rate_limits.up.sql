@@ -0,0 +1,44 @@
+-- Корзины ограничения частоты запросов для RATE_LIMIT_SHARED: общие для
+-- всех экземпляров. Таблица нежурналируемая: после сбоя базы корзины
+-- пустеют, то есть лимиты просто начинаются заново.
+
+CREATE UNLOGGED TABLE public.rate_limit_buckets (
+    key text NOT NULL,
+    tokens double precision NOT NULL,
+    updated_at timestamp with time zone NOT NULL,
+    -- когда корзина наполнится, после этого строку можно удалить
+    full_at timestamp with time zone NOT NULL,
+    CONSTRAINT rate_limit_buckets_pkey PRIMARY KEY (key)
+);
+
+CREATE INDEX rate_limit_buckets_full_at_idx ON public.rate_limit_buckets USING btree (full_at);
+
+-- take_rate_limit берёт токен из корзины key ёмкостью burst, которая
+-- пополняется на rate токенов в секунду. Возвращает, выдан ли токен, и
+-- сколько токенов осталось.
+CREATE FUNCTION public.take_rate_limit(p_key text, p_rate double precision, p_burst double precision,
+                                       OUT allowed boolean, OUT remaining double precision)
+    LANGUAGE plpgsql
+    AS $$
+DECLARE
+    ts timestamp with time zone := clock_timestamp();
+    last_at timestamp with time zone;
+BEGIN
+    INSERT INTO public.rate_limit_buckets (key, tokens, updated_at, full_at)
+    VALUES (p_key, p_burst, ts, ts)
+    ON CONFLICT (key) DO NOTHING;
+
+    SELECT b.tokens, b.updated_at INTO remaining, last_at
+    FROM public.rate_limit_buckets b WHERE b.key = p_key FOR UPDATE;
+
+    remaining := LEAST(p_burst, remaining + GREATEST(EXTRACT(EPOCH FROM ts - last_at)::double precision, 0) * p_rate);
+    allowed := remaining >= 1;
+    IF allowed THEN
+        remaining := remaining - 1;
+    END IF;
+
+    UPDATE public.rate_limit_buckets b
+    SET tokens = remaining, updated_at = ts, full_at = ts + make_interval(secs => (p_burst - remaining) / p_rate)
+    WHERE b.key = p_key;
+END;
+$$;
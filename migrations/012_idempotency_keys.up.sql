@@ -0,0 +1,17 @@
+-- Ответы на запросы с заголовком Idempotency-Key, общие для всех
+-- экземпляров: повтор клиента может прийти на другой экземпляр.
+
+CREATE TABLE public.idempotency_keys (
+    key text NOT NULL,
+    fingerprint bytea NOT NULL,
+    -- кто занял ключ: ответ сохраняет только этот запрос
+    token uuid NOT NULL,
+    done boolean DEFAULT false NOT NULL,
+    status integer,
+    content_type text,
+    body bytea,
+    expires_at timestamp with time zone NOT NULL,
+    CONSTRAINT idempotency_keys_pkey PRIMARY KEY (key)
+);
+
+CREATE INDEX idempotency_keys_expires_at_idx ON public.idempotency_keys USING btree (expires_at);
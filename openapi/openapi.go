@@ -0,0 +1,26 @@
+// Package openapi содержит описание API (schema.yaml), встроенное в бинарник.
+// По нему проверяются запросы и ответы сервиса.
+package openapi
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+//go:embed schema.yaml
+var Spec []byte
+
+// Load разбирает и проверяет schema.yaml.
+func Load() (*openapi3.T, error) {
+	loader := openapi3.NewLoader()
+	doc, err := loader.LoadFromData(Spec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse openapi spec: %w", err)
+	}
+	if err = doc.Validate(context.Background()); err != nil {
+		return nil, fmt.Errorf("invalid openapi spec: %w", err)
+	}
+	return doc, nil
+}
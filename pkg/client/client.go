@@ -0,0 +1,490 @@
+// Package client — Go-клиент API магазина мерча.
+//
+// Клиент сам получает JWT по логину и паролю и обновляет его незадолго до
+// истечения или после ответа 401. Запросы, меняющие состояние, отправляются
+// с заголовком Idempotency-Key, который сохраняется между повторами, поэтому
+// повтор после обрыва соединения не спишет монеты дважды. Сервер с
+// PostgreSQL хранит ключи в базе, так что это верно и при нескольких
+// экземплярах за балансировщиком.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	HeaderIdempotencyKey = "Idempotency-Key"
+
+	defaultMaxAttempts    = 3
+	defaultRetryBaseDelay = 200 * time.Millisecond
+	maxRetryDelay         = 5 * time.Second
+	tokenRefreshMargin    = time.Minute
+)
+
+// Client безопасен для использования из нескольких горутин.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+
+	username string
+	password string
+
+	maxAttempts    int
+	retryBaseDelay time.Duration
+
+	mu          sync.Mutex
+	token       string
+	tokenExpiry time.Time
+}
+
+type Option func(*Client)
+
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithCredentials задаёт логин и пароль, по которым клиент получает токен.
+func WithCredentials(username, password string) Option {
+	return func(c *Client) {
+		c.username = username
+		c.password = password
+	}
+}
+
+// WithToken задаёт готовый токен. Без WithCredentials клиент не сможет его
+// обновить.
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.setToken(token)
+	}
+}
+
+// WithRetries задаёт число попыток на запрос и начальную задержку между ними.
+// Задержка удваивается с каждой попыткой.
+func WithRetries(maxAttempts int, baseDelay time.Duration) Option {
+	return func(c *Client) {
+		c.maxAttempts = max(maxAttempts, 1)
+		c.retryBaseDelay = baseDelay
+	}
+}
+
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:        strings.TrimRight(baseURL, "/"),
+		httpClient:     http.DefaultClient,
+		maxAttempts:    defaultMaxAttempts,
+		retryBaseDelay: defaultRetryBaseDelay,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Login получает новый токен по логину и паролю из WithCredentials.
+// Вызывать его необязательно: клиент войдёт сам при первом запросе.
+func (c *Client) Login(ctx context.Context) error {
+	_, err := c.login(ctx)
+	return err
+}
+
+// Info возвращает баланс и инвентарь. История переводов — через History.
+func (c *Client) Info(ctx context.Context) (*Info, error) {
+	var info Info
+	if err := c.do(ctx, http.MethodGet, "/api/v2/info", nil, &info, false); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// History возвращает страницу истории переводов от новых к старым. Для первой
+// страницы cursor пустой, для следующей — NextCursor предыдущей; limit 0 —
+// размер страницы по умолчанию.
+func (c *Client) History(ctx context.Context, limit int, cursor string) (*HistoryPage, error) {
+	query := url.Values{}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	if cursor != "" {
+		query.Set("cursor", cursor)
+	}
+	path := "/api/v2/history"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+
+	var page HistoryPage
+	if err := c.do(ctx, http.MethodGet, path, nil, &page, false); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+func (c *Client) SendCoin(ctx context.Context, toUser string, amount int64) error {
+	body := map[string]any{"toUser": toUser, "amount": amount}
+	return c.do(ctx, http.MethodPost, "/api/v2/transfers", body, nil, true)
+}
+
+func (c *Client) Buy(ctx context.Context, item string) error {
+	return c.do(ctx, http.MethodPost, "/api/v2/purchases", map[string]string{"item": item}, nil, true)
+}
+
+// Reversals возвращает запросы на отмену, где пользователь отправитель или получатель.
+func (c *Client) Reversals(ctx context.Context) ([]Reversal, error) {
+	var resp struct {
+		Reversals []Reversal `json:"reversals"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/api/reversals", nil, &resp, false); err != nil {
+		return nil, err
+	}
+	return resp.Reversals, nil
+}
+
+func (c *Client) RequestReversal(ctx context.Context, transactionID uuid.UUID, reason string) (*Reversal, error) {
+	return c.reversal(ctx, "/api/transactions/"+transactionID.String()+"/reversal", map[string]string{"reason": reason})
+}
+
+func (c *Client) ApproveReversal(ctx context.Context, reversalID uuid.UUID) (*Reversal, error) {
+	return c.reversal(ctx, "/api/reversals/"+reversalID.String()+"/approve", nil)
+}
+
+func (c *Client) RejectReversal(ctx context.Context, reversalID uuid.UUID) (*Reversal, error) {
+	return c.reversal(ctx, "/api/reversals/"+reversalID.String()+"/reject", nil)
+}
+
+// ForceReversal отменяет перевод без согласия получателя. Только для администраторов.
+func (c *Client) ForceReversal(ctx context.Context, transactionID uuid.UUID, reason string) (*Reversal, error) {
+	return c.reversal(ctx, "/api/admin/transactions/"+transactionID.String()+"/reverse", map[string]string{"reason": reason})
+}
+
+func (c *Client) reversal(ctx context.Context, path string, body any) (*Reversal, error) {
+	var reversal Reversal
+	if err := c.do(ctx, http.MethodPost, path, body, &reversal, true); err != nil {
+		return nil, err
+	}
+	return &reversal, nil
+}
+
+func (c *Client) TransferLimits(ctx context.Context, username string) (*UserTransferLimits, error) {
+	var limits UserTransferLimits
+	path := "/api/admin/users/" + url.PathEscape(username) + "/limits"
+	if err := c.do(ctx, http.MethodGet, path, nil, &limits, false); err != nil {
+		return nil, err
+	}
+	return &limits, nil
+}
+
+func (c *Client) SetTransferLimits(ctx context.Context, username string, override TransferLimitsOverride) (*UserTransferLimits, error) {
+	var limits UserTransferLimits
+	path := "/api/admin/users/" + url.PathEscape(username) + "/limits"
+	if err := c.do(ctx, http.MethodPut, path, override, &limits, true); err != nil {
+		return nil, err
+	}
+	return &limits, nil
+}
+
+func (c *Client) GrantCoins(ctx context.Context, username string, amount int64) error {
+	path := "/api/admin/users/" + url.PathEscape(username) + "/grant"
+	return c.do(ctx, http.MethodPost, path, map[string]int64{"amount": amount}, nil, true)
+}
+
+func (c *Client) HoldCoins(ctx context.Context, username string, request HoldRequest) (*Hold, error) {
+	return c.hold(ctx, "/api/admin/users/"+url.PathEscape(username)+"/holds", request)
+}
+
+func (c *Client) CaptureHold(ctx context.Context, holdID uuid.UUID) (*Hold, error) {
+	return c.hold(ctx, "/api/admin/holds/"+holdID.String()+"/capture", nil)
+}
+
+func (c *Client) ReleaseHold(ctx context.Context, holdID uuid.UUID) (*Hold, error) {
+	return c.hold(ctx, "/api/admin/holds/"+holdID.String()+"/release", nil)
+}
+
+func (c *Client) hold(ctx context.Context, path string, body any) (*Hold, error) {
+	var hold Hold
+	if err := c.do(ctx, http.MethodPost, path, body, &hold, true); err != nil {
+		return nil, err
+	}
+	return &hold, nil
+}
+
+func (c *Client) Webhooks(ctx context.Context) ([]Webhook, error) {
+	var resp struct {
+		Webhooks []Webhook `json:"webhooks"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/api/admin/webhooks", nil, &resp, false); err != nil {
+		return nil, err
+	}
+	return resp.Webhooks, nil
+}
+
+// CreateWebhook регистрирует webhook. Secret в ответе возвращается только здесь.
+func (c *Client) CreateWebhook(ctx context.Context, request WebhookRequest) (*Webhook, error) {
+	var webhook Webhook
+	if err := c.do(ctx, http.MethodPost, "/api/admin/webhooks", request, &webhook, true); err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+func (c *Client) DeleteWebhook(ctx context.Context, webhookID uuid.UUID) error {
+	return c.do(ctx, http.MethodDelete, "/api/admin/webhooks/"+webhookID.String(), nil, nil, false)
+}
+
+// WebhookDeliveries возвращает последние доставки webhook. status пустой — все,
+// DeliveryDead — dead letter; limit 0 — по умолчанию сервера.
+func (c *Client) WebhookDeliveries(ctx context.Context, webhookID uuid.UUID, status string, limit int) ([]WebhookDelivery, error) {
+	query := url.Values{}
+	if status != "" {
+		query.Set("status", status)
+	}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	path := "/api/admin/webhooks/" + webhookID.String() + "/deliveries"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+
+	var resp struct {
+		Deliveries []WebhookDelivery `json:"deliveries"`
+	}
+	if err := c.do(ctx, http.MethodGet, path, nil, &resp, false); err != nil {
+		return nil, err
+	}
+	return resp.Deliveries, nil
+}
+
+// ReplayWebhook ставит доставки из dead letter обратно в очередь и
+// возвращает их число.
+func (c *Client) ReplayWebhook(ctx context.Context, webhookID uuid.UUID, request ReplayRequest) (int64, error) {
+	var resp struct {
+		Replayed int64 `json:"replayed"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/api/admin/webhooks/"+webhookID.String()+"/replay", request, &resp, true); err != nil {
+		return 0, err
+	}
+	return resp.Replayed, nil
+}
+
+func (c *Client) setToken(token string) {
+	c.token = token
+	c.tokenExpiry = time.Time{}
+
+	var claims jwt.RegisteredClaims
+	if _, _, err := jwt.NewParser().ParseUnverified(token, &claims); err == nil && claims.ExpiresAt != nil {
+		c.tokenExpiry = claims.ExpiresAt.Time
+	}
+}
+
+// currentToken возвращает действующий токен, при необходимости входя заново.
+func (c *Client) currentToken(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	token, expiry := c.token, c.tokenExpiry
+	c.mu.Unlock()
+
+	expiring := !expiry.IsZero() && time.Until(expiry) < tokenRefreshMargin
+	if token != "" && (!expiring || c.username == "") {
+		return token, nil
+	}
+	if c.username == "" {
+		return "", errors.New("merch api: no token or credentials configured")
+	}
+	return c.login(ctx)
+}
+
+func (c *Client) login(ctx context.Context) (string, error) {
+	if c.username == "" {
+		return "", errors.New("merch api: no credentials configured")
+	}
+
+	var resp struct {
+		Token string `json:"token"`
+	}
+	body := map[string]string{"username": c.username, "password": c.password}
+	if err := c.send(ctx, http.MethodPost, "/api/v2/auth", body, &resp, "", ""); err != nil {
+		return "", err
+	}
+
+	c.mu.Lock()
+	c.setToken(resp.Token)
+	c.mu.Unlock()
+	return resp.Token, nil
+}
+
+// do выполняет запрос с токеном. unsafe — запрос меняет состояние и получает
+// Idempotency-Key.
+func (c *Client) do(ctx context.Context, method, path string, body, out any, unsafe bool) error {
+	token, err := c.currentToken(ctx)
+	if err != nil {
+		return err
+	}
+
+	var idempotencyKey string
+	if unsafe {
+		idempotencyKey = uuid.NewString()
+	}
+
+	err = c.send(ctx, method, path, body, out, token, idempotencyKey)
+	if errors.Is(err, ErrUnauthorized) && c.username != "" {
+		// Токен отозван или истёк раньше времени, входим заново один раз
+		if token, err = c.login(ctx); err != nil {
+			return err
+		}
+		err = c.send(ctx, method, path, body, out, token, idempotencyKey)
+	}
+	return err
+}
+
+// send отправляет запрос, повторяя его при сетевых ошибках и временных
+// ответах сервера.
+func (c *Client) send(ctx context.Context, method, path string, body, out any, token, idempotencyKey string) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return fmt.Errorf("merch api: failed to encode request: %w", err)
+		}
+	}
+
+	for attempt := 1; ; attempt++ {
+		retryAfter, err := c.sendOnce(ctx, method, path, payload, out, token, idempotencyKey)
+		if err == nil || attempt >= c.maxAttempts || !retryable(err) {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		delay := retryAfter
+		if delay == 0 {
+			delay = c.backoff(attempt)
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (c *Client) sendOnce(ctx context.Context, method, path string, payload []byte, out any, token, idempotencyKey string) (time.Duration, error) {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return 0, fmt.Errorf("merch api: failed to build request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json, application/problem+json")
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if idempotencyKey != "" {
+		req.Header.Set(HeaderIdempotencyKey, idempotencyKey)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, &networkError{err: err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return retryAfter(resp), decodeError(resp)
+	}
+	if out == nil {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return 0, nil
+	}
+	if err = json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return 0, fmt.Errorf("merch api: failed to decode response: %w", err)
+	}
+	return 0, nil
+}
+
+func (c *Client) backoff(attempt int) time.Duration {
+	delay := c.retryBaseDelay << (attempt - 1)
+	if delay <= 0 || delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	// Разброс не даёт клиентам повторять запросы синхронно
+	return delay/2 + rand.N(delay/2+1)
+}
+
+func decodeError(resp *http.Response) error {
+	apiErr := &Error{Status: resp.StatusCode}
+
+	var p problem
+	if err := json.NewDecoder(resp.Body).Decode(&p); err == nil {
+		apiErr.Code = p.Code
+		apiErr.Title = p.Title
+		apiErr.Detail = p.Detail
+		apiErr.RequestID = p.RequestID
+		apiErr.Fields = p.Errors
+	}
+	if apiErr.RequestID == "" {
+		apiErr.RequestID = resp.Header.Get("X-Request-Id")
+	}
+	return apiErr
+}
+
+func retryAfter(resp *http.Response) time.Duration {
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || seconds <= 0 {
+		return 0
+	}
+	return min(time.Duration(seconds)*time.Second, maxRetryDelay)
+}
+
+type networkError struct {
+	err error
+}
+
+func (e *networkError) Error() string {
+	return "merch api: " + e.err.Error()
+}
+
+func (e *networkError) Unwrap() error {
+	return e.err
+}
+
+func retryable(err error) bool {
+	var netErr *networkError
+	if errors.As(err, &netErr) {
+		return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+	}
+
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	switch apiErr.Status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	// Первая попытка ещё выполняется на сервере
+	return apiErr.Code == ErrRequestInProgress.Code
+}
@@ -0,0 +1,279 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/api"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/config"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/models"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/db/repository"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/events"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/health"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/logger"
+	mock_repository "github.com/Ki4EH/stunning-octo-waddle/internal/mocks/repository"
+	"github.com/Ki4EH/stunning-octo-waddle/internal/utils"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+var (
+	aliceID = uuid.New()
+	bobID   = uuid.New()
+	alice   = &models.Credential{ID: aliceID, Username: "alice", Password: "secret"}
+	bob     = &models.Credential{ID: bobID, Username: "bob"}
+)
+
+// proxy стоит между клиентом и сервером, записывает запросы и может
+// подменить ответ, как это делает балансировщик при обрыве соединения.
+type proxy struct {
+	next http.Handler
+	url  string
+
+	mu       sync.Mutex
+	requests []*http.Request
+	// fail возвращает статус, которым заменить ответ сервера, или 0
+	fail func(r *http.Request) int
+}
+
+func (p *proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	p.requests = append(p.requests, r.Clone(context.Background()))
+	p.mu.Unlock()
+
+	if p.fail == nil {
+		p.next.ServeHTTP(w, r)
+		return
+	}
+	if status := p.fail(r); status != 0 {
+		// Сервер выполняет запрос, но клиент ответа не увидит
+		p.next.ServeHTTP(httptest.NewRecorder(), r)
+		w.WriteHeader(status)
+		return
+	}
+	p.next.ServeHTTP(w, r)
+}
+
+func (p *proxy) paths() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	paths := make([]string, 0, len(p.requests))
+	for _, r := range p.requests {
+		paths = append(paths, r.Method+" "+r.URL.Path)
+	}
+	return paths
+}
+
+func newTestServer(t *testing.T, setup func(users *mock_repository.MockUserRepository, coins *mock_repository.MockCoinRepository)) *proxy {
+	ctrl := gomock.NewController(t)
+	users := mock_repository.NewMockUserRepository(ctrl)
+	coins := mock_repository.NewMockCoinRepository(ctrl)
+	if setup != nil {
+		setup(users, coins)
+	}
+
+	e := echo.New()
+	log := logger.Nop()
+	cfg := &config.Config{OpenAPIValidateRequests: true, OpenAPIValidateResponses: true}
+	require.NoError(t, api.InitRoutes(e, api.Repositories{Users: users, Coins: coins}, events.NewBroker(), &log, config.NewStore(cfg, nil), health.NewChecker()))
+
+	p := &proxy{next: e}
+	srv := httptest.NewServer(p)
+	t.Cleanup(srv.Close)
+	p.url = srv.URL
+	return p
+}
+
+func (p *proxy) client(opts ...Option) *Client {
+	opts = append([]Option{WithCredentials("alice", "secret"), WithRetries(3, time.Millisecond)}, opts...)
+	return New(p.url, opts...)
+}
+
+func expectInfo(users *mock_repository.MockUserRepository, coins *mock_repository.MockCoinRepository, times int) {
+	users.EXPECT().GetUserByID(gomock.Any(), aliceID).
+		Return(&models.Credential{ID: aliceID, Username: "alice", Coin: 1000}, nil).Times(times)
+	users.EXPECT().GetUserItems(gomock.Any(), aliceID, gomock.Any()).Return(nil).Times(times)
+	coins.EXPECT().GetExpiringCoins(gomock.Any(), aliceID).Return(&models.ExpiringCoins{}, nil).Times(times)
+}
+
+func TestClient_Token(t *testing.T) {
+	t.Run("token is acquired once and reused", func(t *testing.T) {
+		p := newTestServer(t, func(users *mock_repository.MockUserRepository, coins *mock_repository.MockCoinRepository) {
+			users.EXPECT().GetUserCredentialByName(gomock.Any(), "alice").Return(alice, nil).Times(1)
+			expectInfo(users, coins, 2)
+		})
+		c := p.client()
+
+		for range 2 {
+			info, err := c.Info(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, int64(1000), info.Coins)
+		}
+		assert.Equal(t, []string{"POST /api/v2/auth", "GET /api/v2/info", "GET /api/v2/info"}, p.paths())
+	})
+
+	t.Run("expiring token is refreshed before the request", func(t *testing.T) {
+		p := newTestServer(t, func(users *mock_repository.MockUserRepository, coins *mock_repository.MockCoinRepository) {
+			users.EXPECT().GetUserCredentialByName(gomock.Any(), "alice").Return(alice, nil)
+			expectInfo(users, coins, 1)
+		})
+		token, err := utils.SignToken(&utils.Claims{
+			UserID:           aliceID,
+			RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(10 * time.Second))},
+		})
+		require.NoError(t, err)
+		c := p.client(WithToken(token))
+
+		_, err = c.Info(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, []string{"POST /api/v2/auth", "GET /api/v2/info"}, p.paths())
+	})
+
+	t.Run("rejected token is replaced after 401", func(t *testing.T) {
+		p := newTestServer(t, func(users *mock_repository.MockUserRepository, coins *mock_repository.MockCoinRepository) {
+			users.EXPECT().GetUserCredentialByName(gomock.Any(), "alice").Return(alice, nil)
+			expectInfo(users, coins, 1)
+		})
+		c := p.client(WithToken("revoked"))
+
+		_, err := c.Info(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, []string{"GET /api/v2/info", "POST /api/v2/auth", "GET /api/v2/info"}, p.paths())
+	})
+
+	t.Run("wrong password", func(t *testing.T) {
+		p := newTestServer(t, func(users *mock_repository.MockUserRepository, coins *mock_repository.MockCoinRepository) {
+			users.EXPECT().GetUserCredentialByName(gomock.Any(), "alice").Return(alice, nil)
+		})
+		c := p.client(WithCredentials("alice", "wrong"))
+
+		_, err := c.Info(context.Background())
+		assert.ErrorIs(t, err, ErrInvalidCredentials)
+	})
+}
+
+func TestClient_Errors(t *testing.T) {
+	p := newTestServer(t, func(users *mock_repository.MockUserRepository, coins *mock_repository.MockCoinRepository) {
+		users.EXPECT().GetUserCredentialByName(gomock.Any(), "alice").Return(alice, nil)
+		coins.EXPECT().BuyItemFromShop(gomock.Any(), aliceID, "cup").Return(repository.ErrInsufficientBalance)
+		coins.EXPECT().BuyItemFromShop(gomock.Any(), aliceID, "car").Return(repository.ErrItemNotFound)
+	})
+	c := p.client()
+
+	err := c.Buy(context.Background(), "cup")
+	require.ErrorIs(t, err, ErrInsufficientBalance)
+	var apiErr *Error
+	require.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, http.StatusUnprocessableEntity, apiErr.Status)
+	assert.NotEmpty(t, apiErr.RequestID)
+
+	err = c.Buy(context.Background(), "car")
+	assert.ErrorIs(t, err, ErrItemNotFound)
+	assert.NotErrorIs(t, err, ErrInsufficientBalance)
+
+	err = c.SendCoin(context.Background(), "bob", 0)
+	require.ErrorIs(t, err, ErrInvalidRequest)
+	require.True(t, errors.As(err, &apiErr))
+	require.Len(t, apiErr.Fields, 1)
+	assert.Equal(t, "amount", apiErr.Fields[0].Field)
+}
+
+func TestClient_History(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	entries := []models.HistoryEntry{
+		{ID: uuid.New(), Direction: models.HistorySent, Counterparty: "bob", Amount: 3, CreatedAt: now},
+		{ID: uuid.New(), Direction: models.HistoryReceived, Counterparty: "bob", Amount: 2, CreatedAt: now.Add(-time.Minute)},
+	}
+	p := newTestServer(t, func(users *mock_repository.MockUserRepository, coins *mock_repository.MockCoinRepository) {
+		users.EXPECT().GetUserCredentialByName(gomock.Any(), "alice").Return(alice, nil)
+		coins.EXPECT().GetHistory(gomock.Any(), aliceID, 2, nil).Return(entries, nil)
+		coins.EXPECT().GetHistory(gomock.Any(), aliceID, 2, gomock.Not(gomock.Nil())).Return(entries[1:], nil)
+	})
+	c := p.client()
+
+	first, err := c.History(context.Background(), 1, "")
+	require.NoError(t, err)
+	require.Len(t, first.Items, 1)
+	assert.Equal(t, DirectionSent, first.Items[0].Direction)
+	require.NotEmpty(t, first.NextCursor)
+
+	second, err := c.History(context.Background(), 1, first.NextCursor)
+	require.NoError(t, err)
+	require.Len(t, second.Items, 1)
+	assert.Equal(t, DirectionReceived, second.Items[0].Direction)
+	assert.Empty(t, second.NextCursor)
+}
+
+func TestClient_Retry(t *testing.T) {
+	t.Run("lost response is replayed by idempotency key", func(t *testing.T) {
+		p := newTestServer(t, func(users *mock_repository.MockUserRepository, coins *mock_repository.MockCoinRepository) {
+			users.EXPECT().GetUserCredentialByName(gomock.Any(), "alice").Return(alice, nil)
+			users.EXPECT().GetUserCredentialByName(gomock.Any(), "bob").Return(bob, nil)
+			coins.EXPECT().SendCoins(gomock.Any(), aliceID, bobID, int64(10)).Return(nil).Times(1)
+		})
+		sent := 0
+		p.fail = func(r *http.Request) int {
+			if r.URL.Path != "/api/v2/transfers" {
+				return 0
+			}
+			if sent++; sent == 1 {
+				return http.StatusBadGateway
+			}
+			return 0
+		}
+		c := p.client()
+
+		require.NoError(t, c.SendCoin(context.Background(), "bob", 10))
+
+		var keys []string
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		for _, r := range p.requests {
+			if r.URL.Path == "/api/v2/transfers" {
+				keys = append(keys, r.Header.Get(HeaderIdempotencyKey))
+			}
+		}
+		require.Len(t, keys, 2)
+		assert.NotEmpty(t, keys[0])
+		assert.Equal(t, keys[0], keys[1])
+	})
+
+	t.Run("gives up after max attempts", func(t *testing.T) {
+		p := newTestServer(t, func(users *mock_repository.MockUserRepository, coins *mock_repository.MockCoinRepository) {
+			users.EXPECT().GetUserCredentialByName(gomock.Any(), "alice").Return(alice, nil)
+			expectInfo(users, coins, 3)
+		})
+		p.fail = func(r *http.Request) int {
+			if r.URL.Path == "/api/v2/info" {
+				return http.StatusServiceUnavailable
+			}
+			return 0
+		}
+		c := p.client()
+
+		_, err := c.Info(context.Background())
+		var apiErr *Error
+		require.True(t, errors.As(err, &apiErr))
+		assert.Equal(t, http.StatusServiceUnavailable, apiErr.Status)
+		assert.Len(t, p.paths(), 4)
+	})
+
+	t.Run("client errors are not retried", func(t *testing.T) {
+		p := newTestServer(t, func(users *mock_repository.MockUserRepository, coins *mock_repository.MockCoinRepository) {
+			users.EXPECT().GetUserCredentialByName(gomock.Any(), "alice").Return(alice, nil)
+			coins.EXPECT().BuyItemFromShop(gomock.Any(), aliceID, "cup").Return(repository.ErrInsufficientBalance).Times(1)
+		})
+		c := p.client()
+
+		assert.ErrorIs(t, c.Buy(context.Background(), "cup"), ErrInsufficientBalance)
+		assert.Len(t, p.paths(), 2)
+	})
+}
@@ -0,0 +1,75 @@
+package client
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Error — ошибка API. Поля повторяют ответ application/problem+json сервера.
+// Сравнивать ошибки удобно через errors.Is с переменными ниже: совпадение
+// определяется по Code.
+type Error struct {
+	Status    int
+	Code      string
+	Title     string
+	Detail    string
+	RequestID string
+	// Fields — неверные поля запроса, если сервер их указал
+	Fields []FieldError
+}
+
+func (e *Error) Error() string {
+	detail := e.Detail
+	if detail == "" {
+		detail = http.StatusText(e.Status)
+	}
+	if e.Code == "" {
+		return fmt.Sprintf("merch api: %d: %s", e.Status, detail)
+	}
+	return fmt.Sprintf("merch api: %d %s: %s", e.Status, e.Code, detail)
+}
+
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code != "" && t.Code == e.Code
+}
+
+// Коды ошибок сервера.
+var (
+	ErrInvalidRequest     = &Error{Code: "invalid_request"}
+	ErrUnauthorized       = &Error{Code: "unauthorized"}
+	ErrInvalidCredentials = &Error{Code: "invalid_credentials"}
+	ErrForbidden          = &Error{Code: "forbidden"}
+	ErrNotFound           = &Error{Code: "not_found"}
+	ErrInternal           = &Error{Code: "internal_error"}
+
+	ErrInvalidAmount           = &Error{Code: "invalid_amount"}
+	ErrInvalidLimits           = &Error{Code: "invalid_limits"}
+	ErrUserNotFound            = &Error{Code: "user_not_found"}
+	ErrItemNotFound            = &Error{Code: "item_not_found"}
+	ErrInsufficientBalance     = &Error{Code: "insufficient_balance"}
+	ErrReceiverNotFound        = &Error{Code: "receiver_not_found"}
+	ErrSelfTransfer            = &Error{Code: "self_transfer"}
+	ErrTransferLimitExceeded   = &Error{Code: "transfer_limit_exceeded"}
+	ErrDailyLimitExceeded      = &Error{Code: "daily_limit_exceeded"}
+	ErrDailyRecipientsExceeded = &Error{Code: "daily_recipients_exceeded"}
+
+	ErrTransactionNotFound      = &Error{Code: "transaction_not_found"}
+	ErrReversalNotFound         = &Error{Code: "reversal_not_found"}
+	ErrAlreadyReversed          = &Error{Code: "already_reversed"}
+	ErrReversalAlreadyRequested = &Error{Code: "reversal_already_requested"}
+	ErrReversalNotPending       = &Error{Code: "reversal_not_pending"}
+	ErrCompensatingReversal     = &Error{Code: "compensating_reversal"}
+	ErrNotTransactionSender     = &Error{Code: "not_transaction_sender"}
+	ErrNotTransactionRecipient  = &Error{Code: "not_transaction_recipient"}
+
+	ErrHoldNotFound  = &Error{Code: "hold_not_found"}
+	ErrHoldNotActive = &Error{Code: "hold_not_active"}
+
+	ErrWebhookNotFound = &Error{Code: "webhook_not_found"}
+
+	ErrRequestInProgress    = &Error{Code: "request_in_progress"}
+	ErrIdempotencyKeyReused = &Error{Code: "idempotency_key_reused"}
+
+	ErrRateLimited = &Error{Code: "rate_limited"}
+)
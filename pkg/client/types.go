@@ -0,0 +1,171 @@
+package client
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+type Info struct {
+	Coins        int64         `json:"coins"`
+	HeldCoins    int64         `json:"heldCoins"`
+	ExpiringSoon ExpiringCoins `json:"expiringSoon"`
+	Inventory    []Item        `json:"inventory"`
+}
+
+// ExpiringCoins — сколько монет сгорит до Before.
+type ExpiringCoins struct {
+	Amount int64     `json:"amount"`
+	Before time.Time `json:"before"`
+}
+
+type Item struct {
+	Type     string `json:"type"`
+	Quantity int64  `json:"quantity"`
+}
+
+// Направление перевода в истории
+const (
+	DirectionSent     = "sent"
+	DirectionReceived = "received"
+)
+
+type HistoryEntry struct {
+	ID           uuid.UUID  `json:"id"`
+	Direction    string     `json:"direction"`
+	Counterparty string     `json:"counterparty"`
+	Amount       int64      `json:"amount"`
+	Reversed     bool       `json:"reversed"`
+	ReversalOf   *uuid.UUID `json:"reversalOf,omitempty"`
+	CreatedAt    time.Time  `json:"createdAt"`
+}
+
+// HistoryPage — страница истории. NextCursor пустой на последней странице.
+type HistoryPage struct {
+	Items      []HistoryEntry `json:"items"`
+	NextCursor string         `json:"nextCursor,omitempty"`
+}
+
+// Статусы запроса на отмену перевода
+const (
+	ReversalPending  = "pending"
+	ReversalApproved = "approved"
+	ReversalRejected = "rejected"
+	ReversalForced   = "forced"
+)
+
+type Reversal struct {
+	ID             uuid.UUID  `json:"id"`
+	TransactionID  uuid.UUID  `json:"transactionId"`
+	FromUser       string     `json:"fromUser"`
+	ToUser         string     `json:"toUser"`
+	Amount         int64      `json:"amount"`
+	Reason         string     `json:"reason"`
+	Status         string     `json:"status"`
+	CompensationID *uuid.UUID `json:"compensationId,omitempty"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	ResolvedAt     *time.Time `json:"resolvedAt,omitempty"`
+}
+
+// TransferLimits — ограничения на переводы, 0 — без ограничения.
+type TransferLimits struct {
+	MaxPerTransfer     int64 `json:"maxPerTransfer"`
+	MaxDailyTotal      int64 `json:"maxDailyTotal"`
+	MaxDailyRecipients int64 `json:"maxDailyRecipients"`
+}
+
+// TransferLimitsOverride — персональные лимиты, nil — лимит по умолчанию.
+type TransferLimitsOverride struct {
+	MaxPerTransfer     *int64 `json:"maxPerTransfer"`
+	MaxDailyTotal      *int64 `json:"maxDailyTotal"`
+	MaxDailyRecipients *int64 `json:"maxDailyRecipients"`
+}
+
+type UserTransferLimits struct {
+	Effective TransferLimits         `json:"effective"`
+	Override  TransferLimitsOverride `json:"override"`
+}
+
+// Статусы холда
+const (
+	HoldHeld     = "held"
+	HoldCaptured = "captured"
+	HoldReleased = "released"
+	HoldExpired  = "expired"
+)
+
+type HoldRequest struct {
+	Amount     int64  `json:"amount"`
+	Reason     string `json:"reason"`
+	TTLSeconds int64  `json:"ttlSeconds"`
+}
+
+type Hold struct {
+	ID         uuid.UUID  `json:"id"`
+	Amount     int64      `json:"amount"`
+	Reason     string     `json:"reason"`
+	Status     string     `json:"status"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ExpiresAt  time.Time  `json:"expiresAt"`
+	ResolvedAt *time.Time `json:"resolvedAt,omitempty"`
+}
+
+const (
+	EventTransferCompleted = "transfer.completed"
+	EventPurchaseCompleted = "purchase.completed"
+)
+
+type WebhookRequest struct {
+	URL string `json:"url"`
+	// Пустой секрет сгенерирует сервер
+	Secret string `json:"secret,omitempty"`
+	// Пустой список — все события
+	EventTypes []string `json:"eventTypes,omitempty"`
+}
+
+type Webhook struct {
+	ID         uuid.UUID `json:"id"`
+	URL        string    `json:"url"`
+	Secret     string    `json:"secret,omitempty"`
+	EventTypes []string  `json:"eventTypes"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+)
+
+type WebhookDelivery struct {
+	ID            int64      `json:"id"`
+	WebhookID     uuid.UUID  `json:"webhookId"`
+	EventID       int64      `json:"eventId"`
+	EventType     string     `json:"eventType"`
+	Status        string     `json:"status"`
+	Attempts      int        `json:"attempts"`
+	NextAttemptAt time.Time  `json:"nextAttemptAt"`
+	LastStatus    *int       `json:"lastStatus,omitempty"`
+	LastError     *string    `json:"lastError,omitempty"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	DeliveredAt   *time.Time `json:"deliveredAt,omitempty"`
+}
+
+type ReplayRequest struct {
+	Since            *time.Time `json:"since,omitempty"`
+	IncludeDelivered bool       `json:"includeDelivered,omitempty"`
+}
+
+// FieldError — неверное поле запроса: имя параметра или путь к полю тела.
+type FieldError struct {
+	Field  string `json:"field"`
+	Reason string `json:"reason"`
+}
+
+type problem struct {
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail"`
+	Code      string       `json:"code"`
+	RequestID string       `json:"requestId"`
+	Errors    []FieldError `json:"errors"`
+}
@@ -0,0 +1,94 @@
+package client
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/google/uuid"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Заголовки запросов к webhook
+const (
+	HeaderWebhookSignature = "X-Webhook-Signature"
+	HeaderWebhookID        = "X-Webhook-Id"
+	HeaderWebhookEvent     = "X-Webhook-Event"
+)
+
+var (
+	ErrInvalidSignature = errors.New("merch webhook: invalid signature")
+	ErrStaleSignature   = errors.New("merch webhook: signature timestamp outside tolerance")
+)
+
+// WebhookEvent — тело запроса к webhook. Data разбирается в TransferEvent
+// или PurchaseEvent по Type.
+type WebhookEvent struct {
+	ID        int64           `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"createdAt"`
+	Data      json.RawMessage `json:"data"`
+}
+
+type TransferEvent struct {
+	TransactionID uuid.UUID  `json:"transactionId"`
+	FromUser      string     `json:"fromUser"`
+	ToUser        string     `json:"toUser"`
+	Amount        int64      `json:"amount"`
+	ReversalOf    *uuid.UUID `json:"reversalOf,omitempty"`
+}
+
+type PurchaseEvent struct {
+	User  string `json:"user"`
+	Item  string `json:"item"`
+	Price int64  `json:"price"`
+}
+
+// VerifyWebhook проверяет заголовок X-Webhook-Signature для тела запроса.
+// Подпись старше tolerance отклоняется, чтобы перехваченный запрос нельзя
+// было повторить; tolerance 0 отключает проверку времени. Одно и то же
+// событие может прийти несколько раз, повторы отбрасываются по X-Webhook-Id.
+func VerifyWebhook(secret, signature string, body []byte, tolerance time.Duration) error {
+	var ts string
+	var signatures []string
+	for _, part := range strings.Split(signature, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			ts = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return ErrInvalidSignature
+	}
+
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(ts))
+	h.Write([]byte{'.'})
+	h.Write(body)
+	expected := h.Sum(nil)
+
+	valid := false
+	for _, sig := range signatures {
+		if got, err := hex.DecodeString(sig); err == nil && hmac.Equal(got, expected) {
+			valid = true
+		}
+	}
+	if !valid {
+		return ErrInvalidSignature
+	}
+
+	if tolerance > 0 {
+		if age := time.Since(time.Unix(unix, 0)); age > tolerance || age < -tolerance {
+			return ErrStaleSignature
+		}
+	}
+	return nil
+}
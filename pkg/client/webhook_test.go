@@ -0,0 +1,56 @@
+package client
+
+import (
+	"github.com/Ki4EH/stunning-octo-waddle/internal/webhooks"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestVerifyWebhook(t *testing.T) {
+	body := []byte(`{"id":1,"type":"transfer.completed"}`)
+	now := time.Now()
+
+	tests := []struct {
+		name      string
+		signature string
+		body      []byte
+		expected  error
+	}{
+		{
+			name:      "valid",
+			signature: webhooks.Sign("secret", now, body),
+			body:      body,
+		},
+		{
+			name:      "wrong secret",
+			signature: webhooks.Sign("other", now, body),
+			body:      body,
+			expected:  ErrInvalidSignature,
+		},
+		{
+			name:      "modified body",
+			signature: webhooks.Sign("secret", now, body),
+			body:      []byte(`{"id":2,"type":"transfer.completed"}`),
+			expected:  ErrInvalidSignature,
+		},
+		{
+			name:      "stale",
+			signature: webhooks.Sign("secret", now.Add(-time.Hour), body),
+			body:      body,
+			expected:  ErrStaleSignature,
+		},
+		{
+			name:      "malformed",
+			signature: "v1=abc",
+			body:      body,
+			expected:  ErrInvalidSignature,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.ErrorIs(t, VerifyWebhook("secret", tt.signature, tt.body, 5*time.Minute), tt.expected)
+		})
+	}
+}